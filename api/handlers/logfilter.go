@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// logFilter filtra líneas de los logs estructurados de cliente, tracker y DNS
+// (--log-format=text o json) por nivel mínimo y componente.
+//
+//	WS /ws/logs/:id?level=warn&component=sync,announce
+//
+// level sólo se aplica a las líneas que traen nivel y component descarta
+// las que no traen componente; sin filtros pasa todo.
+type logFilter struct {
+	minLevel   int
+	hasLevel   bool
+	components map[string]bool
+}
+
+// niveles de log/slog
+var logLevels = map[string]int{"DEBUG": -4, "INFO": 0, "WARN": 4, "ERROR": 8}
+
+func newLogFilter(level, components string) logFilter {
+	var f logFilter
+	if lv, ok := logLevels[strings.ToUpper(strings.TrimSpace(level))]; ok {
+		f.minLevel, f.hasLevel = lv, true
+	}
+	for _, c := range strings.Split(components, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			if f.components == nil {
+				f.components = make(map[string]bool)
+			}
+			f.components[c] = true
+		}
+	}
+	return f
+}
+
+func (f logFilter) empty() bool { return !f.hasLevel && f.components == nil }
+
+// match indica si la línea pasa el filtro
+func (f logFilter) match(line string) bool {
+	if f.empty() {
+		return true
+	}
+	level, component := parseLogLine(line)
+	if f.hasLevel {
+		if lv, ok := logLevels[level]; ok && lv < f.minLevel {
+			return false
+		}
+	}
+	if f.components != nil && !f.components[component] {
+		return false
+	}
+	return true
+}
+
+// parseLogLine extrae level y component de una línea JSON o key=value. Las
+// líneas de Docker llevan delante el timestamp (y a veces la cabecera del
+// stream), así que se busca el objeto JSON o las claves dentro de la línea.
+func parseLogLine(line string) (level, component string) {
+	if i := strings.IndexByte(line, '{'); i >= 0 {
+		var rec struct {
+			Level     string `json:"level"`
+			Component string `json:"component"`
+		}
+		if json.Unmarshal([]byte(line[i:]), &rec) == nil && rec.Level != "" {
+			return rec.Level, rec.Component
+		}
+	}
+	return logfmtValue(line, "level"), logfmtValue(line, "component")
+}
+
+// logfmtValue devuelve el valor de key=valor en una línea de slog.TextHandler
+func logfmtValue(line, key string) string {
+	for _, field := range strings.Fields(line) {
+		if v, ok := strings.CutPrefix(field, key+"="); ok {
+			return strings.Trim(v, `"`)
+		}
+	}
+	return ""
+}
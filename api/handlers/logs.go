@@ -23,9 +23,11 @@ var upgrader = websocket.Upgrader{
 }
 
 // StreamLogs transmite logs de un contenedor en tiempo real mediante WebSocket
-// WS /ws/logs/:id
+// WS /ws/logs/:id?level=warn&component=sync,announce
+// level (debug|info|warn|error) y component filtran los logs estructurados
 func StreamLogs(c *gin.Context) {
 	containerID := c.Param("id")
+	filter := newLogFilter(c.Query("level"), c.Query("component"))
 
 	// Upgrade HTTP connection a WebSocket
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -88,6 +90,9 @@ func StreamLogs(c *gin.Context) {
 			// Leer siguiente línea de log
 			if scanner.Scan() {
 				logLine := scanner.Text()
+				if !filter.match(logLine) {
+					continue
+				}
 
 				// Enviar log al cliente WebSocket
 				if err := conn.WriteMessage(websocket.TextMessage, []byte(logLine)); err != nil {
@@ -0,0 +1,54 @@
+package bencode
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeCanonical(t *testing.T) {
+	got := string(Encode(map[string]interface{}{
+		"zeta":  int64(-3),
+		"alpha": "spam",
+		"list":  []interface{}{int64(1), "a", []interface{}{}},
+		"dict":  map[string]interface{}{"b": int64(0), "a": ""},
+	}))
+	// las claves van ordenadas
+	want := "d5:alpha4:spam4:dictd1:a0:1:bi0ee4:listli1e1:alee4:zetai-3ee"
+	if got != want {
+		t.Fatalf("Encode = %q, se esperaba %q", got, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := map[string]interface{}{
+		"announce": "http://tracker:8080/announce",
+		"info": map[string]interface{}{
+			"name":         "a.bin",
+			"piece length": int64(1 << 18),
+			"pieces":       string([]byte{0, 1, 2, 0xff, 'e', ':'}),
+			"length":       int64(1 << 40),
+		},
+		"url-list": []interface{}{"http://a/", "http://b/"},
+	}
+	out, err := Decode(bytes.NewReader(Encode(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("round trip:\n%#v\n%#v", in, out)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, s := range []string{
+		"d3:foo",       // dict sin cerrar
+		"d3:fooi12",    // entero sin cerrar
+		"d3:foo10:abc", // string más corto que su longitud
+	} {
+		if _, err := Decode(strings.NewReader(s)); err == nil {
+			t.Errorf("Decode(%q) no devolvió error", s)
+		}
+	}
+}
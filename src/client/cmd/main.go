@@ -8,16 +8,16 @@ import (
 	"os"
 	"os/signal"
 	"src/client"
-	"src/overlay"
+	"src/logging"
 	"src/peerwire"
-	"src/utils"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 )
 
-var log = utils.NewLogger("CLIENT")
+var log = logging.For("main")
 
 func main() {
 	// Variables de control para manejo de eventos
@@ -31,49 +31,111 @@ func main() {
 
 	var torrentFlag, archivesFlag, hostnameFlag, discoveryFlag, bootstrapFlag string
 	var overlayPortFlag, httpPortFlag int
-	torrentFlag, archivesFlag, hostnameFlag, discoveryFlag, bootstrapFlag, overlayPortFlag, httpPortFlag = client.ParseFlags()
+	var opts *client.ClientOptions
+	torrentFlag, archivesFlag, hostnameFlag, discoveryFlag, bootstrapFlag, overlayPortFlag, httpPortFlag, opts = client.ParseFlags()
+	peerwire.SetRateLimits(opts.Limits)
+	peerwire.SetEncryptionPolicy(opts.Encryption)
+	if err := client.SetAnnounceIPv6(opts.IPv6); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+
+	if opts.Session {
+		runSession(archivesFlag, hostnameFlag, discoveryFlag, bootstrapFlag, httpPortFlag, opts)
+		return
+	}
 
-	cfg := client.LoadTorrentMetadata(torrentFlag, archivesFlag)
+	// --torrent acepta un .torrent o un magnet link; con magnet el info
+	// dictionary se obtiene de los peers antes de preparar el storage
+	var cfg *client.ClientConfig
+	var magnet *client.Magnet
+	if client.IsMagnetURI(torrentFlag) {
+		var err error
+		if magnet, err = client.ParseMagnet(torrentFlag); err != nil {
+			log.Error("magnet link inválido", logging.Err(err))
+			os.Exit(2)
+		}
+		cfg = client.NewMagnetConfig(magnet, archivesFlag)
+	} else {
+		cfg = client.LoadTorrentMetadata(torrentFlag, archivesFlag)
+	}
 	cfg.HTTPPort = httpPortFlag
 	// Abrir listener local (puerto asignado automáticamente)
 
 	ln, err := net.Listen("tcp", ":0")
 	if err != nil {
-		log.Error("No se pudo abrir el listener: %v", err)
+		log.Error("no se pudo abrir el listener", logging.Err(err))
 		panic(err)
 	}
 
 	listenPort := ln.Addr().(*net.TCPAddr).Port
-	log.Info("Cliente escuchando en puerto: %d", listenPort)
+	log.Info("cliente escuchando", "port", listenPort)
 
 	ov := client.SetupOverlay(discoveryFlag, bootstrapFlag, overlayPortFlag)
+	dhtNode := client.SetupDHT(discoveryFlag, bootstrapFlag, opts.DHTPort)
 	if ov != nil {
-		log.Info("=== Modo de descubrimiento: OVERLAY/GOSSIP (distribuido) ===")
+		log.Info("modo de descubrimiento", "mode", "overlay")
+	} else if dhtNode != nil {
+		log.Info("modo de descubrimiento", "mode", "dht")
 	} else {
-		log.Info("=== Modo de descubrimiento: TRACKER (centralizado) ===")
+		log.Info("modo de descubrimiento", "mode", "tracker")
 	}
 
 	// Seleccionar tracker más cercano (solo en modo tracker)
-	if ov == nil && len(cfg.AnnounceURLs) > 1 {
-		log.Info("Seleccionando tracker más cercano...")
+	if ov == nil && dhtNode == nil && len(cfg.AnnounceURLs) > 1 {
 		client.SelectAndReorderTrackers(cfg)
 	}
 
+	if hostnameFlag == "" {
+		hostnameFlag = "127.0.0.1"
+	}
+	providerAddr := net.JoinHostPort(hostnameFlag, strconv.Itoa(listenPort))
+
+	// Magnet link: obtener y verificar el info dictionary antes de descargar
+	if !cfg.HasMetadata() {
+		log.Info("buscando la metadata del torrent (ut_metadata)", logging.InfoHash(cfg.InfoHash))
+		magnetPeers := magnet.Peers
+		if dhtNode != nil {
+			if found, err := dhtNode.GetPeers(cfg.InfoHash); err == nil {
+				magnetPeers = append(magnetPeers, found...)
+			}
+		}
+		if err := client.FetchMagnetMetadata(cfg, magnetPeers, ov, bootstrapFlag, providerAddr, listenPort, hostnameFlag); err != nil {
+			log.Error("no se pudo obtener la metadata", logging.InfoHash(cfg.InfoHash), logging.Err(err))
+			os.Exit(1)
+		}
+	}
+
 	store, mgr, useFinal := client.SetupStorage(cfg)
+	mgr.SetMetadata(cfg.InfoBytes)
+	mgr.SetPipeline(opts.PipelineDepth, opts.PipelineAdaptive, opts.RequestTimeout)
+	mgr.SetUploadSlots(opts.UploadSlots)
+	if opts.Pex && !cfg.Private {
+		if err := client.StartPex(mgr, store, cfg.InfoHash, cfg.PeerId, listenPort); err != nil {
+			log.Warn("no se pudo activar PEX", logging.InfoHash(cfg.InfoHash), logging.Err(err))
+		}
+	}
+	if opts.WebSeeds {
+		client.StartWebSeeds(cfg, mgr)
+	}
 
 	client.SetupPieceCompletionHandler(store, cfg, useFinal, completedChan, &completedMu, downloadCompleted)
+	client.StartResumeRoutine(cfg, store, mgr, shutdownChan)
 
 	// Iniciar servidor HTTP para métricas y control
 	// Extraer nombre del archivo torrent
 	torrentName := torrentFlag
-	if idx := strings.LastIndex(torrentName, "/"); idx >= 0 {
+	if magnet != nil {
+		torrentName = cfg.FileName
+	} else if idx := strings.LastIndex(torrentName, "/"); idx >= 0 {
 		torrentName = torrentName[idx+1:]
 	}
 	httpServer := client.NewHTTPServer(store, mgr, cfg.FileLength, torrentName, cfg.HTTPPort)
+	httpServer.SetStreamFiles(cfg.FileName, cfg.Files)
 	go func() {
-		log.Info("Iniciando servidor HTTP en puerto %d", cfg.HTTPPort)
+		log.Info("servidor HTTP iniciado", "port", cfg.HTTPPort)
 		if err := httpServer.Start(); err != nil {
-			log.Error("Error en servidor HTTP: %v", err)
+			log.Error("error en el servidor HTTP", logging.Err(err))
 		}
 	}()
 
@@ -87,50 +149,33 @@ func main() {
 	var trackerResponse map[string]interface{}
 	trackerInterval := 60 * time.Second
 
-	if hostnameFlag == "" {
-		hostnameFlag = "127.0.0.1"
-	}
-
-	providerAddr := fmt.Sprintf("%s:%d", hostnameFlag, listenPort)
 	if ov != nil {
 		// ov.Announce(cfg.InfoHashEncoded, overlay.ProviderMeta{Addr: providerAddr, PeerId: cfg.PeerId, Left: initialLeft})
 		// fmt.Println("Announced to overlay, left=", initialLeft)
 
 		// construir lista initialPeers: SOLO nodos remotos
-		initialPeers := []string{}
-		if bootstrapFlag != "" {
-			for _, p := range strings.Split(bootstrapFlag, ",") {
-				p = strings.TrimSpace(p)
-				if p != "" && p != providerAddr {
-					initialPeers = append(initialPeers, p)
-				}
-			}
-		}
+		initialPeers := client.OverlayBootstrapPeers(bootstrapFlag, providerAddr)
 
 		// Hacer discovery síncrono antes de anunciar
 		ttlDepth := 3
 		if err := ov.Discover(cfg.InfoHashEncoded, initialPeers, ttlDepth); err != nil {
-			log.Warn("Overlay discovery returned error: %v", err)
+			log.Warn("discovery en el overlay fallido", logging.InfoHash(cfg.InfoHash), logging.Err(err))
 		} else {
-			log.Info("Overlay discovery completed; store has providers for infohash")
+			log.Info("discovery en el overlay completado", logging.InfoHash(cfg.InfoHash))
 		}
 
 		// Ahora sí nos anunciamos al overlay
-		ov.Announce(cfg.InfoHashEncoded, overlay.ProviderMeta{
-			Addr:   providerAddr,
-			PeerId: cfg.PeerId,
-			Left:   initialLeft,
-		})
-		log.Info("Announced to overlay, left=%d", initialLeft)
+		ov.Announce(cfg.InfoHashEncoded, client.LocalProvider(providerAddr, cfg.PeerId, initialLeft))
+		log.Info("announce inicial enviado al overlay", logging.InfoHash(cfg.InfoHash), "left", initialLeft)
 
-	} else {
+	} else if dhtNode == nil {
 		initialLeft := computeLeft()
 		trackerResponse, err = client.SendAnnounceWithFailover(cfg, listenPort, 0, 0, initialLeft, "started", hostnameFlag)
 		if err != nil {
-			log.Error("Error en announce inicial: %v", err)
+			log.Error("announce inicial fallido", logging.InfoHash(cfg.InfoHash), logging.Err(err))
 			panic(err)
 		}
-		log.Info("Tracker responde: %+v", trackerResponse)
+		log.Info("announce inicial enviado", logging.InfoHash(cfg.InfoHash), "url", cfg.GetCurrentTrackerURL())
 
 		// Hacer scrape para obtener estadísticas del torrent
 		client.SendScrape(cfg.GetCurrentTrackerURL(), cfg.InfoHashEncoded, cfg.InfoHash)
@@ -138,56 +183,76 @@ func main() {
 		// Extraer intervalo del tracker (por defecto 30 minutos)
 		if intervalRaw, ok := trackerResponse["interval"].(int64); ok {
 			trackerInterval = time.Duration(intervalRaw) * time.Second
-			log.Info("Intervalo de announces: %v", trackerInterval)
+			log.Info("intervalo de announces", "interval", trackerInterval)
 		}
 	}
 
-	peerInfo := client.ParsePeersFromOthers(trackerResponse, ov, providerAddr, cfg)
+	var peerInfo []client.PeerInfo
+	if dhtNode != nil {
+		peerInfo = client.AnnounceAndGetPeersDHT(dhtNode, cfg, listenPort)
+	} else {
+		peerInfo = client.ParsePeersFromOthers(trackerResponse, ov, providerAddr, cfg)
+	}
 
 	client.ConnectToPeers(peerInfo, cfg.InfoHash, cfg.PeerId, store, mgr)
 
 	// Aceptar conexiones entrantes
 	client.StartListeningForIncomingPeers(ln, cfg.InfoHash, cfg.PeerId, store, mgr)
 
-	// Goroutine: Announces periódicos (tracker o overlay según modo)
-	client.StartPeriodicAnnounceRoutineOverlay(cfg, listenPort, hostnameFlag, computeLeft, shutdownChan, trackerInterval, ov, providerAddr, cfg.InfoHash, cfg.PeerId, store, mgr)
+	// Goroutine: Announces periódicos (tracker, overlay o DHT según modo)
+	if dhtNode != nil {
+		// la DHT no distingue seeders: no hay event=completed ni stopped
+		client.StartPeriodicAnnounceRoutineDHT(dhtNode, cfg, listenPort, shutdownChan, trackerInterval, store, mgr)
+	} else {
+		client.StartPeriodicAnnounceRoutineOverlay(cfg, listenPort, hostnameFlag, computeLeft, shutdownChan, trackerInterval, ov, providerAddr, cfg.InfoHash, cfg.PeerId, store, mgr)
 
-	// Goroutine: Detectar completación y enviar event=completed
-	client.StartCompletionAnnounceRoutineOverlay(completedChan, cfg, listenPort, hostnameFlag, ov, providerAddr)
+		// Goroutine: Detectar completación y enviar event=completed
+		client.StartCompletionAnnounceRoutineOverlay(completedChan, cfg, listenPort, hostnameFlag, ov, providerAddr)
+	}
 
 	// Configurar captura de señales del sistema
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
 	// Loop principal: esperar señal de terminación
-	log.Info("=== Cliente BitTorrent ejecutándose ===")
-	log.Info("Presiona Ctrl+C para detener el cliente")
-	log.Info("Escuchando en puerto: %d", listenPort)
-	log.Info("Announces cada: %v", trackerInterval)
+	log.Info("cliente BitTorrent ejecutándose (Ctrl+C para detenerlo)", logging.InfoHash(cfg.InfoHash),
+		"port", listenPort, "announce_interval", trackerInterval)
 
 	sig := <-sigChan
 
 	// Shutdown limpio
-	log.Warn("=== Señal %v recibida, iniciando shutdown limpio ===", sig)
+	log.Warn("señal recibida, iniciando shutdown limpio", "signal", sig.String())
 
 	// Notificar a todas las goroutines que deben detenerse
 	close(shutdownChan)
 
+	// Guardar el resume para no re-verificar todo en el próximo arranque
+	if err := client.SaveResume(cfg, store, mgr); err != nil {
+		log.Warn("no se pudo guardar el resume", logging.Err(err))
+	} else {
+		log.Info("resume guardado", "path", cfg.ResumePath())
+	}
+
 	// Enviar stopped (tracker o overlay según modo)
-	client.SendStoppedAnnounceOverlay(
-		cfg,
-		listenPort,
-		computeLeft,
-		hostnameFlag,
-		ov,
-		providerAddr,
-	)
+	if dhtNode != nil {
+		log.Info("deteniendo el nodo DHT")
+		dhtNode.Stop()
+	} else {
+		client.SendStoppedAnnounceOverlay(
+			cfg,
+			listenPort,
+			computeLeft,
+			hostnameFlag,
+			ov,
+			providerAddr,
+		)
+	}
 
 	// Cerrar el listener de conexiones
-	log.Warn("Cerrando listener...")
+	log.Info("cerrando el listener")
 	ln.Close()
 
 	// Dar tiempo a las goroutines para terminar
 	time.Sleep(500 * time.Millisecond)
 
-	log.Info("Cliente cerrado correctamente. Adiós!")
+	log.Info("cliente cerrado")
 }
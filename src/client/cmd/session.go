@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"src/client"
+	"src/logging"
+	"syscall"
+)
+
+// runSession ejecuta el cliente en modo sesión (--session): varios torrents en
+// un proceso, un único puerto de peers y control por HTTP en /torrents.
+func runSession(archives, hostname, discovery, bootstrap string, httpPort int, opts *client.ClientOptions) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		log.Error("no se pudo abrir el listener", logging.Err(err))
+		panic(err)
+	}
+	log.Info("sesión escuchando peers", "port", ln.Addr().(*net.TCPAddr).Port)
+
+	if hostname == "" {
+		hostname = "127.0.0.1"
+	}
+	if discovery == "overlay" {
+		log.Warn("el modo sesión no soporta overlay; se usa el tracker de cada torrent")
+	}
+	dhtNode := client.SetupDHT(discovery, bootstrap, opts.DHTPort)
+
+	session := client.NewSession(ln, hostname, archives, opts, dhtNode)
+	session.Start()
+
+	for _, src := range opts.Torrents {
+		if _, err := session.AddTorrent(src, ""); err != nil {
+			log.Error("no se pudo agregar el torrent", "torrent", src, logging.Err(err))
+		}
+	}
+
+	httpServer := client.NewSessionHTTPServer(session, httpPort)
+	go func() {
+		log.Info("servidor HTTP de la sesión iniciado", "port", httpPort)
+		if err := httpServer.Start(); err != nil {
+			log.Error("error en el servidor HTTP", logging.Err(err))
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	log.Info("sesión BitTorrent ejecutándose", "torrents", len(session.Torrents()))
+
+	sig := <-sigChan
+	log.Warn("señal recibida, cerrando la sesión", "signal", sig.String())
+
+	httpServer.Stop()
+	session.Close()
+	if dhtNode != nil {
+		dhtNode.Stop()
+	}
+	log.Info("sesión cerrada")
+}
@@ -2,12 +2,16 @@ package client
 
 import (
 	"crypto/sha1"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"src/bencode"
+	"src/logging"
+	"src/peerwire"
 	"strings"
+	"time"
 )
 
 type ClientConfig struct {
@@ -20,63 +24,161 @@ type ClientConfig struct {
 	AnnounceURL       string   // Tracker principal (deprecated, usar AnnounceURLs)
 	AnnounceURLs      []string // Lista de todos los trackers disponibles
 	CurrentTrackerIdx int      // Índice del tracker actualmente en uso
-	FileLength        int64
+	FileLength        int64    // Tamaño total (suma de todos los archivos en multi-file)
 	PieceLength       int64
 	ExpectedHashes    [][20]byte
-	FileName          string
-	HTTPPort          int // Puerto para servidor HTTP interno
+	FileName          string               // Nombre del archivo o del directorio raíz (multi-file)
+	Files             []peerwire.FileEntry // Archivos de info["files"]; vacío en torrents de un solo archivo
+	HTTPPort          int                  // Puerto para servidor HTTP interno
+	InfoBytes         []byte               // info dictionary bencodeado (SHA1 = InfoHash)
+	Private           bool                 // info["private"]=1: sólo peers del tracker, sin PEX
+	WebSeeds          []string             // url-list (BEP 19) o ws= del magnet
 }
 
-func ParseFlags() (string, string, string, string, string, int, int) {
-	torrentFlag := flag.String("torrent", "", "ruta al archivo .torrent (obligatorio)")
+// ClientOptions agrupa las opciones de ajuste del cliente (no del torrent)
+type ClientOptions struct {
+	PipelineDepth    int           // REQUEST en vuelo por peer
+	PipelineAdaptive bool          // ajustar la profundidad según la tasa medida
+	RequestTimeout   time.Duration // tiempo máximo de espera de un bloque
+	UploadSlots      int           // peers unchoked por rendimiento (más uno optimista)
+	Pex              bool          // intercambiar peers con ut_pex
+	DHTPort          int           // puerto UDP del nodo DHT (--discovery-mode=dht)
+	Session          bool          // varios torrents en un proceso (ver Session)
+	Limits           peerwire.RateLimits
+	Encryption       peerwire.EncryptionPolicy // MSE/PE con los peers
+	IPv6             string                    // --ipv6: auto, off o una IPv6 literal a anunciar
+	WebSeeds         bool                      // bajar piezas de los web seeds del torrent
+	Torrents         []string                  // todos los --torrent, en orden (modo sesión)
+}
+
+// torrentList es el valor de --torrent: el flag se puede repetir y cada
+// valor puede ser además una lista separada por comas (ver SplitTorrentList)
+type torrentList []string
+
+func (l *torrentList) String() string { return strings.Join(*l, ",") }
+
+func (l *torrentList) Set(v string) error {
+	*l = append(*l, SplitTorrentList(v)...)
+	return nil
+}
+
+// SplitTorrentList separa una lista de .torrent y magnet links separada por
+// comas. Un magnet puede tener comas sin escapar (p. ej. en dn=), así que
+// dentro de un magnet sólo se corta donde el siguiente elemento empieza con
+// "magnet:" o termina en ".torrent".
+func SplitTorrentList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		item := strings.TrimSpace(part)
+		if n := len(out); n > 0 && IsMagnetURI(out[n-1]) &&
+			!IsMagnetURI(item) && !strings.HasSuffix(item, ".torrent") {
+			out[n-1] += "," + part
+			continue
+		}
+		if item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func ParseFlags() (string, string, string, string, string, int, int, *ClientOptions) {
+	var torrents torrentList
+	flag.Var(&torrents, "torrent", "ruta al archivo .torrent o magnet link (obligatorio salvo con --session; se puede repetir en modo sesión)")
 	archivesFlag := flag.String("archives", "./archives", "directorio de archivos donde guardar/leer archivos")
 	hostnameFlag := flag.String("hostname", "", "nombre de host para announces (requerido en Docker/NAT)")
-	discoveryFlag := flag.String("discovery-mode", "tracker", "discovery mode: tracker|overlay")
-	bootstrapFlag := flag.String("bootstrap", "", "comma-separated bootstrap peers para overlay (host:port)")
+	discoveryFlag := flag.String("discovery-mode", "tracker", "discovery mode: tracker|overlay|dht")
+	bootstrapFlag := flag.String("bootstrap", "", "comma-separated bootstrap peers para overlay o nodos DHT (host:port)")
 	overlayPortFlag := flag.Int("overlay-port", 6000, "puerto donde escucha el overlay (TCP)")
+	dhtPortFlag := flag.Int("dht-port", 6881, "puerto donde escucha el nodo DHT (UDP)")
 	httpPortFlag := flag.Int("http-port", 9091, "puerto para servidor HTTP de métricas y control")
+	pipelineFlag := flag.Int("pipeline", peerwire.DefaultPipelineDepth, "REQUEST en vuelo por peer")
+	pipelineAdaptiveFlag := flag.Bool("pipeline-adaptive", true, "ajustar el pipeline por peer según la tasa de descarga medida")
+	uploadSlotsFlag := flag.Int("upload-slots", peerwire.DefaultUploadSlots, "peers a los que se sube a la vez (más un optimistic unchoke)")
+	pexFlag := flag.Bool("pex", true, "intercambiar peers con los peers conectados (ut_pex); no aplica a torrents privados")
+	sessionFlag := flag.Bool("session", false, "modo sesión: varios torrents en un proceso (--torrent se puede repetir o llevar una lista separada por comas; más torrents vía POST /torrents)")
+	uploadLimitFlag := flag.Int64("upload-limit", 0, "límite global de subida en KiB/s (0 = sin límite)")
+	downloadLimitFlag := flag.Int64("download-limit", 0, "límite global de descarga en KiB/s (0 = sin límite)")
+	peerUploadLimitFlag := flag.Int64("peer-upload-limit", 0, "límite de subida por peer en KiB/s (0 = sin límite)")
+	peerDownloadLimitFlag := flag.Int64("peer-download-limit", 0, "límite de descarga por peer en KiB/s (0 = sin límite)")
+	encryptionFlag := flag.String("encryption", "prefer", "cifrado MSE/PE con los peers: plaintext|prefer|require")
+	ipv6Flag := flag.String("ipv6", "auto", "IPv6 a anunciar al tracker (ipv6=) y al overlay: auto, off o una dirección")
+	webSeedsFlag := flag.Bool("web-seeds", true, "bajar piezas de los web seeds (url-list) cuando los peers son lentos o no hay")
+	requestTimeoutFlag := flag.Int("request-timeout", int(peerwire.DefaultRequestTimeout.Seconds()), "segundos de espera de un bloque antes de pedirlo a otro peer")
+	logOpts := logging.RegisterFlags(nil)
 
 	flag.Parse()
 
-	if *torrentFlag == "" {
-		fmt.Println("Error: debe especificar --torrent=/ruta/al/archivo.torrent")
+	if err := logging.Setup(*logOpts); err != nil {
+		fmt.Println("Error:", err)
 		os.Exit(2)
 	}
 
-	return *torrentFlag, *archivesFlag, *hostnameFlag, *discoveryFlag, *bootstrapFlag, *overlayPortFlag, *httpPortFlag
+	torrentFlag := ""
+	if len(torrents) > 0 {
+		torrentFlag = torrents[0]
+	}
+
+	if len(torrents) == 0 && !*sessionFlag {
+		fmt.Println("Error: debe especificar --torrent=/ruta/al/archivo.torrent o --torrent='magnet:?xt=urn:btih:...'")
+		os.Exit(2)
+	}
+	encryption, err := peerwire.ParseEncryptionPolicy(*encryptionFlag)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+
+	opts := &ClientOptions{
+		PipelineDepth:    *pipelineFlag,
+		PipelineAdaptive: *pipelineAdaptiveFlag,
+		RequestTimeout:   time.Duration(*requestTimeoutFlag) * time.Second,
+		UploadSlots:      *uploadSlotsFlag,
+		Pex:              *pexFlag,
+		DHTPort:          *dhtPortFlag,
+		Session:          *sessionFlag,
+		Limits: peerwire.RateLimits{
+			GlobalUpload:   *uploadLimitFlag * 1024,
+			GlobalDownload: *downloadLimitFlag * 1024,
+			PeerUpload:     *peerUploadLimitFlag * 1024,
+			PeerDownload:   *peerDownloadLimitFlag * 1024,
+		},
+		Encryption: encryption,
+		IPv6:       *ipv6Flag,
+		WebSeeds:   *webSeedsFlag,
+		Torrents:   torrents,
+	}
+
+	return torrentFlag, *archivesFlag, *hostnameFlag, *discoveryFlag, *bootstrapFlag, *overlayPortFlag, *httpPortFlag, opts
 }
 
 func LoadTorrentMetadata(torrentPath, archivesPath string) *ClientConfig {
-	archivesDir := archivesPath
-	if strings.HasPrefix(archivesDir, "~") {
-		if home, err := os.UserHomeDir(); err == nil {
-			if archivesDir == "~" {
-				archivesDir = home
-			} else if strings.HasPrefix(archivesDir, "~/") {
-				archivesDir = filepath.Join(home, archivesDir[2:])
-			}
-		}
+	cfg, err := ParseTorrentFile(torrentPath, archivesPath)
+	if err != nil {
+		panic(err)
 	}
+	return cfg
+}
 
-	if err := os.MkdirAll(archivesDir, 0755); err != nil {
-		fmt.Println("No se pudo crear directorio:", err)
-		os.Exit(1)
-	}
+// ParseTorrentFile lee un .torrent y arma su configuración; a diferencia de
+// LoadTorrentMetadata devuelve el error en vez de abortar (modo sesión).
+func ParseTorrentFile(torrentPath, archivesPath string) (*ClientConfig, error) {
+	archivesDir := prepareArchivesDir(archivesPath)
 
 	// Abrir y decodificar el .torrent
 	torrent, err := os.Open(torrentPath)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer torrent.Close()
 
 	meta, err := bencode.Decode(torrent)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("torrent inválido: %w", err)
 	}
 
 	// Leer announce principal
-	announce := meta["announce"].(string)
+	announce, _ := meta["announce"].(string)
 
 	// Leer announce-list (lista de listas de trackers)
 	var announceURLs []string
@@ -94,22 +196,113 @@ func LoadTorrentMetadata(torrentPath, archivesPath string) *ClientConfig {
 	}
 
 	// Si no hay announce-list, usar solo announce
-	if len(announceURLs) == 0 {
+	if len(announceURLs) == 0 && announce != "" {
 		announceURLs = []string{announce}
 	}
 
-	info := meta["info"].(map[string]interface{})
+	info, ok := meta["info"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("torrent inválido: falta el diccionario info")
+	}
 	infoEncoded := bencode.Encode(info)
 	infoHash := sha1.Sum(infoEncoded)
 
+	cfg := &ClientConfig{
+		TorrentPath:       torrentPath,
+		ArchivesDir:       archivesDir,
+		PeerId:            GeneratePeerId(),
+		InfoHash:          infoHash,
+		InfoHashEncoded:   encodeInfoHash(infoHash),
+		AnnounceURL:       announce,
+		AnnounceURLs:      announceURLs,
+		CurrentTrackerIdx: 0, // Se seleccionará el más cercano después
+		WebSeeds:          parseURLList(meta["url-list"]),
+	}
+	if err := cfg.applyInfo(info, infoEncoded); err != nil {
+		return nil, err
+	}
+
+	log.Info("torrent cargado", logging.InfoHash(cfg.InfoHash), "name", cfg.FileName,
+		"trackers", announceURLs, "web_seeds", len(cfg.WebSeeds))
+
+	return cfg, nil
+}
+
+// parseURLList lee url-list (BEP 19): una URL o una lista de URLs
+func parseURLList(v interface{}) []string {
+	switch list := v.(type) {
+	case string:
+		if list != "" {
+			return []string{list}
+		}
+	case []interface{}:
+		var out []string
+		for _, item := range list {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// prepareArchivesDir expande "~" y crea el directorio de archivos si no existe
+func prepareArchivesDir(archivesPath string) string {
+	archivesDir := archivesPath
+	if strings.HasPrefix(archivesDir, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			if archivesDir == "~" {
+				archivesDir = home
+			} else if strings.HasPrefix(archivesDir, "~/") {
+				archivesDir = filepath.Join(home, archivesDir[2:])
+			}
+		}
+	}
+
+	if err := os.MkdirAll(archivesDir, 0755); err != nil {
+		log.Error("no se pudo crear el directorio de archivos", "path", archivesDir, logging.Err(err))
+		os.Exit(1)
+	}
+	return archivesDir
+}
+
+// encodeInfoHash devuelve el info_hash percent-encoded para la query del announce
+func encodeInfoHash(infoHash [20]byte) string {
+	var buf strings.Builder
+	for _, b := range infoHash {
+		buf.WriteString(fmt.Sprintf("%%%02X", b))
+	}
+	return buf.String()
+}
+
+// applyInfo completa la configuración con el info dictionary del torrent
+// (tamaños, hashes de piezas, nombre y archivos). raw son los bytes
+// bencodeados cuyo SHA1 es el info_hash; se guardan para servirlos por ut_metadata.
+func (cfg *ClientConfig) applyInfo(info map[string]interface{}, raw []byte) error {
 	var length int64
 	if v, ok := info["length"].(int64); ok {
 		length = v
 	}
+
+	// Torrents multi-archivo: info["files"] es una lista de {length, path}
+	files, err := parseInfoFiles(info)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		length = 0
+		for _, fe := range files {
+			length += fe.Length
+		}
+	}
 	var pieceLength int64
 	if v, ok := info["piece length"].(int64); ok {
 		pieceLength = v
 	}
+	if pieceLength <= 0 || length <= 0 {
+		return fmt.Errorf("info dictionary inválido: length=%d piece length=%d", length, pieceLength)
+	}
 
 	var expectedHashes [][20]byte
 	if piecesRaw, ok := info["pieces"].(string); ok {
@@ -120,43 +313,81 @@ func LoadTorrentMetadata(torrentPath, archivesPath string) *ClientConfig {
 				copy(expectedHashes[i][:], piecesRaw[i*20:(i+1)*20])
 			}
 		} else {
-			fmt.Printf("Advertencia: longitud de 'piece' (%d) no coincide con numPiece*20 (%d)\n", len(piecesRaw), numPieces*20)
+			log.Warn("longitud de pieces inválida, no se verificarán las piezas", "size", len(piecesRaw), "expected", numPieces*20)
 		}
 	}
 
-	var buf strings.Builder
-	for _, b := range infoHash {
-		buf.WriteString(fmt.Sprintf("%%%02X", b))
-	}
-
 	outName := "archivo.bin"
 	if n, ok := info["name"].(string); ok && n != "" {
 		outName = filepath.Base(n)
 	}
 
-	cfg := &ClientConfig{
-		TorrentPath:       torrentPath,
-		ArchivesDir:       archivesDir,
-		PeerId:            GeneratePeerId(),
-		InfoHash:          infoHash,
-		InfoHashEncoded:   buf.String(),
-		AnnounceURL:       announce,
-		AnnounceURLs:      announceURLs,
-		CurrentTrackerIdx: 0, // Se seleccionará el más cercano después
-		FileLength:        length,
-		PieceLength:       pieceLength,
-		ExpectedHashes:    expectedHashes,
-		FileName:          outName,
+	cfg.FileLength = length
+	cfg.PieceLength = pieceLength
+	cfg.ExpectedHashes = expectedHashes
+	cfg.FileName = outName
+	cfg.Files = files
+	cfg.InfoBytes = raw
+	if private, ok := info["private"].(int64); ok && private == 1 {
+		cfg.Private = true
 	}
 
-	fmt.Printf("[CONFIG] Trackers encontrados: %d\n", len(announceURLs))
-	for i, url := range announceURLs {
-		fmt.Printf("  [%d] %s\n", i, url)
+	if cfg.IsMultiFile() {
+		log.Info("torrent multi-archivo", "name", outName, "files", len(files), "bytes", length)
+		for _, fe := range files {
+			log.Debug("archivo del torrent", "path", fe.RelPath(), "bytes", fe.Length)
+		}
 	}
+	return nil
+}
 
-	return cfg
+// HasMetadata indica si ya se conoce el info dictionary (falso al arrancar
+// desde un magnet link hasta obtenerlo de los peers).
+func (cfg *ClientConfig) HasMetadata() bool {
+	return cfg.InfoBytes != nil
+}
+
+// parseInfoFiles lee la lista info["files"] de un torrent multi-archivo.
+// Devuelve nil si el torrent es de un solo archivo.
+func parseInfoFiles(info map[string]interface{}) ([]peerwire.FileEntry, error) {
+	rawFiles, ok := info["files"].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	files := make([]peerwire.FileEntry, 0, len(rawFiles))
+	for i, raw := range rawFiles {
+		dict, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("info.files[%d]: entrada inválida", i)
+		}
+		length, ok := dict["length"].(int64)
+		if !ok || length < 0 {
+			return nil, fmt.Errorf("info.files[%d]: length inválido", i)
+		}
+		rawPath, ok := dict["path"].([]interface{})
+		if !ok || len(rawPath) == 0 {
+			return nil, fmt.Errorf("info.files[%d]: path inválido", i)
+		}
+		path := make([]string, 0, len(rawPath))
+		for _, c := range rawPath {
+			comp, ok := c.(string)
+			if !ok {
+				return nil, fmt.Errorf("info.files[%d]: componente de path inválido", i)
+			}
+			path = append(path, comp)
+		}
+		files = append(files, peerwire.FileEntry{Path: path, Length: length})
+	}
+	return files, nil
+}
+
+// IsMultiFile indica si el torrent tiene varios archivos (info["files"])
+func (cfg *ClientConfig) IsMultiFile() bool {
+	return len(cfg.Files) > 0
 }
 
+// GetStoragePaths devuelve la ruta temporal (.part) y la final. En torrents
+// multi-archivo ambas son directorios que contienen el árbol de archivos.
 func (cfg *ClientConfig) GetStoragePaths() (tempPath, finalPath string) {
 	tempPath = filepath.Join(cfg.ArchivesDir, cfg.FileName+".part")
 	finalPath = filepath.Join(cfg.ArchivesDir, cfg.FileName)
@@ -183,9 +414,8 @@ func (cfg *ClientConfig) SwitchToNextTracker() bool {
 	oldIdx := cfg.CurrentTrackerIdx
 	cfg.CurrentTrackerIdx = (cfg.CurrentTrackerIdx + 1) % len(cfg.AnnounceURLs)
 
-	fmt.Printf("[TRACKER] Cambiando de tracker: %s -> %s\n",
-		cfg.AnnounceURLs[oldIdx],
-		cfg.AnnounceURLs[cfg.CurrentTrackerIdx])
+	announceLog.Info("cambiando de tracker", logging.InfoHash(cfg.InfoHash),
+		"from", cfg.AnnounceURLs[oldIdx], "to", cfg.AnnounceURLs[cfg.CurrentTrackerIdx])
 
 	return true
 }
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"fmt"
+	"src/dht"
+	"src/logging"
+	"src/peerwire"
+	"strings"
+	"time"
+)
+
+// SetupDHT inicializa un nodo Kademlia si el modo de descubrimiento es "dht".
+// La lista --bootstrap se interpreta como nodos DHT (host:puerto UDP).
+func SetupDHT(discoveryMode string, bootstrap string, dhtPort int) *dht.DHT {
+	if discoveryMode != "dht" {
+		return nil
+	}
+	var nodes []string
+	for _, p := range strings.Split(bootstrap, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			nodes = append(nodes, p)
+		}
+	}
+
+	listenAddr := fmt.Sprintf(":%d", dhtPort)
+	node, err := dht.New(listenAddr)
+	if err != nil {
+		log.Error("no se pudo iniciar la DHT", "addr", listenAddr, logging.Err(err))
+		return nil
+	}
+	node.Start()
+	log.Info("DHT iniciada", "addr", listenAddr)
+
+	if len(nodes) == 0 {
+		log.Info("DHT sin nodos de bootstrap: este nodo inicia la red")
+	} else if err := node.Bootstrap(nodes); err != nil {
+		// el mantenimiento reintenta el bootstrap mientras la tabla esté vacía
+		log.Warn("bootstrap de la DHT fallido", logging.Err(err))
+	}
+	return node
+}
+
+// AnnounceAndGetPeersDHT se anuncia en la DHT con el puerto de escucha TCP y
+// devuelve los peers encontrados para el torrent (sin incluirnos).
+func AnnounceAndGetPeersDHT(node *dht.DHT, cfg *ClientConfig, listenPort int) []PeerInfo {
+	addrs, err := node.Announce(cfg.InfoHash, listenPort)
+	if err != nil {
+		announceLog.Warn("announce en la DHT fallido", logging.InfoHash(cfg.InfoHash), logging.Err(err))
+	}
+	var peers []PeerInfo
+	for _, addr := range addrs {
+		if isOwnAddr(addr, listenPort) {
+			continue
+		}
+		peers = append(peers, PeerInfo{Addr: addr})
+	}
+	announceLog.Debug("peers de la DHT", logging.InfoHash(cfg.InfoHash), "peers", len(peers))
+	return peers
+}
+
+// mientras la DHT no devuelva peers se re-anuncia con este intervalo
+const dhtRetryInterval = 10 * time.Second
+
+// StartPeriodicAnnounceRoutineDHT re-anuncia en la DHT cada interval (o cada
+// dhtRetryInterval mientras no haya peers) y conecta a los peers nuevos.
+func StartPeriodicAnnounceRoutineDHT(
+	node *dht.DHT,
+	cfg *ClientConfig,
+	listenPort int,
+	shutdownChan <-chan struct{},
+	interval time.Duration,
+	store *peerwire.DiskPieceStore,
+	mgr *peerwire.Manager,
+) {
+	go func() {
+		next := interval
+		if mgr.GetPeerCount() == 0 {
+			next = dhtRetryInterval
+		}
+		timer := time.NewTimer(next)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+				peerInfo := AnnounceAndGetPeersDHT(node, cfg, listenPort)
+				announceLog.Debug("announce periódico enviado a la DHT", logging.InfoHash(cfg.InfoHash))
+				if len(peerInfo) > 0 {
+					ConnectToPeers(peerInfo, cfg.InfoHash, cfg.PeerId, store, mgr)
+				}
+				next = interval
+				if len(peerInfo) == 0 && mgr.GetPeerCount() == 0 {
+					next = dhtRetryInterval
+				}
+				timer.Reset(next)
+
+			case <-shutdownChan:
+				announceLog.Debug("announce periódico detenido", logging.InfoHash(cfg.InfoHash))
+				return
+			}
+		}
+	}()
+}
@@ -1,7 +1,7 @@
 package client
 
 import (
-	"fmt"
+	"src/logging"
 	"src/overlay"
 	"src/peerwire"
 	"time"
@@ -16,7 +16,6 @@ func StartCompletionAnnounceRoutine(
 
 	go func() {
 		<-completedChan
-		fmt.Println("[INFO] Enviando event=completed al tracker...")
 
 		_, err := SendAnnounceWithFailover(
 			cfg,
@@ -29,9 +28,9 @@ func StartCompletionAnnounceRoutine(
 		)
 
 		if err != nil {
-			fmt.Println("[ERROR] No se pudo enviar completed:", err)
+			announceLog.Error("no se pudo enviar completed", logging.InfoHash(cfg.InfoHash), logging.Err(err))
 		} else {
-			fmt.Println("[INFO] Ahora soy un seeder completo")
+			announceLog.Info("event=completed enviado, ahora somos seeder", logging.InfoHash(cfg.InfoHash))
 		}
 	}()
 }
@@ -49,11 +48,9 @@ func StartCompletionAnnounceRoutineOverlay(
 		<-completedChan
 
 		if ov != nil {
-			fmt.Println("[INFO] Enviando event=completed al overlay...")
-			ov.Announce(cfg.InfoHashEncoded, overlay.ProviderMeta{Addr: providerAddr, PeerId: cfg.PeerId, Left: 0})
-			fmt.Println("[INFO] Ahora soy un seeder completo (overlay)")
+			ov.Announce(cfg.InfoHashEncoded, LocalProvider(providerAddr, cfg.PeerId, 0))
+			announceLog.Info("event=completed enviado al overlay, ahora somos seeder", logging.InfoHash(cfg.InfoHash))
 		} else {
-			fmt.Println("[INFO] Enviando event=completed al tracker...")
 			_, err := SendAnnounceWithFailover(
 				cfg,
 				listenPort,
@@ -65,9 +62,9 @@ func StartCompletionAnnounceRoutineOverlay(
 			)
 
 			if err != nil {
-				fmt.Println("[ERROR] No se pudo enviar completed:", err)
+				announceLog.Error("no se pudo enviar completed", logging.InfoHash(cfg.InfoHash), logging.Err(err))
 			} else {
-				fmt.Println("[INFO] Ahora soy un seeder completo")
+				announceLog.Info("event=completed enviado, ahora somos seeder", logging.InfoHash(cfg.InfoHash))
 			}
 		}
 	}()
@@ -106,14 +103,14 @@ func StartPeriodicAnnounceRoutine(
 				)
 
 				if err != nil {
-					fmt.Println("[ERROR] Announce periódico fallido:", err)
+					announceLog.Warn("announce periódico fallido", logging.InfoHash(infoHash), logging.Err(err))
 				} else {
-					fmt.Println("[INFO] Announce periódico enviado")
+					announceLog.Debug("announce periódico enviado", logging.InfoHash(infoHash))
 
 					// Procesar nuevos peers de la respuesta
 					peerInfo := ParsePeersFromOthers(trackerResponse, nil, "", cfg)
 					if len(peerInfo) > 0 {
-						fmt.Printf("[INFO] Conectando a %d peers nuevos del announce periódico\n", len(peerInfo))
+						announceLog.Info("conectando a peers del announce periódico", logging.InfoHash(infoHash), "peers", len(peerInfo))
 						if diskStore, ok := store.(*peerwire.DiskPieceStore); ok {
 							if manager, ok := mgr.(*peerwire.Manager); ok {
 								ConnectToPeers(peerInfo, infoHash, peerId, diskStore, manager)
@@ -123,7 +120,7 @@ func StartPeriodicAnnounceRoutine(
 				}
 
 			case <-shutdownChan:
-				fmt.Println("[INFO] Periodic announce detenido")
+				announceLog.Debug("announce periódico detenido", logging.InfoHash(infoHash))
 				return
 			}
 		}
@@ -154,13 +151,13 @@ func StartPeriodicAnnounceRoutineOverlay(
 				left := computeLeft()
 
 				if ov != nil {
-					ov.Announce(cfg.InfoHashEncoded, overlay.ProviderMeta{Addr: providerAddr, PeerId: cfg.PeerId, Left: left})
-					fmt.Println("[INFO] Announce periódico enviado (overlay)")
+					ov.Announce(cfg.InfoHashEncoded, LocalProvider(providerAddr, cfg.PeerId, left))
+					announceLog.Debug("announce periódico enviado al overlay", logging.InfoHash(infoHash))
 
 					// Obtener y conectar a nuevos peers del overlay
 					peerInfo := ParsePeersFromOthers(nil, ov, providerAddr, cfg)
 					if len(peerInfo) > 0 {
-						fmt.Printf("[INFO] Conectando a %d peers nuevos del overlay\n", len(peerInfo))
+						announceLog.Info("conectando a peers del overlay", logging.InfoHash(infoHash), "peers", len(peerInfo))
 						if diskStore, ok := store.(*peerwire.DiskPieceStore); ok {
 							if manager, ok := mgr.(*peerwire.Manager); ok {
 								ConnectToPeers(peerInfo, infoHash, peerId, diskStore, manager)
@@ -179,14 +176,14 @@ func StartPeriodicAnnounceRoutineOverlay(
 					)
 
 					if err != nil {
-						fmt.Println("[ERROR] Announce periódico fallido (tracker):", err)
+						announceLog.Warn("announce periódico fallido", logging.InfoHash(infoHash), logging.Err(err))
 					} else {
-						fmt.Println("[INFO] Announce periódico enviado (tracker)")
+						announceLog.Debug("announce periódico enviado", logging.InfoHash(infoHash))
 
 						// Procesar nuevos peers de la respuesta
 						peerInfo := ParsePeersFromOthers(trackerResponse, nil, "", cfg)
 						if len(peerInfo) > 0 {
-							fmt.Printf("[INFO] Conectando a %d peers nuevos del announce periódico\n", len(peerInfo))
+							announceLog.Info("conectando a peers del announce periódico", logging.InfoHash(infoHash), "peers", len(peerInfo))
 							if diskStore, ok := store.(*peerwire.DiskPieceStore); ok {
 								if manager, ok := mgr.(*peerwire.Manager); ok {
 									ConnectToPeers(peerInfo, infoHash, peerId, diskStore, manager)
@@ -197,7 +194,7 @@ func StartPeriodicAnnounceRoutineOverlay(
 				}
 
 			case <-shutdownChan:
-				fmt.Println("[INFO] Periodic announce detenido")
+				announceLog.Debug("announce periódico detenido", logging.InfoHash(infoHash))
 				return
 			}
 		}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"src/logging"
 	"src/peerwire"
 	"sync"
 	"time"
@@ -21,7 +22,8 @@ type StatusResponse struct {
 	DownloadSpeed  int64   `json:"download_speed"`  // Bytes/segundo
 	UploadSpeed    int64   `json:"upload_speed"`    // Bytes/segundo
 	ConnectedPeers int     `json:"connected_peers"` // Peers conectados actualmente
-	TotalPeers     int     `json:"total_peers"`     // Total peers conocidos
+	TotalPeers     int     `json:"total_peers"`     // Total de fuentes conocidas (peers + web seeds)
+	WebSeeds       int     `json:"web_seeds"`       // Web seeds activos
 	Eta            string  `json:"eta"`             // Tiempo estimado restante
 }
 
@@ -38,6 +40,10 @@ type HTTPServer struct {
 	lastDownloaded int64
 	lastUploaded   int64
 	stopMonitoring chan struct{}
+
+	// contenido del torrent para /stream (ver SetStreamFiles)
+	contentName string
+	files       []peerwire.FileEntry
 }
 
 var globalPaused bool
@@ -72,6 +78,9 @@ func NewHTTPServer(store *peerwire.DiskPieceStore, manager *peerwire.Manager, fi
 	mux.HandleFunc("/pause", hs.handlePause)
 	mux.HandleFunc("/resume", hs.handleResume)
 	mux.HandleFunc("/health", hs.handleHealth)
+	mux.HandleFunc("/limits", handleLimits)
+	mux.HandleFunc("/stream", hs.handleStream)
+	mux.HandleFunc("/priorities", hs.handlePriorities)
 
 	hs.server = &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
@@ -125,7 +134,7 @@ func (hs *HTTPServer) handlePause(w http.ResponseWriter, r *http.Request) {
 
 	SetGlobalPause(true)
 
-	fmt.Println("[HTTP] Cliente pausado")
+	httpLog.Info("cliente pausado")
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -142,7 +151,7 @@ func (hs *HTTPServer) handleResume(w http.ResponseWriter, r *http.Request) {
 
 	SetGlobalPause(false)
 
-	fmt.Println("[HTTP] Cliente reanudado")
+	httpLog.Info("cliente reanudado")
 
 	// Reactivar descarga en peers disponibles
 	go hs.resumeDownload()
@@ -165,13 +174,13 @@ func (hs *HTTPServer) resumeDownload() {
 	for i := 0; i < numPieces; i++ {
 		if !hs.store.HasPiece(i) {
 			// Encontramos una pieza que falta, intentar descargarla
-			fmt.Printf("[HTTP] Reactivando descarga desde pieza %d\n", i)
+			httpLog.Debug("reactivando descarga", logging.Piece(i))
 			hs.manager.DownloadPieceParallel(i)
 			return
 		}
 	}
 
-	fmt.Println("[HTTP] No hay piezas pendientes para descargar")
+	httpLog.Debug("no hay piezas pendientes para descargar")
 }
 
 // handleHealth endpoint de salud para Docker
@@ -204,7 +213,8 @@ func (hs *HTTPServer) calculateStatus() StatusResponse {
 
 	// Contar peers conectados
 	connectedPeers := hs.manager.GetPeerCount()
-	totalPeers := connectedPeers // Por ahora, sin overlay info
+	webSeeds := activeWebSeeds(hs.manager)
+	totalPeers := connectedPeers + webSeeds // Por ahora, sin overlay info
 
 	// Calcular ETA
 	eta := "∞"
@@ -218,7 +228,7 @@ func (hs *HTTPServer) calculateStatus() StatusResponse {
 	state := "starting"
 	if IsGlobalPaused() {
 		state = "paused"
-	} else if downloaded >= hs.fileLength {
+	} else if downloaded >= hs.fileLength || hs.store.WantedLeft() == 0 {
 		state = "completed"
 	} else if downloadSpeed > 0 {
 		state = "downloading"
@@ -237,6 +247,7 @@ func (hs *HTTPServer) calculateStatus() StatusResponse {
 		UploadSpeed:    uploadSpeed,
 		ConnectedPeers: connectedPeers,
 		TotalPeers:     totalPeers,
+		WebSeeds:       webSeeds,
 		Eta:            eta,
 	}
 }
@@ -314,7 +325,8 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%ds", seconds)
 }
 
-// GetLocalIP obtiene la IP local del contenedor
+// GetLocalIP obtiene la IP local del contenedor: la primera IPv4 y, si no
+// hay ninguna, la primera IPv6 global
 func GetLocalIP() string {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
@@ -328,5 +340,8 @@ func GetLocalIP() string {
 			}
 		}
 	}
+	if ip6 := GetLocalIPv6(); ip6 != "" {
+		return ip6
+	}
 	return "127.0.0.1"
 }
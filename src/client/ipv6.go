@@ -0,0 +1,60 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"src/overlay"
+)
+
+// announceIPv6 es la IPv6 propia que se informa al tracker (ipv6=, BEP 7) y
+// al overlay (ProviderMeta.Addr6); vacío si no tenemos o no se anuncia
+var announceIPv6 string
+
+// SetAnnounceIPv6 configura la IPv6 a anunciar según --ipv6: "auto" detecta
+// una IPv6 global de las interfaces, "" o "off" no anuncia ninguna y cualquier
+// otro valor debe ser una IPv6 literal.
+func SetAnnounceIPv6(v string) error {
+	switch v {
+	case "", "off":
+		announceIPv6 = ""
+		return nil
+	case "auto":
+		announceIPv6 = GetLocalIPv6()
+		if announceIPv6 != "" {
+			log.Info("IPv6 detectada", "ipv6", announceIPv6)
+		}
+		return nil
+	}
+	ip := net.ParseIP(v)
+	if ip == nil || ip.To4() != nil {
+		return fmt.Errorf("--ipv6 inválido: %q no es una dirección IPv6", v)
+	}
+	announceIPv6 = ip.String()
+	return nil
+}
+
+// GetLocalIPv6 devuelve la primera IPv6 global (no loopback ni link-local)
+// de las interfaces, o "" si no hay
+func GetLocalIPv6() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() == nil && ipnet.IP.IsGlobalUnicast() {
+			return ipnet.IP.String()
+		}
+	}
+	return ""
+}
+
+// LocalProvider arma el ProviderMeta con el que nos anunciamos al overlay,
+// agregando la dirección IPv6 si hay una configurada
+func LocalProvider(providerAddr, peerId string, left int64) overlay.ProviderMeta {
+	pm := overlay.ProviderMeta{Addr: providerAddr, PeerId: peerId, Left: left}
+	host, port, err := net.SplitHostPort(providerAddr)
+	if announceIPv6 != "" && err == nil && host != announceIPv6 {
+		pm.Addr6 = net.JoinHostPort(announceIPv6, port)
+	}
+	return pm
+}
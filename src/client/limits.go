@@ -0,0 +1,73 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"src/peerwire"
+)
+
+// LimitsResponse son los límites de transferencia en KiB/s (0 = sin límite)
+type LimitsResponse struct {
+	Upload       int64 `json:"upload"`        // global, todo el proceso
+	Download     int64 `json:"download"`      // global, todo el proceso
+	PeerUpload   int64 `json:"peer_upload"`   // por conexión
+	PeerDownload int64 `json:"peer_download"` // por conexión
+}
+
+func currentLimits() LimitsResponse {
+	l := peerwire.GetRateLimits()
+	return LimitsResponse{
+		Upload:       l.GlobalUpload / 1024,
+		Download:     l.GlobalDownload / 1024,
+		PeerUpload:   l.PeerUpload / 1024,
+		PeerDownload: l.PeerDownload / 1024,
+	}
+}
+
+// handleLimits atiende /limits: GET devuelve los límites y POST/PUT cambia
+// los campos presentes en el body, p.ej. {"upload": 512}
+func handleLimits(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, currentLimits())
+
+	case http.MethodPost, http.MethodPut:
+		var req struct {
+			Upload       *int64 `json:"upload"`
+			Download     *int64 `json:"download"`
+			PeerUpload   *int64 `json:"peer_upload"`
+			PeerDownload *int64 `json:"peer_download"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "JSON inválido"})
+			return
+		}
+		l := peerwire.GetRateLimits()
+		for _, f := range []struct {
+			v   *int64
+			dst *int64
+		}{
+			{req.Upload, &l.GlobalUpload},
+			{req.Download, &l.GlobalDownload},
+			{req.PeerUpload, &l.PeerUpload},
+			{req.PeerDownload, &l.PeerDownload},
+		} {
+			if f.v == nil {
+				continue
+			}
+			if *f.v < 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "los límites no pueden ser negativos"})
+				return
+			}
+			*f.dst = *f.v * 1024
+		}
+		peerwire.SetRateLimits(l)
+		limits := currentLimits()
+		httpLog.Info("límites actualizados (KiB/s)", "upload", limits.Upload, "download", limits.Download,
+			"peer_upload", limits.PeerUpload, "peer_download", limits.PeerDownload)
+		writeJSON(w, http.StatusOK, limits)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -1,64 +1,107 @@
 package client
 
 import (
-	"bytes"
-	"fmt"
+	"errors"
 	"io"
 	"net"
+	"src/logging"
 	"src/peerwire"
 )
 
+// IncomingTarget es el torrent al que se entrega una conexión entrante
+type IncomingTarget struct {
+	PeerId string
+	Store  *peerwire.DiskPieceStore
+	Mgr    *peerwire.Manager
+}
+
+// IncomingRouter elige el torrent de una conexión entrante según el info_hash
+// del handshake; ok=false si no servimos ese torrent.
+type IncomingRouter func(infoHash [20]byte) (target IncomingTarget, ok bool)
+
 func StartListeningForIncomingPeers(ln net.Listener, infoHash [20]byte, peerId string,
 	store *peerwire.DiskPieceStore, mgr *peerwire.Manager) {
 
+	StartListeningRouted(ln, func(ih [20]byte) (IncomingTarget, bool) {
+		return IncomingTarget{PeerId: peerId, Store: store, Mgr: mgr}, ih == infoHash
+	}, func() [][20]byte { return [][20]byte{infoHash} })
+}
+
+// StartListeningRouted acepta conexiones en ln y las reparte entre los
+// torrents de route (un único puerto para toda la sesión). infoHashes lista
+// los torrents servidos, para identificar el torrent de las conexiones MSE.
+func StartListeningRouted(ln net.Listener, route IncomingRouter, infoHashes func() [][20]byte) {
 	go func() {
 		for {
 			c, err := ln.Accept()
 			if err != nil {
-				fmt.Println("Error aceptando conexión:", err)
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Warn("error aceptando conexión", logging.Err(err))
 				continue
 			}
-			go handleIncomingPeerConnection(c, infoHash, peerId, store, mgr)
+			go handleIncomingPeerConnection(c, route, infoHashes)
 		}
 	}()
 }
 
-func handleIncomingPeerConnection(conn net.Conn, infoHash [20]byte, peerId string,
-	store *peerwire.DiskPieceStore, mgr *peerwire.Manager) {
+func handleIncomingPeerConnection(conn net.Conn, route IncomingRouter, infoHashes func() [][20]byte) {
 
 	//defer conn.Close()
 
+	// MSE/PE: si el peer empieza cifrado, negociar antes del handshake
+	raw := conn
+	conn, mseHash, err := peerwire.AcceptPeer(raw, infoHashes())
+	if err != nil {
+		log.Debug("conexión entrante descartada (MSE)", logging.Peer(raw.RemoteAddr().String()), logging.Err(err))
+		raw.Close()
+		return
+	}
+
 	hs := make([]byte, peerwire.HandshakeLen)
 	if _, err := io.ReadFull(conn, hs); err != nil {
-		fmt.Println("Error leyendo handshake entrante:", err)
+		log.Debug("error leyendo handshake entrante", logging.Peer(conn.RemoteAddr().String()), logging.Err(err))
 		conn.Close()
 		return
 	}
 
 	if int(hs[0]) != 19 || string(hs[1:20]) != "BitTorrent protocol" {
-		fmt.Println("Handshake entrante inválido: pstr")
+		log.Debug("handshake entrante inválido: pstr", logging.Peer(conn.RemoteAddr().String()))
 		conn.Close()
 		return
 	}
 
-	if !bytes.Equal(hs[28:48], infoHash[:]) {
-		fmt.Println("Handshake entrante inválido: info_hash")
+	var infoHash [20]byte
+	copy(infoHash[:], hs[28:48])
+	// con MSE el torrent ya quedó fijado por SKEY: el handshake no puede
+	// cambiarlo por otro
+	if mseHash != nil && *mseHash != infoHash {
+		log.Debug("handshake entrante de un torrent distinto al negociado por MSE", logging.InfoHash(infoHash), logging.Peer(conn.RemoteAddr().String()))
+		conn.Close()
+		return
+	}
+	target, ok := route(infoHash)
+	if !ok {
+		log.Debug("handshake entrante de un torrent desconocido", logging.InfoHash(infoHash), logging.Peer(conn.RemoteAddr().String()))
 		conn.Close()
 		return
 	}
 
 	var pidBytes [20]byte
-	copy(pidBytes[:], []byte(peerId))
+	copy(pidBytes[:], []byte(target.PeerId))
 	pc := peerwire.NewPeerConnFromConn(conn, infoHash, pidBytes)
+	pc.SetRemoteReserved(hs[20:28])
 
 	if err := pc.SendHandshakeOnly(); err != nil {
-		fmt.Println("Error enviando handshake de respuesta:", err)
+		log.Debug("error enviando handshake de respuesta", logging.InfoHash(infoHash), logging.Peer(conn.RemoteAddr().String()), logging.Err(err))
 		conn.Close()
 		return
 	}
 
-	pc.BindManager(mgr)
-	_ = pc.SendBitfield(store.Bitfield())
+	pc.BindManager(target.Mgr)
+	_ = pc.SendExtendedHandshake()
+	_ = pc.SendBitfield(target.Store.Bitfield())
 
 	go pc.ReadLoop()
 
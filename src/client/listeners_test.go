@@ -0,0 +1,70 @@
+package client
+
+import (
+	"io"
+	"net"
+	"src/peerwire"
+	"testing"
+	"time"
+)
+
+// Una conexión MSE negociada para un torrent no puede hacer el handshake de
+// otro: se cierra sin llegar al router
+func TestIncomingMSEHandshakeMustMatchSKEY(t *testing.T) {
+	ihA := [20]byte{0xaa}
+	ihB := [20]byte{0xbb}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	routed := make(chan [20]byte, 2)
+	StartListeningRouted(ln, func(ih [20]byte) (IncomingTarget, bool) {
+		routed <- ih
+		return IncomingTarget{}, false
+	}, func() [][20]byte { return [][20]byte{ihA, ihB} })
+
+	for _, tc := range []struct {
+		name       string
+		handshake  [20]byte
+		wantRouted bool
+	}{
+		{"mismo torrent", ihA, true},
+		{"otro torrent", ihB, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := peerwire.DialPeer(ln.Addr().String(), ihA, 5*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if !peerwire.Encrypted(conn) {
+				t.Fatal("la conexión no negoció MSE")
+			}
+			hs := append([]byte{19}, "BitTorrent protocol"...)
+			hs = append(hs, make([]byte, 8)...)
+			hs = append(hs, tc.handshake[:]...)
+			hs = append(hs, "-JC0001-listenertest"...)
+			if _, err := conn.Write(hs); err != nil {
+				t.Fatal(err)
+			}
+
+			// en los dos casos el listener cierra la conexión (el router no
+			// acepta ningún torrent); sólo el primero pasa por el router
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, err := io.ReadAll(conn); err != nil {
+				t.Fatalf("la conexión no se cerró: %v", err)
+			}
+			select {
+			case ih := <-routed:
+				if !tc.wantRouted || ih != tc.handshake {
+					t.Fatalf("handshake de %x enrutado", ih)
+				}
+			default:
+				if tc.wantRouted {
+					t.Fatal("el handshake no llegó al router")
+				}
+			}
+		})
+	}
+}
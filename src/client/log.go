@@ -0,0 +1,12 @@
+package client
+
+import "src/logging"
+
+// Loggers del cliente por componente; se filtran con component=<nombre>
+var (
+	log         = logging.For("client")
+	announceLog = logging.For("announce") // announces, scrape y selección de trackers
+	sessionLog  = logging.For("session")
+	magnetLog   = logging.For("magnet")
+	httpLog     = logging.For("http")
+)
@@ -0,0 +1,197 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"src/bencode"
+	"src/logging"
+	"src/overlay"
+	"src/peerwire"
+	"strings"
+	"time"
+)
+
+// metadataFetchTimeout es el tiempo máximo para obtener el info dictionary de un peer
+const metadataFetchTimeout = 30 * time.Second
+
+// Magnet es un magnet link ya parseado (magnet:?xt=urn:btih:...)
+type Magnet struct {
+	InfoHash    [20]byte
+	DisplayName string   // dn
+	Trackers    []string // tr
+	Peers       []string // x.pe (host:port)
+	WebSeeds    []string // ws (BEP 19)
+}
+
+// IsMagnetURI indica si el argumento --torrent es un magnet link
+func IsMagnetURI(s string) bool {
+	return strings.HasPrefix(strings.ToLower(s), "magnet:?")
+}
+
+// ParseMagnet parsea un magnet link con info_hash en hex (40) o base32 (32)
+func ParseMagnet(uri string) (*Magnet, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("magnet link inválido: %w", err)
+	}
+	if u.Scheme != "magnet" {
+		return nil, errors.New("magnet link inválido: esquema distinto de magnet")
+	}
+	q, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("magnet link inválido: %w", err)
+	}
+
+	m := &Magnet{DisplayName: q.Get("dn"), Trackers: q["tr"], Peers: q["x.pe"], WebSeeds: q["ws"]}
+	found := false
+	for _, xt := range q["xt"] {
+		if !strings.HasPrefix(xt, "urn:btih:") {
+			continue
+		}
+		ih, err := decodeBtih(strings.TrimPrefix(xt, "urn:btih:"))
+		if err != nil {
+			return nil, err
+		}
+		m.InfoHash = ih
+		found = true
+		break
+	}
+	if !found {
+		return nil, errors.New("magnet link sin xt=urn:btih")
+	}
+	return m, nil
+}
+
+func decodeBtih(s string) ([20]byte, error) {
+	var ih [20]byte
+	var raw []byte
+	var err error
+	switch len(s) {
+	case 40:
+		raw, err = hex.DecodeString(s)
+	case 32:
+		raw, err = base32.StdEncoding.DecodeString(strings.ToUpper(s))
+	default:
+		return ih, fmt.Errorf("btih de longitud inválida: %d", len(s))
+	}
+	if err != nil || len(raw) != 20 {
+		return ih, fmt.Errorf("btih inválido: %s", s)
+	}
+	copy(ih[:], raw)
+	return ih, nil
+}
+
+// NewMagnetConfig crea la configuración de un torrent del que sólo se conoce
+// el info_hash. Los campos del info dictionary quedan vacíos hasta
+// FetchMagnetMetadata.
+func NewMagnetConfig(m *Magnet, archivesPath string) *ClientConfig {
+	name := filepath.Base(m.DisplayName)
+	if m.DisplayName == "" || name == "." || name == "/" {
+		name = hex.EncodeToString(m.InfoHash[:])
+	}
+
+	cfg := &ClientConfig{
+		TorrentPath:     "",
+		ArchivesDir:     prepareArchivesDir(archivesPath),
+		PeerId:          GeneratePeerId(),
+		InfoHash:        m.InfoHash,
+		InfoHashEncoded: encodeInfoHash(m.InfoHash),
+		AnnounceURLs:    m.Trackers,
+		FileName:        name,
+		WebSeeds:        m.WebSeeds,
+	}
+	if len(m.Trackers) > 0 {
+		cfg.AnnounceURL = m.Trackers[0]
+	}
+
+	magnetLog.Info("magnet link", logging.InfoHash(m.InfoHash), "name", name,
+		"trackers", len(m.Trackers), "peers", len(m.Peers))
+	return cfg
+}
+
+// SetInfoDict verifica raw contra el info_hash y completa la configuración
+// con el info dictionary obtenido de los peers.
+func (cfg *ClientConfig) SetInfoDict(raw []byte) error {
+	if sha1.Sum(raw) != cfg.InfoHash {
+		return errors.New("el info dictionary no coincide con el info_hash")
+	}
+	info, err := bencode.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("info dictionary inválido: %w", err)
+	}
+	return cfg.applyInfo(info, raw)
+}
+
+// FetchMagnetMetadata busca peers del torrent usando sólo el info_hash (peers
+// del magnet, overlay o tracker) y descarga de ellos el info dictionary por
+// ut_metadata. Al terminar cfg queda listo para SetupStorage.
+func FetchMagnetMetadata(cfg *ClientConfig, magnetPeers []string, ov *overlay.Overlay, bootstrap string,
+	providerAddr string, listenPort int, hostname string) error {
+
+	candidates := append([]string{}, magnetPeers...)
+
+	if ov != nil {
+		if err := ov.Discover(cfg.InfoHashEncoded, OverlayBootstrapPeers(bootstrap, providerAddr), 3); err != nil {
+			magnetLog.Warn("discovery en el overlay fallido", logging.InfoHash(cfg.InfoHash), logging.Err(err))
+		}
+		for _, p := range ParsePeersFromOthers(nil, ov, providerAddr, cfg) {
+			candidates = append(candidates, p.Addr)
+		}
+	} else if len(cfg.AnnounceURLs) > 0 {
+		// left se desconoce hasta tener la metadata; se anuncia 1 para no
+		// figurar como seeder en el tracker
+		resp, err := SendAnnounceWithFailover(cfg, listenPort, 0, 0, 1, "", hostname)
+		if err != nil {
+			magnetLog.Warn("announce para buscar peers fallido", logging.InfoHash(cfg.InfoHash), logging.Err(err))
+		}
+		for _, p := range ParsePeersFromOthers(resp, nil, providerAddr, cfg) {
+			candidates = append(candidates, p.Addr)
+		}
+	}
+
+	var peerIdBytes [20]byte
+	copy(peerIdBytes[:], []byte(cfg.PeerId))
+
+	seen := make(map[string]bool)
+	for _, addr := range candidates {
+		if addr == providerAddr || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		raw, err := peerwire.FetchMetadata(addr, cfg.InfoHash, peerIdBytes, metadataFetchTimeout)
+		if err != nil {
+			magnetLog.Info("no se obtuvo la metadata", logging.InfoHash(cfg.InfoHash), logging.Peer(addr), logging.Err(err))
+			continue
+		}
+		if err := cfg.SetInfoDict(raw); err != nil {
+			magnetLog.Warn("metadata inválida", logging.InfoHash(cfg.InfoHash), logging.Peer(addr), logging.Err(err))
+			continue
+		}
+		magnetLog.Info("metadata obtenida", logging.InfoHash(cfg.InfoHash), logging.Peer(addr), "size", len(raw),
+			"name", cfg.FileName, "bytes", cfg.FileLength, "pieces", len(cfg.ExpectedHashes))
+		return nil
+	}
+	return fmt.Errorf("ningún peer entregó la metadata (%d candidatos)", len(seen))
+}
+
+// OverlayBootstrapPeers devuelve los nodos de bootstrap del overlay excluyendo
+// nuestra propia dirección
+func OverlayBootstrapPeers(bootstrap, providerAddr string) []string {
+	initialPeers := []string{}
+	if bootstrap != "" {
+		for _, p := range strings.Split(bootstrap, ",") {
+			p = strings.TrimSpace(p)
+			if p != "" && p != providerAddr {
+				initialPeers = append(initialPeers, p)
+			}
+		}
+	}
+	return initialPeers
+}
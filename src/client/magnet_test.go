@@ -0,0 +1,77 @@
+package client
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseMagnet(t *testing.T) {
+	const ihHex = "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+	want, _ := hex.DecodeString(ihHex)
+
+	for _, uri := range []string{
+		"magnet:?xt=urn:btih:" + ihHex + "&dn=a%20b.iso&tr=http%3A%2F%2Ft1%2Fannounce&tr=http%3A%2F%2Ft2%2Fannounce&x.pe=10.0.0.1%3A6881&ws=http%3A%2F%2Fws%2F",
+		"magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK&dn=a%20b.iso&tr=http%3A%2F%2Ft1%2Fannounce&tr=http%3A%2F%2Ft2%2Fannounce&x.pe=10.0.0.1%3A6881&ws=http%3A%2F%2Fws%2F",
+	} {
+		m, err := ParseMagnet(uri)
+		if err != nil {
+			t.Fatalf("%s: %v", uri, err)
+		}
+		if string(m.InfoHash[:]) != string(want) {
+			t.Errorf("info_hash %x, se esperaba %s", m.InfoHash, ihHex)
+		}
+		if m.DisplayName != "a b.iso" || len(m.Trackers) != 2 || m.Trackers[1] != "http://t2/announce" {
+			t.Errorf("dn/tr mal parseados: %+v", m)
+		}
+		if len(m.Peers) != 1 || m.Peers[0] != "10.0.0.1:6881" || len(m.WebSeeds) != 1 {
+			t.Errorf("x.pe/ws mal parseados: %+v", m)
+		}
+	}
+}
+
+func TestParseMagnetInvalid(t *testing.T) {
+	for _, uri := range []string{
+		"http://example.com/?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+		"magnet:?dn=sin-xt",
+		"magnet:?xt=urn:btih:c12fe1",
+		"magnet:?xt=urn:btih:zz2fe1c06bba254a9dc9f519b335aa7c1367a88a",
+	} {
+		if _, err := ParseMagnet(uri); err == nil {
+			t.Errorf("ParseMagnet(%q) no devolvió error", uri)
+		}
+	}
+}
+
+func TestCompactPeerAddrs(t *testing.T) {
+	raw := string([]byte{127, 0, 0, 1, 0x1a, 0xe1, 10, 0, 0, 2, 0, 80, 1, 2}) // el último está truncado
+	got := compactPeerAddrs(raw, 4)
+	if len(got) != 2 || got[0] != "127.0.0.1:6881" || got[1] != "10.0.0.2:80" {
+		t.Fatalf("compactPeerAddrs = %v", got)
+	}
+}
+
+func TestSplitTorrentList(t *testing.T) {
+	const m1 = "magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a&dn=Otro,v2.iso"
+	const m2 = "magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK&dn=a,b,c"
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{"a.torrent,b.torrent", []string{"a.torrent", "b.torrent"}},
+		{" a.torrent , ,b.torrent ", []string{"a.torrent", "b.torrent"}},
+		{m1, []string{m1}},
+		{m1 + "," + m2, []string{m1, m2}},
+		{m2 + ",x/y.torrent," + m1, []string{m2, "x/y.torrent", m1}},
+		{"", nil},
+	} {
+		got := SplitTorrentList(tc.in)
+		if len(got) != len(tc.want) {
+			t.Fatalf("%q: %q, se esperaba %q", tc.in, got, tc.want)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Fatalf("%q: %q, se esperaba %q", tc.in, got, tc.want)
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"fmt"
+	"src/logging"
 	"src/overlay"
 	"strings"
 )
@@ -23,10 +24,10 @@ func SetupOverlay(discoveryMode string, bootstrap string, overlayPort int) *over
 		listenAddr := fmt.Sprintf(":%d", overlayPort)
 		ov = overlay.NewOverlay(listenAddr, peers)
 		if err := ov.Start(); err != nil {
-			fmt.Println("No se pudo iniciar overlay:", err)
+			log.Error("no se pudo iniciar el overlay", "addr", listenAddr, logging.Err(err))
 			ov = nil
 		} else {
-			fmt.Println("Overlay gossip iniciado en", listenAddr)
+			log.Info("overlay iniciado", "addr", listenAddr)
 		}
 	}
 
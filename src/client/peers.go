@@ -2,8 +2,10 @@ package client
 
 import (
 	"encoding/binary"
-	"fmt"
+	"net"
+	"src/logging"
 	"src/overlay"
+	"strconv"
 	"time"
 )
 
@@ -19,31 +21,28 @@ func ParsePeersFromOthers(trackerResponse map[string]interface{}, ov *overlay.Ov
 
 		provs := ov.Lookup(cfg.InfoHashEncoded, 50)
 
-		fmt.Printf("Overlay providers returned: %d\n", len(provs))
+		announceLog.Debug("providers del overlay", logging.InfoHash(cfg.InfoHash), "providers", len(provs))
 
 		for _, p := range provs {
-			fmt.Printf("  provider:%s left=%d lastseen=%d\n", p.Addr, p.Left, p.LastSeen)
+			announceLog.Debug("provider del overlay", logging.InfoHash(cfg.InfoHash), logging.Peer(p.Addr), "left", p.Left, "last_seen", p.LastSeen)
 
 			if p.Addr == providerAddr {
 				continue
 			}
 
 			peerAddrs = append(peerAddrs, p.Addr)
+			if p.Addr6 != "" {
+				peerAddrs = append(peerAddrs, p.Addr6)
+			}
 
 		}
 		if len(peerAddrs) == 0 {
-			fmt.Println("[WARN] No remote providers found via overlay (only self or none).")
+			announceLog.Warn("el overlay no devolvió providers remotos", logging.InfoHash(cfg.InfoHash))
 		}
 	} else {
 		if peersRaw, ok := trackerResponse["peers"].(string); ok {
 			// Formato compact: 6 bytes por peer (4 IP + 2 puerto)
-			data := []byte(peersRaw)
-			for i := 0; i < len(data); i += 6 {
-				ip := fmt.Sprintf("%d.%d.%d.%d", data[i], data[i+1], data[i+2], data[i+3])
-				port := binary.BigEndian.Uint16(data[i+4 : i+6])
-				addr := fmt.Sprintf("%s:%d", ip, port)
-				peerAddrs = append(peerAddrs, addr)
-			}
+			peerAddrs = append(peerAddrs, compactPeerAddrs(peersRaw, net.IPv4len)...)
 		} else if peersList, ok := trackerResponse["peers"].([]interface{}); ok {
 			// Formato non-compact: lista de diccionarios {"ip": "hostname", "port": 12345}
 			for _, peerRaw := range peersList {
@@ -59,12 +58,16 @@ func ParsePeersFromOthers(trackerResponse map[string]interface{}, ov *overlay.Ov
 					}
 
 					if ip != "" && port > 0 {
-						addr := fmt.Sprintf("%s:%d", ip, port)
+						addr := net.JoinHostPort(ip, strconv.FormatInt(port, 10))
 						peerAddrs = append(peerAddrs, addr)
 					}
 				}
 			}
 		}
+		// peers6 (BEP 7): 18 bytes por peer (16 IP + 2 puerto)
+		if peers6, ok := trackerResponse["peers6"].(string); ok {
+			peerAddrs = append(peerAddrs, compactPeerAddrs(peers6, net.IPv6len)...)
+		}
 	}
 
 	peers := make([]PeerInfo, len(peerAddrs))
@@ -79,13 +82,7 @@ func ParsePeersFromTracker(trackerResponse map[string]interface{}) []PeerInfo {
 
 	if peersRaw, ok := trackerResponse["peers"].(string); ok {
 		// Formato compact: 6 bytes por peer (4 IP + 2 puerto)
-		data := []byte(peersRaw)
-		for i := 0; i < len(data); i += 6 {
-			ip := fmt.Sprintf("%d.%d.%d.%d", data[i], data[i+1], data[i+2], data[i+3])
-			port := binary.BigEndian.Uint16(data[i+4 : i+6])
-			addr := fmt.Sprintf("%s:%d", ip, port)
-			peerAddrs = append(peerAddrs, addr)
-		}
+		peerAddrs = append(peerAddrs, compactPeerAddrs(peersRaw, net.IPv4len)...)
 	} else if peersList, ok := trackerResponse["peers"].([]interface{}); ok {
 		for _, peerRaw := range peersList {
 			if peerDict, ok := peerRaw.(map[string]interface{}); ok {
@@ -100,12 +97,16 @@ func ParsePeersFromTracker(trackerResponse map[string]interface{}) []PeerInfo {
 				}
 
 				if ip != "" && port > 0 {
-					addr := fmt.Sprintf("%s:%d", ip, port)
+					addr := net.JoinHostPort(ip, strconv.FormatInt(port, 10))
 					peerAddrs = append(peerAddrs, addr)
 				}
 			}
 		}
 	}
+	// peers6 (BEP 7): 18 bytes por peer (16 IP + 2 puerto)
+	if peers6, ok := trackerResponse["peers6"].(string); ok {
+		peerAddrs = append(peerAddrs, compactPeerAddrs(peers6, net.IPv6len)...)
+	}
 
 	peers := make([]PeerInfo, len(peerAddrs))
 	for i, addr := range peerAddrs {
@@ -113,3 +114,16 @@ func ParsePeersFromTracker(trackerResponse map[string]interface{}) []PeerInfo {
 	}
 	return peers
 }
+
+// compactPeerAddrs decodifica una lista compacta de peers: ipLen bytes de IP
+// (4 en "peers", 16 en "peers6") seguidos de 2 bytes de puerto
+func compactPeerAddrs(raw string, ipLen int) []string {
+	var out []string
+	data := []byte(raw)
+	for i := 0; i+ipLen+2 <= len(data); i += ipLen + 2 {
+		ip := net.IP(data[i : i+ipLen])
+		port := binary.BigEndian.Uint16(data[i+ipLen : i+ipLen+2])
+		out = append(out, net.JoinHostPort(ip.String(), strconv.Itoa(int(port))))
+	}
+	return out
+}
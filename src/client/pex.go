@@ -0,0 +1,100 @@
+package client
+
+import (
+	"net"
+	"src/logging"
+	"src/peerwire"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// una dirección recibida por PEX no se vuelve a intentar antes de este tiempo
+	pexRetryCooldown = 5 * time.Minute
+	// máximo de conexiones nuevas por cada mensaje PEX recibido
+	pexMaxDialsPerBatch = 10
+	// con esta cantidad de peers conectados se ignoran las direcciones de PEX
+	pexMaxConnectedPeers = 50
+)
+
+// pexDialer filtra las direcciones recibidas por PEX antes de conectarse:
+// descarta las propias, las ya conectadas (Manager.HasPeerAddr) y las
+// intentadas hace poco, y limita cuántas se abren por mensaje.
+type pexDialer struct {
+	mu        sync.Mutex
+	attempted map[string]time.Time
+}
+
+// StartPex activa Peer Exchange en el manager y conecta a los peers que
+// anuncien los demás clientes usando ConnectToPeers.
+func StartPex(mgr *peerwire.Manager, store *peerwire.DiskPieceStore, infoHash [20]byte, peerId string, listenPort int) error {
+	d := &pexDialer{attempted: make(map[string]time.Time)}
+	return mgr.EnablePex(listenPort, func(addrs []string) {
+		peers := d.filter(addrs, mgr, listenPort)
+		if len(peers) == 0 {
+			return
+		}
+		log.Info("conectando a peers recibidos por PEX", logging.InfoHash(infoHash), "peers", len(peers))
+		go ConnectToPeers(peers, infoHash, peerId, store, mgr)
+	})
+}
+
+func (d *pexDialer) filter(addrs []string, mgr *peerwire.Manager, listenPort int) []PeerInfo {
+	if mgr.GetPeerCount() >= pexMaxConnectedPeers {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for addr, at := range d.attempted {
+		if now.Sub(at) > pexRetryCooldown {
+			delete(d.attempted, addr)
+		}
+	}
+
+	var out []PeerInfo
+	for _, addr := range addrs {
+		if len(out) >= pexMaxDialsPerBatch {
+			break
+		}
+		if _, recent := d.attempted[addr]; recent {
+			continue
+		}
+		if isOwnAddr(addr, listenPort) || mgr.HasPeerAddr(addr) {
+			continue
+		}
+		d.attempted[addr] = now
+		out = append(out, PeerInfo{Addr: addr})
+	}
+	return out
+}
+
+// isOwnAddr indica si addr apunta a nuestro propio listener
+func isOwnAddr(addr string, listenPort int) bool {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if port, err := strconv.Atoi(portStr); err != nil || port != listenPort {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	ifAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range ifAddrs {
+		if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"src/peerwire"
+	"strconv"
+)
+
+// FilePriorityStatus es un archivo del torrent con su prioridad
+type FilePriorityStatus struct {
+	Index      int    `json:"index"`
+	Path       string `json:"path"`
+	Length     int64  `json:"length"`
+	Priority   string `json:"priority"`
+	FirstPiece int    `json:"first_piece"`
+	LastPiece  int    `json:"last_piece"`
+}
+
+// PieceRangePriority es un rango de piezas [first, last] con prioridad propia
+type PieceRangePriority struct {
+	First    int    `json:"first"`
+	Last     int    `json:"last"`
+	Priority string `json:"priority"` // skip|low|normal|high, o "default" para volver a la del archivo
+}
+
+// PrioritiesResponse es la respuesta de GET /priorities
+type PrioritiesResponse struct {
+	Files  []FilePriorityStatus `json:"files"`
+	Pieces []PieceRangePriority `json:"pieces"` // sólo los rangos con override
+	Left   int64                `json:"left"`   // bytes que faltan de lo que queremos
+}
+
+// PrioritiesRequest es el body de POST /priorities: files mapea índice o ruta
+// relativa a prioridad, p.ej. {"files": {"0": "skip", "video/a.mkv": "high"}}
+type PrioritiesRequest struct {
+	Files  map[string]string    `json:"files"`
+	Pieces []PieceRangePriority `json:"pieces"`
+}
+
+// contentFiles devuelve la lista de archivos del torrent; un torrent de un
+// solo archivo es una lista de uno
+func contentFiles(name string, files []peerwire.FileEntry, length int64) []peerwire.FileEntry {
+	if len(files) > 0 {
+		return files
+	}
+	return []peerwire.FileEntry{{Path: []string{name}, Length: length}}
+}
+
+// fileIndex ubica un archivo por índice en info["files"] o por ruta relativa
+func fileIndex(files []peerwire.FileEntry, sel string) (int, error) {
+	if n, err := strconv.Atoi(sel); err == nil && n >= 0 && n < len(files) {
+		return n, nil
+	}
+	for i, fe := range files {
+		if path.Join(fe.Path...) == sel {
+			return i, nil
+		}
+	}
+	return -1, errors.New("archivo no encontrado en el torrent")
+}
+
+func currentPriorities(store *peerwire.DiskPieceStore, files []peerwire.FileEntry) PrioritiesResponse {
+	filePrio, override := store.PriorityState()
+	resp := PrioritiesResponse{Files: []FilePriorityStatus{}, Pieces: []PieceRangePriority{}, Left: store.WantedLeft()}
+	for i, fe := range files {
+		first, last := store.FilePieces(i)
+		resp.Files = append(resp.Files, FilePriorityStatus{
+			Index:      i,
+			Path:       path.Join(fe.Path...),
+			Length:     fe.Length,
+			Priority:   filePrio[i].String(),
+			FirstPiece: first,
+			LastPiece:  last,
+		})
+	}
+	// overrides consecutivos iguales se agrupan en un rango
+	for i := 0; i < len(override); i++ {
+		if override[i] < 0 {
+			continue
+		}
+		j := i
+		for j+1 < len(override) && override[j+1] == override[i] {
+			j++
+		}
+		resp.Pieces = append(resp.Pieces, PieceRangePriority{First: i, Last: j, Priority: override[i].String()})
+		i = j
+	}
+	return resp
+}
+
+// applyPriorities valida y aplica un PrioritiesRequest. Si algo es inválido
+// no se cambia nada.
+func applyPriorities(store *peerwire.DiskPieceStore, files []peerwire.FileEntry, req PrioritiesRequest) error {
+	type fileChange struct {
+		idx  int
+		prio peerwire.Priority
+	}
+	var fileChanges []fileChange
+	for sel, p := range req.Files {
+		idx, err := fileIndex(files, sel)
+		if err != nil {
+			return fmt.Errorf("%s: %w", sel, err)
+		}
+		prio, err := peerwire.ParsePriority(p)
+		if err != nil {
+			return err
+		}
+		fileChanges = append(fileChanges, fileChange{idx, prio})
+	}
+	for _, pr := range req.Pieces {
+		if pr.First < 0 || pr.Last >= store.NumPieces() || pr.First > pr.Last {
+			return fmt.Errorf("rango de piezas inválido [%d, %d]", pr.First, pr.Last)
+		}
+		if pr.Priority != "default" {
+			if _, err := peerwire.ParsePriority(pr.Priority); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, fc := range fileChanges {
+		if err := store.SetFilePriority(fc.idx, fc.prio); err != nil {
+			return err
+		}
+		httpLog.Info("prioridad de archivo", "file", path.Join(files[fc.idx].Path...), "priority", fc.prio.String())
+	}
+	for _, pr := range req.Pieces {
+		var err error
+		if pr.Priority == "default" {
+			err = store.ResetPiecePriority(pr.First, pr.Last)
+		} else {
+			prio, _ := peerwire.ParsePriority(pr.Priority)
+			err = store.SetPiecePriority(pr.First, pr.Last, prio)
+		}
+		if err != nil {
+			return err
+		}
+		httpLog.Info("prioridad de piezas", "first", pr.First, "last", pr.Last, "priority", pr.Priority)
+	}
+	return nil
+}
+
+// servePriorities atiende GET (prioridades actuales) y POST/PUT (cambios)
+// de prioridades de un torrent
+func servePriorities(w http.ResponseWriter, r *http.Request, store *peerwire.DiskPieceStore,
+	mgr *peerwire.Manager, files []peerwire.FileEntry) {
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, currentPriorities(store, files))
+
+	case http.MethodPost, http.MethodPut:
+		var req PrioritiesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "JSON inválido"})
+			return
+		}
+		if err := applyPriorities(store, files, req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		mgr.PrioritiesChanged()
+		writeJSON(w, http.StatusOK, currentPriorities(store, files))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePriorities atiende /priorities del torrent de este cliente
+func (hs *HTTPServer) handlePriorities(w http.ResponseWriter, r *http.Request) {
+	hs.mu.RLock()
+	name := hs.contentName
+	if name == "" {
+		name = hs.torrentName
+	}
+	files := contentFiles(name, hs.files, hs.fileLength)
+	hs.mu.RUnlock()
+	servePriorities(w, r, hs.store, hs.manager, files)
+}
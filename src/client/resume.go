@@ -0,0 +1,198 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"src/bencode"
+	"src/logging"
+	"src/peerwire"
+	"time"
+)
+
+// cada cuánto se reescribe el archivo .resume mientras el cliente corre
+const resumeSaveInterval = 30 * time.Second
+
+// resumeData es el contenido del sidecar <archivo>.resume (bencodeado): el
+// bitfield y los contadores de la última sesión, más el tamaño y mtime de cada
+// archivo de datos para saber si el bitfield sigue siendo confiable, y las
+// prioridades elegidas (por archivo y overrides por pieza, -1 = ninguno).
+type resumeData struct {
+	InfoHash      [20]byte
+	Bitfield      []byte
+	Uploaded      int64
+	Downloaded    int64
+	Files         []resumeFile
+	FilePriority  []peerwire.Priority
+	PiecePriority []peerwire.Priority
+}
+
+type resumeFile struct {
+	Length int64
+	Mtime  int64 // UnixNano
+}
+
+// ResumePath devuelve la ruta del sidecar .resume del torrent
+func (cfg *ClientConfig) ResumePath() string {
+	_, finalPath := cfg.GetStoragePaths()
+	return finalPath + ".resume"
+}
+
+// dataFiles devuelve las rutas de los archivos de datos bajo root, en el orden del torrent
+func (cfg *ClientConfig) dataFiles(root string) []string {
+	if !cfg.IsMultiFile() {
+		return []string{root}
+	}
+	paths := make([]string, len(cfg.Files))
+	for i, fe := range cfg.Files {
+		paths[i] = filepath.Join(root, fe.RelPath())
+	}
+	return paths
+}
+
+// statFiles toma tamaño y mtime de los archivos de datos bajo root
+func (cfg *ClientConfig) statFiles(root string) ([]resumeFile, error) {
+	var files []resumeFile
+	for _, path := range cfg.dataFiles(root) {
+		st, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, resumeFile{Length: st.Size(), Mtime: st.ModTime().UnixNano()})
+	}
+	return files, nil
+}
+
+// SaveResume escribe el .resume con el estado actual de store y mgr
+func SaveResume(cfg *ClientConfig, store *peerwire.DiskPieceStore, mgr *peerwire.Manager) error {
+	tempPath, finalPath := cfg.GetStoragePaths()
+	root := tempPath
+	if cfg.layoutMatches(finalPath) {
+		root = finalPath
+	}
+
+	// el bitfield se toma antes que los mtimes: cualquier escritura posterior
+	// cambia el mtime y fuerza la verificación completa al arrancar
+	bf := store.Bitfield()
+	uploaded, downloaded := mgr.TransferTotals()
+	filePrio, piecePrio := store.PriorityState()
+	files, err := cfg.statFiles(root)
+	if err != nil {
+		return err
+	}
+
+	list := make([]interface{}, len(files))
+	for i, f := range files {
+		list[i] = map[string]interface{}{"length": f.Length, "mtime": f.Mtime}
+	}
+	data := bencode.Encode(map[string]interface{}{
+		"info_hash":      string(cfg.InfoHash[:]),
+		"bitfield":       string(bf),
+		"uploaded":       uploaded,
+		"downloaded":     downloaded,
+		"files":          list,
+		"file_priority":  priorityList(filePrio),
+		"piece_priority": priorityList(piecePrio),
+	})
+
+	// escritura atómica: archivo temporal + rename
+	path := cfg.ResumePath()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadResume lee el .resume del torrent y comprueba que sea del mismo info_hash
+func loadResume(cfg *ClientConfig) (*resumeData, error) {
+	raw, err := os.ReadFile(cfg.ResumePath())
+	if err != nil {
+		return nil, err
+	}
+	d, err := bencode.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("resume corrupto: %w", err)
+	}
+
+	rd := &resumeData{}
+	ih, _ := d["info_hash"].(string)
+	if len(ih) != 20 {
+		return nil, errors.New("resume sin info_hash")
+	}
+	copy(rd.InfoHash[:], ih)
+	if rd.InfoHash != cfg.InfoHash {
+		return nil, errors.New("resume de otro torrent")
+	}
+	bf, _ := d["bitfield"].(string)
+	rd.Bitfield = []byte(bf)
+	rd.Uploaded, _ = d["uploaded"].(int64)
+	rd.Downloaded, _ = d["downloaded"].(int64)
+	list, _ := d["files"].([]interface{})
+	for _, item := range list {
+		f, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("resume con lista de archivos inválida")
+		}
+		length, _ := f["length"].(int64)
+		mtime, _ := f["mtime"].(int64)
+		rd.Files = append(rd.Files, resumeFile{Length: length, Mtime: mtime})
+	}
+	rd.FilePriority = parsePriorityList(d["file_priority"])
+	rd.PiecePriority = parsePriorityList(d["piece_priority"])
+	return rd, nil
+}
+
+func priorityList(prio []peerwire.Priority) []interface{} {
+	out := make([]interface{}, len(prio))
+	for i, p := range prio {
+		out[i] = int64(p)
+	}
+	return out
+}
+
+func parsePriorityList(v interface{}) []peerwire.Priority {
+	list, _ := v.([]interface{})
+	out := make([]peerwire.Priority, 0, len(list))
+	for _, item := range list {
+		p, _ := item.(int64)
+		out = append(out, peerwire.Priority(p))
+	}
+	return out
+}
+
+// filesUnchanged indica si los archivos bajo root tienen el mismo tamaño y
+// mtime que cuando se guardó el resume
+func (rd *resumeData) filesUnchanged(cfg *ClientConfig, root string) bool {
+	current, err := cfg.statFiles(root)
+	if err != nil || len(current) != len(rd.Files) {
+		return false
+	}
+	for i := range current {
+		if current[i] != rd.Files[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// StartResumeRoutine guarda el .resume cada resumeSaveInterval hasta el shutdown
+func StartResumeRoutine(cfg *ClientConfig, store *peerwire.DiskPieceStore, mgr *peerwire.Manager, shutdownChan <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(resumeSaveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := SaveResume(cfg, store, mgr); err != nil {
+					log.Warn("no se pudo guardar el resume", logging.InfoHash(cfg.InfoHash), logging.Err(err))
+				}
+			case <-shutdownChan:
+				return
+			}
+		}
+	}()
+}
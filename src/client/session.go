@@ -0,0 +1,342 @@
+package client
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"src/dht"
+	"src/logging"
+	"src/peerwire"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Session aloja varios torrents en un mismo proceso: comparten el puerto de
+// escucha (las conexiones entrantes se reparten por info_hash) y, en modo
+// DHT, el nodo de la DHT. Cada torrent tiene su propio storage y Manager.
+type Session struct {
+	mu       sync.RWMutex
+	torrents map[[20]byte]*Torrent
+
+	ln         net.Listener
+	listenPort int
+	hostname   string
+	archives   string // directorio por defecto de los torrents agregados
+	opts       *ClientOptions
+	dht        *dht.DHT // nil en modo tracker
+}
+
+// Torrent es un torrent activo dentro de una Session
+type Torrent struct {
+	Cfg     *ClientConfig
+	Store   *peerwire.DiskPieceStore
+	Manager *peerwire.Manager
+	Name    string
+
+	session     *Session
+	stopCh      chan struct{}
+	completedCh chan struct{}
+	completedMu sync.Mutex
+	computeLeft ComputeLeftFunc
+}
+
+// TorrentStatus resume el estado de un torrent de la sesión
+type TorrentStatus struct {
+	InfoHash       string  `json:"info_hash"`
+	Name           string  `json:"name"`
+	State          string  `json:"state"` // "downloading", "seeding", "paused"
+	Paused         bool    `json:"paused"`
+	Progress       float64 `json:"progress"` // Porcentaje 0-100
+	TotalSize      int64   `json:"total_size"`
+	Left           int64   `json:"left"`
+	Uploaded       int64   `json:"uploaded"`
+	Downloaded     int64   `json:"downloaded"`
+	ConnectedPeers int     `json:"connected_peers"`
+	WebSeeds       int     `json:"web_seeds"` // web seeds activos (fuentes además de los peers)
+}
+
+// NewSession crea una sesión que escucha peers en ln. dhtNode es nil salvo en
+// --discovery-mode=dht.
+func NewSession(ln net.Listener, hostname, archives string, opts *ClientOptions, dhtNode *dht.DHT) *Session {
+	return &Session{
+		torrents:   make(map[[20]byte]*Torrent),
+		ln:         ln,
+		listenPort: ln.Addr().(*net.TCPAddr).Port,
+		hostname:   hostname,
+		archives:   archives,
+		opts:       opts,
+		dht:        dhtNode,
+	}
+}
+
+// Start empieza a aceptar conexiones entrantes para todos los torrents
+func (s *Session) Start() {
+	StartListeningRouted(s.ln, s.route, s.infoHashes)
+}
+
+func (s *Session) infoHashes() [][20]byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([][20]byte, 0, len(s.torrents))
+	for ih := range s.torrents {
+		out = append(out, ih)
+	}
+	return out
+}
+
+func (s *Session) route(infoHash [20]byte) (IncomingTarget, bool) {
+	s.mu.RLock()
+	t, ok := s.torrents[infoHash]
+	s.mu.RUnlock()
+	if !ok {
+		return IncomingTarget{}, false
+	}
+	return IncomingTarget{PeerId: t.Cfg.PeerId, Store: t.Store, Mgr: t.Manager}, true
+}
+
+// ListenPort devuelve el puerto TCP compartido por todos los torrents
+func (s *Session) ListenPort() int { return s.listenPort }
+
+// AddTorrent agrega un .torrent o magnet link a la sesión y arranca su
+// descarga. archives vacío usa el directorio por defecto de la sesión.
+func (s *Session) AddTorrent(source, archives string) (*Torrent, error) {
+	if archives == "" {
+		archives = s.archives
+	}
+
+	var cfg *ClientConfig
+	if IsMagnetURI(source) {
+		m, err := ParseMagnet(source)
+		if err != nil {
+			return nil, err
+		}
+		if s.get(m.InfoHash) != nil {
+			return nil, fmt.Errorf("el torrent %x ya está en la sesión", m.InfoHash)
+		}
+		cfg = NewMagnetConfig(m, archives)
+		peers := m.Peers
+		if s.dht != nil {
+			if found, err := s.dht.GetPeers(cfg.InfoHash); err == nil {
+				peers = append(peers, found...)
+			}
+		}
+		providerAddr := net.JoinHostPort(s.hostname, strconv.Itoa(s.listenPort))
+		if err := FetchMagnetMetadata(cfg, peers, nil, "", providerAddr, s.listenPort, s.hostname); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if cfg, err = ParseTorrentFile(source, archives); err != nil {
+			return nil, err
+		}
+		// antes de abrir el storage: reabrirlo re-verificaría todas las piezas
+		// y podría truncar el archivo temporal del torrent activo
+		if s.get(cfg.InfoHash) != nil {
+			return nil, fmt.Errorf("el torrent %x ya está en la sesión", cfg.InfoHash)
+		}
+	}
+
+	store, mgr, useFinal, err := OpenStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+	mgr.SetMetadata(cfg.InfoBytes)
+	mgr.SetPipeline(s.opts.PipelineDepth, s.opts.PipelineAdaptive, s.opts.RequestTimeout)
+	mgr.SetUploadSlots(s.opts.UploadSlots)
+
+	t := &Torrent{
+		Cfg:         cfg,
+		Store:       store,
+		Manager:     mgr,
+		Name:        cfg.FileName,
+		session:     s,
+		stopCh:      make(chan struct{}),
+		completedCh: make(chan struct{}),
+		computeLeft: CreateComputeLeftFunc(store, cfg.FileLength),
+	}
+
+	s.mu.Lock()
+	if _, dup := s.torrents[cfg.InfoHash]; dup {
+		s.mu.Unlock()
+		mgr.Close()
+		store.Close()
+		return nil, fmt.Errorf("el torrent %x ya está en la sesión", cfg.InfoHash)
+	}
+	s.torrents[cfg.InfoHash] = t
+	s.mu.Unlock()
+
+	if s.opts.Pex && !cfg.Private {
+		if err := StartPex(mgr, store, cfg.InfoHash, cfg.PeerId, s.listenPort); err != nil {
+			sessionLog.Warn("no se pudo activar PEX", logging.InfoHash(cfg.InfoHash), "name", t.Name, logging.Err(err))
+		}
+	}
+	if s.opts.WebSeeds {
+		StartWebSeeds(cfg, mgr)
+	}
+	SetupPieceCompletionHandler(store, cfg, useFinal, t.completedCh, &t.completedMu, false)
+	StartResumeRoutine(cfg, store, mgr, t.stopCh)
+	go t.run()
+
+	sessionLog.Info("torrent agregado", logging.InfoHash(cfg.InfoHash), "name", t.Name)
+	return t, nil
+}
+
+// run hace el announce inicial, conecta a los peers y mantiene los announces
+// periódicos hasta que el torrent se quite de la sesión.
+func (t *Torrent) run() {
+	s, cfg := t.session, t.Cfg
+
+	if s.dht != nil {
+		ConnectToPeers(AnnounceAndGetPeersDHT(s.dht, cfg, s.listenPort), cfg.InfoHash, cfg.PeerId, t.Store, t.Manager)
+		StartPeriodicAnnounceRoutineDHT(s.dht, cfg, s.listenPort, t.stopCh, 60*time.Second, t.Store, t.Manager)
+		return
+	}
+
+	interval := 60 * time.Second
+	resp, err := SendAnnounceWithFailover(cfg, s.listenPort, 0, 0, t.computeLeft(), "started", s.hostname)
+	if err != nil {
+		sessionLog.Warn("announce inicial fallido", logging.InfoHash(cfg.InfoHash), "name", t.Name, logging.Err(err))
+	} else {
+		if intervalRaw, ok := resp["interval"].(int64); ok && intervalRaw > 0 {
+			interval = time.Duration(intervalRaw) * time.Second
+		}
+		ConnectToPeers(ParsePeersFromTracker(resp), cfg.InfoHash, cfg.PeerId, t.Store, t.Manager)
+	}
+	StartPeriodicAnnounceRoutine(cfg, s.listenPort, s.hostname, t.computeLeft, t.stopCh, interval,
+		cfg.InfoHash, cfg.PeerId, t.Store, t.Manager)
+
+	select {
+	case <-t.completedCh:
+		uploaded, downloaded := t.Manager.TransferTotals()
+		if _, err := SendAnnounceWithFailover(cfg, s.listenPort, uploaded, downloaded, 0, "completed", s.hostname); err != nil {
+			sessionLog.Warn("no se pudo enviar completed", logging.InfoHash(cfg.InfoHash), "name", t.Name, logging.Err(err))
+		}
+	case <-t.stopCh:
+	}
+}
+
+// RemoveTorrent detiene un torrent, guarda su resume y lo quita de la sesión.
+// Los archivos descargados quedan en disco.
+func (s *Session) RemoveTorrent(infoHash [20]byte) error {
+	s.mu.Lock()
+	t, ok := s.torrents[infoHash]
+	delete(s.torrents, infoHash)
+	s.mu.Unlock()
+	if !ok {
+		return errors.New("torrent no encontrado")
+	}
+
+	// cerrar los peers antes de guardar el resume: una escritura posterior
+	// cambiaría el mtime y forzaría la verificación completa
+	close(t.stopCh)
+	t.Manager.Close()
+	if err := SaveResume(t.Cfg, t.Store, t.Manager); err != nil {
+		sessionLog.Warn("no se pudo guardar el resume", logging.InfoHash(infoHash), "name", t.Name, logging.Err(err))
+	}
+	if s.dht == nil {
+		left := t.computeLeft()
+		uploaded, downloaded := t.Manager.TransferTotals()
+		if _, err := SendAnnounceWithFailover(t.Cfg, s.listenPort, uploaded, downloaded, left, "stopped", s.hostname); err != nil {
+			sessionLog.Warn("no se pudo enviar stopped", logging.InfoHash(infoHash), "name", t.Name, logging.Err(err))
+		}
+	}
+	if err := t.Store.Close(); err != nil {
+		sessionLog.Warn("error cerrando el storage", logging.InfoHash(infoHash), "name", t.Name, logging.Err(err))
+	}
+	sessionLog.Info("torrent quitado", logging.InfoHash(infoHash), "name", t.Name)
+	return nil
+}
+
+// PauseTorrent deja de pedir bloques para el torrent (sigue subiendo)
+func (s *Session) PauseTorrent(infoHash [20]byte) error {
+	t := s.get(infoHash)
+	if t == nil {
+		return errors.New("torrent no encontrado")
+	}
+	t.Manager.SetPaused(true)
+	sessionLog.Info("torrent pausado", logging.InfoHash(t.Cfg.InfoHash), "name", t.Name)
+	return nil
+}
+
+// ResumeTorrent reanuda la descarga de un torrent pausado
+func (s *Session) ResumeTorrent(infoHash [20]byte) error {
+	t := s.get(infoHash)
+	if t == nil {
+		return errors.New("torrent no encontrado")
+	}
+	t.Manager.SetPaused(false)
+	sessionLog.Info("torrent reanudado", logging.InfoHash(t.Cfg.InfoHash), "name", t.Name)
+	return nil
+}
+
+func (s *Session) get(infoHash [20]byte) *Torrent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.torrents[infoHash]
+}
+
+// Torrent devuelve el torrent con ese info_hash o nil
+func (s *Session) Torrent(infoHash [20]byte) *Torrent { return s.get(infoHash) }
+
+// Torrents devuelve los torrents de la sesión ordenados por nombre
+func (s *Session) Torrents() []*Torrent {
+	s.mu.RLock()
+	list := make([]*Torrent, 0, len(s.torrents))
+	for _, t := range s.torrents {
+		list = append(list, t)
+	}
+	s.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Close quita todos los torrents (guardando su resume) y deja de escuchar
+func (s *Session) Close() {
+	for _, t := range s.Torrents() {
+		_ = s.RemoveTorrent(t.Cfg.InfoHash)
+	}
+	s.ln.Close()
+}
+
+// Status calcula el estado actual del torrent
+func (t *Torrent) Status() TorrentStatus {
+	left := t.computeLeft()
+	uploaded, downloaded := t.Manager.TransferTotals()
+	st := TorrentStatus{
+		InfoHash:       hex.EncodeToString(t.Cfg.InfoHash[:]),
+		Name:           t.Name,
+		Paused:         t.Manager.Paused(),
+		TotalSize:      t.Cfg.FileLength,
+		Left:           left,
+		Uploaded:       uploaded,
+		Downloaded:     downloaded,
+		ConnectedPeers: t.Manager.GetPeerCount(),
+		WebSeeds:       activeWebSeeds(t.Manager),
+	}
+	if t.Cfg.FileLength > 0 {
+		st.Progress = float64(t.Cfg.FileLength-left) / float64(t.Cfg.FileLength) * 100
+	}
+	switch {
+	case st.Paused:
+		st.State = "paused"
+	case left == 0:
+		st.State = "seeding"
+	default:
+		st.State = "downloading"
+	}
+	return st
+}
+
+// ParseInfoHashHex convierte un info_hash en hex (40 caracteres)
+func ParseInfoHashHex(s string) ([20]byte, error) {
+	var ih [20]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 20 {
+		return ih, errors.New("info_hash inválido (se esperan 40 caracteres hex)")
+	}
+	copy(ih[:], b)
+	return ih, nil
+}
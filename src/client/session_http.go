@@ -0,0 +1,152 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SessionHTTPServer expone la sesión multi-torrent:
+//
+//	GET    /torrents              lista de torrents
+//	POST   /torrents              agrega {"torrent": ".torrent o magnet", "archives": "dir opcional"}
+//	GET    /torrents/{hash}       estado de un torrent
+//	DELETE /torrents/{hash}       quita el torrent (los archivos quedan en disco)
+//	POST   /torrents/{hash}/pause
+//	POST   /torrents/{hash}/resume
+//	GET    /torrents/{hash}/priorities   prioridades por archivo/pieza (POST para cambiarlas)
+//	GET    /limits                límites de transferencia (POST/PUT para cambiarlos)
+//	GET    /health
+type SessionHTTPServer struct {
+	session *Session
+	server  *http.Server
+}
+
+// NewSessionHTTPServer crea el servidor HTTP de control de la sesión
+func NewSessionHTTPServer(session *Session, port int) *SessionHTTPServer {
+	hs := &SessionHTTPServer{session: session}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /torrents", hs.handleList)
+	mux.HandleFunc("POST /torrents", hs.handleAdd)
+	mux.HandleFunc("GET /torrents/{hash}", hs.handleGet)
+	mux.HandleFunc("DELETE /torrents/{hash}", hs.handleRemove)
+	mux.HandleFunc("POST /torrents/{hash}/pause", hs.handlePause)
+	mux.HandleFunc("POST /torrents/{hash}/resume", hs.handleResume)
+	mux.HandleFunc("/torrents/{hash}/priorities", hs.handlePriorities)
+	mux.HandleFunc("/limits", handleLimits)
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+
+	hs.server = &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: mux,
+	}
+	return hs
+}
+
+// Start inicia el servidor HTTP
+func (hs *SessionHTTPServer) Start() error {
+	return hs.server.ListenAndServe()
+}
+
+// Stop detiene el servidor HTTP
+func (hs *SessionHTTPServer) Stop() error {
+	return hs.server.Close()
+}
+
+func (hs *SessionHTTPServer) handleList(w http.ResponseWriter, r *http.Request) {
+	list := []TorrentStatus{}
+	for _, t := range hs.session.Torrents() {
+		list = append(list, t.Status())
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (hs *SessionHTTPServer) handleAdd(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Torrent  string `json:"torrent"`
+		Archives string `json:"archives"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Torrent == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "se espera {\"torrent\": ...}"})
+		return
+	}
+	t, err := hs.session.AddTorrent(req.Torrent, req.Archives)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusCreated, t.Status())
+}
+
+func (hs *SessionHTTPServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	ih, ok := pathInfoHash(w, r)
+	if !ok {
+		return
+	}
+	t := hs.session.Torrent(ih)
+	if t == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "torrent no encontrado"})
+		return
+	}
+	writeJSON(w, http.StatusOK, t.Status())
+}
+
+func (hs *SessionHTTPServer) handleRemove(w http.ResponseWriter, r *http.Request) {
+	hs.torrentAction(w, r, hs.session.RemoveTorrent, "removed")
+}
+
+func (hs *SessionHTTPServer) handlePause(w http.ResponseWriter, r *http.Request) {
+	hs.torrentAction(w, r, hs.session.PauseTorrent, "paused")
+}
+
+func (hs *SessionHTTPServer) handleResume(w http.ResponseWriter, r *http.Request) {
+	hs.torrentAction(w, r, hs.session.ResumeTorrent, "resumed")
+}
+
+func (hs *SessionHTTPServer) handlePriorities(w http.ResponseWriter, r *http.Request) {
+	ih, ok := pathInfoHash(w, r)
+	if !ok {
+		return
+	}
+	t := hs.session.Torrent(ih)
+	if t == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "torrent no encontrado"})
+		return
+	}
+	files := contentFiles(t.Cfg.FileName, t.Cfg.Files, t.Cfg.FileLength)
+	servePriorities(w, r, t.Store, t.Manager, files)
+}
+
+func (hs *SessionHTTPServer) torrentAction(w http.ResponseWriter, r *http.Request, action func([20]byte) error, status string) {
+	ih, ok := pathInfoHash(w, r)
+	if !ok {
+		return
+	}
+	if err := action(ih); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": status})
+}
+
+// pathInfoHash lee el info_hash hex de la ruta; responde 400 si es inválido
+func pathInfoHash(w http.ResponseWriter, r *http.Request) ([20]byte, bool) {
+	ih, err := ParseInfoHashHex(r.PathValue("hash"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return ih, false
+	}
+	return ih, true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -1,9 +1,10 @@
 package client
 
 import (
-	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"src/logging"
 	"src/overlay"
 	"src/peerwire"
 	"sync"
@@ -12,42 +13,45 @@ import (
 
 type ComputeLeftFunc func() int64
 
+// CreateComputeLeftFunc calcula el "left" de los announces: sólo cuentan los
+// bytes de piezas que queremos (las de archivos en skip no se descargan)
 func CreateComputeLeftFunc(store *peerwire.DiskPieceStore, fileLength int64) ComputeLeftFunc {
 	return func() int64 {
-		var have int64
-		num := store.NumPieces()
-		for i := 0; i < num; i++ {
-			if store.HasPiece(i) {
-				if i == num-1 {
-					have += fileLength - int64(store.PieceLength())*int64(num-1)
-				} else {
-					have += int64(store.PieceLength())
-				}
-			}
-		}
-		if have > fileLength {
-			have = fileLength
-		}
-		return fileLength - have
+		return min(store.WantedLeft(), fileLength)
 	}
 }
 
 func SetupStorage(cfg *ClientConfig) (*peerwire.DiskPieceStore, *peerwire.Manager, bool) {
+	store, mgr, useFinal, err := OpenStorage(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return store, mgr, useFinal
+}
+
+// OpenStorage es SetupStorage devolviendo el error en vez de abortar
+func OpenStorage(cfg *ClientConfig) (*peerwire.DiskPieceStore, *peerwire.Manager, bool, error) {
 	tempPath, finalPath := cfg.GetStoragePaths()
 
 	useFinal := false
 	usePartResume := false
 
-	if st, err := os.Stat(finalPath); err == nil && st.Size() == cfg.FileLength {
+	if cfg.layoutMatches(finalPath) {
 		useFinal = true
-	} else if st, err := os.Stat(tempPath); err == nil && st.Size() == cfg.FileLength {
+	} else if cfg.layoutMatches(tempPath) {
 		usePartResume = true
 	}
 
 	var store *peerwire.DiskPieceStore
 	var err error
 
-	if useFinal {
+	if cfg.IsMultiFile() {
+		root := tempPath
+		if useFinal {
+			root = finalPath
+		}
+		store, err = peerwire.NewMultiFilePieceStore(root, cfg.Files, int(cfg.PieceLength), !(useFinal || usePartResume))
+	} else if useFinal {
 		store, err = peerwire.NewDiskPieceStoreWithMode(finalPath, int(cfg.PieceLength), cfg.FileLength, false)
 	} else if usePartResume {
 		store, err = peerwire.NewDiskPieceStoreWithMode(tempPath, int(cfg.PieceLength), cfg.FileLength, false)
@@ -56,24 +60,66 @@ func SetupStorage(cfg *ClientConfig) (*peerwire.DiskPieceStore, *peerwire.Manage
 	}
 
 	if err != nil {
-		panic(err)
+		return nil, nil, false, err
 	}
 
 	mgr := peerwire.NewManager(store)
+	mgr.SetInfoHash(cfg.InfoHash)
 
 	// Verificacion SHA-1 por pieza si tenemos los hashes esperados
 	if len(cfg.ExpectedHashes) == store.NumPieces() {
 		store.SetExpectedHashes(cfg.ExpectedHashes)
 	}
 
+	// Datos de resume de la sesión anterior: los contadores se restauran
+	// siempre; el bitfield sólo si los archivos no cambiaron desde que se guardó
+	rd, err := loadResume(cfg)
+	if err == nil {
+		mgr.AddTransferTotals(rd.Uploaded, rd.Downloaded)
+		if len(rd.FilePriority) > 0 {
+			if err := store.RestorePriorityState(rd.FilePriority, rd.PiecePriority); err != nil {
+				log.Warn("resume: prioridades ignoradas", logging.InfoHash(cfg.InfoHash), logging.Err(err))
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		log.Warn("resume ignorado", logging.InfoHash(cfg.InfoHash), logging.Err(err))
+	}
+
 	// Si existe archivo final o .part previo,intentar marcar piezas copletas por SHA-1
 	if (useFinal || usePartResume) && len(cfg.ExpectedHashes) == store.NumPieces() {
-		if err := store.ScanAndMarkComplete(); err != nil {
-			fmt.Println("No se pudo escanear archivo existente para marcar piezas:", err)
+		root := tempPath
+		if useFinal {
+			root = finalPath
+		}
+		if rd != nil && rd.filesUnchanged(cfg, root) && store.RestoreBitfield(rd.Bitfield) == nil {
+			log.Info("resume: archivos sin cambios, se usa el bitfield guardado", logging.InfoHash(cfg.InfoHash))
+		} else {
+			if rd != nil {
+				log.Info("resume: los archivos cambiaron, verificando piezas", logging.InfoHash(cfg.InfoHash))
+			}
+			if err := store.ScanAndMarkComplete(); err != nil {
+				log.Warn("no se pudo escanear el contenido existente", logging.InfoHash(cfg.InfoHash), logging.Err(err))
+			}
 		}
 	}
 
-	return store, mgr, useFinal
+	return store, mgr, useFinal, nil
+}
+
+// layoutMatches indica si en root existe el contenido del torrent con los
+// tamaños esperados: el archivo único, o todos los archivos del árbol multi-file.
+func (cfg *ClientConfig) layoutMatches(root string) bool {
+	if !cfg.IsMultiFile() {
+		st, err := os.Stat(root)
+		return err == nil && !st.IsDir() && st.Size() == cfg.FileLength
+	}
+	for _, fe := range cfg.Files {
+		st, err := os.Stat(filepath.Join(root, fe.RelPath()))
+		if err != nil || st.IsDir() || st.Size() != fe.Length {
+			return false
+		}
+	}
+	return true
 }
 
 func SetupPieceCompletionHandler(store *peerwire.DiskPieceStore, cfg *ClientConfig,
@@ -81,18 +127,20 @@ func SetupPieceCompletionHandler(store *peerwire.DiskPieceStore, cfg *ClientConf
 
 	tempPath, finalPath := cfg.GetStoragePaths()
 
+	// la descarga termina cuando están todas las piezas que queremos; si
+	// después se pide un archivo que estaba en skip se sigue escribiendo en
+	// los mismos archivos abiertos (ya renombrados)
+	var renameMu sync.Mutex
 	store.OnPieceComplete(func(_ int) {
-		n := store.NumPieces()
-		all := true
-		for i := 0; i < n; i++ {
-			if !store.HasPiece(i) {
-				all = false
-				break
-			}
+		if store.WantedLeft() > 0 {
+			return
 		}
-		if all && !useFinal {
+		renameMu.Lock()
+		defer renameMu.Unlock()
+		if !useFinal {
 			if err := os.Rename(tempPath, finalPath); err == nil {
-				fmt.Println("Descarga completa. Archivo listo en:", finalPath)
+				useFinal = true
+				log.Info("descarga completa", logging.InfoHash(cfg.InfoHash), "path", finalPath)
 
 				// notificar que la descarga se completo
 				completedMu.Lock()
@@ -102,7 +150,7 @@ func SetupPieceCompletionHandler(store *peerwire.DiskPieceStore, cfg *ClientConf
 				}
 				completedMu.Unlock()
 			} else {
-				fmt.Println("No se pudo renombrar el archivo final:", err)
+				log.Error("no se pudo renombrar el archivo final", logging.InfoHash(cfg.InfoHash), logging.Err(err))
 			}
 		}
 	})
@@ -115,17 +163,20 @@ func ConnectToPeers(peers []PeerInfo, infoHash [20]byte, peerId string,
 
 	for _, peerInfo := range peers {
 		if _, dup := seen[peerInfo.Addr]; dup {
-			fmt.Printf("Peer duplicado omitido: %s\n", peerInfo.Addr)
+			log.Debug("peer duplicado omitido", logging.InfoHash(infoHash), logging.Peer(peerInfo.Addr))
 			continue
 		}
 		seen[peerInfo.Addr] = struct{}{}
-		fmt.Printf("Peer: %s\n", peerInfo.Addr)
+		if mgr.HasPeerAddr(peerInfo.Addr) {
+			log.Debug("peer ya conectado, omitido", logging.InfoHash(infoHash), logging.Peer(peerInfo.Addr))
+			continue
+		}
 
 		// Probe: verificar que el puerto realmente escucha antes de intentar handshake
 		// (evita errores con providers stale del overlay)
 		conn, err := net.DialTimeout("tcp", peerInfo.Addr, 2*time.Second)
 		if err != nil {
-			fmt.Printf("  [SKIP] Peer inaccesible: %v\n", err)
+			log.Debug("peer inaccesible", logging.InfoHash(infoHash), logging.Peer(peerInfo.Addr), logging.Err(err))
 			continue
 		}
 		conn.Close() // solo verificamos, cerramos la conexión de prueba
@@ -135,7 +186,7 @@ func ConnectToPeers(peers []PeerInfo, infoHash [20]byte, peerId string,
 
 		pc, err := peerwire.NewPeerConn(peerInfo.Addr, infoHash, peerIdBytes)
 		if err != nil {
-			fmt.Println("Error creando PeerConn:", err)
+			log.Debug("no se pudo conectar al peer", logging.InfoHash(infoHash), logging.Peer(peerInfo.Addr), logging.Err(err))
 			continue
 		}
 		//defer pc.Close()
@@ -143,12 +194,13 @@ func ConnectToPeers(peers []PeerInfo, infoHash [20]byte, peerId string,
 		pc.BindManager(mgr)
 
 		if err := pc.Handshake(); err != nil {
-			fmt.Println("Handshake fallido:", err)
+			log.Debug("handshake fallido", logging.InfoHash(infoHash), logging.Peer(peerInfo.Addr), logging.Err(err))
 			pc.Close()
 			continue
 		}
 
-		fmt.Println("Conectado al peer, handshake OK")
+		log.Info("conectado al peer", logging.InfoHash(infoHash), logging.Peer(peerInfo.Addr), "encrypted", peerwire.Encrypted(pc.Conn))
+		_ = pc.SendExtendedHandshake()
 		_ = pc.SendBitfield(store.Bitfield())
 		pc.SendMessage(peerwire.MsgInterested, nil)
 
@@ -164,7 +216,6 @@ func ConnectToPeers(peers []PeerInfo, infoHash [20]byte, peerId string,
 func SendStoppedAnnounce(cfg *ClientConfig, listenPort int,
 	computeLeft ComputeLeftFunc, hostname string) {
 
-	fmt.Println("[SHUTDOWN] Enviando event=stopped al tracker...")
 	left := computeLeft()
 	downloaded := cfg.FileLength - left
 
@@ -172,9 +223,9 @@ func SendStoppedAnnounce(cfg *ClientConfig, listenPort int,
 	_, err = SendAnnounceWithFailover(cfg, listenPort, 0, downloaded, left, "stopped", hostname)
 
 	if err != nil {
-		fmt.Println("[ERROR] No se pudo enviar stopped:", err)
+		announceLog.Error("no se pudo enviar stopped", logging.InfoHash(cfg.InfoHash), logging.Err(err))
 	} else {
-		fmt.Println("[SHUTDOWN] Event=stopped enviado correctamente")
+		announceLog.Info("event=stopped enviado", logging.InfoHash(cfg.InfoHash))
 	}
 }
 
@@ -188,17 +239,15 @@ func SendStoppedAnnounceOverlay(cfg *ClientConfig, listenPort int,
 	var err error
 
 	if ov != nil {
-		fmt.Println("[SHUTDOWN] Enviando event=stopped al overlay...")
-		ov.Announce(cfg.InfoHashEncoded, overlay.ProviderMeta{Addr: providerAddr, PeerId: cfg.PeerId, Left: left})
-		fmt.Println("[SHUTDOWN] Event=stopped enviado al overlay")
+		ov.Announce(cfg.InfoHashEncoded, LocalProvider(providerAddr, cfg.PeerId, left))
+		announceLog.Info("event=stopped enviado al overlay", logging.InfoHash(cfg.InfoHash))
 	} else {
-		fmt.Println("[SHUTDOWN] Enviando event=stopped al tracker...")
 		_, err = SendAnnounceWithFailover(cfg, listenPort, 0, downloaded, left, "stopped", hostname)
 
 		if err != nil {
-			fmt.Println("[ERROR] No se pudo enviar stopped:", err)
+			announceLog.Error("no se pudo enviar stopped", logging.InfoHash(cfg.InfoHash), logging.Err(err))
 		} else {
-			fmt.Println("[SHUTDOWN] Event=stopped enviado correctamente")
+			announceLog.Info("event=stopped enviado", logging.InfoHash(cfg.InfoHash))
 		}
 	}
 
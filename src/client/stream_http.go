@@ -0,0 +1,89 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"src/peerwire"
+	"time"
+)
+
+// SetStreamFiles indica qué hay dentro del torrent para /stream: el nombre
+// del archivo (torrents de un solo archivo) o la lista de info["files"]
+func (hs *HTTPServer) SetStreamFiles(name string, files []peerwire.FileEntry) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.contentName = name
+	hs.files = files
+}
+
+// handleStream sirve un archivo del torrent mientras se descarga, con
+// soporte de Range (http.ServeContent). Las lecturas esperan a que las
+// piezas estén verificadas y, mientras dure la respuesta, el torrent se
+// descarga en orden desde la posición pedida.
+//
+//	GET /stream               archivo único, o el más grande del torrent
+//	GET /stream?file=2        archivo por índice en info["files"]
+//	GET /stream?file=a/b.mkv  archivo por ruta relativa
+func (hs *HTTPServer) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, offset, length, err := hs.streamFile(r.URL.Query().Get("file"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	sr, err := hs.manager.NewStreamReader(offset, length, r.Context().Done())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer sr.Close()
+
+	httpLog.Info("stream", "remote", r.RemoteAddr, "file", name, "range", r.Header.Get("Range"))
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	http.ServeContent(w, r, path.Base(name), time.Time{}, sr)
+}
+
+// streamFile ubica el archivo pedido dentro del torrent: nombre, offset
+// global y largo
+func (hs *HTTPServer) streamFile(sel string) (string, int64, int64, error) {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	if len(hs.files) == 0 {
+		if sel != "" && sel != "0" && sel != hs.contentName {
+			return "", 0, 0, errors.New("archivo no encontrado en el torrent")
+		}
+		name := hs.contentName
+		if name == "" {
+			name = hs.torrentName
+		}
+		return name, 0, hs.fileLength, nil
+	}
+
+	idx := -1
+	if sel == "" {
+		// por defecto el más grande: normalmente el que se quiere ver
+		for i, fe := range hs.files {
+			if idx < 0 || fe.Length > hs.files[idx].Length {
+				idx = i
+			}
+		}
+	} else {
+		var err error
+		if idx, err = fileIndex(hs.files, sel); err != nil {
+			return "", 0, 0, err
+		}
+	}
+
+	var offset int64
+	for _, fe := range hs.files[:idx] {
+		offset += fe.Length
+	}
+	fe := hs.files[idx]
+	return path.Join(fe.Path...), offset, fe.Length, nil
+}
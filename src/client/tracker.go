@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"src/bencode"
+	"src/logging"
 	"strings"
 	"time"
 )
@@ -38,6 +39,9 @@ func SendAnnounce(announceURL, infoHashEncoded, peerId string, port int,
 	if event != "" {
 		params.Set("event", event)
 	}
+	if announceIPv6 != "" {
+		params.Set("ipv6", announceIPv6)
+	}
 
 	switch event {
 	case "started":
@@ -48,11 +52,7 @@ func SendAnnounce(announceURL, infoHashEncoded, peerId string, port int,
 
 	fullURL := announceURL + "?info_hash=" + infoHashEncoded + "&" + params.Encode()
 
-	if event != "" {
-		fmt.Printf("[ANNOUNCE] Enviando event=%s, left=%d\n", event, left)
-	} else {
-		fmt.Printf("[ANNOUNCE] Enviando announce periódico, left=%d\n", left)
-	}
+	announceLog.Debug("enviando announce", "url", announceURL, "event", event, "left", left)
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Get(fullURL)
@@ -87,20 +87,25 @@ func SendAnnounceWithFailover(cfg *ClientConfig, port int, uploaded, downloaded,
 	for attempt := 0; attempt < maxAttempts; attempt++ {
 		trackerURL := cfg.GetCurrentTrackerURL()
 
-		fmt.Printf("[ANNOUNCE] Intentando con tracker: %s (intento %d/%d)\n", trackerURL, attempt+1, maxAttempts)
-
-		response, err := SendAnnounce(trackerURL, cfg.InfoHashEncoded, cfg.PeerId, port, uploaded, downloaded, left, event, hostname)
+		var response map[string]interface{}
+		var err error
+		if IsUDPTracker(trackerURL) {
+			response, err = SendAnnounceUDP(trackerURL, cfg.InfoHash, cfg.PeerId, port, uploaded, downloaded, left, event, hostname)
+		} else {
+			response, err = SendAnnounce(trackerURL, cfg.InfoHashEncoded, cfg.PeerId, port, uploaded, downloaded, left, event, hostname)
+		}
 
 		if err == nil {
 			// Éxito
 			if attempt > 0 {
-				fmt.Printf("[ANNOUNCE] ✓ Announce exitoso después de %d intentos\n", attempt+1)
+				announceLog.Info("announce exitoso tras failover", logging.InfoHash(cfg.InfoHash), "url", trackerURL, "attempts", attempt+1)
 			}
 			return response, nil
 		}
 
 		// Error: intentar con el siguiente tracker
-		fmt.Printf("[ANNOUNCE] ✗ Error con tracker %s: %v\n", trackerURL, err)
+		announceLog.Warn("announce fallido", logging.InfoHash(cfg.InfoHash), "url", trackerURL,
+			"attempt", attempt+1, "of", maxAttempts, logging.Err(err))
 
 		if attempt < maxAttempts-1 {
 			cfg.SwitchToNextTracker()
@@ -114,47 +119,55 @@ func SendAnnounceWithFailover(cfg *ClientConfig, port int, uploaded, downloaded,
 
 // envia una peticion scrape al tracker y muestra las estadisticas
 func SendScrape(announceURL, infoHashEncoded string, infoHash [20]byte) {
+	if IsUDPTracker(announceURL) {
+		complete, incomplete, downloaded, err := SendScrapeUDP(announceURL, infoHash)
+		if err != nil {
+			announceLog.Warn("scrape fallido", logging.InfoHash(infoHash), "url", announceURL, logging.Err(err))
+			return
+		}
+		logScrapeStats(infoHash, complete, incomplete, downloaded)
+		return
+	}
+
 	pos := strings.LastIndex(announceURL, "/")
 	if pos == -1 {
-		fmt.Println("[SCRAPE] URL inválida, no se puede hacer scrape")
+		announceLog.Warn("scrape: URL inválida", "url", announceURL)
 		return
 	}
 
 	last := announceURL[pos+1:]
 	if !strings.HasPrefix(last, "announce") {
-		fmt.Println("[SCRAPE] Tracker no soporta scrape")
+		announceLog.Info("el tracker no soporta scrape", "url", announceURL)
 		return
 	}
 
 	scrapeURL := announceURL[:pos+1] + strings.Replace(last, "announce", "scrape", 1)
 	fullURL := scrapeURL + "?info_hash=" + infoHashEncoded
 
-	fmt.Println("[SCRAPE] Obteniendo estadísticas del tracker...")
-
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Get(fullURL)
 	if err != nil {
-		fmt.Println("[SCRAPE] Error:", err)
+		announceLog.Warn("scrape fallido", logging.InfoHash(infoHash), "url", scrapeURL, logging.Err(err))
 		return
 	}
 	defer resp.Body.Close()
 
 	scrapeResponse, err := bencode.Decode(resp.Body)
 	if err != nil && err != io.EOF {
-		fmt.Println("[SCRAPE] Error decodificando:", err)
+		announceLog.Warn("scrape: respuesta inválida", logging.InfoHash(infoHash), "url", scrapeURL, logging.Err(err))
 		return
 	}
 
 	// Extraer y mostrar estadisticas
 	files, ok := scrapeResponse["files"].(map[string]interface{})
 	if !ok {
-		fmt.Println("[SCRAPE] No hay estadísticas disponibles")
+		announceLog.Info("scrape sin estadísticas", logging.InfoHash(infoHash), "url", scrapeURL)
 		return
 	}
 
 	stats, ok := files[string(infoHash[:])].(map[string]interface{})
 	if !ok {
-		fmt.Println("[SCRAPE] No hay estadísticas para este torrent")
+		announceLog.Info("scrape sin estadísticas para este torrent", logging.InfoHash(infoHash), "url", scrapeURL)
 		return
 	}
 
@@ -162,13 +175,10 @@ func SendScrape(announceURL, infoHashEncoded string, infoHash [20]byte) {
 	incomplete, _ := stats["incomplete"].(int64)
 	downloaded, _ := stats["downloaded"].(int64)
 
-	fmt.Println("\n========================================")
-	fmt.Println("      ESTADÍSTICAS DEL TRACKER           ")
-	fmt.Println("=========================================")
-	fmt.Printf(" Seeders (completos):   %15d \n", complete)
-	fmt.Printf(" Leechers (descargando): %14d \n", incomplete)
-	fmt.Printf(" Descargas completadas:  %14d \n", downloaded)
-	fmt.Printf(" Total peers:            %14d \n", complete+incomplete)
-	fmt.Println("=========================================")
-	fmt.Println()
+	logScrapeStats(infoHash, complete, incomplete, downloaded)
+}
+
+func logScrapeStats(infoHash [20]byte, complete, incomplete, downloaded int64) {
+	announceLog.Info("estadísticas del tracker", logging.InfoHash(infoHash),
+		"seeders", complete, "leechers", incomplete, "downloaded", downloaded, "peers", complete+incomplete)
 }
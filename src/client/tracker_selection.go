@@ -1,9 +1,9 @@
 package client
 
 import (
-	"fmt"
 	"net/http"
 	"sort"
+	"src/logging"
 	"strings"
 	"time"
 )
@@ -16,7 +16,13 @@ type TrackerLatency struct {
 }
 
 // PingTracker mide la latencia de un tracker haciendo una petición HEAD o GET rápida
+// (o un connect si es udp://)
 func PingTracker(trackerURL string, timeout time.Duration) (time.Duration, error) {
+	// En trackers UDP se mide el round-trip de un connect
+	if IsUDPTracker(trackerURL) {
+		return pingUDPTracker(trackerURL, timeout)
+	}
+
 	// Construir URL base del tracker (sin /announce)
 	baseURL := strings.TrimSuffix(trackerURL, "/announce")
 
@@ -46,24 +52,17 @@ func PingTracker(trackerURL string, timeout time.Duration) (time.Duration, error
 
 // SelectClosestTracker mide la latencia de todos los trackers y retorna el índice del más rápido
 func SelectClosestTracker(trackerURLs []string) int {
-	if len(trackerURLs) == 0 {
-		return 0
-	}
-
-	if len(trackerURLs) == 1 {
-		fmt.Println("[TRACKER] Solo hay un tracker disponible")
+	if len(trackerURLs) <= 1 {
 		return 0
 	}
 
-	fmt.Printf("[TRACKER] Midiendo latencia de %d trackers...\n", len(trackerURLs))
-
 	latencies := make([]TrackerLatency, 0, len(trackerURLs))
 	timeout := 3 * time.Second
 
 	for i, url := range trackerURLs {
 		latency, err := PingTracker(url, timeout)
 		if err != nil {
-			fmt.Printf("  [%d] %s - ERROR: %v\n", i, url, err)
+			announceLog.Debug("latencia del tracker", "url", url, logging.Err(err))
 			// Asignar latencia muy alta si falla
 			latencies = append(latencies, TrackerLatency{
 				URL:     url,
@@ -71,7 +70,7 @@ func SelectClosestTracker(trackerURLs []string) int {
 				Index:   i,
 			})
 		} else {
-			fmt.Printf("  [%d] %s - %v\n", i, url, latency)
+			announceLog.Debug("latencia del tracker", "url", url, "latency", latency)
 			latencies = append(latencies, TrackerLatency{
 				URL:     url,
 				Latency: latency,
@@ -87,8 +86,7 @@ func SelectClosestTracker(trackerURLs []string) int {
 
 	// Retornar el índice del tracker más rápido
 	closestIdx := latencies[0].Index
-	fmt.Printf("[TRACKER] Tracker más cercano seleccionado: %s (latencia: %v)\n",
-		latencies[0].URL, latencies[0].Latency)
+	announceLog.Info("tracker más cercano seleccionado", "url", latencies[0].URL, "latency", latencies[0].Latency)
 
 	// Reordenar el slice de URLs poniendo los más rápidos primero
 	reorderedURLs := make([]string, len(trackerURLs))
@@ -103,26 +101,23 @@ func SelectClosestTracker(trackerURLs []string) int {
 // SelectAndReorderTrackers mide latencias y reordena la lista poniendo el más rápido primero
 func SelectAndReorderTrackers(cfg *ClientConfig) {
 	if len(cfg.AnnounceURLs) <= 1 {
-		fmt.Println("[TRACKER] Solo hay un tracker, no es necesario reordenar")
 		return
 	}
 
-	fmt.Println("[TRACKER] Seleccionando tracker más cercano...")
-
 	latencies := make([]TrackerLatency, 0, len(cfg.AnnounceURLs))
 	timeout := 3 * time.Second
 
 	for i, url := range cfg.AnnounceURLs {
 		latency, err := PingTracker(url, timeout)
 		if err != nil {
-			fmt.Printf("  [%d] %s - ERROR: %v\n", i, url, err)
+			announceLog.Debug("latencia del tracker", "url", url, logging.Err(err))
 			latencies = append(latencies, TrackerLatency{
 				URL:     url,
 				Latency: 999 * time.Second,
 				Index:   i,
 			})
 		} else {
-			fmt.Printf("  [%d] %s - %v\n", i, url, latency)
+			announceLog.Debug("latencia del tracker", "url", url, "latency", latency)
 			latencies = append(latencies, TrackerLatency{
 				URL:     url,
 				Latency: latency,
@@ -145,10 +140,6 @@ func SelectAndReorderTrackers(cfg *ClientConfig) {
 	cfg.AnnounceURLs = reorderedURLs
 	cfg.CurrentTrackerIdx = 0 // El primero es ahora el más rápido
 
-	fmt.Printf("[TRACKER] Tracker seleccionado: %s (latencia: %v)\n",
-		cfg.AnnounceURLs[0], latencies[0].Latency)
-	fmt.Println("[TRACKER] Orden de failover:")
-	for i, url := range cfg.AnnounceURLs {
-		fmt.Printf("  [%d] %s\n", i+1, url)
-	}
+	announceLog.Info("tracker seleccionado", logging.InfoHash(cfg.InfoHash), "url", cfg.AnnounceURLs[0],
+		"latency", latencies[0].Latency, "failover", cfg.AnnounceURLs)
 }
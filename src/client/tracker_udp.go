@@ -0,0 +1,315 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocolo de tracker UDP (BEP 15)
+const (
+	udpProtocolID = 0x41727101980
+
+	udpActionConnect  = 0
+	udpActionAnnounce = 1
+	udpActionScrape   = 2
+	udpActionError    = 3
+
+	// un connection ID sirve durante un minuto desde que se obtuvo
+	udpConnIDTTL = time.Minute
+	// timeout del primer intento; se duplica en cada reintento
+	udpBaseTimeout = 2 * time.Second
+	udpMaxAttempts = 3
+)
+
+// cache de connection IDs por dirección de tracker
+var (
+	udpConnMu  sync.Mutex
+	udpConnIDs = map[string]udpConnID{}
+	udpKey     = randomUint32()
+)
+
+type udpConnID struct {
+	id       uint64
+	obtained time.Time
+}
+
+// IsUDPTracker indica si la URL de announce usa el protocolo UDP
+func IsUDPTracker(announceURL string) bool {
+	return strings.HasPrefix(strings.ToLower(announceURL), "udp://")
+}
+
+// SendAnnounceUDP envía un announce a un tracker udp:// y devuelve la
+// respuesta con la misma forma que la del tracker HTTP (interval, complete,
+// incomplete y peers en formato compacto), para que el resto del cliente no
+// distinga el transporte.
+func SendAnnounceUDP(announceURL string, infoHash [20]byte, peerId string, port int,
+	uploaded, downloaded, left int64, event string, hostname string) (map[string]interface{}, error) {
+
+	conn, err := dialUDPTracker(announceURL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var eventID uint32
+	numwant := int32(-1) // -1: lo que decida el tracker
+	switch event {
+	case "completed":
+		eventID = 1
+	case "started":
+		eventID = 2
+		numwant = 50
+	case "stopped":
+		eventID = 3
+		numwant = 0
+	}
+
+	announceLog.Debug("enviando announce", "url", announceURL, "event", event, "left", left)
+
+	resp, err := udpRequest(conn, udpActionAnnounce, func(req []byte) []byte {
+		req = append(req, infoHash[:]...)
+		req = append(req, peerIdBytes(peerId)...)
+		req = binary.BigEndian.AppendUint64(req, uint64(downloaded))
+		req = binary.BigEndian.AppendUint64(req, uint64(left))
+		req = binary.BigEndian.AppendUint64(req, uint64(uploaded))
+		req = binary.BigEndian.AppendUint32(req, eventID)
+		// ip: sólo si el hostname es una IPv4 literal; si no, el tracker usa el origen
+		ip := net.IPv4zero.To4()
+		if parsed := net.ParseIP(hostname).To4(); parsed != nil {
+			ip = parsed
+		}
+		req = append(req, ip...)
+		req = binary.BigEndian.AppendUint32(req, udpKey)
+		req = binary.BigEndian.AppendUint32(req, uint32(numwant))
+		return binary.BigEndian.AppendUint16(req, uint16(port))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 20 {
+		return nil, errors.New("respuesta de announce udp demasiado corta")
+	}
+
+	// sobre IPv6 el tracker responde peers de 18 bytes (BEP 15)
+	key, entry := "peers", 6
+	if raddr, ok := conn.RemoteAddr().(*net.UDPAddr); ok && raddr.IP.To4() == nil {
+		key, entry = "peers6", 18
+	}
+	return map[string]interface{}{
+		"interval":   int64(binary.BigEndian.Uint32(resp[8:12])),
+		"incomplete": int64(binary.BigEndian.Uint32(resp[12:16])),
+		"complete":   int64(binary.BigEndian.Uint32(resp[16:20])),
+		key:          string(resp[20 : 20+(len(resp)-20)/entry*entry]),
+	}, nil
+}
+
+// SendScrapeUDP pide al tracker udp:// las estadísticas de un torrent
+func SendScrapeUDP(announceURL string, infoHash [20]byte) (complete, incomplete, downloaded int64, err error) {
+	conn, err := dialUDPTracker(announceURL)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer conn.Close()
+
+	resp, err := udpRequest(conn, udpActionScrape, func(req []byte) []byte {
+		return append(req, infoHash[:]...)
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if len(resp) < 20 {
+		return 0, 0, 0, errors.New("respuesta de scrape udp demasiado corta")
+	}
+	complete = int64(binary.BigEndian.Uint32(resp[8:12]))
+	downloaded = int64(binary.BigEndian.Uint32(resp[12:16]))
+	incomplete = int64(binary.BigEndian.Uint32(resp[16:20]))
+	return complete, incomplete, downloaded, nil
+}
+
+// pingUDPTracker mide la latencia de un tracker udp:// con un connect
+func pingUDPTracker(announceURL string, timeout time.Duration) (time.Duration, error) {
+	conn, err := dialUDPTracker(announceURL)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	id, err := udpExchange(conn, udpConnectRequest(), udpActionConnect, timeout)
+	if err != nil {
+		return 0, err
+	}
+	latency := time.Since(start)
+	storeConnID(conn.RemoteAddr().String(), id)
+	return latency, nil
+}
+
+// dialUDPTracker abre un socket UDP hacia el host:port de la URL
+func dialUDPTracker(announceURL string) (*net.UDPConn, error) {
+	u, err := url.Parse(announceURL)
+	if err != nil {
+		return nil, fmt.Errorf("url de tracker inválida: %w", err)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("url de tracker udp sin puerto: %s", announceURL)
+	}
+	raddr, err := net.ResolveUDPAddr("udp", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("error resolviendo %s: %w", u.Host, err)
+	}
+	return net.DialUDP("udp", nil, raddr)
+}
+
+// udpRequest obtiene (o reutiliza) el connection ID y envía la acción
+// construida por build. Si el tracker rechaza el ID se reconecta una vez.
+func udpRequest(conn *net.UDPConn, action uint32, build func(req []byte) []byte) ([]byte, error) {
+	addr := conn.RemoteAddr().String()
+	for retry := 0; retry < 2; retry++ {
+		id, err := udpConnectionID(conn)
+		if err != nil {
+			return nil, err
+		}
+		req := binary.BigEndian.AppendUint64(make([]byte, 0, 98), id)
+		req = binary.BigEndian.AppendUint32(req, action)
+		req = binary.BigEndian.AppendUint32(req, 0) // transaction_id, lo fija udpRoundTrip
+		req = build(req)
+
+		resp, err := udpRoundTrip(conn, req, action)
+		if err == nil {
+			return resp, nil
+		}
+		// Un ID caducado produce un error del tracker: olvidarlo y reconectar
+		var trackerErr *udpTrackerError
+		if !errors.As(err, &trackerErr) || retry > 0 {
+			return nil, err
+		}
+		udpConnMu.Lock()
+		delete(udpConnIDs, addr)
+		udpConnMu.Unlock()
+	}
+	return nil, errors.New("no se pudo completar la petición udp")
+}
+
+// udpConnectionID devuelve un connection ID vigente para el tracker
+func udpConnectionID(conn *net.UDPConn) (uint64, error) {
+	addr := conn.RemoteAddr().String()
+	udpConnMu.Lock()
+	c, ok := udpConnIDs[addr]
+	udpConnMu.Unlock()
+	if ok && time.Since(c.obtained) < udpConnIDTTL {
+		return c.id, nil
+	}
+
+	resp, err := udpRoundTrip(conn, udpConnectRequest(), udpActionConnect)
+	if err != nil {
+		return 0, err
+	}
+	id := binary.BigEndian.Uint64(resp[8:16])
+	storeConnID(addr, id)
+	return id, nil
+}
+
+func storeConnID(addr string, id uint64) {
+	udpConnMu.Lock()
+	defer udpConnMu.Unlock()
+	udpConnIDs[addr] = udpConnID{id: id, obtained: time.Now()}
+}
+
+func udpConnectRequest() []byte {
+	req := binary.BigEndian.AppendUint64(make([]byte, 0, 16), udpProtocolID)
+	req = binary.BigEndian.AppendUint32(req, udpActionConnect)
+	return binary.BigEndian.AppendUint32(req, 0)
+}
+
+// udpRoundTrip envía req con reintentos (timeout udpBaseTimeout*2^n) y
+// devuelve la respuesta validada de la acción esperada.
+func udpRoundTrip(conn *net.UDPConn, req []byte, action uint32) ([]byte, error) {
+	timeout := udpBaseTimeout
+	var lastErr error
+	for attempt := 0; attempt < udpMaxAttempts; attempt++ {
+		resp, err := udpExchangeRaw(conn, req, action, timeout)
+		if err == nil {
+			return resp, nil
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return nil, err
+		}
+		lastErr = err
+		timeout *= 2
+	}
+	return nil, fmt.Errorf("tracker udp sin respuesta tras %d intentos: %w", udpMaxAttempts, lastErr)
+}
+
+// udpExchange hace un único intento de connect y devuelve el connection ID
+func udpExchange(conn *net.UDPConn, req []byte, action uint32, timeout time.Duration) (uint64, error) {
+	resp, err := udpExchangeRaw(conn, req, action, timeout)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(resp[8:16]), nil
+}
+
+// udpExchangeRaw envía req con un transaction_id nuevo y espera la respuesta
+// que lo lleve, descartando paquetes de otras transacciones.
+func udpExchangeRaw(conn *net.UDPConn, req []byte, action uint32, timeout time.Duration) ([]byte, error) {
+	txID := randomUint32()
+	binary.BigEndian.PutUint32(req[12:16], txID)
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 4096)
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n < 8 || binary.BigEndian.Uint32(buf[4:8]) != txID {
+			continue
+		}
+		resp := buf[:n]
+		switch got := binary.BigEndian.Uint32(resp[0:4]); {
+		case got == udpActionError:
+			return nil, &udpTrackerError{msg: string(resp[8:])}
+		case got != action:
+			return nil, fmt.Errorf("acción inesperada en respuesta udp: %d", got)
+		case action == udpActionConnect && n < 16:
+			return nil, errors.New("respuesta de connect udp demasiado corta")
+		}
+		return append([]byte(nil), resp...), nil
+	}
+}
+
+// udpTrackerError es un error devuelto por el tracker (action 3)
+type udpTrackerError struct {
+	msg string
+}
+
+func (e *udpTrackerError) Error() string {
+	return "tracker error: " + e.msg
+}
+
+// peerIdBytes ajusta el peer id a los 20 bytes del protocolo
+func peerIdBytes(peerId string) []byte {
+	b := make([]byte, 20)
+	copy(b, peerId)
+	return b
+}
+
+func randomUint32() uint32 {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return binary.BigEndian.Uint32(b[:])
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"src/logging"
+	"src/peerwire"
+)
+
+// StartWebSeeds agrega al manager los web seeds del torrent (url-list o ws=
+// del magnet); descargan piezas cuando los peers son lentos o no hay
+func StartWebSeeds(cfg *ClientConfig, mgr *peerwire.Manager) {
+	for _, u := range cfg.WebSeeds {
+		if err := mgr.AddWebSeed(u, cfg.FileName, cfg.Files); err != nil {
+			log.Warn("web seed ignorado", logging.InfoHash(cfg.InfoHash), "url", u, logging.Err(err))
+			continue
+		}
+		log.Info("usando web seed", logging.InfoHash(cfg.InfoHash), "url", u)
+	}
+}
+
+// activeWebSeeds cuenta los web seeds que no están en backoff
+func activeWebSeeds(mgr *peerwire.Manager) int {
+	n := 0
+	for _, ws := range mgr.WebSeeds() {
+		if ws.Active {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,434 @@
+package dht
+
+// dht/dht.go
+// Nodo Kademlia (BEP 5): KRPC bencodeado sobre UDP, tabla de k-buckets,
+// tokens para announce_peer y almacén de peers por info_hash.
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"src/bencode"
+	"src/logging"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tiempo de espera de la respuesta a una query
+	queryTimeout = 2 * time.Second
+	// los secretos de los tokens rotan cada tokenRotation; se acepta el anterior
+	tokenRotation = 5 * time.Minute
+	// un peer anunciado se olvida si no se re-anuncia en este tiempo
+	peerTTL = 30 * time.Minute
+	// intervalo del mantenimiento (refresco de la tabla y expiración de peers)
+	refreshInterval = 5 * time.Minute
+	// máximo de peers devueltos en "values"
+	maxValues = 50
+
+	maxPacket = 4096
+)
+
+// DHT es un nodo de la DHT escuchando en un socket UDP
+type DHT struct {
+	id    NodeID
+	conn  *net.UDPConn
+	table *routingTable
+
+	// queries en vuelo: transaction id -> canal de respuesta
+	pendingMu sync.Mutex
+	pending   map[string]chan map[string]interface{}
+	nextTx    uint16
+
+	// secretos para tokens (actual y anterior)
+	tokenMu   sync.Mutex
+	secrets   [2][]byte
+	rotatedAt time.Time
+
+	// peers anunciados a este nodo
+	peersMu sync.Mutex
+	peers   map[NodeID]map[string]time.Time // info_hash -> "ip:port" -> último announce
+
+	bootMu    sync.Mutex
+	bootstrap []string
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+	Logger    *slog.Logger
+}
+
+// New crea un nodo DHT con id aleatorio escuchando en listenAddr (UDP)
+func New(listenAddr string) (*DHT, error) {
+	laddr, err := net.ResolveUDPAddr("udp", listenAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on udp %s: %w", listenAddr, err)
+	}
+	id := RandomNodeID()
+	d := &DHT{
+		id:      id,
+		conn:    conn,
+		table:   newRoutingTable(id),
+		pending: make(map[string]chan map[string]interface{}),
+		peers:   make(map[NodeID]map[string]time.Time),
+		stopCh:  make(chan struct{}),
+		Logger:  logging.For("dht"),
+	}
+	d.secrets[0], d.secrets[1] = randomSecret(), randomSecret()
+	d.rotatedAt = time.Now()
+	return d, nil
+}
+
+// Start lanza la lectura de paquetes y el mantenimiento periódico
+func (d *DHT) Start() {
+	d.Logger.Info("DHT node listening", "node_id", d.id.String(), "addr", d.conn.LocalAddr().String())
+	go d.readLoop()
+	go d.maintenanceLoop()
+}
+
+// Stop cierra el socket y detiene las rutinas del nodo
+func (d *DHT) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stopCh)
+		d.conn.Close()
+	})
+}
+
+// ID devuelve el id del nodo
+func (d *DHT) ID() NodeID { return d.id }
+
+// Addr devuelve la dirección UDP local del nodo
+func (d *DHT) Addr() *net.UDPAddr { return d.conn.LocalAddr().(*net.UDPAddr) }
+
+// NodeCount devuelve cuántos contactos hay en la tabla de ruteo
+func (d *DHT) NodeCount() int { return d.table.size() }
+
+// Bootstrap contacta los nodos de addrs (host:port) y llena la tabla con un
+// find_node de nuestro propio id. Se guardan para re-bootstrap si la tabla se vacía.
+func (d *DHT) Bootstrap(addrs []string) error {
+	d.bootMu.Lock()
+	d.bootstrap = addrs
+	d.bootMu.Unlock()
+	contacted := 0
+	for _, a := range addrs {
+		udpAddr, err := net.ResolveUDPAddr("udp", a)
+		if err != nil {
+			d.Logger.Warn("bootstrap failed", "node", a, logging.Err(err))
+			continue
+		}
+		if udpAddr.Port == d.Addr().Port && (udpAddr.IP.IsLoopback() || udpAddr.IP.IsUnspecified()) {
+			continue // nosotros mismos
+		}
+		if _, err := d.ping(udpAddr); err != nil {
+			d.Logger.Warn("bootstrap failed", "node", a, logging.Err(err))
+			continue
+		}
+		contacted++
+	}
+	if contacted == 0 {
+		return errors.New("ningún nodo de bootstrap respondió")
+	}
+	d.lookup(d.id, false)
+	d.Logger.Info("bootstrap completed", "nodes", d.table.size())
+	return nil
+}
+
+// ---- transporte KRPC ----
+
+func (d *DHT) readLoop() {
+	buf := make([]byte, maxPacket)
+	for {
+		n, addr, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-d.stopCh:
+				return
+			default:
+			}
+			continue
+		}
+		msg, err := bencode.Decode(bytes.NewReader(buf[:n]))
+		if err != nil {
+			continue
+		}
+		d.handleMessage(msg, addr)
+	}
+}
+
+func (d *DHT) handleMessage(msg map[string]interface{}, addr *net.UDPAddr) {
+	tx, _ := msg["t"].(string)
+	switch y, _ := msg["y"].(string); y {
+	case "q":
+		d.handleQuery(msg, tx, addr)
+	case "r", "e":
+		d.pendingMu.Lock()
+		ch, ok := d.pending[tx]
+		delete(d.pending, tx)
+		d.pendingMu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+}
+
+func (d *DHT) send(msg map[string]interface{}, addr *net.UDPAddr) error {
+	_, err := d.conn.WriteToUDP(bencode.Encode(msg), addr)
+	return err
+}
+
+// query envía la query method con args a addr y espera la respuesta "r".
+// Los nodos que responden se agregan a la tabla de ruteo.
+func (d *DHT) query(addr *net.UDPAddr, method string, args map[string]interface{}) (map[string]interface{}, error) {
+	args["id"] = string(d.id[:])
+
+	d.pendingMu.Lock()
+	d.nextTx++
+	var tb [2]byte
+	binary.BigEndian.PutUint16(tb[:], d.nextTx)
+	tx := string(tb[:])
+	ch := make(chan map[string]interface{}, 1)
+	d.pending[tx] = ch
+	d.pendingMu.Unlock()
+
+	msg := map[string]interface{}{"t": tx, "y": "q", "q": method, "a": args}
+	if err := d.send(msg, addr); err != nil {
+		d.pendingMu.Lock()
+		delete(d.pending, tx)
+		d.pendingMu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		if y, _ := resp["y"].(string); y == "e" {
+			return nil, fmt.Errorf("krpc error de %s: %v", addr, resp["e"])
+		}
+		r, ok := resp["r"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("respuesta inválida de %s", addr)
+		}
+		id, ok := nodeIDFrom(r["id"])
+		if !ok {
+			return nil, fmt.Errorf("respuesta sin id de %s", addr)
+		}
+		d.nodeSeen(id, addr)
+		return r, nil
+	case <-time.After(queryTimeout):
+		d.pendingMu.Lock()
+		delete(d.pending, tx)
+		d.pendingMu.Unlock()
+		return nil, fmt.Errorf("timeout esperando %s de %s", method, addr)
+	case <-d.stopCh:
+		return nil, errors.New("dht detenida")
+	}
+}
+
+// nodeSeen actualiza la tabla con un nodo activo. Si su bucket está lleno se
+// hace ping al contacto menos visto y se lo reemplaza si no responde.
+func (d *DHT) nodeSeen(id NodeID, addr *net.UDPAddr) {
+	oldest := d.table.seen(id, addr)
+	if oldest == nil {
+		return
+	}
+	go func() {
+		if _, err := d.ping(oldest.addr); err != nil {
+			d.table.replace(oldest, id, addr)
+		}
+	}()
+}
+
+// queryNode es query para un contacto conocido: cuenta los fallos en la tabla
+func (d *DHT) queryNode(n *node, method string, args map[string]interface{}) (map[string]interface{}, error) {
+	r, err := d.query(n.addr, method, args)
+	if err != nil {
+		d.table.failed(n.id)
+	}
+	return r, err
+}
+
+func (d *DHT) ping(addr *net.UDPAddr) (NodeID, error) {
+	r, err := d.query(addr, "ping", map[string]interface{}{})
+	if err != nil {
+		return NodeID{}, err
+	}
+	id, _ := nodeIDFrom(r["id"])
+	return id, nil
+}
+
+// ---- tokens ----
+
+// token devuelve el token que se entrega a ip en get_peers
+func (d *DHT) token(ip net.IP) string {
+	d.tokenMu.Lock()
+	defer d.tokenMu.Unlock()
+	d.rotateSecretsLocked()
+	return tokenFor(d.secrets[0], ip)
+}
+
+// validToken acepta tokens generados con el secreto actual o el anterior
+func (d *DHT) validToken(tok string, ip net.IP) bool {
+	d.tokenMu.Lock()
+	defer d.tokenMu.Unlock()
+	d.rotateSecretsLocked()
+	return tok == tokenFor(d.secrets[0], ip) || tok == tokenFor(d.secrets[1], ip)
+}
+
+func (d *DHT) rotateSecretsLocked() {
+	if time.Since(d.rotatedAt) < tokenRotation {
+		return
+	}
+	d.secrets[1] = d.secrets[0]
+	d.secrets[0] = randomSecret()
+	d.rotatedAt = time.Now()
+}
+
+func tokenFor(secret []byte, ip net.IP) string {
+	h := sha1.New()
+	h.Write(secret)
+	h.Write(ip.To16())
+	return string(h.Sum(nil)[:8])
+}
+
+func randomSecret() []byte {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return b
+}
+
+// ---- almacén de peers ----
+
+func (d *DHT) storePeer(infoHash NodeID, addr string) {
+	d.peersMu.Lock()
+	defer d.peersMu.Unlock()
+	m := d.peers[infoHash]
+	if m == nil {
+		m = make(map[string]time.Time)
+		d.peers[infoHash] = m
+	}
+	m[addr] = time.Now()
+}
+
+// localPeers devuelve los peers anunciados a este nodo para infoHash
+func (d *DHT) localPeers(infoHash NodeID) []string {
+	d.peersMu.Lock()
+	defer d.peersMu.Unlock()
+	var out []string
+	for addr, at := range d.peers[infoHash] {
+		if time.Since(at) > peerTTL {
+			continue
+		}
+		out = append(out, addr)
+		if len(out) >= maxValues {
+			break
+		}
+	}
+	return out
+}
+
+func (d *DHT) expirePeers() {
+	d.peersMu.Lock()
+	defer d.peersMu.Unlock()
+	for ih, m := range d.peers {
+		for addr, at := range m {
+			if time.Since(at) > peerTTL {
+				delete(m, addr)
+			}
+		}
+		if len(m) == 0 {
+			delete(d.peers, ih)
+		}
+	}
+}
+
+// maintenanceLoop refresca la tabla (re-bootstrap si quedó vacía) y expira peers
+func (d *DHT) maintenanceLoop() {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.expirePeers()
+			d.bootMu.Lock()
+			boot := d.bootstrap
+			d.bootMu.Unlock()
+			if d.table.size() == 0 && len(boot) > 0 {
+				_ = d.Bootstrap(boot)
+			} else {
+				d.lookup(d.id, false)
+			}
+		case <-d.stopCh:
+			return
+		}
+	}
+}
+
+// ---- codificación compacta ----
+
+func nodeIDFrom(v interface{}) (NodeID, bool) {
+	var id NodeID
+	s, ok := v.(string)
+	if !ok || len(s) != 20 {
+		return id, false
+	}
+	copy(id[:], s)
+	return id, true
+}
+
+// encodeNodes codifica contactos en "compact node info" (26 bytes: id, ip, puerto)
+func encodeNodes(nodes []*node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		ip := n.addr.IP.To4()
+		if ip == nil {
+			continue
+		}
+		b.Write(n.id[:])
+		b.Write(ip)
+		var port [2]byte
+		binary.BigEndian.PutUint16(port[:], uint16(n.addr.Port))
+		b.Write(port[:])
+	}
+	return b.String()
+}
+
+func decodeNodes(s string) []*node {
+	var out []*node
+	for i := 0; i+26 <= len(s); i += 26 {
+		var id NodeID
+		copy(id[:], s[i:i+20])
+		ip := net.IPv4(s[i+20], s[i+21], s[i+22], s[i+23])
+		port := int(binary.BigEndian.Uint16([]byte(s[i+24 : i+26])))
+		if port == 0 {
+			continue
+		}
+		out = append(out, &node{id: id, addr: &net.UDPAddr{IP: ip, Port: port}})
+	}
+	return out
+}
+
+// encodePeer codifica ip:port en "compact peer info" (6 bytes)
+func encodePeer(ip net.IP, port int) string {
+	b := make([]byte, 6)
+	copy(b, ip.To4())
+	binary.BigEndian.PutUint16(b[4:], uint16(port))
+	return string(b)
+}
+
+func decodePeer(s string) (string, bool) {
+	if len(s) != 6 {
+		return "", false
+	}
+	port := binary.BigEndian.Uint16([]byte(s[4:6]))
+	if port == 0 {
+		return "", false
+	}
+	return fmt.Sprintf("%d.%d.%d.%d:%d", s[0], s[1], s[2], s[3], port), true
+}
@@ -0,0 +1,255 @@
+package dht
+
+import (
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testNodes = 20
+
+// idWithPrefix devuelve un id que comparte exactamente cpl bits con self
+func idWithPrefix(rng *rand.Rand, self NodeID, cpl int) NodeID {
+	var id NodeID
+	rng.Read(id[:])
+	for i := 0; i < cpl; i++ {
+		mask := byte(0x80) >> (i % 8)
+		id[i/8] = id[i/8]&^mask | self[i/8]&mask
+	}
+	mask := byte(0x80) >> (cpl % 8)
+	id[cpl/8] = id[cpl/8]&^mask | ^self[cpl/8]&mask
+	return id
+}
+
+// sortedByDistance devuelve ids ordenados por distancia a target
+func sortedByDistance(target NodeID, ids []NodeID) []NodeID {
+	out := append([]NodeID(nil), ids...)
+	sort.Slice(out, func(i, j int) bool { return closerTo(target, out[i], out[j]) })
+	return out
+}
+
+// Los buckets lejanos se llenan y dejan de aceptar contactos, pero los nodos
+// cercanos a nuestro id (buckets profundos, poco poblados) se conservan todos
+func TestRoutingTableKeepsClosest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	self := RandomNodeID()
+	rt := newRoutingTable(self)
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+
+	// el bucket 0 (la mitad del espacio) recibe 3K candidatos
+	var far []NodeID
+	for i := 0; i < 3*K; i++ {
+		id := idWithPrefix(rng, self, 0)
+		far = append(far, id)
+		oldest := rt.seen(id, addr)
+		if i < K && oldest != nil {
+			t.Fatalf("bucket con %d nodos pidió reemplazo", i)
+		}
+		if i >= K && (oldest == nil || oldest.id != far[0]) {
+			t.Fatalf("bucket lleno: se esperaba el primer contacto como candidato, llegó %v", oldest)
+		}
+	}
+	if got := len(rt.buckets[0]); got != K {
+		t.Fatalf("bucket 0 con %d nodos, máximo %d", got, K)
+	}
+
+	// un contacto visto de nuevo pasa al final (el más reciente)
+	rt.seen(far[0], addr)
+	if oldest := rt.seen(idWithPrefix(rng, self, 0), addr); oldest == nil || oldest.id != far[1] {
+		t.Fatalf("tras refrescar far[0] el candidato debía ser far[1], llegó %v", oldest)
+	}
+	// replace saca al que no respondió y guarda el nuevo
+	newcomer := far[K]
+	rt.replace(&node{id: far[1]}, newcomer, addr)
+	if rt.bucketFor(newcomer) != 0 || rt.buckets[0][K-1].id != newcomer || len(rt.buckets[0]) != K {
+		t.Fatal("replace no dejó al nuevo contacto en el bucket")
+	}
+
+	// un nodo por bucket profundo: todos entran
+	var near []NodeID
+	for cpl := 1; cpl <= 40; cpl++ {
+		id := idWithPrefix(rng, self, cpl)
+		if rt.seen(id, addr) != nil {
+			t.Fatalf("bucket %d con espacio pidió reemplazo", cpl)
+		}
+		if b := rt.bucketFor(id); b != cpl {
+			t.Fatalf("id con prefijo de %d bits en el bucket %d", cpl, b)
+		}
+		near = append(near, id)
+	}
+	if got := rt.size(); got != K+len(near) {
+		t.Fatalf("tabla con %d nodos, se esperaban %d", got, K+len(near))
+	}
+
+	// los K más cercanos a nosotros son los de los buckets más profundos
+	want := sortedByDistance(self, near)[:K]
+	got := rt.closest(self, K)
+	for i := range want {
+		if got[i].id != want[i] {
+			t.Fatalf("closest[%d] = %v, se esperaba %v", i, got[i].id, want[i])
+		}
+	}
+
+	// para un target cualquiera closest coincide con ordenar toda la tabla
+	var all []NodeID
+	for _, bucket := range rt.buckets {
+		for _, n := range bucket {
+			all = append(all, n.id)
+		}
+	}
+	target := RandomNodeID()
+	want = sortedByDistance(target, all)[:K]
+	for i, n := range rt.closest(target, K) {
+		if n.id != want[i] {
+			t.Fatalf("closest(target)[%d] = %v, se esperaba %v", i, n.id, want[i])
+		}
+	}
+}
+
+// startNetwork levanta testNodes nodos en loopback que hacen bootstrap
+// contra el primero
+func startNetwork(t *testing.T) []*DHT {
+	t.Helper()
+	var nodes []*DHT
+	for i := 0; i < testNodes; i++ {
+		d, err := New("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Start()
+		t.Cleanup(d.Stop)
+		nodes = append(nodes, d)
+	}
+	seed := nodes[0].Addr().String()
+	for _, d := range nodes[1:] {
+		if err := d.Bootstrap([]string{seed}); err != nil {
+			t.Fatalf("bootstrap de %v: %v", d.ID(), err)
+		}
+	}
+	// una segunda ronda (lo que hace el mantenimiento) para que los primeros
+	// en entrar conozcan a los que llegaron después
+	for _, d := range nodes {
+		d.lookup(d.id, false)
+	}
+	for _, d := range nodes {
+		if d.NodeCount() < K {
+			t.Fatalf("nodo %v con sólo %d contactos", d.ID(), d.NodeCount())
+		}
+	}
+	return nodes
+}
+
+// find_node iterativo converge en los K nodos más cercanos al target
+func TestFindNodeConverges(t *testing.T) {
+	nodes := startNetwork(t)
+	for i := 0; i < 5; i++ {
+		target := RandomNodeID()
+		from := nodes[(i*7+3)%len(nodes)]
+
+		var ids []NodeID
+		for _, d := range nodes {
+			if d != from {
+				ids = append(ids, d.ID())
+			}
+		}
+		want := sortedByDistance(target, ids)[:K]
+
+		res := from.lookup(target, false)
+		if len(res.closest) != K {
+			t.Fatalf("lookup devolvió %d nodos, se esperaban %d", len(res.closest), K)
+		}
+		for j, n := range res.closest {
+			if n.id != want[j] {
+				t.Fatalf("lookup %d: closest[%d] = %v, se esperaba %v", i, j, n.id, want[j])
+			}
+		}
+	}
+}
+
+// Un announce_peer con token válido queda guardado en los nodos cercanos al
+// info_hash y otro nodo lo encuentra con get_peers
+func TestAnnounceThenGetPeers(t *testing.T) {
+	nodes := startNetwork(t)
+	infoHash := [20]byte(RandomNodeID())
+	announcer := nodes[testNodes/2]
+	if _, err := announcer.Announce(infoHash, 6881); err != nil {
+		t.Fatalf("Announce: %v", err)
+	}
+
+	stored := 0
+	var seeker *DHT
+	for _, d := range nodes {
+		if len(d.localPeers(NodeID(infoHash))) > 0 {
+			stored++
+		} else if d != announcer && seeker == nil {
+			seeker = d
+		}
+	}
+	if stored == 0 || seeker == nil {
+		t.Fatalf("announce guardado en %d nodos", stored)
+	}
+
+	// seeker no tiene el peer localmente: tiene que venir de otro nodo
+	peers, err := seeker.GetPeers(infoHash)
+	if err != nil {
+		t.Fatalf("GetPeers: %v", err)
+	}
+	if !containsString(peers, "127.0.0.1:6881") {
+		t.Fatalf("get_peers devolvió %v, se esperaba 127.0.0.1:6881", peers)
+	}
+}
+
+// announce_peer rechaza tokens inventados y tokens de hace más de una rotación
+func TestAnnounceRejectsBadToken(t *testing.T) {
+	nodes := startNetwork(t)
+	client, server := nodes[1], nodes[2]
+	infoHash := RandomNodeID()
+	announce := func(tok string) error {
+		_, err := client.query(server.Addr(), "announce_peer", map[string]interface{}{
+			"info_hash": string(infoHash[:]),
+			"port":      int64(6881),
+			"token":     tok,
+		})
+		return err
+	}
+	// expire simula el paso de una rotación de secretos
+	expire := func() {
+		server.tokenMu.Lock()
+		server.rotatedAt = time.Now().Add(-tokenRotation - time.Second)
+		server.tokenMu.Unlock()
+	}
+
+	if err := announce("bogus"); err == nil || !strings.Contains(err.Error(), "bad token") {
+		t.Fatalf("token inventado: %v, se esperaba bad token", err)
+	}
+
+	r, err := client.query(server.Addr(), "get_peers", map[string]interface{}{"info_hash": string(infoHash[:])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := r["token"].(string)
+	if tok == "" {
+		t.Fatal("get_peers sin token")
+	}
+	// un token de otra IP no sirve
+	if server.validToken(tok, net.IPv4(10, 0, 0, 1)) {
+		t.Fatal("token aceptado desde otra IP")
+	}
+
+	// tras una rotación el token sigue valiendo (secreto anterior)...
+	expire()
+	if err := announce(tok); err != nil {
+		t.Fatalf("token de la rotación anterior rechazado: %v", err)
+	}
+	// ...tras dos ya no
+	expire()
+	if err := announce(tok); err == nil || !strings.Contains(err.Error(), "bad token") {
+		t.Fatalf("token vencido: %v, se esperaba bad token", err)
+	}
+	if peers := server.localPeers(infoHash); len(peers) != 1 {
+		t.Fatalf("peers guardados: %v, se esperaba sólo el announce válido", peers)
+	}
+}
@@ -0,0 +1,97 @@
+package dht
+
+import (
+	"net"
+	"src/logging"
+	"strconv"
+)
+
+// códigos de error KRPC
+const (
+	errProtocol = 203
+	errMethod   = 204
+)
+
+// handleQuery responde las queries de otros nodos: ping, find_node,
+// get_peers y announce_peer.
+func (d *DHT) handleQuery(msg map[string]interface{}, tx string, addr *net.UDPAddr) {
+	args, _ := msg["a"].(map[string]interface{})
+	method, _ := msg["q"].(string)
+	id, ok := nodeIDFrom(args["id"])
+	if !ok {
+		d.sendError(tx, addr, errProtocol, "missing or invalid id")
+		return
+	}
+	d.nodeSeen(id, addr)
+
+	r := map[string]interface{}{"id": string(d.id[:])}
+	switch method {
+	case "ping":
+
+	case "find_node":
+		target, ok := nodeIDFrom(args["target"])
+		if !ok {
+			d.sendError(tx, addr, errProtocol, "missing or invalid target")
+			return
+		}
+		r["nodes"] = encodeNodes(d.table.closest(target, K))
+
+	case "get_peers":
+		infoHash, ok := nodeIDFrom(args["info_hash"])
+		if !ok {
+			d.sendError(tx, addr, errProtocol, "missing or invalid info_hash")
+			return
+		}
+		r["token"] = d.token(addr.IP)
+		if peers := d.localPeers(infoHash); len(peers) > 0 {
+			values := make([]interface{}, 0, len(peers))
+			for _, p := range peers {
+				host, portStr, err := net.SplitHostPort(p)
+				port, _ := strconv.Atoi(portStr)
+				if ip := net.ParseIP(host); err == nil && ip.To4() != nil {
+					values = append(values, encodePeer(ip, port))
+				}
+			}
+			r["values"] = values
+		} else {
+			r["nodes"] = encodeNodes(d.table.closest(infoHash, K))
+		}
+
+	case "announce_peer":
+		infoHash, ok := nodeIDFrom(args["info_hash"])
+		if !ok {
+			d.sendError(tx, addr, errProtocol, "missing or invalid info_hash")
+			return
+		}
+		tok, _ := args["token"].(string)
+		if !d.validToken(tok, addr.IP) {
+			d.sendError(tx, addr, errProtocol, "bad token")
+			return
+		}
+		port, _ := args["port"].(int64)
+		if implied, _ := args["implied_port"].(int64); implied != 0 {
+			port = int64(addr.Port)
+		}
+		if port <= 0 || port > 65535 {
+			d.sendError(tx, addr, errProtocol, "invalid port")
+			return
+		}
+		peer := net.JoinHostPort(addr.IP.String(), strconv.Itoa(int(port)))
+		d.storePeer(infoHash, peer)
+		d.Logger.Debug("announce_peer received", logging.InfoHashHex(infoHash.String()), logging.Peer(peer))
+
+	default:
+		d.sendError(tx, addr, errMethod, "method unknown")
+		return
+	}
+
+	_ = d.send(map[string]interface{}{"t": tx, "y": "r", "r": r}, addr)
+}
+
+func (d *DHT) sendError(tx string, addr *net.UDPAddr, code int, msg string) {
+	_ = d.send(map[string]interface{}{
+		"t": tx,
+		"y": "e",
+		"e": []interface{}{int64(code), msg},
+	}, addr)
+}
@@ -0,0 +1,174 @@
+package dht
+
+import (
+	"errors"
+	"sort"
+	"src/logging"
+	"sync"
+)
+
+// alpha es la cantidad de queries en paralelo de una búsqueda iterativa
+const alpha = 3
+
+// lookupResult es lo que devuelve una búsqueda iterativa
+type lookupResult struct {
+	closest []*node           // nodos que respondieron, ordenados por distancia
+	tokens  map[NodeID]string // token de get_peers de cada nodo
+	peers   []string          // valores de get_peers (ip:port)
+}
+
+// lookup busca iterativamente los K nodos más cercanos a target. Con
+// getPeers usa get_peers (recoge tokens y peers); si no, find_node.
+func (d *DHT) lookup(target NodeID, getPeers bool) *lookupResult {
+	res := &lookupResult{tokens: make(map[NodeID]string)}
+	shortlist := d.table.closest(target, K)
+	known := make(map[NodeID]bool)
+	for _, n := range shortlist {
+		known[n.id] = true
+	}
+	queried := make(map[NodeID]bool)
+	seenPeers := make(map[string]bool)
+	var mu sync.Mutex
+
+	for {
+		// próximos alpha nodos sin consultar entre los K más cercanos
+		sort.Slice(shortlist, func(i, j int) bool { return closerTo(target, shortlist[i].id, shortlist[j].id) })
+		var batch []*node
+		for i := 0; i < len(shortlist) && i < K && len(batch) < alpha; i++ {
+			if !queried[shortlist[i].id] {
+				batch = append(batch, shortlist[i])
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		var wg sync.WaitGroup
+		for _, n := range batch {
+			queried[n.id] = true
+			wg.Add(1)
+			go func(n *node) {
+				defer wg.Done()
+				method, args := "find_node", map[string]interface{}{"target": string(target[:])}
+				if getPeers {
+					method, args = "get_peers", map[string]interface{}{"info_hash": string(target[:])}
+				}
+				r, err := d.queryNode(n, method, args)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					// descartar de la shortlist a los que no responden
+					for i, s := range shortlist {
+						if s.id == n.id {
+							shortlist = append(shortlist[:i], shortlist[i+1:]...)
+							break
+						}
+					}
+					return
+				}
+				res.closest = append(res.closest, n)
+				if tok, ok := r["token"].(string); ok {
+					res.tokens[n.id] = tok
+				}
+				if values, ok := r["values"].([]interface{}); ok {
+					for _, v := range values {
+						s, _ := v.(string)
+						if addr, ok := decodePeer(s); ok && !seenPeers[addr] {
+							seenPeers[addr] = true
+							res.peers = append(res.peers, addr)
+						}
+					}
+				}
+				nodes, _ := r["nodes"].(string)
+				for _, nn := range decodeNodes(nodes) {
+					if nn.id == d.id || known[nn.id] {
+						continue
+					}
+					known[nn.id] = true
+					shortlist = append(shortlist, nn)
+				}
+			}(n)
+		}
+		wg.Wait()
+	}
+
+	sort.Slice(res.closest, func(i, j int) bool { return closerTo(target, res.closest[i].id, res.closest[j].id) })
+	if len(res.closest) > K {
+		res.closest = res.closest[:K]
+	}
+	return res
+}
+
+// GetPeers busca en la DHT los peers (ip:port) que anunciaron infoHash
+func (d *DHT) GetPeers(infoHash [20]byte) ([]string, error) {
+	if d.table.size() == 0 {
+		return nil, errors.New("tabla de ruteo vacía, falta bootstrap")
+	}
+	res := d.lookup(NodeID(infoHash), true)
+	peers := d.withLocalPeers(NodeID(infoHash), res.peers)
+	d.Logger.Info("get_peers", logging.InfoHash(infoHash), "peers", len(peers), "nodes", len(res.closest))
+	return peers, nil
+}
+
+// Announce anuncia que escuchamos en port para infoHash a los K nodos más
+// cercanos, usando los tokens que entregaron en get_peers. Devuelve también
+// los peers encontrados en la búsqueda.
+func (d *DHT) Announce(infoHash [20]byte, port int) ([]string, error) {
+	if d.table.size() == 0 {
+		return nil, errors.New("tabla de ruteo vacía, falta bootstrap")
+	}
+	res := d.lookup(NodeID(infoHash), true)
+
+	announced := 0
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, n := range res.closest {
+		tok, ok := res.tokens[n.id]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(n *node, tok string) {
+			defer wg.Done()
+			_, err := d.queryNode(n, "announce_peer", map[string]interface{}{
+				"info_hash": string(infoHash[:]),
+				"port":      int64(port),
+				"token":     tok,
+			})
+			if err == nil {
+				mu.Lock()
+				announced++
+				mu.Unlock()
+			}
+		}(n, tok)
+	}
+	wg.Wait()
+
+	peers := d.withLocalPeers(NodeID(infoHash), res.peers)
+	d.Logger.Info("announce_peer", logging.InfoHash(infoHash), "port", port,
+		"accepted", announced, "nodes", len(res.closest), "peers", len(peers))
+	if announced == 0 {
+		return peers, errors.New("ningún nodo aceptó el announce")
+	}
+	return peers, nil
+}
+
+// withLocalPeers agrega a peers los anunciados directamente a este nodo
+func (d *DHT) withLocalPeers(infoHash NodeID, peers []string) []string {
+	for _, p := range d.localPeers(infoHash) {
+		if !containsString(peers, p) {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
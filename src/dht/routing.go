@@ -0,0 +1,175 @@
+package dht
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math/bits"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// K es el tamaño de cada k-bucket y de los resultados de find_node/get_peers
+	K = 8
+	// un nodo que no respondió a este número de queries seguidas se descarta
+	maxNodeFailures = 2
+)
+
+// NodeID es el identificador de 160 bits de un nodo (mismo espacio que los info_hash)
+type NodeID [20]byte
+
+// RandomNodeID genera un id aleatorio
+func RandomNodeID() NodeID {
+	var id NodeID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+func (id NodeID) String() string { return hex.EncodeToString(id[:]) }
+
+// distance es la métrica XOR de Kademlia
+func distance(a, b NodeID) NodeID {
+	var d NodeID
+	for i := range a {
+		d[i] = a[i] ^ b[i]
+	}
+	return d
+}
+
+// closerTo indica si a está más cerca de target que b
+func closerTo(target, a, b NodeID) bool {
+	da, db := distance(target, a), distance(target, b)
+	for i := range da {
+		if da[i] != db[i] {
+			return da[i] < db[i]
+		}
+	}
+	return false
+}
+
+// commonPrefixLen devuelve cuántos bits iniciales comparten a y b (160 si son iguales)
+func commonPrefixLen(a, b NodeID) int {
+	for i, x := range distance(a, b) {
+		if x != 0 {
+			return i*8 + bits.LeadingZeros8(x)
+		}
+	}
+	return 160
+}
+
+// node es un contacto de la tabla de ruteo
+type node struct {
+	id       NodeID
+	addr     *net.UDPAddr
+	lastSeen time.Time
+	failures int
+}
+
+// routingTable agrupa los contactos en 160 k-buckets según el prefijo común
+// con nuestro id: el bucket i guarda nodos que comparten exactamente i bits.
+type routingTable struct {
+	mu      sync.Mutex
+	self    NodeID
+	buckets [160][]*node // de menos a más recientemente visto
+}
+
+func newRoutingTable(self NodeID) *routingTable {
+	return &routingTable{self: self}
+}
+
+func (rt *routingTable) bucketFor(id NodeID) int {
+	return min(commonPrefixLen(rt.self, id), 159)
+}
+
+// seen registra que id respondió o nos consultó desde addr. Si el bucket está
+// lleno devuelve el contacto menos visto para que el llamador lo ping-ee y,
+// si no responde, lo reemplace con replace.
+func (rt *routingTable) seen(id NodeID, addr *net.UDPAddr) (oldest *node) {
+	if id == rt.self {
+		return nil
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	b := rt.bucketFor(id)
+	bucket := rt.buckets[b]
+	for i, n := range bucket {
+		if n.id == id {
+			n.addr = addr
+			n.lastSeen = time.Now()
+			n.failures = 0
+			rt.buckets[b] = append(append(bucket[:i:i], bucket[i+1:]...), n)
+			return nil
+		}
+	}
+	if len(bucket) < K {
+		rt.buckets[b] = append(bucket, &node{id: id, addr: addr, lastSeen: time.Now()})
+		return nil
+	}
+	oldest = new(node)
+	*oldest = *bucket[0]
+	return oldest
+}
+
+// replace cambia el contacto old (que no respondió) por uno nuevo
+func (rt *routingTable) replace(old *node, id NodeID, addr *net.UDPAddr) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	b := rt.bucketFor(old.id)
+	bucket := rt.buckets[b]
+	for i, n := range bucket {
+		if n.id == old.id {
+			rt.buckets[b] = append(append(bucket[:i:i], bucket[i+1:]...), &node{id: id, addr: addr, lastSeen: time.Now()})
+			return
+		}
+	}
+}
+
+// failed cuenta una query sin respuesta y descarta el nodo si acumula demasiadas
+func (rt *routingTable) failed(id NodeID) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	b := rt.bucketFor(id)
+	bucket := rt.buckets[b]
+	for i, n := range bucket {
+		if n.id == id {
+			n.failures++
+			if n.failures >= maxNodeFailures {
+				rt.buckets[b] = append(bucket[:i:i], bucket[i+1:]...)
+			}
+			return
+		}
+	}
+}
+
+// closest devuelve hasta n contactos ordenados por distancia a target
+func (rt *routingTable) closest(target NodeID, n int) []*node {
+	rt.mu.Lock()
+	var all []*node
+	for _, bucket := range rt.buckets {
+		for _, nd := range bucket {
+			cp := *nd
+			all = append(all, &cp)
+		}
+	}
+	rt.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool { return closerTo(target, all[i].id, all[j].id) })
+	if len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+// size devuelve cuántos contactos hay en la tabla
+func (rt *routingTable) size() int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	total := 0
+	for _, bucket := range rt.buckets {
+		total += len(bucket)
+	}
+	return total
+}
@@ -1,14 +1,23 @@
 package main
 
 import (
+    "flag"
+    "fmt"
     "os"
     "strings"
 	"src/dns/internal"
+	"src/logging"
 )
 
 func main() {
 
-	log := internal.NewLogger("MAIN")
+	logOpts := logging.RegisterFlags(nil)
+	flag.Parse()
+	if err := logging.Setup(*logOpts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	log := logging.For("main")
 
 	log.Info("Starting DNS Service")
 
@@ -16,7 +25,7 @@ func main() {
     peers := []string{}
     if peersEnv != "" {
         peers = strings.Split(peersEnv, ",")
-		log.Info("Loaded peers : %v", peers)
+		log.Info("Loaded peers", "peers", peers)
     } else{
 		log.Warn("No peers specified; running standalone")
 	}
@@ -32,7 +41,7 @@ func main() {
 
     s := internal.New()
     go  func() {
-		log.Info("Starting UDP resolver at :8053")
+		log.Info("Starting UDP resolver", "addr", ":8053")
 		internal.StartUDP(s, ":8053")
 		
 	}()
@@ -42,6 +51,6 @@ func main() {
 		internal.StartGossip(peers, s)
 	}()
 	
-	log.Info("Starting API on :6969")
+	log.Info("Starting API", "addr", ":6969")
 	internal.Start(s)
 }
@@ -4,9 +4,10 @@ import (
 	"encoding/json"
 	"net"
 	"net/http"
+	"src/logging"
 )
 
-var apilog = NewLogger("API")
+var apilog = logging.For("dns-api")
 
 // jsonResponse is a helper for sending JSON responses
 func jsonResponse(w http.ResponseWriter, status int, body any) {
@@ -17,7 +18,7 @@ func jsonResponse(w http.ResponseWriter, status int, body any) {
 
 func Start(store *Store) {
 
-	apilog.Info("Starting HTTP server on port 6969")
+	apilog.Info("starting HTTP server", "addr", ":6969")
 
 	mux := http.NewServeMux()
 
@@ -25,7 +26,7 @@ func Start(store *Store) {
 	//      POST /add
 	// ============================
 	mux.HandleFunc("/add", func(w http.ResponseWriter, r *http.Request) {
-		apilog.Debug("Received /add request")
+		apilog.Debug("received /add request")
 
 		if r.Method != http.MethodPost {
 			jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{
@@ -37,7 +38,7 @@ func Start(store *Store) {
 		var rec Record
 
 		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
-			apilog.Error("Failed to decode JSON: %v", err)
+			apilog.Error("failed to decode JSON", logging.Err(err))
 			jsonResponse(w, http.StatusBadRequest, map[string]string{
 				"error": "invalid JSON body",
 			})
@@ -72,7 +73,7 @@ func Start(store *Store) {
 
 		if rec.TTL <= 0 {
 			rec.TTL = 60 // default TTL if user does not provide one
-			apilog.Warn("TTL not provided for %s, defaulting to 60", rec.Name)
+			apilog.Warn("TTL not provided, defaulting to 60", "name", rec.Name)
 		}
 
 		store.Add(rec)
@@ -87,7 +88,7 @@ func Start(store *Store) {
 	//      POST /del
 	// ============================
 	mux.HandleFunc("/del", func(w http.ResponseWriter, r *http.Request) {
-		apilog.Debug("Received /del request")
+		apilog.Debug("received /del request")
 
 		if r.Method != http.MethodPost {
 			jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{
@@ -99,7 +100,7 @@ func Start(store *Store) {
 		var data map[string]string
 
 		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-			apilog.Error("Failed to decode JSON: %v", err)
+			apilog.Error("failed to decode JSON", logging.Err(err))
 			jsonResponse(w, http.StatusBadRequest, map[string]string{
 				"error": "invalid JSON body",
 			})
@@ -126,7 +127,7 @@ func Start(store *Store) {
 	//      GET /list
 	// ============================
 	mux.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
-		apilog.Debug("Received /list request")
+		apilog.Debug("received /list request")
 
 		if r.Method != http.MethodGet {
 			jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{
@@ -141,7 +142,7 @@ func Start(store *Store) {
 
 	// start server
 	if err := http.ListenAndServe(":6969", mux); err != nil {
-		apilog.Error("HTTP server failed: %v", err)
+		apilog.Error("HTTP server failed", logging.Err(err))
 	}
 }
 
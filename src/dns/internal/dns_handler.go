@@ -5,11 +5,12 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"src/logging"
 	"strings"
 	"time"
 )
 
-var dnslog = NewLogger("DNS")
+var dnslog = logging.For("dns")
 
 // DNS constants
 const (
@@ -39,25 +40,25 @@ type Header struct {
 func StartUDP(store *Store, listenAddr string) {
 	addr, err := net.ResolveUDPAddr("udp", listenAddr)
 	if err != nil {
-		dnslog.Error("Failed to resolve address %s: %v", listenAddr, err)
+		dnslog.Error("failed to resolve address", "addr", listenAddr, logging.Err(err))
 		return
 	}
 
 	conn, err := net.ListenUDP("udp", addr)
 	if err != nil {
-		dnslog.Error("Failed to start UDP listener: %v", err)
+		dnslog.Error("failed to start UDP listener", logging.Err(err))
 		return
 	}
 	defer conn.Close()
 
-	dnslog.Info("DNS UDP server listening on %s", listenAddr)
+	dnslog.Info("DNS UDP server listening", "addr", listenAddr)
 
 	buf := make([]byte, 512)
 
 	for {
 		n, client, err := conn.ReadFromUDP(buf)
 		if err != nil {
-			dnslog.Warn("Error reading UDP packet: %v", err)
+			dnslog.Warn("error reading UDP packet", logging.Err(err))
 			continue
 		}
 
@@ -70,7 +71,7 @@ func StartUDP(store *Store, listenAddr string) {
 // ================================
 func handleQuery(conn *net.UDPConn, client *net.UDPAddr, msg []byte, store *Store) {
 	if len(msg) < 12 {
-		dnslog.Warn("Received invalid DNS packet (too short) from %s", client)
+		dnslog.Warn("invalid DNS packet (too short)", "client", client.String())
 		return
 	}
 
@@ -85,7 +86,7 @@ func handleQuery(conn *net.UDPConn, client *net.UDPAddr, msg []byte, store *Stor
 	if header.QDCount != 1 {
 		resp := buildErrorResponse(header.ID, RCODE_NI)
 		conn.WriteToUDP(resp, client)
-		dnslog.Warn("Received packet with QDCount=%d (unsupported)", header.QDCount)
+		dnslog.Warn("unsupported QDCount", "qdcount", header.QDCount)
 		return
 	}
 
@@ -96,13 +97,13 @@ func handleQuery(conn *net.UDPConn, client *net.UDPAddr, msg []byte, store *Stor
 
 	name := strings.TrimSuffix(strings.ToLower(qname), ".")
 
-	dnslog.Info("Query: %s (type=%d) from %s", name, qtype, client)
+	dnslog.Debug("query", "name", name, "type", qtype, "client", client.String())
 
 	// Only support A + IN
 	if qtype != TypeA || qclass != ClassIN {
 		resp := buildErrorResponse(header.ID, RCODE_NI)
 		conn.WriteToUDP(resp, client)
-		dnslog.Warn("Unsupported query type=%d for %s", qtype, name)
+		dnslog.Warn("unsupported query type", "name", name, "type", qtype)
 		return
 	}
 
@@ -111,7 +112,7 @@ func handleQuery(conn *net.UDPConn, client *net.UDPAddr, msg []byte, store *Stor
 	if !ok {
 		resp := buildErrorResponse(header.ID, RCODE_NX)
 		conn.WriteToUDP(resp, client)
-		dnslog.Info("NXDOMAIN: %s", name)
+		dnslog.Info("NXDOMAIN", "name", name)
 		return
 	}
 
@@ -120,7 +121,7 @@ func handleQuery(conn *net.UDPConn, client *net.UDPAddr, msg []byte, store *Stor
 	if remainingTTL <= 0 {
 		resp := buildErrorResponse(header.ID, RCODE_NX)
 		conn.WriteToUDP(resp, client)
-		dnslog.Info("NXDOMAIN (TTL expired) for %s", name)
+		dnslog.Info("NXDOMAIN (TTL expired)", "name", name)
 		return
 	}
 
@@ -138,7 +139,7 @@ func handleQuery(conn *net.UDPConn, client *net.UDPAddr, msg []byte, store *Stor
 
 	conn.WriteToUDP(resp, client)
 
-	dnslog.Info("Response A %s → %s (TTL=%d)", name, ip, remainingTTL)
+	dnslog.Debug("response A", "name", name, "ip", ip, "ttl", remainingTTL)
 }
 
 // ================================
@@ -8,11 +8,12 @@ package internal
 import (
 	"encoding/json"
 	"net"
+	"src/logging"
 	"strings"
 	"time"
 )
 
-var gossiplog = NewLogger("GOSSIP")
+var gossiplog = logging.For("dns-gossip")
 
 func StartGossip(peers []string, s *Store) {
 
@@ -21,20 +22,20 @@ func StartGossip(peers []string, s *Store) {
 		ln, err := net.Listen("tcp", ":5300")
 
 		if err != nil {
-			gossiplog.Error("Fialed to start TCP listener :%v", err)
+			gossiplog.Error("failed to start TCP listener", logging.Err(err))
 			return
 		}
 
-		gossiplog.Info("TCP server listening on :5300")
+		gossiplog.Info("TCP server listening", "addr", ":5300")
 
 		for {
 			conn, err := ln.Accept()
 			if err != nil {
-				gossiplog.Warn("Failed to accept connection: %v", err)
+				gossiplog.Warn("failed to accept connection", logging.Err(err))
 				continue
 			}
 
-			gossiplog.Info("Accepted connection from %s", conn.RemoteAddr())
+			gossiplog.Debug("accepted connection", "remote", conn.RemoteAddr().String())
 			go handleConn(conn, s)
 		}
 	}()
@@ -50,11 +51,11 @@ func StartGossip(peers []string, s *Store) {
 				conn, err := net.DialTimeout("tcp", peer, time.Second)
 
 				if err != nil {
-					gossiplog.Warn("Failed to connect to peer %s: %v", peer, err)
+					gossiplog.Warn("failed to connect to peer", "peer", peer, logging.Err(err))
 					continue
 				}
 
-				gossiplog.Debug("Sending update to peer %s (%d records)", peer, len(payload.Records))
+				gossiplog.Debug("sending update", "peer", peer, "records", len(payload.Records))
 				conn.Write(b)
 				conn.Close()
 			}
@@ -72,23 +73,23 @@ func handleConn(conn net.Conn, s *Store) {
 	dec := json.NewDecoder(conn)
 
 	if err := dec.Decode(&msg); err != nil {
-		gossiplog.Warn("Failed to decode message from %s: %v", conn.RemoteAddr(), err)
+		gossiplog.Warn("failed to decode message", "remote", conn.RemoteAddr().String(), logging.Err(err))
 		return
 	}
 
-	gossiplog.Info("Received %d records from %s", len(msg.Records), conn.RemoteAddr())
+	gossiplog.Info("received records", "records", len(msg.Records), "remote", conn.RemoteAddr().String())
 	for _, r := range msg.Records {
 
 		if len(r.IPs) == 0 {
-			gossiplog.Warn("Ignoring record with no IPs: %s", r.Name)
+			gossiplog.Warn("ignoring record with no IPs", "name", r.Name)
 			continue
 		}
 
 		s.Add(r)
 
-		gossiplog.Debug("Updated record: %s -> [%s]",
-			r.Name,
-			strings.Join(r.IPs, ","),
+		gossiplog.Debug("updated record",
+			"name", r.Name,
+			"ips", strings.Join(r.IPs, ","),
 		)
 	}
 }
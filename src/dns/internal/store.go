@@ -2,12 +2,13 @@
 package internal
 
 import (
+	"src/logging"
 	"strings"
 	"sync"
 	"time"
 )
 
-var storelog = NewLogger("STORE")
+var storelog = logging.For("dns-store")
 
 // Store holds the local DNS records and provides tthread-safe access
 type Store struct {
@@ -27,7 +28,7 @@ func (s *Store) Add(r Record) {
 
 	r.Timestamp = time.Now()
 	s.records[r.Name] = r
-	storelog.Info("Added/Updated record: %s -> [%s] (TTL %d)", r.Name, strings.Join(r.IPs, ","), r.TTL)
+	storelog.Info("added/updated record", "name", r.Name, "ips", strings.Join(r.IPs, ","), "ttl", r.TTL)
 }
 
 func (s *Store) Delete(name string) {
@@ -36,9 +37,9 @@ func (s *Store) Delete(name string) {
 
 	if _, ok := s.records[name]; ok {
 		delete(s.records, name)
-		storelog.Info("Deleted record: %s", name)
+		storelog.Info("deleted record", "name", name)
 	} else {
-		storelog.Warn("Attempted to delete non-existent record: %s", name)
+		storelog.Warn("attempted to delete non-existent record", "name", name)
 	}
 }
 
@@ -48,9 +49,9 @@ func (s *Store) Get(name string) (Record, bool) {
 	r, ok := s.records[name]
 
 	if ok {
-		storelog.Debug("Retrieved record: %s -> [%s]", r.Name, strings.Join(r.IPs, ","))
+		storelog.Debug("retrieved record", "name", r.Name, "ips", strings.Join(r.IPs, ","))
 	} else {
-		storelog.Debug("Record not found: %s", name)
+		storelog.Debug("record not found", "name", name)
 	}
 
 	return r, ok
@@ -65,6 +66,6 @@ func (s *Store) List() []Record {
 		out = append(out, r)
 	}
 
-	storelog.Debug("Listing all records, total: %d", len(out))
+	storelog.Debug("listing all records", "total", len(out))
 	return out
 }
@@ -0,0 +1,167 @@
+// Package logging es la capa de logs de todos los binarios (cliente, tracker,
+// DNS): log/slog con niveles, un logger por componente y campos comunes
+// (info_hash, peer, piece). La salida es texto (key=value) o JSON, una línea
+// por evento, elegida con --log-format; --log-level filtra por nivel.
+//
+// Los loggers de componente se pueden crear en variables de paquete antes de
+// que main llame a Setup: cada mensaje usa la configuración vigente.
+//
+//	var log = logging.For("peerwire")
+//	log.Debug("bloque recibido", logging.Peer(addr), logging.Piece(i), "begin", begin)
+package logging
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// ComponentKey es el campo con el componente que emitió el log
+const ComponentKey = "component"
+
+// Options es la configuración de los logs
+type Options struct {
+	Level  string // debug | info | warn | error
+	Format string // text | json
+}
+
+var (
+	level = new(slog.LevelVar) // info por defecto
+	base  atomic.Pointer[slog.Handler]
+)
+
+func init() {
+	var h slog.Handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level})
+	base.Store(&h)
+	slog.SetDefault(slog.New(&lazyHandler{}))
+}
+
+// RegisterFlags agrega --log-level y --log-format a fs (flag.CommandLine si
+// es nil). Después de parsear, pasar las opciones a Setup.
+func RegisterFlags(fs *flag.FlagSet) *Options {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	opts := &Options{}
+	fs.StringVar(&opts.Level, "log-level", "info", "nivel mínimo de los logs: debug|info|warn|error")
+	fs.StringVar(&opts.Format, "log-format", "text", "formato de los logs: text (key=value) o json (una línea JSON por evento)")
+	return opts
+}
+
+// Setup aplica opts a todos los loggers, escribiendo en stdout
+func Setup(opts Options) error {
+	return SetupWriter(opts, os.Stdout)
+}
+
+// SetupWriter es Setup escribiendo en w
+func SetupWriter(opts Options, w io.Writer) error {
+	var lv slog.Level
+	if opts.Level != "" {
+		if err := lv.UnmarshalText([]byte(opts.Level)); err != nil {
+			return fmt.Errorf("--log-level inválido %q (debug|info|warn|error)", opts.Level)
+		}
+	}
+
+	hopts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		h = slog.NewTextHandler(w, hopts)
+	case "json":
+		h = slog.NewJSONHandler(w, hopts)
+	default:
+		return fmt.Errorf("--log-format inválido %q (text|json)", opts.Format)
+	}
+	level.Set(lv)
+	base.Store(&h)
+	return nil
+}
+
+// SetLevel cambia el nivel mínimo en caliente
+func SetLevel(l slog.Level) { level.Set(l) }
+
+// For devuelve el logger de un componente ("peerwire", "tracker", "pex", ...)
+func For(component string) *slog.Logger {
+	return slog.New(&lazyHandler{}).With(ComponentKey, component)
+}
+
+// InfoHash es el campo info_hash (hex) de un torrent
+func InfoHash(ih [20]byte) slog.Attr {
+	return slog.String("info_hash", hex.EncodeToString(ih[:]))
+}
+
+// InfoHashHex es InfoHash para un info_hash que ya está en hex (tracker)
+func InfoHashHex(ih string) slog.Attr { return slog.String("info_hash", ih) }
+
+// Peer es el campo peer con la dirección ip:puerto de un peer
+func Peer(addr string) slog.Attr { return slog.String("peer", addr) }
+
+// Piece es el campo piece con el índice de una pieza
+func Piece(i int) slog.Attr { return slog.Int("piece", i) }
+
+// Err es el campo err; nil se omite
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.Attr{}
+	}
+	return slog.String("err", err.Error())
+}
+
+// lazyHandler aplica sus WithAttrs/WithGroup sobre el handler configurado en
+// el momento de cada log, así los loggers creados antes de Setup lo respetan.
+type lazyHandler struct {
+	ops   []func(slog.Handler) slog.Handler
+	cache atomic.Pointer[resolved]
+}
+
+type resolved struct {
+	base *slog.Handler
+	h    slog.Handler
+}
+
+func (h *lazyHandler) handler() slog.Handler {
+	b := base.Load()
+	if r := h.cache.Load(); r != nil && r.base == b {
+		return r.h
+	}
+	out := *b
+	for _, op := range h.ops {
+		out = op(out)
+	}
+	h.cache.Store(&resolved{base: b, h: out})
+	return out
+}
+
+func (h *lazyHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= level.Level()
+}
+
+func (h *lazyHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler().Handle(ctx, r)
+}
+
+func (h *lazyHandler) with(op func(slog.Handler) slog.Handler) *lazyHandler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &lazyHandler{ops: append(ops, op)}
+}
+
+func (h *lazyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(func(b slog.Handler) slog.Handler { return b.WithAttrs(attrs) })
+}
+
+func (h *lazyHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(func(b slog.Handler) slog.Handler { return b.WithGroup(name) })
+}
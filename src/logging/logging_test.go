@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSetupAppliesToExistingLoggers(t *testing.T) {
+	log := For("pex") // creado antes de Setup, como las variables de paquete
+	peer := log.With(InfoHash([20]byte{0xab}), Peer("10.0.0.1:6881"))
+
+	var buf bytes.Buffer
+	if err := SetupWriter(Options{Level: "info", Format: "json"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	defer Setup(Options{})
+
+	peer.Debug("no se ve")
+	peer.Warn("pex inválido", Piece(3), Err(errors.New("boom")), Err(nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("se esperaba una línea (debug filtrado), hay %d: %q", len(lines), buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"level":     "WARN",
+		"msg":       "pex inválido",
+		"component": "pex",
+		"info_hash": "ab00000000000000000000000000000000000000",
+		"peer":      "10.0.0.1:6881",
+		"piece":     float64(3),
+		"err":       "boom",
+	}
+	for k, v := range want {
+		if rec[k] != v {
+			t.Errorf("%s = %v, se esperaba %v", k, rec[k], v)
+		}
+	}
+
+	buf.Reset()
+	if err := SetupWriter(Options{Level: "debug", Format: "text"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	log.Debug("bloque recibido", Piece(7))
+	if got := buf.String(); !strings.Contains(got, "level=DEBUG") || !strings.Contains(got, "component=pex piece=7") {
+		t.Fatalf("salida de texto inesperada: %q", got)
+	}
+}
+
+func TestSetupInvalid(t *testing.T) {
+	if err := SetupWriter(Options{Level: "verbose"}, &bytes.Buffer{}); err == nil {
+		t.Error("--log-level inválido aceptado")
+	}
+	if err := SetupWriter(Options{Format: "xml"}, &bytes.Buffer{}); err == nil {
+		t.Error("--log-format inválido aceptado")
+	}
+}
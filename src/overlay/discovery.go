@@ -22,10 +22,10 @@ func checkNodeAlive(addr string, timeout time.Duration) bool {
 func (o *Overlay) Discover(infoHash string, initialPeers []string, ttl int) error {
 
 	//fmt.Printf("[DISCOVER] Iniciando discovery para infohash %s con TTL %d y bootstraps: %v\n", infoHash, ttl, initialPeers)
-	o.Logger.Info("Iniciando discovery para infohash %s con TTL %d y bootstrap: %v\n",infoHash,ttl,initialPeers)
+	o.Logger.Info("iniciando discovery", "key", infoHash, "ttl", ttl, "bootstrap", initialPeers)
 
 	if len(initialPeers) == 0 {
-		o.Logger.Warn("Discover: initialPeers vacío")
+		o.Logger.Warn("discover: initialPeers vacío", "key", infoHash)
 		return fmt.Errorf("Discover: initialPeers vacío")
 	}
 	seen := make(map[string]struct{})
@@ -52,7 +52,7 @@ func (o *Overlay) Discover(infoHash string, initialPeers []string, ttl int) erro
 		// agrega con PeerId vacío si no tenemos peerId; LastSeen se ajusta en Announce si fuera necesario
 		pm := ProviderMeta{Addr: p, PeerId: "", Left: 0, LastSeen: now}
 		// fmt.Printf("%v", pm)
-		o.Logger.Debug("%v",pm)
+		o.Logger.Debug("provider de bootstrap", "key", infoHash, "addr", pm.Addr)
 		o.Store.Merge(infoHash, []ProviderMeta{pm})
 	}
 
@@ -110,7 +110,7 @@ func (o *Overlay) Discover(infoHash string, initialPeers []string, ttl int) erro
 	// último chequeo: si no hay providers en store para el infohash devolvemos error
 	finalList := o.Store.Lookup(infoHash, 1)
 	if len(finalList) == 0 {
-		o.Logger.Warn("Discover: no providers encontrados (quizá TTL o bootstraps fallaron)")
+		o.Logger.Warn("discover: no se encontraron providers (quizá TTL o bootstraps fallaron)", "key", infoHash)
 		return fmt.Errorf("Discover: no providers encontrados (quizá TTL o bootstraps fallaron)")
 	}
 
@@ -5,7 +5,8 @@ import (
 	"net"
 	"sort"
 	"time"
-	"src/utils"
+	"log/slog"
+	"src/logging"
 )
 
 // message types used on the wire
@@ -22,7 +23,7 @@ type Overlay struct {
 	peers      []string
 	listenAddr string
 	stopCh     chan struct{}
-	Logger     *utils.Logger
+	Logger     *slog.Logger
 }
 
 // NewOverlay crea un overlay con TTL por defecto de 90s
@@ -33,23 +34,23 @@ func NewOverlay(listenAddr string, peers []string) *Overlay {
 		peers: peers, 
 		listenAddr: listenAddr, 
 		stopCh: make(chan struct{}),
-		Logger: utils.NewLogger("Overlay")}
+		Logger: logging.For("overlay")}
 }
 
 // Start inicia el listener TCP y el loop de gossip periódico
 func (o *Overlay) Start() error {
-	o.Logger.Info("Iniciando Overlay en %s con peers %v", o.listenAddr, o.peers)
+	o.Logger.Info("iniciando overlay", "addr", o.listenAddr, "peers", o.peers)
 	
 	ln, err := net.Listen("tcp", o.listenAddr)
 	if err != nil {
-		o.Logger.Error("Fallo escuchando en %s: %v", o.listenAddr, err)
+		o.Logger.Error("fallo escuchando", "addr", o.listenAddr, logging.Err(err))
         return err
 	}
 	go o.ServeListener(ln)
 	go o.PeriodicGossip() // cada 8 seg
 	go o.PeriodicHealthCheck() // cada 10 seg
 
-	o.Logger.Info("Overlay iniciado correctamente")
+	o.Logger.Info("overlay iniciado")
 	return nil
 }
 
@@ -192,6 +193,8 @@ func sendWireMsg(addr string, msg wireMsg) {
 
 // Announce locally registers the provider and also tries to push to peers
 func (o *Overlay) Announce(infoHash string, p ProviderMeta) {
+	// LastSeen viaja en el push: con 0 el receptor lo descartaría como stale
+	p.LastSeen = time.Now().Unix()
 	_ = o.Store.Announce(infoHash, p)
 	// fire-and-forget push to bootstrap peers
 	msg := wireMsg{Type: "announce", InfoHash: infoHash, Providers: []ProviderMeta{p}}
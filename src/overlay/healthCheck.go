@@ -30,7 +30,7 @@ func (o *Overlay) checkDeadPeers() {
 			if now-pm.LastSeen < timeout {
 				alive = append(alive,pm)
 			} else {
-				o.Logger.Warn("Peer muerto: %s",pm.Addr)
+				o.Logger.Warn("provider muerto", "key", infoHash, "addr", pm.Addr)
 			}
 		}
 
@@ -11,6 +11,7 @@ import (
 // ProviderMeta representa a un peer que anunció un infohash
 type ProviderMeta struct {
 	Addr     string `json:"addr"`
+	Addr6    string `json:"addr6,omitempty"` // [ipv6]:puerto adicional del peer, si tiene
 	PeerId   string `json:"peer_id"`
 	Left     int64  `json:"left"`
 	LastSeen int64  `json:"last_seen"`
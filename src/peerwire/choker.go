@@ -0,0 +1,208 @@
+package peerwire
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultUploadSlots es la cantidad de peers a los que se sube a la vez
+	// (sin contar el slot de optimistic unchoke)
+	DefaultUploadSlots = 4
+
+	chokeInterval      = 10 * time.Second
+	optimisticInterval = 30 * time.Second
+)
+
+// uploadStats cuenta los bytes subidos a un peer y la tasa de la última ronda del choker
+type uploadStats struct {
+	mu       sync.Mutex
+	sent     int64   // bytes enviados en la ronda actual
+	rate     float64 // bytes/s en la última ronda
+	lastTick time.Time
+}
+
+func (u *uploadStats) add(n int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.sent += int64(n)
+}
+
+// sample cierra la ronda actual y devuelve la tasa de subida medida
+func (u *uploadStats) sample(now time.Time) float64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.lastTick.IsZero() {
+		if elapsed := now.Sub(u.lastTick).Seconds(); elapsed > 0 {
+			u.rate = float64(u.sent) / elapsed
+		}
+	}
+	u.sent = 0
+	u.lastTick = now
+	return u.rate
+}
+
+// UploadRate devuelve la tasa de subida a este peer medida en la última ronda (bytes/s)
+func (p *PeerConn) UploadRate() float64 {
+	p.upload.mu.Lock()
+	defer p.upload.mu.Unlock()
+	return p.upload.rate
+}
+
+// SetUploadSlots configura cuántos peers se mantienen unchoked por rendimiento
+func (m *Manager) SetUploadSlots(n int) {
+	if n <= 0 {
+		n = DefaultUploadSlots
+	}
+	m.chokeMu.Lock()
+	defer m.chokeMu.Unlock()
+	m.uploadSlots = n
+}
+
+func (p *PeerConn) chokePeer() {
+	if !p.AmChoking.CompareAndSwap(false, true) {
+		return
+	}
+	_ = p.SendMessage(MsgChoke, nil)
+}
+
+func (p *PeerConn) unchokePeer() {
+	if !p.AmChoking.CompareAndSwap(true, false) {
+		return
+	}
+	_ = p.SendMessage(MsgUnchoke, nil)
+}
+
+// isSeeding indica si ya tenemos todas las piezas
+func (m *Manager) isSeeding() bool {
+	if m.store == nil {
+		return false
+	}
+	for i := 0; i < m.store.NumPieces(); i++ {
+		if !m.store.HasPiece(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// peerInterested atiende un INTERESTED: si quedan slots libres se hace unchoke
+// de inmediato en lugar de esperar a la siguiente ronda del choker.
+func (m *Manager) peerInterested(p *PeerConn) {
+	m.chokeMu.Lock()
+	defer m.chokeMu.Unlock()
+	if !p.AmChoking.Load() {
+		return
+	}
+	unchoked := 0
+	for _, other := range m.snapshotPeers() {
+		if !other.AmChoking.Load() && other != m.optimistic {
+			unchoked++
+		}
+	}
+	if unchoked < m.uploadSlots {
+		p.log().Debug("unchoke por slot libre", "unchoked", unchoked+1, "slots", m.uploadSlots)
+		p.unchokePeer()
+	}
+}
+
+// chokerLoop ejecuta el algoritmo de choking cada chokeInterval
+func (m *Manager) chokerLoop() {
+	ticker := time.NewTicker(chokeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.rechoke(now)
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// rechoke elige los peers a los que subir: los uploadSlots peers interesados
+// con mejor tasa (la que nos dan mientras descargamos, la que les damos al
+// hacer seeding) más un slot optimista que rota cada optimisticInterval.
+func (m *Manager) rechoke(now time.Time) {
+	m.chokeMu.Lock()
+	defer m.chokeMu.Unlock()
+
+	seeding := m.isSeeding()
+	peers := m.snapshotPeers()
+	score := make(map[*PeerConn]float64, len(peers))
+	var interested []*PeerConn
+	for _, p := range peers {
+		up := p.upload.sample(now)
+		if seeding {
+			score[p] = up
+		} else {
+			score[p] = p.Rate()
+		}
+		if p.PeerInterested.Load() {
+			interested = append(interested, p)
+		}
+	}
+	sort.Slice(interested, func(i, j int) bool { return score[interested[i]] > score[interested[j]] })
+
+	unchoke := make(map[*PeerConn]bool)
+	for i := 0; i < len(interested) && i < m.uploadSlots; i++ {
+		unchoke[interested[i]] = true
+	}
+
+	// Optimistic unchoke: rotar cada optimisticInterval o si el actual ya no sirve
+	opt := m.optimistic
+	if opt == nil || unchoke[opt] || !opt.PeerInterested.Load() || !m.hasPeer(opt) ||
+		now.Sub(m.optimisticSince) >= optimisticInterval {
+		var candidates []*PeerConn
+		for _, p := range interested {
+			if !unchoke[p] {
+				candidates = append(candidates, p)
+			}
+		}
+		opt = nil
+		if len(candidates) > 0 {
+			opt = candidates[rand.Intn(len(candidates))]
+			if opt != m.optimistic {
+				opt.log().Debug("optimistic unchoke")
+			}
+		}
+		m.optimistic = opt
+		m.optimisticSince = now
+	}
+	if opt != nil {
+		unchoke[opt] = true
+	}
+
+	mode := "download"
+	if seeding {
+		mode = "upload"
+	}
+	m.log().Debug("ronda de choke", "rate", mode, "interested", len(interested), "unchoked", len(unchoke), "peers", len(peers))
+
+	for _, p := range peers {
+		if unchoke[p] {
+			p.unchokePeer()
+		} else {
+			p.chokePeer()
+		}
+	}
+}
+
+func (m *Manager) snapshotPeers() []*PeerConn {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]*PeerConn, 0, len(m.peers))
+	for p := range m.peers {
+		out = append(out, p)
+	}
+	return out
+}
+
+func (m *Manager) hasPeer(p *PeerConn) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.peers[p]
+	return ok
+}
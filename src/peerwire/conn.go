@@ -3,36 +3,40 @@ package peerwire
 import (
 	"fmt"
 	"net"
+	"src/logging"
 	"time"
 )
 
 func NewPeerConn(addr string, infoHash [20]byte, peerId [20]byte) (*PeerConn, error) {
-	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	conn, err := DialPeer(addr, infoHash, 5*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("error conectando al peer %s: %v", addr, err)
 	}
 
-	return &PeerConn{
-		Conn:           conn,
-		InfoHash:       infoHash,
-		PeerId:         peerId,
-		AmChoking:      true,
-		AmInterested:   false,
-		PeerChoking:    true,
-		PeerInterested: false,
-	}, nil
+	p := &PeerConn{
+		Conn:         conn,
+		InfoHash:     infoHash,
+		PeerId:       peerId,
+		AmInterested: false,
+		outgoing:     true,
+		logger:       log.With(logging.InfoHash(infoHash), logging.Peer(addr)),
+	}
+	p.AmChoking.Store(true)
+	p.PeerChoking.Store(true)
+	return p, nil
 }
 
 // NewPeerConnFromConn envuelve una conexión existente (aceptada por un listener)
 // para reutilizar la misma estructura y lógica de PeerConn.
 func NewPeerConnFromConn(conn net.Conn, infoHash [20]byte, peerId [20]byte) *PeerConn {
-	return &PeerConn{
-		Conn:           conn,
-		InfoHash:       infoHash,
-		PeerId:         peerId,
-		AmChoking:      true,
-		AmInterested:   false,
-		PeerChoking:    true,
-		PeerInterested: false,
+	p := &PeerConn{
+		Conn:         conn,
+		InfoHash:     infoHash,
+		PeerId:       peerId,
+		AmInterested: false,
+		logger:       log.With(logging.InfoHash(infoHash), logging.Peer(conn.RemoteAddr().String())),
 	}
+	p.AmChoking.Store(true)
+	p.PeerChoking.Store(true)
+	return p
 }
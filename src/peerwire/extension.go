@@ -0,0 +1,208 @@
+package peerwire
+
+import (
+	"bytes"
+	"fmt"
+	"src/bencode"
+	"src/logging"
+	"sync"
+)
+
+// Extension es una extensión del extension protocol (BEP 10) registrada en un
+// Manager (ut_metadata, ut_pex, ...). El Manager le asigna un id local que se
+// anuncia en el diccionario "m" del handshake extendido.
+type Extension struct {
+	// Name es el nombre con el que se anuncia en "m" (p. ej. "ut_metadata")
+	Name string
+	// HandshakeFields añade claves propias al handshake extendido (opcional)
+	HandshakeFields func() map[string]interface{}
+	// OnHandshake se llama al recibir el handshake extendido de un peer que
+	// también anuncia la extensión; hs es el diccionario completo (opcional)
+	OnHandshake func(p *PeerConn, hs map[string]interface{})
+	// Handle procesa un mensaje de la extensión recibido de p (sin el id)
+	Handle func(p *PeerConn, payload []byte)
+}
+
+// extensionRegistry guarda las extensiones del Manager por nombre y por id local
+type extensionRegistry struct {
+	mu     sync.RWMutex
+	byName map[string]byte
+	byID   map[byte]*Extension
+}
+
+// remoteExtensions es lo que el peer anunció en su handshake extendido
+type remoteExtensions struct {
+	mu        sync.RWMutex
+	ids       map[string]byte // nombre -> id con el que el peer espera esa extensión
+	handshake map[string]interface{}
+}
+
+// RegisterExtension registra ext en el Manager y devuelve su id local. Debe
+// llamarse antes de conectar peers: el handshake extendido se envía una vez.
+func (m *Manager) RegisterExtension(ext Extension) (byte, error) {
+	if ext.Name == "" || ext.Handle == nil {
+		return 0, fmt.Errorf("extensión inválida: falta nombre o handler")
+	}
+	r := &m.extensions
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.byName == nil {
+		r.byName = make(map[string]byte)
+		r.byID = make(map[byte]*Extension)
+	}
+	if _, dup := r.byName[ext.Name]; dup {
+		return 0, fmt.Errorf("extensión %s ya registrada", ext.Name)
+	}
+	if len(r.byID) >= 255 {
+		return 0, fmt.Errorf("no quedan ids para la extensión %s", ext.Name)
+	}
+	id := byte(len(r.byID) + 1) // 0 es el handshake extendido
+	e := ext
+	r.byName[ext.Name] = id
+	r.byID[id] = &e
+	return id, nil
+}
+
+// Extensions devuelve los nombres de las extensiones registradas
+func (m *Manager) Extensions() []string {
+	r := &m.extensions
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.byName))
+	for name := range r.byName {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (m *Manager) extensionByID(id byte) *Extension {
+	r := &m.extensions
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.byID[id]
+}
+
+// extendedHandshake arma el diccionario del handshake extendido con todas
+// las extensiones registradas
+func (m *Manager) extendedHandshake() map[string]interface{} {
+	r := &m.extensions
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make(map[string]interface{}, len(r.byName))
+	hs := map[string]interface{}{"m": names, "v": "JC0001"}
+	for id, ext := range r.byID {
+		names[ext.Name] = int64(id)
+		if ext.HandshakeFields == nil {
+			continue
+		}
+		for k, v := range ext.HandshakeFields() {
+			hs[k] = v
+		}
+	}
+	return hs
+}
+
+// SendExtendedHandshake envía el handshake extendido (BEP 10) con las
+// extensiones del Manager. No hace nada si el peer no activó el bit de
+// extensiones en su handshake.
+func (p *PeerConn) SendExtendedHandshake() error {
+	if !p.SupportsExtensions() || p.manager == nil {
+		return nil
+	}
+	return p.sendExtended(extHandshakeID, bencode.Encode(p.manager.extendedHandshake()))
+}
+
+// SendExtensionMessage envía payload a p por la extensión name, usando el id
+// que el peer le asignó. Falla si el peer no anunció la extensión.
+func (p *PeerConn) SendExtensionMessage(name string, payload []byte) error {
+	id := p.RemoteExtensionID(name)
+	if id == 0 {
+		return fmt.Errorf("el peer no soporta la extensión %s", name)
+	}
+	return p.sendExtended(id, payload)
+}
+
+// RemoteExtensionID devuelve el id que el peer asignó a la extensión name
+// (0 si no la anunció)
+func (p *PeerConn) RemoteExtensionID(name string) byte {
+	p.remoteExt.mu.RLock()
+	defer p.remoteExt.mu.RUnlock()
+	return p.remoteExt.ids[name]
+}
+
+// SupportsExtension indica si el peer anunció la extensión name
+func (p *PeerConn) SupportsExtension(name string) bool {
+	return p.RemoteExtensionID(name) != 0
+}
+
+// RemoteHandshake devuelve el handshake extendido recibido del peer (nil si
+// todavía no llegó). El mapa no debe modificarse.
+func (p *PeerConn) RemoteHandshake() map[string]interface{} {
+	p.remoteExt.mu.RLock()
+	defer p.remoteExt.mu.RUnlock()
+	return p.remoteExt.handshake
+}
+
+func (p *PeerConn) sendExtended(extID byte, payload []byte) error {
+	return p.SendMessage(MsgExtended, append([]byte{extID}, payload...))
+}
+
+// setRemoteHandshake guarda el handshake extendido del peer. Un nuevo
+// handshake reemplaza al anterior (BEP 10 permite reenviarlo).
+func (p *PeerConn) setRemoteHandshake(hs map[string]interface{}) {
+	ids := make(map[string]byte)
+	if m, ok := hs["m"].(map[string]interface{}); ok {
+		for name := range m {
+			if id := extensionID(hs, name); id != 0 {
+				ids[name] = id
+			}
+		}
+	}
+	p.remoteExt.mu.Lock()
+	defer p.remoteExt.mu.Unlock()
+	p.remoteExt.ids = ids
+	p.remoteExt.handshake = hs
+}
+
+// handleExtended atiende un MsgExtended: guarda el handshake extendido y
+// despacha el resto de mensajes a la extensión registrada con ese id local.
+func (p *PeerConn) handleExtended(payload []byte) {
+	if len(payload) == 0 || p.manager == nil {
+		return
+	}
+	if payload[0] == extHandshakeID {
+		hs, err := bencode.Decode(bytes.NewReader(payload[1:]))
+		if err != nil {
+			p.log().Debug("handshake extendido inválido", logging.Err(err))
+			return
+		}
+		p.setRemoteHandshake(hs)
+		r := &p.manager.extensions
+		r.mu.RLock()
+		var notify []*Extension
+		for name, id := range r.byName {
+			if ext := r.byID[id]; ext.OnHandshake != nil && p.SupportsExtension(name) {
+				notify = append(notify, ext)
+			}
+		}
+		r.mu.RUnlock()
+		for _, ext := range notify {
+			ext.OnHandshake(p, hs)
+		}
+		return
+	}
+	if ext := p.manager.extensionByID(payload[0]); ext != nil {
+		ext.Handle(p, payload[1:])
+	}
+}
+
+// extensionID devuelve el id que el peer asignó a la extensión name en el
+// diccionario "m" de su handshake extendido (0 si no la soporta).
+func extensionID(hs map[string]interface{}, name string) byte {
+	m, _ := hs["m"].(map[string]interface{})
+	id, _ := m[name].(int64)
+	if id <= 0 || id > 255 {
+		return 0
+	}
+	return byte(id)
+}
@@ -10,22 +10,35 @@ const (
 	pstr         = "BitTorrent protocol"
 	pstrlen      = 19
 	HandshakeLen = 49 + pstrlen
+
+	// bit 20 (contando desde el final) de los reserved bytes: extension protocol (BEP 10)
+	extensionReservedByte = 5
+	extensionReservedBit  = 0x10
 )
 
-// funcion donde se envia el handshake inicial y valida el recibido
-func (p *PeerConn) Handshake() error {
-	buf := new(bytes.Buffer)
+// handshakeReserved son los reserved bytes que anunciamos en el handshake
+var handshakeReserved = [8]byte{extensionReservedByte: extensionReservedBit}
 
+// writeHandshake envía nuestro handshake (pstr, reserved, info_hash, peer_id)
+func (p *PeerConn) writeHandshake() error {
+	buf := new(bytes.Buffer)
 	buf.WriteByte(pstrlen)
 	buf.WriteString(pstr)
-	buf.Write(make([]byte, 8))
+	buf.Write(handshakeReserved[:])
 	buf.Write(p.InfoHash[:])
 	buf.Write(p.PeerId[:])
-
-	//enviarlo
 	if _, err := p.Conn.Write(buf.Bytes()); err != nil {
 		return fmt.Errorf("error enviando handshake: %v", err)
 	}
+	return nil
+}
+
+// funcion donde se envia el handshake inicial y valida el recibido
+func (p *PeerConn) Handshake() error {
+	//enviarlo
+	if err := p.writeHandshake(); err != nil {
+		return err
+	}
 
 	// leer respuesta
 	resp := make([]byte, HandshakeLen)
@@ -41,22 +54,25 @@ func (p *PeerConn) Handshake() error {
 	if !bytes.Equal(resp[28:48], p.InfoHash[:]) {
 		return fmt.Errorf("info_hash no coincide")
 	}
+	p.SetRemoteReserved(resp[20:28])
 
-	fmt.Println("Handshake completado con exito")
+	p.log().Debug("handshake completado")
 	return nil
 }
 
 // SendHandshakeOnly envía nuestro handshake sin leer respuesta (útil para conexiones entrantes
 // donde ya hemos leído el handshake del peer remoto).
 func (p *PeerConn) SendHandshakeOnly() error {
-	buf := new(bytes.Buffer)
-	buf.WriteByte(pstrlen)
-	buf.WriteString(pstr)
-	buf.Write(make([]byte, 8))
-	buf.Write(p.InfoHash[:])
-	buf.Write(p.PeerId[:])
-	if _, err := p.Conn.Write(buf.Bytes()); err != nil {
-		return fmt.Errorf("error enviando handshake: %v", err)
-	}
-	return nil
+	return p.writeHandshake()
+}
+
+// SetRemoteReserved guarda los reserved bytes del handshake del peer remoto
+// (en conexiones entrantes los lee el listener antes de crear el PeerConn).
+func (p *PeerConn) SetRemoteReserved(reserved []byte) {
+	copy(p.remoteReserved[:], reserved)
+}
+
+// SupportsExtensions indica si el peer anunció el extension protocol (BEP 10)
+func (p *PeerConn) SupportsExtensions() bool {
+	return p.remoteReserved[extensionReservedByte]&extensionReservedBit != 0
 }
@@ -0,0 +1,32 @@
+package peerwire
+
+import (
+	"log/slog"
+	"src/logging"
+)
+
+// log is the package logger; peers and managers add their own fields
+// (info_hash, peer) on top of it.
+var log = logging.For("peerwire")
+
+// log returns the logger of this connection, tagged with its info hash and
+// remote address.
+func (p *PeerConn) log() *slog.Logger {
+	if p.logger != nil {
+		return p.logger
+	}
+	return log.With(logging.InfoHash(p.InfoHash), logging.Peer(peerAddrOf(p)))
+}
+
+// SetInfoHash tags the manager logs with the torrent info hash.
+func (m *Manager) SetInfoHash(ih [20]byte) {
+	m.logger.Store(log.With(logging.InfoHash(ih)))
+}
+
+// log returns the logger of this manager (see SetInfoHash).
+func (m *Manager) log() *slog.Logger {
+	if l := m.logger.Load(); l != nil {
+		return l
+	}
+	return log
+}
@@ -1,56 +1,17 @@
 package peerwire
 
 import (
-	"bytes"
 	"encoding/binary"
-	"fmt"
+	"src/logging"
 )
 
 const blockLen = 16 * 1024
 
-// requestNextBlocks requests up to a small window of blocks for the active piece
-func (p *PeerConn) requestNextBlocks(piece int) {
-	if p.manager == nil || p.manager.Store() == nil {
-		return
-	}
-	store := p.manager.Store()
-	plen := store.PieceLength()
-	// last piece size
-	if piece == store.NumPieces()-1 {
-		total := store.TotalLength()
-		plen = int(total - int64(store.PieceLength())*int64(store.NumPieces()-1))
-	}
-	// if we already have the piece skip
-	if store.HasPiece(piece) {
-		return
-	}
-	// establish per-peer state
-	if p.curPiece != piece {
-		p.curPiece = piece
-		p.curOffset = 0
-	}
-	begin := p.curOffset
-	// size to request this time
-	sz := blockLen
-	if begin+sz > plen {
-		sz = plen - begin
-	}
-	if sz <= 0 {
-		return
-	}
-	var buf bytes.Buffer
-	binary.Write(&buf, binary.BigEndian, uint32(piece))
-	binary.Write(&buf, binary.BigEndian, uint32(begin))
-	binary.Write(&buf, binary.BigEndian, uint32(sz))
-	_ = p.SendMessage(MsgRequest, buf.Bytes())
-	p.downloading = true
-}
-
 func (p *PeerConn) ReadLoop() {
 	for {
 		id, payload, err := p.ReadMessage()
 		if err != nil {
-			fmt.Println("Error con peer:", err)
+			p.log().Debug("conexión cerrada", logging.Err(err))
 			p.Close()
 			return
 		}
@@ -66,51 +27,51 @@ var IsPaused func() bool = func() bool { return false }
 func (p *PeerConn) handleMessage(id byte, payload []byte) {
 	switch id {
 	case MsgChoke:
-		p.PeerChoking = true
+		p.PeerChoking.Store(true)
+		// Un choke descarta nuestros REQUEST pendientes: reprogramarlos en otros peers
+		if p.manager != nil {
+			for pieceIndex, blocks := range p.manager.releasePeerBlocks(p, "peer nos hizo choke") {
+				p.manager.retryPendingBlocks(pieceIndex, blocks, p)
+			}
+		}
 	case MsgInterested:
-		p.PeerInterested = true
-		_ = p.SendMessage(MsgUnchoke, nil)
+		p.PeerInterested.Store(true)
+		// El choker decide a quién subir; con slots libres hace unchoke ya
+		if p.manager != nil {
+			p.manager.peerInterested(p)
+		} else {
+			p.unchokePeer()
+		}
 	case MsgNotInterested:
-		p.PeerInterested = false
+		p.PeerInterested.Store(false)
 	case MsgUnchoke:
-		p.PeerChoking = false
-		fmt.Println("Peer te unchokeo. Buscando pieza a solicitar...")
+		p.PeerChoking.Store(false)
+		p.log().Debug("unchoke recibido")
 		if p.manager != nil && p.manager.Store() != nil {
-			if !p.downloading && !IsPaused() {
-				picker := NewPiecePicker()
-				piece := picker.NextPieceFor(p, p.manager.Store())
-				if piece >= 0 {
-					p.manager.DownloadPieceParallel(piece)
-				} else {
-					fmt.Println("Nada que pedir a este peer")
+			if !p.downloading.Load() && !p.manager.Paused() {
+				if p.manager.FillPipeline(p) == 0 {
+					p.log().Debug("nada que pedir a este peer")
 				}
 			}
 		}
 	case MsgHave:
 		index := binary.BigEndian.Uint32(payload)
-		fmt.Println("Peer tiene pieza:", index)
 		if p.manager != nil && p.manager.Store() != nil {
 			n := p.manager.Store().NumPieces()
 			if int(index) < n {
-				exp := (n + 7) / 8
-				if len(p.remoteBF) != exp {
-					p.remoteBF = make([]byte, exp)
-				}
-				byteIdx := int(index) / 8
-				bit := 7 - (int(index) % 8)
-				p.remoteBF[byteIdx] |= (1 << uint(bit))
+				p.markRemoteHave(int(index), n)
 			}
 		}
 	case MsgBitfiled:
 		if p.manager != nil && p.manager.Store() != nil {
 			exp := (p.manager.Store().NumPieces() + 7) / 8
 			if len(payload) != exp {
-				fmt.Println("Bitfield inválido: tamaño", len(payload), "esperado", exp)
+				p.log().Warn("bitfield inválido", "size", len(payload), "expected", exp)
 				return
 			}
 		}
 		p.UpdateRemoteBitfield(payload)
-		fmt.Println("Bitfield inicial recibido")
+		p.log().Debug("bitfield recibido")
 		if p.manager != nil && p.manager.Store() != nil {
 			haveInterest := false
 			n := p.manager.Store().NumPieces()
@@ -125,54 +86,46 @@ func (p *PeerConn) handleMessage(id byte, payload []byte) {
 			}
 		}
 	case MsgPort:
-		fmt.Println("Puerto abierto")
+		p.log().Debug("mensaje port recibido")
 	case MsgPiece:
 		if len(payload) < 8 {
-			fmt.Println("Piece demasiado corta")
+			p.log().Warn("mensaje piece demasiado corto", "size", len(payload))
 			return
 		}
 		index := binary.BigEndian.Uint32(payload[0:4])
 		begin := binary.BigEndian.Uint32(payload[4:8])
 		block := payload[8:]
 
-		// Log: Mostrar desde qué peer se recibió el bloque
-		peerAddr := "unknown"
-		if p.Conn != nil && p.Conn.RemoteAddr() != nil {
-			peerAddr = p.Conn.RemoteAddr().String()
-		}
 		blockNum := int(begin) / blockLen
-		fmt.Printf("✓ Recibido bloque %d de pieza %d desde peer %s (offset %d, tamaño %d bytes)\n",
-			blockNum, index, peerAddr, begin, len(block))
+		p.log().Debug("bloque recibido", logging.Piece(int(index)), "block", blockNum, "begin", begin, "size", len(block))
 
 		// Guardar bloque en el storage
 		if p.manager != nil && p.manager.Store() != nil {
+			// Marcar bloque como recibido en el tracking Round-Robin; las copias
+			// duplicadas (endgame) se descartan antes de tocar el storage
+			if !p.manager.completeBlock(int(index), int(begin), len(block), p) {
+				p.log().Debug("bloque duplicado descartado", logging.Piece(int(index)), "block", blockNum)
+				return
+			}
+
 			if _, err := p.manager.Store().WriteBlock(int(index), int(begin), block); err != nil {
-				fmt.Println("Error guardando bloque:", err)
+				p.log().Error("error guardando bloque", logging.Piece(int(index)), "block", blockNum, logging.Err(err))
+				// Descartar la descarga en curso para que la pieza vuelva a elegirse
+				p.manager.abortPieceDownload(int(index))
 				return
 			}
+			p.manager.downloaded.Add(int64(len(block)))
 
-			// Marcar bloque como recibido en el tracking Round-Robin
-			blockNum := int(begin) / blockLen
 			p.manager.downloadsMu.Lock()
 			if pd, exists := p.manager.pieceDownloads[int(index)]; exists {
-				pd.blocksReceived[peerAddr]++
-
-				delete(pd.blocksPending, blockNum)
-				delete(pd.blocksInProgress, blockNum)
-
 				// Verificar si la pieza está completa
 				if len(pd.blocksPending) == 0 {
-					fmt.Printf("\n═══════════════════════════════════════════════\n")
-					fmt.Printf("✓ Pieza %d completada (Round-Robin)\n", index)
-					fmt.Printf("═══════════════════════════════════════════════\n")
-					fmt.Printf("Distribución de bloques por peer:\n")
 					totalBlocks := 0
-					for pAddr, count := range pd.blocksReceived {
-						fmt.Printf("  • Peer %s: %d bloques\n", pAddr, count)
+					for _, count := range pd.blocksReceived {
 						totalBlocks += count
 					}
-					fmt.Printf("Total: %d bloques\n", totalBlocks)
-					fmt.Printf("═══════════════════════════════════════════════\n\n")
+					p.manager.log().Debug("pieza descargada", logging.Piece(int(index)),
+						"blocks", totalBlocks, "blocks_by_peer", pd.blocksReceived)
 
 					// Limpiar tracking
 					delete(p.manager.pieceDownloads, int(index))
@@ -180,24 +133,14 @@ func (p *PeerConn) handleMessage(id byte, payload []byte) {
 			}
 			p.manager.downloadsMu.Unlock()
 
-			// Si la pieza está verificada y completa, buscar siguiente pieza
-			if p.manager.Store().HasPiece(int(index)) {
-				if !IsPaused() {
-					picker := NewPiecePicker()
-					nxt := picker.NextPieceFor(p, p.manager.Store())
-					if nxt >= 0 {
-						p.curPiece = nxt
-						p.curOffset = 0
-						p.downloading = false
-						p.manager.DownloadPieceParallel(nxt)
-					} else {
-						p.downloading = false
-						fmt.Println("Descarga completada, no hay más piezas")
-					}
-				} else {
-					p.downloading = false
-					fmt.Println("Cliente pausado, no se solicitan más piezas")
+			// Rellenar el pipeline de este peer con los siguientes bloques
+			if !p.manager.Paused() {
+				if p.manager.FillPipeline(p) == 0 && p.pipeline.inFlight() == 0 {
+					p.log().Debug("nada más que pedir a este peer")
 				}
+			} else if p.pipeline.inFlight() == 0 {
+				p.downloading.Store(false)
+				p.log().Debug("torrent pausado, no se piden más bloques")
 			}
 		}
 	case MsgRequest:
@@ -210,14 +153,25 @@ func (p *PeerConn) handleMessage(id byte, payload []byte) {
 		if p.manager == nil || p.manager.Store() == nil {
 			return
 		}
+		// No se atienden peticiones de peers a los que tenemos en choke
+		if p.AmChoking.Load() {
+			return
+		}
 		data, err := p.manager.Store().ReadBlock(int(idx), int(rbegin), int(rlen))
 		if err != nil {
 			return
 		}
-		_ = p.SendPiece(idx, rbegin, data)
+		if err := p.SendPiece(idx, rbegin, data); err == nil {
+			p.upload.add(len(data))
+			p.manager.uploaded.Add(int64(len(data)))
+		}
+	case MsgCancel:
+		// Las peticiones se atienden en cuanto llegan, no hay cola que cancelar
+	case MsgExtended:
+		p.handleExtended(payload)
 	case 255:
 		//ignorar
 	default:
-		fmt.Println("Mensaje desconocido", id)
+		p.log().Debug("mensaje desconocido", "id", id)
 	}
 }
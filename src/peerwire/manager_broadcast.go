@@ -1,16 +1,20 @@
 package peerwire
 
 import (
-	"fmt"
+	"log/slog"
+	"src/logging"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // PieceDownload rastrea el estado de descarga de una pieza desde múltiples peers
 type PieceDownload struct {
 	pieceIndex       int
-	blocksPending    map[int]bool      // bloque index -> true si falta descargar
-	blocksInProgress map[int]*PeerConn // bloque index -> peer que lo está descargando
-	blocksReceived   map[string]int    // peerAddr -> cantidad de bloques recibidos
+	blocksPending    map[int]bool        // bloque index -> true si falta descargar
+	blocksInProgress map[int]*PeerConn   // bloque index -> peer que lo está descargando
+	blocksReceived   map[string]int      // peerAddr -> cantidad de bloques recibidos
+	endgameRequests  map[int][]*PeerConn // bloque index -> peers adicionales a los que se pidió en endgame
 }
 
 type Manager struct {
@@ -19,6 +23,48 @@ type Manager struct {
 	store          PieceStore
 	pieceDownloads map[int]*PieceDownload // pieceIndex -> estado de descarga
 	downloadsMu    sync.Mutex             // protege pieceDownloads
+	picker         *PiecePicker           // rarest-first compartido por todos los peers
+
+	// pipeline de REQUEST por peer (ver pipeline.go)
+	pipeMu           sync.Mutex
+	pipelineDepth    int
+	pipelineAdaptive bool
+	requestTimeout   time.Duration
+	stopCh           chan struct{}
+	stopOnce         sync.Once
+
+	// choking (ver choker.go)
+	chokeMu         sync.Mutex
+	uploadSlots     int
+	optimistic      *PeerConn
+	optimisticSince time.Time
+
+	// info dictionary bencodeado que se sirve por ut_metadata (ver metadata.go)
+	metaMu   sync.RWMutex
+	metadata []byte
+
+	// extensiones del extension protocol (ver extension.go)
+	extensions extensionRegistry
+
+	// PEX (ver pex.go)
+	pexMu      sync.Mutex
+	listenPort int
+	onPexPeers func(addrs []string)
+
+	// bytes subidos y descargados (ver TransferTotals)
+	uploaded   atomic.Int64
+	downloaded atomic.Int64
+
+	// pausa de este torrent, además de la global IsPaused (ver SetPaused)
+	paused atomic.Bool
+
+	// web seeds y piezas que están bajando (ver webseed.go)
+	webMu     sync.Mutex
+	webSeeds  []*WebSeed
+	webPieces map[int]struct{}
+
+	// logger con el info_hash del torrent (ver SetInfoHash)
+	logger atomic.Pointer[slog.Logger]
 }
 
 func NewManager(store PieceStore) *Manager {
@@ -26,13 +72,83 @@ func NewManager(store PieceStore) *Manager {
 		peers:          make(map[*PeerConn]struct{}),
 		store:          store,
 		pieceDownloads: make(map[int]*PieceDownload),
+		webPieces:      make(map[int]struct{}),
+		pipelineDepth:  DefaultPipelineDepth,
+		requestTimeout: DefaultRequestTimeout,
+		uploadSlots:    DefaultUploadSlots,
+		stopCh:         make(chan struct{}),
 	}
+	numPieces := 0
+	if store != nil {
+		numPieces = store.NumPieces()
+	}
+	m.picker = NewPiecePicker(numPieces)
+	m.picker.skip = m.isDownloading
+	_, _ = m.RegisterExtension(m.metadataExtension())
 	if store != nil {
 		store.OnPieceComplete(func(idx int) { m.BroadcastHave(idx) })
 	}
+	go m.pipelineLoop()
+	go m.chokerLoop()
 	return m
 }
 
+// TransferTotals devuelve los bytes de bloques subidos y descargados,
+// incluidos los restaurados con AddTransferTotals
+func (m *Manager) TransferTotals() (uploaded, downloaded int64) {
+	return m.uploaded.Load(), m.downloaded.Load()
+}
+
+// AddTransferTotals suma contadores de sesiones anteriores (datos de resume)
+func (m *Manager) AddTransferTotals(uploaded, downloaded int64) {
+	m.uploaded.Add(uploaded)
+	m.downloaded.Add(downloaded)
+}
+
+// Stop detiene las rutinas de fondo del manager
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() { close(m.stopCh) })
+}
+
+// Close detiene el manager y cierra las conexiones con todos sus peers
+func (m *Manager) Close() {
+	m.Stop()
+	for _, p := range m.snapshotPeers() {
+		p.Close()
+	}
+}
+
+// SetPaused pausa o reanuda sólo este torrent. Al reanudar se vuelven a
+// llenar los pipelines de los peers que nos tienen unchoked.
+func (m *Manager) SetPaused(paused bool) {
+	m.paused.Store(paused)
+	if !paused {
+		m.fillPipelines()
+	}
+}
+
+// PrioritiesChanged se llama tras cambiar prioridades en el storage: los
+// peers ociosos pueden tener ahora piezas que queremos
+func (m *Manager) PrioritiesChanged() {
+	if !m.Paused() {
+		m.fillPipelines()
+	}
+}
+
+// fillPipelines llena el pipeline de todos los peers que nos tienen unchoked
+func (m *Manager) fillPipelines() {
+	for _, p := range m.snapshotPeers() {
+		if !p.PeerChoking.Load() {
+			m.FillPipeline(p)
+		}
+	}
+}
+
+// Paused indica si este torrent no debe pedir bloques (pausa propia o global)
+func (m *Manager) Paused() bool {
+	return m.paused.Load() || IsPaused()
+}
+
 func (m *Manager) AddPeer(p *PeerConn) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -41,39 +157,28 @@ func (m *Manager) AddPeer(p *PeerConn) {
 
 func (m *Manager) RemovePeer(p *PeerConn) {
 	m.mu.Lock()
+	_, present := m.peers[p]
 	delete(m.peers, p)
 	m.mu.Unlock()
 
-	// Liberar bloques que este peer estaba descargando
-	m.downloadsMu.Lock()
-	piecesToRetry := make(map[int][]int) // pieceIndex -> lista de bloques a reintentar
-
-	for pieceIndex, pd := range m.pieceDownloads {
-		blocksToRetry := []int{}
-
-		// Buscar bloques que este peer estaba descargando
-		for blockNum, peer := range pd.blocksInProgress {
-			if peer == p {
-				blocksToRetry = append(blocksToRetry, blockNum)
-			}
-		}
-
-		// Liberar esos bloques y devolverlos a pending
-		for _, blockNum := range blocksToRetry {
-			delete(pd.blocksInProgress, blockNum)
-			pd.blocksPending[blockNum] = true
-			fmt.Printf("[CLEANUP] Bloque %d de pieza %d liberado por peer desconectado\n", blockNum, pieceIndex)
-		}
+	// RemovePeer puede llamarse más de una vez para el mismo peer (Close desde
+	// ReadLoop y desde el defer del llamador); la disponibilidad se descuenta una vez
+	if present {
+		p.dropRemoteBitfield()
+	}
 
-		if len(blocksToRetry) > 0 {
-			piecesToRetry[pieceIndex] = blocksToRetry
-		}
+	m.chokeMu.Lock()
+	if m.optimistic == p {
+		m.optimistic = nil
 	}
-	m.downloadsMu.Unlock()
+	m.chokeMu.Unlock()
+
+	// Liberar bloques que este peer estaba descargando
+	released := m.releasePeerBlocks(p, "peer desconectado")
 
 	// Reintentar descargar los bloques liberados desde otros peers
-	for pieceIndex, blocks := range piecesToRetry {
-		m.retryPendingBlocks(pieceIndex, blocks)
+	for pieceIndex, blocks := range released {
+		m.retryPendingBlocks(pieceIndex, blocks, p)
 	}
 }
 
@@ -85,7 +190,7 @@ func (m *Manager) BroadcastHave(index int) {
 	}
 	m.mu.RUnlock()
 
-	println("Broadcast HAVE a", len(peers), "peers. Pieza", index)
+	m.log().Debug("pieza verificada, enviando HAVE", logging.Piece(index), "peers", len(peers))
 	for _, p := range peers {
 		_ = p.SendHave(uint32(index))
 	}
@@ -93,6 +198,23 @@ func (m *Manager) BroadcastHave(index int) {
 
 func (m *Manager) Store() PieceStore { return m.store }
 
+// Picker devuelve el selector de piezas compartido por los peers del manager
+func (m *Manager) Picker() *PiecePicker { return m.picker }
+
+// isDownloading indica si una pieza ya tiene una descarga en curso, de
+// peers o de un web seed
+func (m *Manager) isDownloading(pieceIndex int) bool {
+	return m.peerDownloading(pieceIndex) || m.webFetching(pieceIndex)
+}
+
+// peerDownloading indica si una pieza se está bajando de peers
+func (m *Manager) peerDownloading(pieceIndex int) bool {
+	m.downloadsMu.Lock()
+	defer m.downloadsMu.Unlock()
+	_, ok := m.pieceDownloads[pieceIndex]
+	return ok
+}
+
 // GetPeerCount retorna el número de peers conectados
 func (m *Manager) GetPeerCount() int {
 	m.mu.RLock()
@@ -100,7 +222,8 @@ func (m *Manager) GetPeerCount() int {
 	return len(m.peers)
 }
 
-// HasPeerAddr returns true if there is already a peer with the given remote address (ip:port)
+// HasPeerAddr returns true if there is already a peer with the given remote
+// address (ip:port) or listening on it (incoming peers, see ListenAddr)
 func (m *Manager) HasPeerAddr(addr string) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -108,6 +231,9 @@ func (m *Manager) HasPeerAddr(addr string) bool {
 		if p != nil && p.Conn != nil && p.Conn.RemoteAddr() != nil && p.Conn.RemoteAddr().String() == addr {
 			return true
 		}
+		if p != nil && p.ListenAddr() == addr {
+			return true
+		}
 	}
 	return false
 }
@@ -133,11 +259,12 @@ func (m *Manager) DownloadPieceParallel(pieceIndex int) {
 		return
 	}
 
-	// Verificar si ya se está descargando esta pieza (prevenir race condition)
+	// Verificar si ya se está descargando esta pieza, de peers o de un web
+	// seed (prevenir race condition; ver WebSeed.reserve)
 	m.downloadsMu.Lock()
-	if _, alreadyDownloading := m.pieceDownloads[pieceIndex]; alreadyDownloading {
+	if _, alreadyDownloading := m.pieceDownloads[pieceIndex]; alreadyDownloading || m.webFetching(pieceIndex) {
 		m.downloadsMu.Unlock()
-		println("Pieza", pieceIndex, "ya está siendo descargada, omitiendo solicitud duplicada")
+		m.log().Debug("pieza ya en descarga, solicitud duplicada omitida", logging.Piece(pieceIndex))
 		return
 	}
 	// Reservar la pieza inmediatamente para evitar duplicados
@@ -146,6 +273,7 @@ func (m *Manager) DownloadPieceParallel(pieceIndex int) {
 		blocksPending:    make(map[int]bool),
 		blocksInProgress: make(map[int]*PeerConn),
 		blocksReceived:   make(map[string]int),
+		endgameRequests:  make(map[int][]*PeerConn),
 	}
 	m.downloadsMu.Unlock()
 
@@ -153,7 +281,7 @@ func (m *Manager) DownloadPieceParallel(pieceIndex int) {
 	m.mu.RLock()
 	availablePeers := []*PeerConn{}
 	for peer := range m.peers {
-		if peer.RemoteHasPiece(pieceIndex) && !peer.PeerChoking {
+		if peer.RemoteHasPiece(pieceIndex) && !peer.PeerChoking.Load() {
 			availablePeers = append(availablePeers, peer)
 		}
 	}
@@ -164,11 +292,11 @@ func (m *Manager) DownloadPieceParallel(pieceIndex int) {
 		m.downloadsMu.Lock()
 		delete(m.pieceDownloads, pieceIndex)
 		m.downloadsMu.Unlock()
-		println("No hay peers disponibles para pieza", pieceIndex)
+		m.log().Debug("no hay peers disponibles para la pieza", logging.Piece(pieceIndex))
 		return
 	}
 
-	println("Descargando pieza", pieceIndex, "desde", len(availablePeers), "peers en paralelo (Round-Robin)")
+	m.log().Debug("descargando pieza", logging.Piece(pieceIndex), "peers", len(availablePeers))
 
 	// PASO 2: Inicializar tracking de bloques
 	numBlocks := m.calculateNumBlocks(pieceIndex)
@@ -179,16 +307,33 @@ func (m *Manager) DownloadPieceParallel(pieceIndex int) {
 	}
 	m.downloadsMu.Unlock()
 
-	// PASO 3: Round-Robin - distribuir bloques entre peers
-	peerIndex := 0
-	plen := m.store.PieceLength()
-	if pieceIndex == m.store.NumPieces()-1 {
-		total := m.store.TotalLength()
-		plen = int(total - int64(m.store.PieceLength())*int64(m.store.NumPieces()-1))
+	// PASO 3: Round-Robin - distribuir bloques entre peers con hueco en su
+	// pipeline. Los que no quepan quedan pendientes sin asignar y se piden a
+	// medida que se liberan huecos (FillPipeline).
+	free := make([]int, len(availablePeers))
+	for i, peer := range availablePeers {
+		free[i] = m.pipelineDepthFor(peer) - peer.pipeline.inFlight()
 	}
 
+	plen := m.pieceSize(pieceIndex)
+	peerIndex := 0
 	for blockNum := 0; blockNum < numBlocks; blockNum++ {
-		peer := availablePeers[peerIndex%len(availablePeers)]
+		// siguiente peer en la rotación con capacidad libre
+		chosen := -1
+		for tries := 0; tries < len(availablePeers); tries++ {
+			i := (peerIndex + tries) % len(availablePeers)
+			if free[i] > 0 {
+				chosen = i
+				break
+			}
+		}
+		if chosen < 0 {
+			m.log().Debug("pipelines llenos", logging.Piece(pieceIndex), "pending_blocks", numBlocks-blockNum)
+			break
+		}
+		peer := availablePeers[chosen]
+		free[chosen]--
+		peerIndex = chosen + 1
 		offset := blockNum * blockLen
 
 		// Calcular tamaño del bloque (último puede ser menor)
@@ -197,30 +342,21 @@ func (m *Manager) DownloadPieceParallel(pieceIndex int) {
 			sz = plen - offset
 		}
 
-		// Marcar peer como descargando esta pieza (con lock para thread-safety)
-		peer.curPiece = pieceIndex
-		peer.downloading = true
-
 		m.downloadsMu.Lock()
 		pd.blocksInProgress[blockNum] = peer
 		m.downloadsMu.Unlock()
 
-		// Log: Mostrar desde qué peer se solicita el bloque
-		peerAddr := "unknown"
-		if peer.Conn != nil && peer.Conn.RemoteAddr() != nil {
-			peerAddr = peer.Conn.RemoteAddr().String()
-		}
-		println("  → Solicitando bloque", blockNum, "de pieza", pieceIndex, "a peer", peerAddr)
+		peer.log().Debug("solicitando bloque", logging.Piece(pieceIndex), "block", blockNum)
 
 		// Enviar REQUEST
-		peer.SendBlockRequest(uint32(pieceIndex), uint32(offset), uint32(sz))
-
-		peerIndex++
+		m.sendRequest(peer, blockRequest{piece: pieceIndex, begin: offset, length: sz})
 	}
 }
 
-// retryPendingBlocks reintenta descargar bloques pendientes de una pieza desde peers disponibles
-func (m *Manager) retryPendingBlocks(pieceIndex int, blocks []int) {
+// retryPendingBlocks reintenta descargar bloques pendientes de una pieza desde
+// peers disponibles. Los bloques ya están pendientes y sin asignar; se evita
+// exclude (el peer que falló) salvo que sea el único que tiene la pieza.
+func (m *Manager) retryPendingBlocks(pieceIndex int, blocks []int, exclude *PeerConn) {
 	if m.store == nil || m.store.HasPiece(pieceIndex) {
 		return
 	}
@@ -228,51 +364,185 @@ func (m *Manager) retryPendingBlocks(pieceIndex int, blocks []int) {
 	// Obtener peers disponibles que tienen esta pieza
 	m.mu.RLock()
 	availablePeers := []*PeerConn{}
+	var fallback *PeerConn
 	for peer := range m.peers {
-		if peer.RemoteHasPiece(pieceIndex) && !peer.PeerChoking {
+		if peer.RemoteHasPiece(pieceIndex) && !peer.PeerChoking.Load() {
+			if peer == exclude {
+				fallback = peer
+				continue
+			}
 			availablePeers = append(availablePeers, peer)
 		}
 	}
 	m.mu.RUnlock()
 
+	if len(availablePeers) == 0 && fallback != nil {
+		availablePeers = append(availablePeers, fallback)
+	}
 	if len(availablePeers) == 0 {
-		fmt.Printf("[RETRY] No hay peers disponibles para reintentar bloques de pieza %d\n", pieceIndex)
+		m.log().Debug("sin peers para reintentar bloques", logging.Piece(pieceIndex), "blocks", len(blocks))
 		return
 	}
 
-	fmt.Printf("[RETRY] Reintentando %d bloques de pieza %d desde %d peers\n", len(blocks), pieceIndex, len(availablePeers))
+	m.log().Debug("reintentando bloques", logging.Piece(pieceIndex), "blocks", len(blocks), "peers", len(availablePeers))
 
-	plen := m.store.PieceLength()
-	if pieceIndex == m.store.NumPieces()-1 {
-		total := m.store.TotalLength()
-		plen = int(total - int64(m.store.PieceLength())*int64(m.store.NumPieces()-1))
+	for _, peer := range availablePeers {
+		m.FillPipeline(peer)
 	}
+}
 
-	peerIndex := 0
-	for _, blockNum := range blocks {
-		peer := availablePeers[peerIndex%len(availablePeers)]
-		offset := blockNum * blockLen
+// endgameMaxRequesters limita cuántos peers piden a la vez el mismo bloque en endgame
+const endgameMaxRequesters = 3
 
-		sz := blockLen
-		if offset+sz > plen {
-			sz = plen - offset
+// inEndgame indica si ya se pidieron todas las piezas que faltan: no queda
+// ninguna pieza sin descarga en curso y hay al menos una pendiente.
+func (m *Manager) inEndgame() bool {
+	if m.store == nil {
+		return false
+	}
+	web := m.webPieceSet()
+	m.downloadsMu.Lock()
+	defer m.downloadsMu.Unlock()
+	if len(m.pieceDownloads) == 0 {
+		return false
+	}
+	for i := 0; i < m.store.NumPieces(); i++ {
+		if m.store.HasPiece(i) || piecePriority(m.store, i) == PrioritySkip {
+			continue
+		}
+		if _, ok := web[i]; ok {
+			continue
 		}
+		if _, ok := m.pieceDownloads[i]; !ok {
+			return false
+		}
+	}
+	return true
+}
 
-		// Marcar bloque como en progreso
-		m.downloadsMu.Lock()
-		if pd, exists := m.pieceDownloads[pieceIndex]; exists {
-			pd.blocksInProgress[blockNum] = peer
-			delete(pd.blocksPending, blockNum)
+// RequestEndgameBlocks pide a p los bloques aún pendientes que p tiene y que
+// todavía no se le han pedido. Solo actúa en modo endgame. Cuando llega una
+// copia de un bloque se envía CANCEL al resto (ver completeBlock).
+// Devuelve cuántos bloques se pidieron.
+func (m *Manager) RequestEndgameBlocks(p *PeerConn) int {
+	if p.PeerChoking.Load() || !m.inEndgame() {
+		return 0
+	}
+
+	type blockReq struct{ piece, block, size int }
+	var reqs []blockReq
+
+	m.downloadsMu.Lock()
+	for pieceIndex, pd := range m.pieceDownloads {
+		if !p.RemoteHasPiece(pieceIndex) {
+			continue
 		}
+		plen := m.pieceSize(pieceIndex)
+		for blockNum := range pd.blocksPending {
+			owner := pd.blocksInProgress[blockNum]
+			others := pd.endgameRequests[blockNum]
+			if owner == p || containsPeerConn(others, p) || len(others)+1 >= endgameMaxRequesters {
+				continue
+			}
+			pd.endgameRequests[blockNum] = append(others, p)
+			sz := blockLen
+			if blockNum*blockLen+sz > plen {
+				sz = plen - blockNum*blockLen
+			}
+			reqs = append(reqs, blockReq{pieceIndex, blockNum, sz})
+		}
+	}
+	m.downloadsMu.Unlock()
+
+	if len(reqs) > 0 {
+		p.log().Debug("endgame: pidiendo bloques pendientes", "blocks", len(reqs))
+	}
+	for _, r := range reqs {
+		m.sendRequest(p, blockRequest{piece: r.piece, begin: r.block * blockLen, length: r.size})
+	}
+	return len(reqs)
+}
+
+// completeBlock registra la llegada de un bloque desde peer. Devuelve false si
+// el bloque no se esperaba: ya se había recibido (copia duplicada de endgame)
+// o la pieza no tiene una descarga en curso. En ese caso debe descartarse.
+// A los demás peers a los que se pidió el mismo bloque se les envía CANCEL.
+func (m *Manager) completeBlock(pieceIndex, begin, length int, from *PeerConn) bool {
+	blockNum := begin / blockLen
+	req := blockRequest{piece: pieceIndex, begin: begin, length: length}
+	from.pipeline.remove(req)
+	from.pipeline.received(length)
+
+	m.downloadsMu.Lock()
+	pd, exists := m.pieceDownloads[pieceIndex]
+	if !exists || !pd.blocksPending[blockNum] {
 		m.downloadsMu.Unlock()
+		return false
+	}
 
-		peerAddr := "unknown"
-		if peer.Conn != nil && peer.Conn.RemoteAddr() != nil {
-			peerAddr = peer.Conn.RemoteAddr().String()
+	var cancel []*PeerConn
+	if owner := pd.blocksInProgress[blockNum]; owner != nil && owner != from {
+		cancel = append(cancel, owner)
+	}
+	for _, other := range pd.endgameRequests[blockNum] {
+		if other != from {
+			cancel = append(cancel, other)
 		}
-		fmt.Printf("  → [RETRY] Solicitando bloque %d de pieza %d a peer %s\n", blockNum, pieceIndex, peerAddr)
+	}
+	pd.blocksReceived[peerAddrOf(from)]++
+	delete(pd.blocksPending, blockNum)
+	delete(pd.blocksInProgress, blockNum)
+	delete(pd.endgameRequests, blockNum)
+	m.downloadsMu.Unlock()
+
+	for _, other := range cancel {
+		other.log().Debug("endgame: cancel", logging.Piece(pieceIndex), "block", blockNum)
+		other.pipeline.remove(req)
+		_ = other.SendCancel(uint32(pieceIndex), uint32(begin), uint32(length))
+	}
+	return true
+}
 
-		peer.SendBlockRequest(uint32(pieceIndex), uint32(offset), uint32(sz))
-		peerIndex++
+// pieceSize devuelve el tamaño de una pieza (la última puede ser más corta)
+func (m *Manager) pieceSize(pieceIndex int) int {
+	plen := m.store.PieceLength()
+	if pieceIndex == m.store.NumPieces()-1 {
+		total := m.store.TotalLength()
+		plen = int(total - int64(m.store.PieceLength())*int64(m.store.NumPieces()-1))
 	}
+	return plen
+}
+
+func peerAddrOf(p *PeerConn) string {
+	if p != nil && p.Conn != nil && p.Conn.RemoteAddr() != nil {
+		return p.Conn.RemoteAddr().String()
+	}
+	return "unknown"
+}
+
+func containsPeerConn(list []*PeerConn, p *PeerConn) bool {
+	for _, x := range list {
+		if x == p {
+			return true
+		}
+	}
+	return false
+}
+
+func removePeerConn(list []*PeerConn, p *PeerConn) []*PeerConn {
+	out := list[:0]
+	for _, x := range list {
+		if x != p {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// abortPieceDownload descarta el tracking de una pieza (p. ej. tras un fallo de
+// hash) para que el picker pueda volver a elegirla.
+func (m *Manager) abortPieceDownload(pieceIndex int) {
+	m.downloadsMu.Lock()
+	delete(m.pieceDownloads, pieceIndex)
+	m.downloadsMu.Unlock()
 }
@@ -3,7 +3,6 @@ package peerwire
 import (
 	"bytes"
 	"encoding/binary"
-	"fmt"
 	"io"
 )
 
@@ -18,6 +17,7 @@ const (
 	MsgPiece         = 7
 	MsgCancel        = 8
 	MsgPort          = 9
+	MsgExtended      = 20
 )
 
 // funcion que envia un mensaje generico del protocolo
@@ -52,6 +52,11 @@ func (p *PeerConn) ReadMessage() (id byte, payload []byte, err error) {
 	if _, err := io.ReadFull(p.Conn, data); err != nil {
 		return 0, nil, err
 	}
+	// sólo se limitan los datos de bloques; mientras se espera no se lee
+	// del socket y TCP frena al peer
+	if data[0] == MsgPiece {
+		p.waitDownload(len(data))
+	}
 
 	return data[0], data[1:], nil
 }
@@ -60,7 +65,6 @@ func (p *PeerConn) ReadMessage() (id byte, payload []byte, err error) {
 func (p *PeerConn) SendHave(index uint32) error {
 	payload := make([]byte, 4)
 	binary.BigEndian.PutUint32(payload, index)
-	fmt.Println("Enviando HAVE de pieza", index)
 	return p.SendMessage(MsgHave, payload)
 }
 
@@ -92,8 +96,19 @@ func (p *PeerConn) SendBlockRequest(index uint32, begin uint32, length uint32) e
 	return p.SendMessage(MsgRequest, payload)
 }
 
-// SendPiece sends a piece block with given index, begin and data
+// SendCancel sends a CANCEL message for a previously requested block
+func (p *PeerConn) SendCancel(index uint32, begin uint32, length uint32) error {
+	payload := make([]byte, 12)
+	binary.BigEndian.PutUint32(payload[0:4], index)
+	binary.BigEndian.PutUint32(payload[4:8], begin)
+	binary.BigEndian.PutUint32(payload[8:12], length)
+	return p.SendMessage(MsgCancel, payload)
+}
+
+// SendPiece sends a piece block with given index, begin and data, waiting
+// first for the per-peer and global upload limits
 func (p *PeerConn) SendPiece(index uint32, begin uint32, data []byte) error {
+	p.waitUpload(len(data))
 	hdr := new(bytes.Buffer)
 	total := uint32(9 + len(data))
 	if err := binary.Write(hdr, binary.BigEndian, total); err != nil {
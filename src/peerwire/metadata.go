@@ -0,0 +1,194 @@
+package peerwire
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"src/bencode"
+	"time"
+)
+
+const (
+	// id del handshake extendido dentro de MsgExtended (BEP 10)
+	extHandshakeID = 0
+	// id local de ut_metadata en el handshake que envía FetchMetadata (sin Manager)
+	utMetadataID = 1
+
+	// tipos de mensaje de ut_metadata (BEP 9)
+	utMetadataRequest = 0
+	utMetadataData    = 1
+	utMetadataReject  = 2
+
+	metadataPieceLen = 16 * 1024
+	maxMetadataSize  = 8 * 1024 * 1024
+)
+
+// SetMetadata guarda el info dictionary bencodeado del torrent para servirlo
+// por ut_metadata a los peers que arrancaron desde un magnet link.
+func (m *Manager) SetMetadata(info []byte) {
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+	m.metadata = info
+}
+
+func (m *Manager) metadataBytes() []byte {
+	m.metaMu.RLock()
+	defer m.metaMu.RUnlock()
+	return m.metadata
+}
+
+// metadataExtension es la extensión ut_metadata que sirve el info dictionary
+// del Manager; anuncia metadata_size cuando ya se conoce.
+func (m *Manager) metadataExtension() Extension {
+	return Extension{
+		Name: "ut_metadata",
+		HandshakeFields: func() map[string]interface{} {
+			if md := m.metadataBytes(); len(md) > 0 {
+				return map[string]interface{}{"metadata_size": int64(len(md))}
+			}
+			return nil
+		},
+		Handle: func(p *PeerConn, payload []byte) { p.serveMetadata(payload) },
+	}
+}
+
+// serveMetadata responde un request de ut_metadata con la pieza pedida del
+// info dictionary, o con reject si no la tenemos.
+func (p *PeerConn) serveMetadata(payload []byte) {
+	msg, _, err := splitMetadataMessage(payload)
+	if err != nil {
+		return
+	}
+	if msgType, _ := msg["msg_type"].(int64); msgType != utMetadataRequest {
+		return
+	}
+	piece, _ := msg["piece"].(int64)
+
+	var md []byte
+	if p.manager != nil {
+		md = p.manager.metadataBytes()
+	}
+	start := int(piece) * metadataPieceLen
+	if len(md) == 0 || piece < 0 || start >= len(md) {
+		reject := bencode.Encode(map[string]interface{}{"msg_type": int64(utMetadataReject), "piece": piece})
+		_ = p.SendExtensionMessage("ut_metadata", reject)
+		return
+	}
+	end := min(start+metadataPieceLen, len(md))
+	hdr := bencode.Encode(map[string]interface{}{
+		"msg_type":   int64(utMetadataData),
+		"piece":      piece,
+		"total_size": int64(len(md)),
+	})
+	p.log().Debug("enviando pieza de metadata", "metadata_piece", piece)
+	_ = p.SendExtensionMessage("ut_metadata", append(hdr, md[start:end]...))
+}
+
+// FetchMetadata se conecta a addr y descarga por ut_metadata (BEP 9) el info
+// dictionary del torrent. Devuelve los bytes bencodeados tal como los envió
+// el peer, ya verificados contra infoHash.
+func FetchMetadata(addr string, infoHash, peerId [20]byte, timeout time.Duration) ([]byte, error) {
+	p, err := NewPeerConn(addr, infoHash, peerId)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Conn.Close()
+	_ = p.Conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := p.Handshake(); err != nil {
+		return nil, err
+	}
+	if !p.SupportsExtensions() {
+		return nil, fmt.Errorf("peer %s no soporta extension protocol", addr)
+	}
+	hs := map[string]interface{}{"m": map[string]interface{}{"ut_metadata": int64(utMetadataID)}}
+	if err := p.sendExtended(extHandshakeID, bencode.Encode(hs)); err != nil {
+		return nil, err
+	}
+
+	var md []byte
+	var got []bool
+	remaining := 0
+	for {
+		id, payload, err := p.ReadMessage()
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo metadata de %s: %v", addr, err)
+		}
+		if id != MsgExtended || len(payload) == 0 {
+			continue
+		}
+
+		switch payload[0] {
+		case extHandshakeID:
+			hs, err := bencode.Decode(bytes.NewReader(payload[1:]))
+			if err != nil {
+				return nil, fmt.Errorf("handshake extendido inválido: %v", err)
+			}
+			p.setRemoteHandshake(hs)
+			size, _ := hs["metadata_size"].(int64)
+			if !p.SupportsExtension("ut_metadata") || size <= 0 {
+				return nil, fmt.Errorf("peer %s no ofrece metadata", addr)
+			}
+			if size > maxMetadataSize {
+				return nil, fmt.Errorf("metadata_size demasiado grande: %d", size)
+			}
+			md = make([]byte, size)
+			remaining = int((size + metadataPieceLen - 1) / metadataPieceLen)
+			got = make([]bool, remaining)
+			for i := 0; i < remaining; i++ {
+				req := bencode.Encode(map[string]interface{}{"msg_type": int64(utMetadataRequest), "piece": int64(i)})
+				if err := p.SendExtensionMessage("ut_metadata", req); err != nil {
+					return nil, err
+				}
+			}
+
+		case utMetadataID:
+			if md == nil {
+				continue
+			}
+			msg, data, err := splitMetadataMessage(payload[1:])
+			if err != nil {
+				return nil, err
+			}
+			piece, _ := msg["piece"].(int64)
+			switch msgType, _ := msg["msg_type"].(int64); msgType {
+			case utMetadataReject:
+				return nil, fmt.Errorf("peer %s rechazó la pieza %d de metadata", addr, piece)
+			case utMetadataData:
+				start := int(piece) * metadataPieceLen
+				if piece < 0 || int(piece) >= len(got) || len(data) != min(metadataPieceLen, len(md)-start) {
+					return nil, fmt.Errorf("pieza de metadata inválida: %d (%d bytes)", piece, len(data))
+				}
+				if got[piece] {
+					continue
+				}
+				copy(md[start:], data)
+				got[piece] = true
+				remaining--
+			}
+			if remaining == 0 {
+				if sha1.Sum(md) != infoHash {
+					return nil, errors.New("la metadata recibida no coincide con el info_hash")
+				}
+				return md, nil
+			}
+		}
+	}
+}
+
+// splitMetadataMessage separa el diccionario bencodeado de un mensaje
+// ut_metadata de los datos que lo siguen (sólo en msg_type=data). El decoder
+// no informa cuántos bytes consumió, así que se re-codifica el diccionario:
+// bencode es canónico (claves ordenadas), por lo que la longitud coincide.
+func splitMetadataMessage(payload []byte) (map[string]interface{}, []byte, error) {
+	msg, err := bencode.Decode(bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, fmt.Errorf("mensaje ut_metadata inválido: %v", err)
+	}
+	n := len(bencode.Encode(msg))
+	if n > len(payload) {
+		return nil, nil, errors.New("mensaje ut_metadata truncado")
+	}
+	return msg, payload[n:], nil
+}
@@ -0,0 +1,454 @@
+package peerwire
+
+// peerwire/mse.go
+// Message Stream Encryption / Protocol Encryption (MSE/PE): intercambio
+// Diffie-Hellman, verificación del info_hash (SKEY) y flujo RC4 alrededor del
+// net.Conn, antes del handshake de BitTorrent.
+//
+//	A->B: Ya, PadA
+//	B->A: Yb, PadB
+//	A->B: HASH('req1', S), HASH('req2', SKEY) xor HASH('req3', S),
+//	      ENCRYPT(VC, crypto_provide, len(PadC), PadC, len(IA)), ENCRYPT(IA)
+//	B->A: ENCRYPT(VC, crypto_select, len(PadD), PadD), ENCRYPT2(payload)
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"src/logging"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EncryptionPolicy decide cómo se negocian las conexiones con peers
+type EncryptionPolicy int32
+
+const (
+	// EncryptionPlaintext no usa MSE: rechaza conexiones entrantes cifradas
+	EncryptionPlaintext EncryptionPolicy = iota
+	// EncryptionPrefer intenta MSE y vuelve a texto plano si el peer no lo soporta
+	EncryptionPrefer
+	// EncryptionRequire sólo acepta conexiones cifradas con RC4
+	EncryptionRequire
+)
+
+func (e EncryptionPolicy) String() string {
+	switch e {
+	case EncryptionPlaintext:
+		return "plaintext"
+	case EncryptionRequire:
+		return "require"
+	default:
+		return "prefer"
+	}
+}
+
+// ParseEncryptionPolicy interpreta plaintext|prefer|require
+func ParseEncryptionPolicy(s string) (EncryptionPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "plaintext":
+		return EncryptionPlaintext, nil
+	case "prefer", "":
+		return EncryptionPrefer, nil
+	case "require":
+		return EncryptionRequire, nil
+	}
+	return EncryptionPrefer, fmt.Errorf("política de cifrado inválida %q (plaintext|prefer|require)", s)
+}
+
+var encryptionPolicy atomic.Int32
+
+func init() {
+	encryptionPolicy.Store(int32(EncryptionPrefer))
+}
+
+// SetEncryptionPolicy fija la política para las próximas conexiones
+func SetEncryptionPolicy(e EncryptionPolicy) {
+	encryptionPolicy.Store(int32(e))
+}
+
+// GetEncryptionPolicy devuelve la política vigente
+func GetEncryptionPolicy() EncryptionPolicy {
+	return EncryptionPolicy(encryptionPolicy.Load())
+}
+
+const (
+	mseKeyLen       = 96 // bytes de Ya/Yb (primo de 768 bits)
+	msePrivKeyLen   = 20 // 160 bits de clave privada
+	mseMaxPad       = 512
+	mseHandshakeTTL = 10 * time.Second
+
+	cryptoPlaintext uint32 = 0x01
+	cryptoRC4       uint32 = 0x02
+)
+
+var (
+	mseP, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1"+
+		"29024E088A67CC74020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B"+
+		"302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A63A3621"+
+		"0000000000090563", 16)
+	mseG = big.NewInt(2)
+
+	mseVC = make([]byte, 8) // verification constant: 8 bytes en cero
+
+	errNotMSE = errors.New("el peer no respondió al handshake MSE")
+)
+
+// mseConn es un net.Conn cifrado (o en claro si se negoció plaintext) que
+// lee a través del buffer usado durante la negociación
+type mseConn struct {
+	net.Conn
+	r   io.Reader
+	enc *rc4.Cipher // nil = en claro
+	dec *rc4.Cipher
+
+	wmu sync.Mutex // RC4 es un flujo: cifrar y escribir tienen que ir juntos
+}
+
+func (c *mseConn) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	if c.dec != nil && n > 0 {
+		c.dec.XORKeyStream(b[:n], b[:n])
+	}
+	return n, err
+}
+
+func (c *mseConn) Write(b []byte) (int, error) {
+	if c.enc == nil {
+		return c.Conn.Write(b)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	out := make([]byte, len(b))
+	c.enc.XORKeyStream(out, b)
+	return c.Conn.Write(out)
+}
+
+// Encrypted indica si conn es una conexión con RC4 negociado por MSE
+func Encrypted(conn net.Conn) bool {
+	c, ok := conn.(*mseConn)
+	return ok && c.enc != nil
+}
+
+// DialPeer abre una conexión TCP con addr aplicando la política de cifrado:
+// con prefer, si el handshake MSE falla, reintenta en texto plano.
+func DialPeer(addr string, infoHash [20]byte, timeout time.Duration) (net.Conn, error) {
+	policy := GetEncryptionPolicy()
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil || policy == EncryptionPlaintext {
+		return conn, err
+	}
+
+	enc, err := mseInitiate(conn, infoHash, policy)
+	if err == nil {
+		return enc, nil
+	}
+	conn.Close()
+	if policy == EncryptionRequire {
+		return nil, fmt.Errorf("cifrado requerido y el handshake MSE con %s falló: %v", addr, err)
+	}
+	log.Debug("MSE no negociado, reintentando en texto plano", logging.Peer(addr), logging.Err(err))
+	return net.DialTimeout("tcp", addr, timeout)
+}
+
+// AcceptPeer detecta si una conexión entrante empieza con el handshake de
+// BitTorrent o con MSE y, en ese caso, hace la negociación buscando el
+// info_hash entre infoHashes. La conexión devuelta entrega el handshake en claro.
+// infoHash es el torrent negociado por MSE (SKEY), o nil si la conexión llegó
+// en texto plano: el handshake tiene que ser de ese mismo torrent.
+func AcceptPeer(conn net.Conn, infoHashes [][20]byte) (c net.Conn, infoHash *[20]byte, err error) {
+	return acceptPeer(conn, infoHashes, GetEncryptionPolicy())
+}
+
+func acceptPeer(conn net.Conn, infoHashes [][20]byte, policy EncryptionPolicy) (net.Conn, *[20]byte, error) {
+	br := bufio.NewReader(conn)
+
+	_ = conn.SetReadDeadline(time.Now().Add(mseHandshakeTTL))
+	head, err := br.Peek(1 + pstrlen)
+	if err != nil {
+		return nil, nil, err
+	}
+	if head[0] == pstrlen && string(head[1:]) == pstr {
+		_ = conn.SetReadDeadline(time.Time{})
+		if policy == EncryptionRequire {
+			return nil, nil, errors.New("conexión en texto plano rechazada (cifrado requerido)")
+		}
+		return &mseConn{Conn: conn, r: br}, nil, nil
+	}
+	if policy == EncryptionPlaintext {
+		return nil, nil, errors.New("conexión cifrada rechazada (cifrado deshabilitado)")
+	}
+
+	c, infoHash, err := mseReceive(conn, br, infoHashes, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return c, infoHash, nil
+}
+
+// mseInitiate es el lado A (quien abre la conexión)
+func mseInitiate(conn net.Conn, infoHash [20]byte, policy EncryptionPolicy) (net.Conn, error) {
+	_ = conn.SetDeadline(time.Now().Add(mseHandshakeTTL))
+	defer conn.SetDeadline(time.Time{})
+	br := bufio.NewReader(conn)
+
+	priv, pub, err := mseKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(append(pub, msePad()...)); err != nil {
+		return nil, err
+	}
+
+	yb := make([]byte, mseKeyLen)
+	if _, err := io.ReadFull(br, yb); err != nil {
+		return nil, errNotMSE
+	}
+	s := mseSecret(yb, priv)
+	enc, dec := mseCiphers(s, infoHash[:], true)
+
+	provide := cryptoRC4
+	if policy == EncryptionPrefer {
+		provide |= cryptoPlaintext
+	}
+	padC := msePad()
+	msg := new(bytes.Buffer)
+	msg.Write(mseVC)
+	binary.Write(msg, binary.BigEndian, provide)
+	binary.Write(msg, binary.BigEndian, uint16(len(padC)))
+	msg.Write(padC)
+	binary.Write(msg, binary.BigEndian, uint16(0)) // len(IA): el handshake va después
+	encrypted := make([]byte, msg.Len())
+	enc.XORKeyStream(encrypted, msg.Bytes())
+
+	out := new(bytes.Buffer)
+	out.Write(mseHash("req1", s))
+	req2, req3 := mseHash("req2", infoHash[:]), mseHash("req3", s)
+	for i := range req2 {
+		out.WriteByte(req2[i] ^ req3[i])
+	}
+	out.Write(encrypted)
+	if _, err := conn.Write(out.Bytes()); err != nil {
+		return nil, err
+	}
+
+	// B responde ENCRYPT(VC) después de PadB: buscarlo en el flujo
+	vcEnc := make([]byte, len(mseVC))
+	dec.XORKeyStream(vcEnc, mseVC)
+	if err := mseSync(br, vcEnc, mseMaxPad+len(vcEnc)); err != nil {
+		return nil, err
+	}
+
+	hdr := make([]byte, 6)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, err
+	}
+	dec.XORKeyStream(hdr, hdr)
+	selected := binary.BigEndian.Uint32(hdr[:4])
+	padD := int(binary.BigEndian.Uint16(hdr[4:]))
+	if padD > mseMaxPad {
+		return nil, fmt.Errorf("len(PadD) inválido: %d", padD)
+	}
+	pad := make([]byte, padD)
+	if _, err := io.ReadFull(br, pad); err != nil {
+		return nil, err
+	}
+	dec.XORKeyStream(pad, pad)
+
+	switch {
+	case selected == cryptoRC4:
+		return &mseConn{Conn: conn, r: br, enc: enc, dec: dec}, nil
+	case selected == cryptoPlaintext && provide&cryptoPlaintext != 0:
+		return &mseConn{Conn: conn, r: br}, nil
+	}
+	return nil, fmt.Errorf("crypto_select inválido: %#x", selected)
+}
+
+// mseReceive es el lado B (quien acepta la conexión)
+func mseReceive(conn net.Conn, br *bufio.Reader, infoHashes [][20]byte, policy EncryptionPolicy) (net.Conn, *[20]byte, error) {
+	_ = conn.SetDeadline(time.Now().Add(mseHandshakeTTL))
+
+	ya := make([]byte, mseKeyLen)
+	if _, err := io.ReadFull(br, ya); err != nil {
+		return nil, nil, err
+	}
+	priv, pub, err := mseKeyPair()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := conn.Write(append(pub, msePad()...)); err != nil {
+		return nil, nil, err
+	}
+	s := mseSecret(ya, priv)
+
+	// HASH('req1', S) llega después de PadA
+	if err := mseSync(br, mseHash("req1", s), mseMaxPad+sha1.Size); err != nil {
+		return nil, nil, err
+	}
+	skeyHash := make([]byte, sha1.Size)
+	if _, err := io.ReadFull(br, skeyHash); err != nil {
+		return nil, nil, err
+	}
+	req3 := mseHash("req3", s)
+	for i := range skeyHash {
+		skeyHash[i] ^= req3[i]
+	}
+	var infoHash *[20]byte
+	for _, ih := range infoHashes {
+		if bytes.Equal(mseHash("req2", ih[:]), skeyHash) {
+			infoHash = &ih
+			break
+		}
+	}
+	if infoHash == nil {
+		return nil, nil, errors.New("MSE: info_hash desconocido")
+	}
+	enc, dec := mseCiphers(s, infoHash[:], false)
+
+	hdr := make([]byte, 14)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, nil, err
+	}
+	dec.XORKeyStream(hdr, hdr)
+	if !bytes.Equal(hdr[:8], mseVC) {
+		return nil, nil, errors.New("MSE: VC inválido")
+	}
+	provide := binary.BigEndian.Uint32(hdr[8:12])
+	padC := int(binary.BigEndian.Uint16(hdr[12:]))
+	if padC > mseMaxPad {
+		return nil, nil, fmt.Errorf("len(PadC) inválido: %d", padC)
+	}
+	rest := make([]byte, padC+2)
+	if _, err := io.ReadFull(br, rest); err != nil {
+		return nil, nil, err
+	}
+	dec.XORKeyStream(rest, rest)
+	ia := make([]byte, binary.BigEndian.Uint16(rest[padC:]))
+	if _, err := io.ReadFull(br, ia); err != nil {
+		return nil, nil, err
+	}
+	dec.XORKeyStream(ia, ia)
+
+	var selected uint32
+	switch {
+	case provide&cryptoRC4 != 0:
+		selected = cryptoRC4
+	case provide&cryptoPlaintext != 0 && policy != EncryptionRequire:
+		selected = cryptoPlaintext
+	default:
+		return nil, nil, fmt.Errorf("MSE: ningún método de cifrado aceptable (crypto_provide=%#x)", provide)
+	}
+
+	padD := msePad()
+	msg := new(bytes.Buffer)
+	msg.Write(mseVC)
+	binary.Write(msg, binary.BigEndian, selected)
+	binary.Write(msg, binary.BigEndian, uint16(len(padD)))
+	msg.Write(padD)
+	reply := make([]byte, msg.Len())
+	enc.XORKeyStream(reply, msg.Bytes())
+	if _, err := conn.Write(reply); err != nil {
+		return nil, nil, err
+	}
+
+	// IA (si vino) ya está descifrado y es el comienzo del payload
+	c := &mseConn{Conn: conn}
+	payload := io.Reader(br)
+	if selected == cryptoRC4 {
+		c.enc = enc
+		payload = &decryptReader{r: br, dec: dec}
+	}
+	c.r = io.MultiReader(bytes.NewReader(ia), payload)
+	return c, infoHash, nil
+}
+
+// decryptReader descifra lo leído de r (lo que sigue a IA en el flujo)
+type decryptReader struct {
+	r   io.Reader
+	dec *rc4.Cipher
+}
+
+func (d *decryptReader) Read(b []byte) (int, error) {
+	n, err := d.r.Read(b)
+	d.dec.XORKeyStream(b[:n], b[:n])
+	return n, err
+}
+
+// mseSync consume br hasta encontrar marker, leyendo a lo sumo limit bytes
+func mseSync(br *bufio.Reader, marker []byte, limit int) error {
+	window := make([]byte, 0, limit)
+	for len(window) < limit {
+		b, err := br.ReadByte()
+		if err != nil {
+			return errNotMSE
+		}
+		window = append(window, b)
+		if bytes.HasSuffix(window, marker) {
+			return nil
+		}
+	}
+	return errors.New("MSE: no se pudo sincronizar el flujo")
+}
+
+func mseKeyPair() (priv *big.Int, pub []byte, err error) {
+	x := make([]byte, msePrivKeyLen)
+	if _, err := rand.Read(x); err != nil {
+		return nil, nil, err
+	}
+	priv = new(big.Int).SetBytes(x)
+	return priv, mseBytes(new(big.Int).Exp(mseG, priv, mseP)), nil
+}
+
+func mseSecret(remotePub []byte, priv *big.Int) []byte {
+	y := new(big.Int).SetBytes(remotePub)
+	return mseBytes(new(big.Int).Exp(y, priv, mseP))
+}
+
+// mseBytes serializa n big-endian en mseKeyLen bytes
+func mseBytes(n *big.Int) []byte {
+	out := make([]byte, mseKeyLen)
+	return n.FillBytes(out)
+}
+
+func mseHash(label string, parts ...[]byte) []byte {
+	h := sha1.New()
+	h.Write([]byte(label))
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+// mseCiphers arma los RC4 de ambos sentidos: A cifra con keyA y B con keyB.
+// Se descartan los primeros 1024 bytes de cada flujo.
+func mseCiphers(s, skey []byte, initiator bool) (enc, dec *rc4.Cipher) {
+	a, _ := rc4.NewCipher(mseHash("keyA", s, skey))
+	b, _ := rc4.NewCipher(mseHash("keyB", s, skey))
+	discard := make([]byte, 1024)
+	a.XORKeyStream(discard, discard)
+	b.XORKeyStream(discard, discard)
+	if initiator {
+		return a, b
+	}
+	return b, a
+}
+
+// msePad devuelve entre 0 y mseMaxPad bytes aleatorios
+func msePad() []byte {
+	var n [2]byte
+	rand.Read(n[:])
+	pad := make([]byte, int(binary.BigEndian.Uint16(n[:]))%(mseMaxPad+1))
+	rand.Read(pad)
+	return pad
+}
@@ -0,0 +1,202 @@
+package peerwire
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+var mseTestHash = [20]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+
+// testHandshake is the plaintext BitTorrent handshake the dialer sends once
+// the connection is negotiated.
+func testHandshake() []byte {
+	hs := append([]byte{pstrlen}, pstr...)
+	hs = append(hs, make([]byte, 8)...)
+	hs = append(hs, mseTestHash[:]...)
+	return append(hs, "-JC0001-msetestpeer1"...)
+}
+
+// dialPipe is the dialer side of DialPeer over an existing connection (there
+// is no redial: with prefer a failed handshake is reported as errNotMSE).
+func dialPipe(conn net.Conn, policy EncryptionPolicy) (net.Conn, error) {
+	if policy == EncryptionPlaintext {
+		return conn, nil
+	}
+	return mseInitiate(conn, mseTestHash, policy)
+}
+
+type acceptResult struct {
+	conn     net.Conn
+	infoHash *[20]byte
+	err      error
+}
+
+func TestMSEPolicies(t *testing.T) {
+	const (
+		plain = "plaintext"
+		rc4   = "rc4"
+		fail  = "fail"
+	)
+	for _, tc := range []struct {
+		dial, listen EncryptionPolicy
+		want         string
+		dialErr      error // for fail: errNotMSE means DialPeer retries in plaintext
+	}{
+		{EncryptionPlaintext, EncryptionPlaintext, plain, nil},
+		{EncryptionPlaintext, EncryptionPrefer, plain, nil}, // fallback at the listener
+		{EncryptionPlaintext, EncryptionRequire, fail, nil},
+		{EncryptionPrefer, EncryptionPlaintext, fail, errNotMSE},
+		{EncryptionPrefer, EncryptionPrefer, rc4, nil},
+		{EncryptionPrefer, EncryptionRequire, rc4, nil},
+		{EncryptionRequire, EncryptionPlaintext, fail, errNotMSE},
+		{EncryptionRequire, EncryptionPrefer, rc4, nil},
+		{EncryptionRequire, EncryptionRequire, rc4, nil},
+	} {
+		t.Run(tc.dial.String()+"->"+tc.listen.String(), func(t *testing.T) {
+			a, b := net.Pipe()
+			defer a.Close()
+			defer b.Close()
+
+			accepted := make(chan acceptResult, 1)
+			go func() {
+				c, ih, err := acceptPeer(b, [][20]byte{{0xff}, mseTestHash}, tc.listen)
+				if err != nil {
+					b.Close()
+				}
+				accepted <- acceptResult{c, ih, err}
+			}()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				ac, err := dialPipe(a, tc.dial)
+				if tc.want == fail && tc.dialErr != nil {
+					if !errors.Is(err, tc.dialErr) {
+						t.Errorf("dial: %v, want %v", err, tc.dialErr)
+					}
+					if res := <-accepted; res.err == nil {
+						t.Error("listener accepted the connection")
+					}
+					return
+				}
+				if err != nil {
+					t.Errorf("dial: %v", err)
+					return
+				}
+				// the plaintext dialer only learns about a rejection here
+				go ac.Write(testHandshake())
+
+				res := <-accepted
+				if tc.want == fail {
+					if res.err == nil {
+						t.Error("listener accepted the connection")
+					}
+					return
+				}
+				if res.err != nil {
+					t.Errorf("accept: %v", res.err)
+					return
+				}
+				got := make([]byte, len(testHandshake()))
+				if _, err := io.ReadFull(res.conn, got); err != nil || !bytes.Equal(got, testHandshake()) {
+					t.Errorf("got handshake %q (%v)", got, err)
+					return
+				}
+				go res.conn.Write([]byte("pong"))
+				reply := make([]byte, 4)
+				if _, err := io.ReadFull(ac, reply); err != nil || string(reply) != "pong" {
+					t.Errorf("got reply %q (%v)", reply, err)
+				}
+				if Encrypted(ac) != (tc.want == rc4) || Encrypted(res.conn) != (tc.want == rc4) {
+					t.Errorf("encrypted: dialer %v, listener %v; want %s", Encrypted(ac), Encrypted(res.conn), tc.want)
+				}
+				// the SKEY match is reported only for MSE connections
+				if tc.want == rc4 && (res.infoHash == nil || *res.infoHash != mseTestHash) {
+					t.Errorf("MSE info_hash %x, want %x", res.infoHash, mseTestHash)
+				}
+				if tc.want == plain && res.infoHash != nil {
+					t.Errorf("plaintext connection reported MSE info_hash %x", *res.infoHash)
+				}
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("negotiation did not finish")
+			}
+		})
+	}
+}
+
+// A peer that sends garbage (or stops early) after Ya must make the listener
+// give up once PadA exceeds its bound, well before the handshake deadline.
+func TestMSEGarbagePeer(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		endless bool // keep sending garbage; otherwise close after 100 bytes
+	}{
+		{"garbage", true},
+		{"truncated", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := net.Pipe()
+			defer b.Close()
+			go io.Copy(io.Discard, a) // Yb and PadB
+			go func() {
+				junk := bytes.Repeat([]byte{0xff}, mseKeyLen+100)
+				for {
+					if _, err := a.Write(junk); err != nil || !tc.endless {
+						a.Close()
+						return
+					}
+				}
+			}()
+
+			start := time.Now()
+			_, _, err := acceptPeer(b, [][20]byte{mseTestHash}, EncryptionPrefer)
+			if err == nil {
+				t.Fatal("listener accepted an invalid peer")
+			}
+			if tc.endless && errors.Is(err, errNotMSE) {
+				t.Fatalf("got %v, want the padding bound error", err)
+			}
+			if d := time.Since(start); d > mseHandshakeTTL/2 {
+				t.Fatalf("listener took %v to give up", d)
+			}
+		})
+	}
+}
+
+func TestMSESyncBound(t *testing.T) {
+	marker := []byte("marker")
+	limit := mseMaxPad + len(marker)
+	for _, tc := range []struct {
+		name     string
+		in       []byte
+		err      bool
+		consumed int
+	}{
+		{"marker after padding", append(bytes.Repeat([]byte{0}, mseMaxPad), marker...), false, limit},
+		{"marker without padding", append(append([]byte{}, marker...), 1, 2, 3), false, len(marker)},
+		{"garbage", bytes.Repeat([]byte{0xaa}, 4*limit), true, limit},
+		{"marker past the bound", append(bytes.Repeat([]byte{0}, mseMaxPad+1), marker...), true, limit},
+		{"truncated", bytes.Repeat([]byte{0xaa}, 100), true, 100},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := bytes.NewReader(tc.in)
+			br := bufio.NewReader(r)
+			err := mseSync(br, marker, limit)
+			if (err != nil) != tc.err {
+				t.Fatalf("got %v, want error=%v", err, tc.err)
+			}
+			if consumed := len(tc.in) - r.Len() - br.Buffered(); consumed != tc.consumed {
+				t.Fatalf("consumed %d bytes, want %d", consumed, tc.consumed)
+			}
+		})
+	}
+}
@@ -1,24 +1,55 @@
 package peerwire
 
-import "net"
+import (
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 type PeerConn struct {
 	Conn           net.Conn
 	InfoHash       [20]byte
 	PeerId         [20]byte
-	AmChoking      bool
+	AmChoking      atomic.Bool // lo escribe el choker; lo lee el ReadLoop al atender REQUEST
 	AmInterested   bool
-	PeerChoking    bool
-	PeerInterested bool
+	PeerChoking    atomic.Bool // lo escribe el ReadLoop; lo leen los demás peers, el pipeline y los web seeds
+	PeerInterested atomic.Bool // lo escribe el ReadLoop; lo lee el choker
 	manager        *Manager
 
-	// remote bitfield (as advertised by the peer). Length should be ceil(NumPieces/8)
+	// remote bitfield (as advertised by the peer). Length should be ceil(NumPieces/8).
+	// Lo escribe el ReadLoop del peer y lo leen los de los demás peers al
+	// repartir piezas: se protege con bfMu, igual que su cuenta en el picker.
+	bfMu     sync.RWMutex
 	remoteBF []byte
+	bfGone   bool // el peer salió del manager: ya no cuenta para la disponibilidad
 
-	// simple per-peer download state (phase 1)
-	curPiece    int // -1 if none
-	curOffset   int // next offset within curPiece to request
-	downloading bool
+	// per-peer download state: REQUESTs in flight and measured rate
+	pipeline    requestPipeline
+	downloading atomic.Bool
+
+	// bytes subidos a este peer, para el choker
+	upload uploadStats
+
+	// límites de transferencia de este peer (ver ratelimit.go)
+	uploadLimit   RateLimiter
+	downloadLimit RateLimiter
+
+	// extension protocol (BEP 10): reserved bytes del handshake remoto y lo
+	// que el peer anunció en su handshake extendido (ver extension.go)
+	remoteReserved [8]byte
+	remoteExt      remoteExtensions
+
+	// true si la conexión la abrimos nosotros (la dirección remota es la de escucha)
+	outgoing bool
+
+	// PEX (ver pex.go): direcciones ya anunciadas a este peer y último mensaje recibido
+	pexKnown    map[string]struct{}
+	pexLastRecv time.Time
+
+	// logger con info_hash y peer (ver log.go)
+	logger *slog.Logger
 }
 
 func (p *PeerConn) Close() {
@@ -39,7 +70,7 @@ func (p *PeerConn) BindManager(m *Manager) {
 // UpdateRemoteBitfield stores the remote peer bitfield snapshot
 func (p *PeerConn) UpdateRemoteBitfield(b []byte) {
 	if b == nil {
-		p.remoteBF = nil
+		p.setRemoteBitfield(nil)
 		return
 	}
 	if p.manager != nil && p.manager.Store() != nil {
@@ -50,21 +81,67 @@ func (p *PeerConn) UpdateRemoteBitfield(b []byte) {
 			return
 		}
 	}
-	p.remoteBF = make([]byte, len(b))
-	copy(p.remoteBF, b)
+	bf := make([]byte, len(b))
+	copy(bf, b)
+	p.setRemoteBitfield(bf)
+}
+
+// setRemoteBitfield replaces the remote bitfield and keeps the manager's
+// piece availability in sync.
+func (p *PeerConn) setRemoteBitfield(bf []byte) {
+	p.bfMu.Lock()
+	defer p.bfMu.Unlock()
+	p.swapRemoteBitfield(bf)
+}
+
+// swapRemoteBitfield reemplaza el bitfield; requiere bfMu
+func (p *PeerConn) swapRemoteBitfield(bf []byte) {
+	old := p.remoteBF
+	p.remoteBF = bf
+	if p.manager != nil && !p.bfGone {
+		p.manager.picker.PeerBitfield(old, bf)
+	}
+}
+
+// dropRemoteBitfield descuenta el bitfield del peer de la disponibilidad al
+// sacarlo del manager; lo que llegue después ya no se cuenta
+func (p *PeerConn) dropRemoteBitfield() {
+	p.bfMu.Lock()
+	defer p.bfMu.Unlock()
+	p.swapRemoteBitfield(nil)
+	p.bfGone = true
+}
+
+// markRemoteHave sets piece i in the remote bitfield after a HAVE message.
+func (p *PeerConn) markRemoteHave(i int, numPieces int) {
+	p.bfMu.Lock()
+	defer p.bfMu.Unlock()
+	exp := (numPieces + 7) / 8
+	if len(p.remoteBF) != exp {
+		p.swapRemoteBitfield(make([]byte, exp))
+	}
+	if hasBit(p.remoteBF, i) {
+		return
+	}
+	p.remoteBF[i/8] |= 1 << uint(7-i%8)
+	if p.manager != nil && !p.bfGone {
+		p.manager.picker.PeerHave(i)
+	}
 }
 
 // RemoteHasPiece checks remote bitfield for a piece index
 func (p *PeerConn) RemoteHasPiece(i int) bool {
-	if i < 0 || p.remoteBF == nil {
-		return false
-	}
-	byteIdx := i / 8
-	bit := 7 - (i % 8)
-	if byteIdx < 0 || byteIdx >= len(p.remoteBF) {
+	p.bfMu.RLock()
+	defer p.bfMu.RUnlock()
+	return hasBit(p.remoteBF, i)
+}
+
+// hasBit indica si la pieza i está marcada en el bitfield
+func hasBit(bf []byte, i int) bool {
+	if i < 0 || i/8 >= len(bf) {
 		return false
 	}
-	return (p.remoteBF[byteIdx] & (1 << uint(bit))) != 0
+	return bf[i/8]&(1<<uint(7-i%8)) != 0
 }
 
 // estructura para representar una pieza del archivo torrent
@@ -0,0 +1,239 @@
+package peerwire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"src/bencode"
+	"src/logging"
+	"strconv"
+	"time"
+)
+
+const (
+	// BEP 11: como mucho un mensaje PEX por minuto a cada peer
+	pexInterval = time.Minute
+	// máximo de direcciones en "added" y "dropped" por mensaje
+	pexMaxPeers = 50
+	// los mensajes que lleguen más seguido que esto se ignoran
+	pexMinRecvInterval = pexInterval / 2
+
+	// flags de added.f
+	pexFlagSeed = 0x02
+)
+
+// EnablePex activa Peer Exchange (ut_pex): cada pexInterval se envía a cada
+// peer que lo soporte las direcciones añadidas y caídas desde el último
+// mensaje, y las direcciones recibidas se entregan a onPeers. listenPort se
+// anuncia en el handshake extendido ("p") para que los peers que nos
+// aceptaron sepan dónde escuchamos. Debe llamarse antes de conectar peers.
+func (m *Manager) EnablePex(listenPort int, onPeers func(addrs []string)) error {
+	m.pexMu.Lock()
+	m.listenPort = listenPort
+	m.onPexPeers = onPeers
+	m.pexMu.Unlock()
+
+	if _, err := m.RegisterExtension(Extension{
+		Name:            "ut_pex",
+		HandshakeFields: m.listenPortField,
+		Handle:          m.handlePex,
+	}); err != nil {
+		return err
+	}
+	go m.pexLoop()
+	return nil
+}
+
+func (m *Manager) listenPortField() map[string]interface{} {
+	m.pexMu.Lock()
+	defer m.pexMu.Unlock()
+	if m.listenPort <= 0 {
+		return nil
+	}
+	return map[string]interface{}{"p": int64(m.listenPort)}
+}
+
+// ListenAddr devuelve la dirección (ip:port) en la que escucha el peer: la
+// remota si lo conectamos nosotros, o la IP remota con el puerto "p" de su
+// handshake extendido si nos conectó él. Vacío si no se conoce.
+func (p *PeerConn) ListenAddr() string {
+	if p.Conn == nil || p.Conn.RemoteAddr() == nil {
+		return ""
+	}
+	remote := p.Conn.RemoteAddr().String()
+	if p.outgoing {
+		return remote
+	}
+	port, _ := p.RemoteHandshake()["p"].(int64)
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil || port <= 0 || port > 65535 {
+		return ""
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port)))
+}
+
+// pexLoop envía los deltas de PEX cada pexInterval
+func (m *Manager) pexLoop() {
+	ticker := time.NewTicker(pexInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.sendPex()
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// sendPex calcula para cada peer con ut_pex qué direcciones conectadas no le
+// hemos contado todavía (added) y cuáles ya no están (dropped).
+func (m *Manager) sendPex() {
+	peers := m.snapshotPeers()
+	current := make(map[string]bool, len(peers))
+	for _, p := range peers {
+		if addr := p.ListenAddr(); addr != "" {
+			current[addr] = m.store != nil && p.remoteIsSeed(m.store.NumPieces())
+		}
+	}
+
+	for _, p := range peers {
+		if !p.SupportsExtension("ut_pex") {
+			continue
+		}
+		if p.pexKnown == nil {
+			p.pexKnown = make(map[string]struct{})
+		}
+		self := p.ListenAddr()
+
+		var added, dropped []string
+		for addr := range current {
+			if _, known := p.pexKnown[addr]; !known && addr != self && len(added) < pexMaxPeers {
+				added = append(added, addr)
+			}
+		}
+		for addr := range p.pexKnown {
+			if _, still := current[addr]; !still && len(dropped) < pexMaxPeers {
+				dropped = append(dropped, addr)
+			}
+		}
+		if len(added) == 0 && len(dropped) == 0 {
+			continue
+		}
+
+		addedC, flags := compactAddrs(added, current, net.IPv4len)
+		droppedC, _ := compactAddrs(dropped, nil, net.IPv4len)
+		added6C, flags6 := compactAddrs(added, current, net.IPv6len)
+		dropped6C, _ := compactAddrs(dropped, nil, net.IPv6len)
+		msg := bencode.Encode(map[string]interface{}{
+			"added":    string(addedC),
+			"added.f":  string(flags),
+			"dropped":  string(droppedC),
+			"added6":   string(added6C),
+			"added6.f": string(flags6),
+			"dropped6": string(dropped6C),
+		})
+		if err := p.SendExtensionMessage("ut_pex", msg); err != nil {
+			continue
+		}
+		for _, addr := range added {
+			p.pexKnown[addr] = struct{}{}
+		}
+		for _, addr := range dropped {
+			delete(p.pexKnown, addr)
+		}
+		p.log().Debug("pex enviado", "added", len(added), "dropped", len(dropped))
+	}
+}
+
+// handlePex procesa un mensaje ut_pex y entrega las direcciones añadidas al
+// callback de EnablePex. Los mensajes demasiado seguidos se descartan.
+func (m *Manager) handlePex(p *PeerConn, payload []byte) {
+	now := time.Now()
+	if !p.pexLastRecv.IsZero() && now.Sub(p.pexLastRecv) < pexMinRecvInterval {
+		p.log().Debug("pex ignorado (demasiado frecuente)")
+		return
+	}
+	p.pexLastRecv = now
+
+	msg, err := bencode.Decode(bytes.NewReader(payload))
+	if err != nil {
+		p.log().Debug("pex inválido", logging.Err(err))
+		return
+	}
+	added, _ := msg["added"].(string)
+	added6, _ := msg["added6"].(string)
+	addrs := parseCompactAddrs([]byte(added), pexMaxPeers, net.IPv4len)
+	addrs = append(addrs, parseCompactAddrs([]byte(added6), pexMaxPeers-len(addrs), net.IPv6len)...)
+	if len(addrs) == 0 {
+		return
+	}
+
+	m.pexMu.Lock()
+	onPeers := m.onPexPeers
+	m.pexMu.Unlock()
+	p.log().Debug("pex recibido", "peers", len(addrs))
+	if onPeers != nil {
+		onPeers(addrs)
+	}
+}
+
+// remoteIsSeed indica si el bitfield remoto tiene todas las piezas
+func (p *PeerConn) remoteIsSeed(numPieces int) bool {
+	if numPieces == 0 {
+		return false
+	}
+	for i := 0; i < numPieces; i++ {
+		if !p.RemoteHasPiece(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// compactAddrs codifica en formato compacto (ipLen bytes de IP + 2 de puerto)
+// las direcciones de la familia de ipLen (4: added, 16: added6) y devuelve sus
+// flags de added.f; las de la otra familia o que no son IP literales se omiten.
+func compactAddrs(addrs []string, seeds map[string]bool, ipLen int) ([]byte, []byte) {
+	out := make([]byte, 0, len(addrs)*(ipLen+2))
+	flags := make([]byte, 0, len(addrs))
+	for _, addr := range addrs {
+		host, portStr, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || (ip.To4() != nil) != (ipLen == net.IPv4len) {
+			continue
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port <= 0 || port > 65535 {
+			continue
+		}
+		if ipLen == net.IPv4len {
+			ip = ip.To4()
+		}
+		out = append(out, ip...)
+		out = binary.BigEndian.AppendUint16(out, uint16(port))
+		var f byte
+		if seeds[addr] {
+			f |= pexFlagSeed
+		}
+		flags = append(flags, f)
+	}
+	return out, flags
+}
+
+// parseCompactAddrs decodifica hasta max direcciones compactas con ipLen
+// bytes de IP (4 en added, 16 en added6)
+func parseCompactAddrs(b []byte, max, ipLen int) []string {
+	var out []string
+	for i := 0; i+ipLen+2 <= len(b) && len(out) < max; i += ipLen + 2 {
+		port := binary.BigEndian.Uint16(b[i+ipLen : i+ipLen+2])
+		if port == 0 {
+			continue
+		}
+		out = append(out, net.JoinHostPort(net.IP(b[i:i+ipLen]).String(), strconv.Itoa(int(port))))
+	}
+	return out
+}
@@ -1,21 +1,201 @@
 package peerwire
 
-// PiecePicker provides a minimal strategy to choose which piece to download next from a peer.
-// Phase 1: simple first-needed strategy (can be upgraded to rarest-first later).
-type PiecePicker struct{}
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
 
-func NewPiecePicker() *PiecePicker { return &PiecePicker{} }
+// PiecePicker chooses which piece to download next. It keeps the availability
+// of every piece across the peers of a Manager (from BITFIELD and HAVE
+// messages) and picks rarest-first, breaking ties at random so that peers in
+// the swarm do not all pull the same pieces. Piece priorities (see
+// priority.go) come first: skipped pieces are never picked and a higher
+// priority wins over availability.
+//
+// While a stream is open (see StreamReader) the picker switches to sequential
+// mode: the first missing piece from each stream's read position wins, so the
+// pieces right after the position are fetched first, even if skipped.
+type PiecePicker struct {
+	mu           sync.Mutex
+	availability []int
+	rng          *rand.Rand
 
-// NextPieceFor returns the index of a piece that we need and the peer has, or -1 if none.
+	// skip reports pieces that must not be picked (e.g. already in flight)
+	skip func(piece int) bool
+
+	// read position (piece index) of every open stream, by stream id
+	streams    map[int]int
+	nextStream int
+}
+
+func NewPiecePicker(numPieces int) *PiecePicker {
+	return &PiecePicker{
+		availability: make([]int, numPieces),
+		rng:          rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Availability returns how many connected peers have piece i.
+func (pp *PiecePicker) Availability(i int) int {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if i < 0 || i >= len(pp.availability) {
+		return 0
+	}
+	return pp.availability[i]
+}
+
+// PeerHave accounts for a HAVE message of a piece the peer did not have before.
+func (pp *PiecePicker) PeerHave(i int) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if i >= 0 && i < len(pp.availability) {
+		pp.availability[i]++
+	}
+}
+
+// PeerBitfield replaces the contribution of a peer bitfield: old is removed
+// and new is added. Either can be nil (new peer, or peer leaving).
+func (pp *PiecePicker) PeerBitfield(old, new []byte) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	for i := range pp.availability {
+		if bitSet(old, i) {
+			pp.availability[i]--
+		}
+		if bitSet(new, i) {
+			pp.availability[i]++
+		}
+	}
+}
+
+// AddStream registers a stream reading at piece and returns its id.
+func (pp *PiecePicker) AddStream(piece int) int {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if pp.streams == nil {
+		pp.streams = make(map[int]int)
+	}
+	pp.nextStream++
+	pp.streams[pp.nextStream] = piece
+	return pp.nextStream
+}
+
+// SetStreamPiece moves the read position of stream id.
+func (pp *PiecePicker) SetStreamPiece(id, piece int) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if _, ok := pp.streams[id]; ok {
+		pp.streams[id] = piece
+	}
+}
+
+// RemoveStream unregisters stream id; without streams the picker goes back
+// to rarest-first.
+func (pp *PiecePicker) RemoveStream(id int) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	delete(pp.streams, id)
+}
+
+// Sequential reports whether some stream is open (sequential mode).
+func (pp *PiecePicker) Sequential() bool {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	return len(pp.streams) > 0
+}
+
+// NextPieceFor returns the piece to download next from p, or -1 if none: in
+// sequential mode the first missing piece after a stream position, otherwise
+// the rarest of the highest-priority pieces that we need and the peer has.
 func (pp *PiecePicker) NextPieceFor(p *PeerConn, store PieceStore) int {
 	if p == nil || store == nil {
 		return -1
 	}
+	return pp.next(store, p.RemoteHasPiece)
+}
+
+// NextPieceAny is NextPieceFor for a source that has every piece (a web
+// seed): pieces no peer has come first.
+func (pp *PiecePicker) NextPieceAny(store PieceStore) int {
+	if store == nil {
+		return -1
+	}
+	return pp.next(store, func(int) bool { return true })
+}
+
+func (pp *PiecePicker) next(store PieceStore, has func(int) bool) int {
 	n := store.NumPieces()
+
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	if len(pp.streams) > 0 {
+		if i := pp.nextSequential(store, has, n); i >= 0 {
+			return i
+		}
+	}
+
+	best, bestPrio := -1, PrioritySkip
+	var candidates []int
 	for i := 0; i < n; i++ {
-		if !store.HasPiece(i) && p.RemoteHasPiece(i) {
+		if store.HasPiece(i) || !has(i) {
+			continue
+		}
+		prio := piecePriority(store, i)
+		if prio == PrioritySkip || prio < bestPrio {
+			continue
+		}
+		if pp.skip != nil && pp.skip(i) {
+			continue
+		}
+		avail := 0
+		if i < len(pp.availability) {
+			avail = pp.availability[i]
+		}
+		switch {
+		case best < 0 || prio > bestPrio || avail < best:
+			best, bestPrio = avail, prio
+			candidates = append(candidates[:0], i)
+		case avail == best:
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return -1
+	}
+	return candidates[pp.rng.Intn(len(candidates))]
+}
+
+// nextSequential returns the first piece the source has after the closest
+// stream position, or -1. Caller holds pp.mu.
+func (pp *PiecePicker) nextSequential(store PieceStore, has func(int) bool, n int) int {
+	positions := make([]int, 0, len(pp.streams))
+	for _, pos := range pp.streams {
+		positions = append(positions, pos)
+	}
+	sort.Ints(positions)
+	for _, pos := range positions {
+		for i := max(pos, 0); i < n; i++ {
+			if store.HasPiece(i) || !has(i) {
+				continue
+			}
+			if pp.skip != nil && pp.skip(i) {
+				continue
+			}
 			return i
 		}
 	}
 	return -1
 }
+
+// bitSet checks bit i of a BitTorrent bitfield (high bit first).
+func bitSet(bf []byte, i int) bool {
+	byteIdx := i / 8
+	if i < 0 || byteIdx >= len(bf) {
+		return false
+	}
+	return bf[byteIdx]&(1<<uint(7-i%8)) != 0
+}
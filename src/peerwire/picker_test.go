@@ -0,0 +1,107 @@
+package peerwire
+
+import "testing"
+
+// fakeStore is a PieceStore with piece priorities that only tracks which
+// pieces we have.
+type fakeStore struct {
+	have []bool
+	prio []Priority
+}
+
+func newFakeStore(n int) *fakeStore {
+	s := &fakeStore{have: make([]bool, n), prio: make([]Priority, n)}
+	for i := range s.prio {
+		s.prio[i] = PriorityNormal
+	}
+	return s
+}
+
+func (s *fakeStore) NumPieces() int                            { return len(s.have) }
+func (s *fakeStore) PieceLength() int                          { return blockLen }
+func (s *fakeStore) TotalLength() int64                        { return int64(len(s.have) * blockLen) }
+func (s *fakeStore) Bitfield() []byte                          { return nil }
+func (s *fakeStore) HasPiece(i int) bool                       { return s.have[i] }
+func (s *fakeStore) WriteBlock(int, int, []byte) (bool, error) { return false, nil }
+func (s *fakeStore) ReadBlock(int, int, int) ([]byte, error)   { return nil, nil }
+func (s *fakeStore) OnPieceComplete(func(int))                 {}
+func (s *fakeStore) PiecePriority(i int) Priority              { return s.prio[i] }
+
+// bitfield builds a bitfield of n pieces with the given pieces set.
+func bitfield(n int, pieces ...int) []byte {
+	bf := make([]byte, (n+7)/8)
+	for _, i := range pieces {
+		bf[i/8] |= 1 << uint(7-i%8)
+	}
+	return bf
+}
+
+func TestPickerRarestFirst(t *testing.T) {
+	const n = 10
+	pp := NewPiecePicker(n)
+	store := newFakeStore(n)
+	all := make([]int, n)
+	for i := range all {
+		all[i] = i
+	}
+	pp.PeerBitfield(nil, bitfield(n, all...))
+	pp.PeerBitfield(nil, bitfield(n, all...))
+	pp.PeerBitfield(nil, bitfield(n, 0, 1, 2, 3, 5, 6, 7, 8, 9)) // 4 is the rarest
+
+	if got := pp.NextPieceAny(store); got != 4 {
+		t.Fatalf("picked %d, want the rarest piece 4", got)
+	}
+	store.have[4] = true
+	for i := 0; i < 20; i++ {
+		if got := pp.NextPieceAny(store); got == 4 || got < 0 {
+			t.Fatalf("picked %d after having piece 4", got)
+		}
+	}
+}
+
+func TestPickerPriorities(t *testing.T) {
+	const n = 8
+	pp := NewPiecePicker(n)
+	store := newFakeStore(n)
+	pp.PeerHave(0) // 0 is less rare than the rest
+
+	store.prio[0] = PriorityHigh
+	if got := pp.NextPieceAny(store); got != 0 {
+		t.Fatalf("picked %d, want the high priority piece 0", got)
+	}
+
+	for i := range store.prio {
+		store.prio[i] = PrioritySkip
+	}
+	if got := pp.NextPieceAny(store); got != -1 {
+		t.Fatalf("picked skipped piece %d", got)
+	}
+	store.prio[5] = PriorityLow
+	if got := pp.NextPieceAny(store); got != 5 {
+		t.Fatalf("picked %d, want the only wanted piece 5", got)
+	}
+}
+
+func TestPickerSequentialStream(t *testing.T) {
+	const n = 8
+	pp := NewPiecePicker(n)
+	store := newFakeStore(n)
+	store.have[3] = true
+	store.prio[4] = PrioritySkip // a stream reads skipped pieces too
+
+	id := pp.AddStream(3)
+	if got := pp.NextPieceAny(store); got != 4 {
+		t.Fatalf("picked %d, want 4 (first missing after the stream position)", got)
+	}
+	pp.SetStreamPiece(id, 6)
+	if got := pp.NextPieceAny(store); got != 6 {
+		t.Fatalf("picked %d, want 6", got)
+	}
+	pp.RemoveStream(id)
+	if pp.Sequential() {
+		t.Fatal("still sequential without streams")
+	}
+	if got := pp.NextPieceAny(store); got == 4 || got == 3 || got < 0 {
+		t.Fatalf("picked %d back in rarest-first mode", got)
+	}
+}
@@ -0,0 +1,280 @@
+package peerwire
+
+import (
+	"src/logging"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPipelineDepth es la cantidad de REQUEST en vuelo por peer por defecto
+	DefaultPipelineDepth = 10
+	// DefaultRequestTimeout es el tiempo máximo de espera de un bloque pedido
+	DefaultRequestTimeout = 20 * time.Second
+
+	// límites del modo adaptativo
+	minAdaptiveDepth = 2
+	maxAdaptiveDepth = 250
+	// el modo adaptativo mantiene en vuelo lo que el peer entrega en este tiempo
+	adaptiveQueueTime = 2 * time.Second
+)
+
+// blockRequest identifica un REQUEST enviado a un peer
+type blockRequest struct {
+	piece  int
+	begin  int
+	length int
+}
+
+// requestPipeline mantiene los REQUEST en vuelo de un PeerConn y la tasa de
+// descarga medida para ese peer.
+type requestPipeline struct {
+	mu          sync.Mutex
+	outstanding map[blockRequest]time.Time // request -> momento de envío
+	recvBytes   int64                      // bytes recibidos desde la última muestra
+	rate        float64                    // bytes/s (media móvil exponencial)
+}
+
+func (rp *requestPipeline) add(r blockRequest) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.outstanding == nil {
+		rp.outstanding = make(map[blockRequest]time.Time)
+	}
+	rp.outstanding[r] = time.Now()
+}
+
+func (rp *requestPipeline) remove(r blockRequest) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	delete(rp.outstanding, r)
+}
+
+func (rp *requestPipeline) clear() {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	rp.outstanding = nil
+}
+
+func (rp *requestPipeline) inFlight() int {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return len(rp.outstanding)
+}
+
+func (rp *requestPipeline) received(n int) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	rp.recvBytes += int64(n)
+}
+
+// sample actualiza la tasa medida con los bytes recibidos en elapsed
+func (rp *requestPipeline) sample(elapsed time.Duration) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	cur := float64(rp.recvBytes) / elapsed.Seconds()
+	rp.recvBytes = 0
+	rp.rate = 0.8*rp.rate + 0.2*cur
+}
+
+// expired devuelve (y quita) los requests con más de timeout sin respuesta
+func (rp *requestPipeline) expired(timeout time.Duration) []blockRequest {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	var out []blockRequest
+	now := time.Now()
+	for r, sent := range rp.outstanding {
+		if now.Sub(sent) > timeout {
+			out = append(out, r)
+			delete(rp.outstanding, r)
+		}
+	}
+	return out
+}
+
+// Rate devuelve la tasa de descarga medida desde este peer en bytes/s
+func (p *PeerConn) Rate() float64 {
+	p.pipeline.mu.Lock()
+	defer p.pipeline.mu.Unlock()
+	return p.pipeline.rate
+}
+
+// SetPipeline configura la profundidad del pipeline de REQUEST por peer, si se
+// adapta a la tasa medida y el timeout de un bloque sin respuesta.
+func (m *Manager) SetPipeline(depth int, adaptive bool, timeout time.Duration) {
+	if depth <= 0 {
+		depth = DefaultPipelineDepth
+	}
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+	m.pipeMu.Lock()
+	defer m.pipeMu.Unlock()
+	m.pipelineDepth = depth
+	m.pipelineAdaptive = adaptive
+	m.requestTimeout = timeout
+}
+
+// pipelineDepthFor devuelve cuántos REQUEST puede tener en vuelo el peer.
+// En modo adaptativo se usa la tasa medida: rate * adaptiveQueueTime / blockLen.
+func (m *Manager) pipelineDepthFor(p *PeerConn) int {
+	m.pipeMu.Lock()
+	depth, adaptive := m.pipelineDepth, m.pipelineAdaptive
+	m.pipeMu.Unlock()
+	if !adaptive {
+		return depth
+	}
+	rate := p.Rate()
+	if rate <= 0 {
+		return depth
+	}
+	n := int(rate * adaptiveQueueTime.Seconds() / blockLen)
+	return min(max(n, minAdaptiveDepth), maxAdaptiveDepth)
+}
+
+// sendRequest registra el request en el pipeline del peer y lo envía
+func (m *Manager) sendRequest(p *PeerConn, r blockRequest) {
+	p.pipeline.add(r)
+	p.downloading.Store(true)
+	if err := p.SendBlockRequest(uint32(r.piece), uint32(r.begin), uint32(r.length)); err != nil {
+		p.pipeline.remove(r)
+	}
+}
+
+// assignBlocks reserva para p hasta max bloques pendientes sin asignar de las
+// piezas en curso que p tiene. Debe llamarse con downloadsMu tomado.
+func (m *Manager) assignBlocks(p *PeerConn, max int) []blockRequest {
+	var out []blockRequest
+	for pieceIndex, pd := range m.pieceDownloads {
+		if len(out) >= max {
+			break
+		}
+		if !p.RemoteHasPiece(pieceIndex) {
+			continue
+		}
+		plen := m.pieceSize(pieceIndex)
+		for blockNum := range pd.blocksPending {
+			if len(out) >= max {
+				break
+			}
+			if _, assigned := pd.blocksInProgress[blockNum]; assigned {
+				continue
+			}
+			pd.blocksInProgress[blockNum] = p
+			sz := blockLen
+			if blockNum*blockLen+sz > plen {
+				sz = plen - blockNum*blockLen
+			}
+			out = append(out, blockRequest{piece: pieceIndex, begin: blockNum * blockLen, length: sz})
+		}
+	}
+	return out
+}
+
+// FillPipeline pide a p bloques hasta llenar su pipeline: primero los
+// pendientes de piezas en curso y, si sobra capacidad, una pieza nueva elegida
+// por el picker. Sin nada más que pedir intenta el modo endgame.
+// Devuelve cuántos requests se enviaron.
+func (m *Manager) FillPipeline(p *PeerConn) int {
+	if m.store == nil || p.PeerChoking.Load() || m.Paused() {
+		return 0
+	}
+	sent := 0
+	for attempt := 0; attempt < 2; attempt++ {
+		free := m.pipelineDepthFor(p) - p.pipeline.inFlight()
+		if free <= 0 {
+			return sent
+		}
+		m.downloadsMu.Lock()
+		reqs := m.assignBlocks(p, free)
+		m.downloadsMu.Unlock()
+		for _, r := range reqs {
+			m.sendRequest(p, r)
+		}
+		sent += len(reqs)
+		if len(reqs) == free {
+			return sent
+		}
+		// Queda capacidad: arrancar una pieza nueva (reparte sus bloques en
+		// Round-Robin entre los peers disponibles, p incluido)
+		nxt := m.picker.NextPieceFor(p, m.store)
+		if nxt < 0 {
+			break
+		}
+		before := p.pipeline.inFlight()
+		m.DownloadPieceParallel(nxt)
+		sent += p.pipeline.inFlight() - before
+	}
+	if p.pipeline.inFlight() == 0 {
+		p.downloading.Store(false)
+		sent += m.RequestEndgameBlocks(p)
+	}
+	return sent
+}
+
+// releasePeerBlocks devuelve a pendientes (sin asignar) los bloques que p tenía
+// pedidos y vacía su pipeline. Devuelve pieceIndex -> bloques liberados.
+func (m *Manager) releasePeerBlocks(p *PeerConn, reason string) map[int][]int {
+	m.downloadsMu.Lock()
+	released := make(map[int][]int)
+	for pieceIndex, pd := range m.pieceDownloads {
+		for blockNum, reqs := range pd.endgameRequests {
+			pd.endgameRequests[blockNum] = removePeerConn(reqs, p)
+		}
+		for blockNum, peer := range pd.blocksInProgress {
+			if peer == p {
+				delete(pd.blocksInProgress, blockNum)
+				pd.blocksPending[blockNum] = true
+				released[pieceIndex] = append(released[pieceIndex], blockNum)
+				p.log().Debug("bloque liberado", logging.Piece(pieceIndex), "block", blockNum, "reason", reason)
+			}
+		}
+	}
+	m.downloadsMu.Unlock()
+	p.pipeline.clear()
+	p.downloading.Store(false)
+	return released
+}
+
+// pipelineLoop mide la tasa de cada peer y reprograma en otro peer los bloques
+// cuyo REQUEST superó el timeout.
+func (m *Manager) pipelineLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case now := <-ticker.C:
+			elapsed := now.Sub(last)
+			last = now
+
+			m.pipeMu.Lock()
+			timeout := m.requestTimeout
+			m.pipeMu.Unlock()
+
+			for _, p := range m.snapshotPeers() {
+				p.pipeline.sample(elapsed)
+				expired := p.pipeline.expired(timeout)
+				if len(expired) == 0 {
+					continue
+				}
+				p.log().Debug("requests sin respuesta, reprogramando", "requests", len(expired))
+				retry := make(map[int][]int)
+				m.downloadsMu.Lock()
+				for _, r := range expired {
+					blockNum := r.begin / blockLen
+					if pd, ok := m.pieceDownloads[r.piece]; ok && pd.blocksInProgress[blockNum] == p {
+						delete(pd.blocksInProgress, blockNum)
+						retry[r.piece] = append(retry[r.piece], blockNum)
+					}
+				}
+				m.downloadsMu.Unlock()
+				for pieceIndex, blocks := range retry {
+					m.retryPendingBlocks(pieceIndex, blocks, p)
+				}
+			}
+		case <-m.stopCh:
+			return
+		}
+	}
+}
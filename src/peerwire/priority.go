@@ -0,0 +1,233 @@
+package peerwire
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Priority of a file or piece. The picker never picks PrioritySkip pieces
+// (unless a stream reads them) and, among the rest, prefers the higher
+// priority before applying rarest-first.
+type Priority int
+
+const (
+	PrioritySkip Priority = iota
+	PriorityLow
+	PriorityNormal
+	PriorityHigh
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PrioritySkip:
+		return "skip"
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// ParsePriority parses skip|low|normal|high.
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "skip":
+		return PrioritySkip, nil
+	case "low":
+		return PriorityLow, nil
+	case "normal":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+	return PriorityNormal, fmt.Errorf("prioridad inválida %q (skip|low|normal|high)", s)
+}
+
+// priorities keeps the per-file priorities of a DiskPieceStore and the
+// per-piece overrides set with SetPiecePriority. The effective priority of a
+// piece is its override if any, otherwise the highest priority among the
+// files it overlaps (a piece shared with a wanted file is still needed).
+type priorities struct {
+	offsets  []int64 // global offset where each file starts
+	lengths  []int64
+	files    []Priority
+	override []Priority // per piece, -1 = none
+	pieces   []Priority // effective, recomputed on every change
+}
+
+func newPriorities(offsets, lengths []int64, numPieces int) *priorities {
+	pr := &priorities{
+		offsets:  offsets,
+		lengths:  lengths,
+		files:    make([]Priority, len(offsets)),
+		override: make([]Priority, numPieces),
+		pieces:   make([]Priority, numPieces),
+	}
+	for i := range pr.files {
+		pr.files[i] = PriorityNormal
+	}
+	for i := range pr.override {
+		pr.override[i] = -1
+		pr.pieces[i] = PriorityNormal
+	}
+	return pr
+}
+
+// FilePieces returns the piece range [first, last] covered by file i, or
+// first > last for an empty file.
+func (s *DiskPieceStore) FilePieces(i int) (int, int) {
+	pl := int64(s.pieceLength)
+	off, n := s.prio.offsets[i], s.prio.lengths[i]
+	if n == 0 {
+		return 0, -1
+	}
+	return int(off / pl), int((off + n - 1) / pl)
+}
+
+// recomputePriorities rebuilds the effective priority of every piece.
+// Caller holds s.mu.
+func (s *DiskPieceStore) recomputePriorities() {
+	pr := s.prio
+	for i := range pr.pieces {
+		pr.pieces[i] = PrioritySkip
+	}
+	for f := range pr.files {
+		first, last := s.FilePieces(f)
+		for i := first; i <= last; i++ {
+			pr.pieces[i] = max(pr.pieces[i], pr.files[f])
+		}
+	}
+	for i, o := range pr.override {
+		if o >= 0 {
+			pr.pieces[i] = o
+		}
+	}
+}
+
+// NumFiles returns how many files the torrent has (1 for single-file).
+func (s *DiskPieceStore) NumFiles() int { return len(s.prio.files) }
+
+// FilePriority returns the priority of file i.
+func (s *DiskPieceStore) FilePriority(i int) Priority {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i < 0 || i >= len(s.prio.files) {
+		return PriorityNormal
+	}
+	return s.prio.files[i]
+}
+
+// SetFilePriority changes the priority of file i (index in info["files"]).
+func (s *DiskPieceStore) SetFilePriority(i int, p Priority) error {
+	if p < PrioritySkip || p > PriorityHigh {
+		return errors.New("prioridad inválida")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i < 0 || i >= len(s.prio.files) {
+		return fmt.Errorf("archivo %d fuera de rango", i)
+	}
+	s.prio.files[i] = p
+	s.recomputePriorities()
+	return nil
+}
+
+// SetPiecePriority sets the priority of pieces [first, last], overriding the
+// priority derived from their files.
+func (s *DiskPieceStore) SetPiecePriority(first, last int, p Priority) error {
+	if p < PrioritySkip || p > PriorityHigh {
+		return errors.New("prioridad inválida")
+	}
+	return s.setOverride(first, last, p)
+}
+
+// ResetPiecePriority drops the overrides of pieces [first, last]: they go
+// back to the priority of their files.
+func (s *DiskPieceStore) ResetPiecePriority(first, last int) error {
+	return s.setOverride(first, last, -1)
+}
+
+func (s *DiskPieceStore) setOverride(first, last int, p Priority) error {
+	if first < 0 || last >= s.numPieces || first > last {
+		return fmt.Errorf("rango de piezas inválido [%d, %d]", first, last)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := first; i <= last; i++ {
+		s.prio.override[i] = p
+	}
+	s.recomputePriorities()
+	return nil
+}
+
+// PiecePriority returns the effective priority of piece i.
+func (s *DiskPieceStore) PiecePriority(i int) Priority {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i < 0 || i >= len(s.prio.pieces) {
+		return PrioritySkip
+	}
+	return s.prio.pieces[i]
+}
+
+// Wanted reports whether piece i has to be downloaded (priority above skip).
+func (s *DiskPieceStore) Wanted(i int) bool {
+	return s.PiecePriority(i) > PrioritySkip
+}
+
+// WantedLeft returns the bytes of wanted pieces we do not have yet.
+func (s *DiskPieceStore) WantedLeft() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var left int64
+	for i := 0; i < s.numPieces; i++ {
+		if !s.completed[i] && s.prio.pieces[i] > PrioritySkip {
+			left += s.pieceSize(i)
+		}
+	}
+	return left
+}
+
+// PriorityState returns the file priorities and the piece overrides (-1 =
+// none), e.g. to save them in the resume data.
+func (s *DiskPieceStore) PriorityState() (files, pieces []Priority) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Priority(nil), s.prio.files...), append([]Priority(nil), s.prio.override...)
+}
+
+// RestorePriorityState loads the state returned by PriorityState; it is
+// ignored if the lengths do not match this torrent.
+func (s *DiskPieceStore) RestorePriorityState(files, pieces []Priority) error {
+	if len(files) != len(s.prio.files) || len(pieces) != s.numPieces {
+		return errors.New("prioridades de otro torrent")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range files {
+		s.prio.files[i] = min(max(p, PrioritySkip), PriorityHigh)
+	}
+	for i, p := range pieces {
+		s.prio.override[i] = min(max(p, -1), PriorityHigh)
+	}
+	s.recomputePriorities()
+	return nil
+}
+
+// piecePrioritizer is implemented by stores with priorities (DiskPieceStore);
+// the picker treats every piece as normal in other stores.
+type piecePrioritizer interface {
+	PiecePriority(i int) Priority
+}
+
+// piecePriority returns the priority of piece i in store.
+func piecePriority(store PieceStore, i int) Priority {
+	if ps, ok := store.(piecePrioritizer); ok {
+		return ps.PiecePriority(i)
+	}
+	return PriorityNormal
+}
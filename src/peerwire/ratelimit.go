@@ -0,0 +1,134 @@
+package peerwire
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimiter es un token bucket en bytes/s. Rate 0 significa sin límite; el
+// valor cero del tipo es un limitador sin límite listo para usar.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   int64   // bytes/s
+	tokens float64 // puede quedar negativo: deuda que se paga esperando
+	last   time.Time
+	now    func() time.Time // reloj; nil = time.Now (los tests lo fijan)
+}
+
+// NewRateLimiter crea un limitador de rate bytes/s (0 = sin límite)
+func NewRateLimiter(rate int64) *RateLimiter {
+	return &RateLimiter{rate: rate}
+}
+
+// burst es lo máximo que se acumula sin uso: un segundo de tasa, al menos un bloque
+func (l *RateLimiter) burst() float64 {
+	return float64(max(l.rate, blockLen))
+}
+
+// SetRate cambia la tasa en caliente
+func (l *RateLimiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if rate < 0 {
+		rate = 0
+	}
+	if rate == l.rate {
+		return
+	}
+	l.rate = rate
+	l.tokens = min(l.tokens, l.burst())
+	if rate == 0 {
+		l.tokens = 0
+	}
+}
+
+// Rate devuelve la tasa actual en bytes/s (0 = sin límite)
+func (l *RateLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// reserve descuenta n bytes y devuelve cuánto hay que esperar para pagarlos
+func (l *RateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.now != nil {
+		now = l.now()
+	}
+	if l.rate <= 0 {
+		// sin límite no queda deuda para cuando vuelva a haberlo
+		l.last = now
+		l.tokens = 0
+		return 0
+	}
+	if l.last.IsZero() {
+		l.tokens = l.burst()
+	} else {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*float64(l.rate), l.burst())
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+}
+
+// Wait bloquea hasta que se puedan transferir n bytes
+func (l *RateLimiter) Wait(n int) {
+	if d := l.reserve(n); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// RateLimits son los límites de transferencia en bytes/s (0 = sin límite).
+// Los globales valen para todo el proceso; los por peer, para cada conexión.
+type RateLimits struct {
+	GlobalUpload   int64
+	GlobalDownload int64
+	PeerUpload     int64
+	PeerDownload   int64
+}
+
+var (
+	globalUploadLimit   RateLimiter
+	globalDownloadLimit RateLimiter
+	peerUploadRate      atomic.Int64
+	peerDownloadRate    atomic.Int64
+)
+
+// SetRateLimits aplica los límites; las conexiones abiertas los toman en su
+// próxima transferencia
+func SetRateLimits(l RateLimits) {
+	globalUploadLimit.SetRate(l.GlobalUpload)
+	globalDownloadLimit.SetRate(l.GlobalDownload)
+	peerUploadRate.Store(max(l.PeerUpload, 0))
+	peerDownloadRate.Store(max(l.PeerDownload, 0))
+}
+
+// GetRateLimits devuelve los límites vigentes
+func GetRateLimits() RateLimits {
+	return RateLimits{
+		GlobalUpload:   globalUploadLimit.Rate(),
+		GlobalDownload: globalDownloadLimit.Rate(),
+		PeerUpload:     peerUploadRate.Load(),
+		PeerDownload:   peerDownloadRate.Load(),
+	}
+}
+
+// waitUpload aplica el límite del peer y el global antes de enviar n bytes de bloque
+func (p *PeerConn) waitUpload(n int) {
+	p.uploadLimit.SetRate(peerUploadRate.Load())
+	p.uploadLimit.Wait(n)
+	globalUploadLimit.Wait(n)
+}
+
+// waitDownload aplica el límite del peer y el global a n bytes de bloque recibidos
+func (p *PeerConn) waitDownload(n int) {
+	p.downloadLimit.SetRate(peerDownloadRate.Load())
+	p.downloadLimit.Wait(n)
+	globalDownloadLimit.Wait(n)
+}
@@ -0,0 +1,87 @@
+package peerwire
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for RateLimiter.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(rate int64) (*RateLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+	l := NewRateLimiter(rate)
+	l.now = clock.now
+	return l, clock
+}
+
+func expectWait(t *testing.T, l *RateLimiter, n int, want time.Duration) {
+	t.Helper()
+	if got := l.reserve(n); got < want-time.Millisecond || got > want+time.Millisecond {
+		t.Fatalf("reserve(%d) = %v, want %v", n, got, want)
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	const rate = 100_000
+	l, clock := newTestLimiter(rate)
+	expectWait(t, l, rate, 0)                      // a full bucket to start with
+	expectWait(t, l, rate/2, 500*time.Millisecond) // debt paid at rate bytes/s
+
+	clock.advance(1500 * time.Millisecond) // pays the debt and refills the bucket
+	expectWait(t, l, rate, 0)
+	clock.advance(250 * time.Millisecond)
+	expectWait(t, l, rate/4, 0)
+	expectWait(t, l, rate/4, 250*time.Millisecond)
+}
+
+func TestRateLimiterBurstCap(t *testing.T) {
+	const rate = 100_000
+	l, clock := newTestLimiter(rate)
+	expectWait(t, l, 0, 0)
+	clock.advance(time.Hour) // idle time does not accumulate past one second of rate
+	expectWait(t, l, rate, 0)
+	expectWait(t, l, rate, time.Second)
+
+	// below one block per second the burst is still one block
+	small, _ := newTestLimiter(1024)
+	expectWait(t, small, blockLen, 0)
+	expectWait(t, small, 1024, time.Second)
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	l, _ := newTestLimiter(0)
+	for i := 0; i < 10; i++ {
+		expectWait(t, l, 1<<30, 0)
+	}
+	var zero RateLimiter
+	if d := zero.reserve(1 << 30); d != 0 {
+		t.Fatalf("zero value limiter waited %v", d)
+	}
+}
+
+func TestRateLimiterSetRate(t *testing.T) {
+	const rate = 100_000
+	l, clock := newTestLimiter(rate)
+	expectWait(t, l, rate, 0)
+
+	// a higher rate pays the same debt faster
+	l.SetRate(2 * rate)
+	expectWait(t, l, 2*rate, time.Second)
+
+	// removing the limit takes effect on the next transfer
+	l.SetRate(0)
+	expectWait(t, l, 1<<30, 0)
+
+	// and a new limit starts from an empty bucket, not a saved-up burst
+	l.SetRate(rate)
+	clock.advance(time.Second)
+	expectWait(t, l, rate, 0)
+	expectWait(t, l, rate/10, 100*time.Millisecond)
+	if l.Rate() != rate {
+		t.Fatalf("Rate() = %d, want %d", l.Rate(), rate)
+	}
+}
@@ -3,6 +3,7 @@ package peerwire
 import (
 	"crypto/sha1"
 	"errors"
+	"io"
 	"os"
 	"sync"
 )
@@ -22,9 +23,32 @@ type PieceStore interface {
 	OnPieceComplete(cb func(piece int))
 }
 
+// storageFile is the on-disk layout behind a DiskPieceStore: a single file
+// or a set of files addressed as one contiguous byte range.
+type storageFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Size() (int64, error)
+	Sync() error
+	Close() error
+}
+
+// singleFile adapts *os.File to storageFile.
+type singleFile struct {
+	*os.File
+}
+
+func (f singleFile) Size() (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
 // DiskPieceStore is a simple file-backed implementation
 type DiskPieceStore struct {
-	f           *os.File
+	f           storageFile
 	mu          sync.RWMutex
 	pieceLength int
 	totalLength int64
@@ -38,6 +62,13 @@ type DiskPieceStore struct {
 	expected [][20]byte
 
 	cbs []func(int)
+
+	// pieceDone se cierra (y se reemplaza) cada vez que se completa una pieza;
+	// lo usa WaitPiece
+	pieceDone chan struct{}
+
+	// prioridades por archivo y por pieza (ver priority.go)
+	prio *priorities
 }
 
 func NewDiskPieceStore(path string, pieceLength int, totalLength int64) (*DiskPieceStore, error) {
@@ -61,7 +92,15 @@ func NewDiskPieceStoreWithMode(path string, pieceLength int, totalLength int64,
 			return nil, err
 		}
 	}
+	return newDiskPieceStore(singleFile{f}, pieceLength, totalLength), nil
+}
+
+func newDiskPieceStore(f storageFile, pieceLength int, totalLength int64) *DiskPieceStore {
 	numPieces := int((totalLength + int64(pieceLength) - 1) / int64(pieceLength))
+	offsets, lengths := []int64{0}, []int64{totalLength}
+	if mf, ok := f.(*multiFile); ok {
+		offsets, lengths = mf.offsets, mf.lengths
+	}
 	return &DiskPieceStore{
 		f:           f,
 		pieceLength: pieceLength,
@@ -70,7 +109,9 @@ func NewDiskPieceStoreWithMode(path string, pieceLength int, totalLength int64,
 		bitfield:    make([]byte, (numPieces+7)/8),
 		completed:   make([]bool, numPieces),
 		received:    make([]int64, numPieces),
-	}, nil
+		pieceDone:   make(chan struct{}),
+		prio:        newPriorities(offsets, lengths, numPieces),
+	}
 }
 
 func (s *DiskPieceStore) NumPieces() int     { return s.numPieces }
@@ -111,6 +152,31 @@ func (s *DiskPieceStore) markComplete(i int) {
 	bit := 7 - (i % 8)
 	s.bitfield[byteIdx] |= (1 << uint(bit))
 	s.completed[i] = true
+	close(s.pieceDone)
+	s.pieceDone = make(chan struct{})
+}
+
+// WaitPiece bloquea hasta que la pieza i esté verificada o se cierre cancel o
+// closed (cualquiera de los dos puede ser nil)
+func (s *DiskPieceStore) WaitPiece(i int, cancel, closed <-chan struct{}) error {
+	if i < 0 || i >= s.numPieces {
+		return errors.New("piece out of range")
+	}
+	for {
+		s.mu.RLock()
+		done, ch := s.completed[i], s.pieceDone
+		s.mu.RUnlock()
+		if done {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-cancel:
+			return errors.New("espera de pieza cancelada")
+		case <-closed:
+			return errors.New("espera de pieza cancelada")
+		}
+	}
 }
 
 func (s *DiskPieceStore) WriteBlock(piece int, begin int, data []byte) (bool, error) {
@@ -211,11 +277,11 @@ func (s *DiskPieceStore) ScanAndMarkComplete() error {
 	if len(s.expected) != s.numPieces {
 		return errors.New("expected hashes not set or length mismatch")
 	}
-	fi, err := s.f.Stat()
+	size, err := s.f.Size()
 	if err != nil {
 		return err
 	}
-	if fi.Size() != s.totalLength {
+	if size != s.totalLength {
 		return errors.New("file size does not match total length")
 	}
 	// Iterate pieces
@@ -244,3 +310,32 @@ func (s *DiskPieceStore) ScanAndMarkComplete() error {
 	}
 	return nil
 }
+
+// Close closes the underlying file(s)
+func (s *DiskPieceStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// RestoreBitfield marks the pieces set in bf as complete without reading them
+// back. Used when resume data proves the file has not changed since it was
+// saved; otherwise ScanAndMarkComplete must be used.
+func (s *DiskPieceStore) RestoreBitfield(bf []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(bf) != len(s.bitfield) {
+		return errors.New("bitfield length mismatch")
+	}
+	// los bits de relleno del último byte deben ser cero
+	if spare := len(bf)*8 - s.numPieces; spare > 0 && bf[len(bf)-1]&(1<<uint(spare)-1) != 0 {
+		return errors.New("bitfield has spare bits set")
+	}
+	for i := 0; i < s.numPieces; i++ {
+		if bf[i/8]&(1<<uint(7-i%8)) != 0 {
+			s.markComplete(i)
+			s.received[i] = s.pieceSize(i)
+		}
+	}
+	return nil
+}
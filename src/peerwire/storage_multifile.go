@@ -0,0 +1,175 @@
+package peerwire
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileEntry describes one file of a multi-file torrent (info["files"]).
+// Path holds the path components relative to the torrent root directory.
+type FileEntry struct {
+	Path   []string
+	Length int64
+}
+
+// RelPath returns the file path relative to the torrent root directory.
+func (fe FileEntry) RelPath() string {
+	return filepath.Join(fe.Path...)
+}
+
+// multiFile maps the contiguous torrent byte range onto a list of files,
+// in the order given by the metainfo.
+type multiFile struct {
+	files   []*os.File
+	offsets []int64 // global offset where each file starts
+	lengths []int64
+	total   int64
+}
+
+// NewMultiFilePieceStore creates a DiskPieceStore over the files of a
+// multi-file torrent rooted at root. The directory tree is created if needed.
+// If truncate is true every file is created/truncated to its length (download
+// mode); otherwise existing files are opened as they are (seeding/resume).
+func NewMultiFilePieceStore(root string, files []FileEntry, pieceLength int, truncate bool) (*DiskPieceStore, error) {
+	if len(files) == 0 {
+		return nil, errors.New("empty file list")
+	}
+	var total int64
+	for _, fe := range files {
+		if fe.Length < 0 {
+			return nil, fmt.Errorf("invalid length for %s", fe.RelPath())
+		}
+		total += fe.Length
+	}
+	if pieceLength <= 0 || total <= 0 {
+		return nil, errors.New("invalid lengths")
+	}
+
+	mf := &multiFile{total: total}
+	var off int64
+	for _, fe := range files {
+		path, err := safeJoin(root, fe.Path)
+		if err != nil {
+			mf.Close()
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			mf.Close()
+			return nil, err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			mf.Close()
+			return nil, err
+		}
+		if truncate {
+			if err := f.Truncate(fe.Length); err != nil {
+				f.Close()
+				mf.Close()
+				return nil, err
+			}
+		}
+		mf.files = append(mf.files, f)
+		mf.offsets = append(mf.offsets, off)
+		mf.lengths = append(mf.lengths, fe.Length)
+		off += fe.Length
+	}
+	return newDiskPieceStore(mf, pieceLength, total), nil
+}
+
+// safeJoin joins the path components under root, rejecting absolute paths and
+// components that would escape the torrent directory.
+func safeJoin(root string, parts []string) (string, error) {
+	if len(parts) == 0 {
+		return "", errors.New("empty file path")
+	}
+	for _, p := range parts {
+		if p == "" || p == "." || p == ".." || strings.ContainsAny(p, `/\`) {
+			return "", fmt.Errorf("invalid path component %q", p)
+		}
+	}
+	return filepath.Join(append([]string{root}, parts...)...), nil
+}
+
+// span calls fn for every file chunk covered by [off, off+n), passing the file
+// index, the offset inside that file and the range inside the caller buffer.
+func (m *multiFile) span(off int64, n int, fn func(i int, fileOff int64, lo, hi int) error) error {
+	if off < 0 || off+int64(n) > m.total {
+		return errors.New("range outside torrent data")
+	}
+	done := 0
+	for i := range m.files {
+		if done == n {
+			break
+		}
+		start, length := m.offsets[i], m.lengths[i]
+		cur := off + int64(done)
+		if cur >= start+length || length == 0 {
+			continue
+		}
+		fileOff := cur - start
+		chunk := int(min(int64(n-done), length-fileOff))
+		if err := fn(i, fileOff, done, done+chunk); err != nil {
+			return err
+		}
+		done += chunk
+	}
+	return nil
+}
+
+func (m *multiFile) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	err := m.span(off, len(p), func(i int, fileOff int64, lo, hi int) error {
+		r, err := m.files[i].ReadAt(p[lo:hi], fileOff)
+		n += r
+		return err
+	})
+	return n, err
+}
+
+func (m *multiFile) WriteAt(p []byte, off int64) (int, error) {
+	n := 0
+	err := m.span(off, len(p), func(i int, fileOff int64, lo, hi int) error {
+		w, err := m.files[i].WriteAt(p[lo:hi], fileOff)
+		n += w
+		return err
+	})
+	return n, err
+}
+
+// Size returns the total size of the layout, or an error if any file on disk
+// does not have the length announced in the metainfo.
+func (m *multiFile) Size() (int64, error) {
+	for i, f := range m.files {
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if fi.Size() != m.lengths[i] {
+			return fi.Size(), fmt.Errorf("%s: size %d, expected %d", f.Name(), fi.Size(), m.lengths[i])
+		}
+	}
+	return m.total, nil
+}
+
+func (m *multiFile) Sync() error {
+	for _, f := range m.files {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *multiFile) Close() error {
+	var first error
+	for _, f := range m.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,131 @@
+package peerwire
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+var errStreamClosed = errors.New("stream cerrado")
+
+// StreamReader lee un rango de bytes del torrent (p.ej. uno de sus archivos)
+// mientras se descarga. Cada Read bloquea hasta que la pieza que necesita
+// está verificada, y mientras el reader está abierto el picker del Manager
+// descarga en orden desde la posición de lectura (ver PiecePicker).
+type StreamReader struct {
+	store  *DiskPieceStore
+	m      *Manager
+	id     int
+	offset int64 // inicio del rango dentro del torrent
+	length int64
+	cancel <-chan struct{}
+
+	// done se cierra en Close sin tomar mu: Read lo tiene tomado mientras
+	// espera una pieza
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu     sync.Mutex
+	pos    int64 // relativa a offset
+	closed bool
+}
+
+// NewStreamReader abre un stream sobre [offset, offset+length) del torrent.
+// Las lecturas en espera terminan con error al cerrarse cancel o el reader.
+func (m *Manager) NewStreamReader(offset, length int64, cancel <-chan struct{}) (*StreamReader, error) {
+	store, ok := m.store.(*DiskPieceStore)
+	if !ok {
+		return nil, errors.New("el storage no admite streaming")
+	}
+	if offset < 0 || length < 0 || offset+length > store.TotalLength() {
+		return nil, errors.New("rango fuera del torrent")
+	}
+	sr := &StreamReader{store: store, m: m, offset: offset, length: length, cancel: cancel, done: make(chan struct{})}
+	sr.id = m.picker.AddStream(sr.pieceAt(0))
+	return sr, nil
+}
+
+// pieceAt devuelve la pieza que contiene la posición pos del rango
+func (sr *StreamReader) pieceAt(pos int64) int {
+	return int((sr.offset + pos) / int64(sr.store.PieceLength()))
+}
+
+// Size devuelve el largo del rango
+func (sr *StreamReader) Size() int64 { return sr.length }
+
+func (sr *StreamReader) Read(p []byte) (int, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.closed {
+		return 0, errStreamClosed
+	}
+	if sr.pos >= sr.length {
+		return 0, io.EOF
+	}
+
+	piece := sr.pieceAt(sr.pos)
+	if !sr.store.HasPiece(piece) {
+		// mover la ventana de prioridad y despertar a los peers ociosos
+		sr.m.picker.SetStreamPiece(sr.id, piece)
+		sr.m.fillPipelines()
+		if err := sr.store.WaitPiece(piece, sr.cancel, sr.done); err != nil {
+			select {
+			case <-sr.done:
+				return 0, errStreamClosed
+			default:
+				return 0, err
+			}
+		}
+	}
+
+	pl := int64(sr.store.PieceLength())
+	begin := (sr.offset + sr.pos) % pl
+	n := min(int64(len(p)), sr.store.pieceSize(piece)-begin, sr.length-sr.pos)
+	data, err := sr.store.ReadBlock(piece, int(begin), int(n))
+	if err != nil {
+		return 0, err
+	}
+	copy(p, data)
+	sr.pos += n
+	if next := sr.pieceAt(sr.pos); next != piece && sr.pos < sr.length {
+		sr.m.picker.SetStreamPiece(sr.id, next)
+	}
+	return int(n), nil
+}
+
+func (sr *StreamReader) Seek(offset int64, whence int) (int64, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = sr.pos + offset
+	case io.SeekEnd:
+		pos = sr.length + offset
+	default:
+		return 0, errors.New("whence inválido")
+	}
+	if pos < 0 {
+		return 0, errors.New("posición negativa")
+	}
+	sr.pos = pos
+	if pos < sr.length {
+		sr.m.picker.SetStreamPiece(sr.id, sr.pieceAt(pos))
+	}
+	return pos, nil
+}
+
+// Close libera el stream; sin streams abiertos el picker vuelve a rarest-first.
+// Un Read esperando una pieza termina con error.
+func (sr *StreamReader) Close() error {
+	sr.closeOnce.Do(func() { close(sr.done) })
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if !sr.closed {
+		sr.closed = true
+		sr.m.picker.RemoveStream(sr.id)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package peerwire
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Close must wake up a Read blocked waiting for a missing piece even though
+// Read holds the reader's lock while it waits.
+func TestStreamReaderCloseUnblocksRead(t *testing.T) {
+	store, err := NewDiskPieceStore(filepath.Join(t.TempDir(), "data"), blockLen, 4*blockLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(store)
+	defer m.Stop()
+	sr, err := m.NewStreamReader(0, 4*blockLen, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := sr.Read(make([]byte, 16))
+		readErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // let Read block in WaitPiece
+
+	closed := make(chan struct{})
+	go func() {
+		sr.Close()
+		close(closed)
+	}()
+	select {
+	case err := <-readErr:
+		if !errors.Is(err, errStreamClosed) {
+			t.Fatalf("Read returned %v, want %v", err, errStreamClosed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Read still blocked after Close")
+	}
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not return")
+	}
+}
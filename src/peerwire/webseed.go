@@ -0,0 +1,305 @@
+package peerwire
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"src/logging"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// por debajo de esta tasa (suma de todos los peers) el swarm se considera
+	// lento y los web seeds empiezan a bajar piezas
+	webSeedSlowRate = 256 * 1024
+	// espera entre comprobaciones cuando no hace falta el web seed
+	webSeedIdleWait = 2 * time.Second
+	// backoff tras un error (se duplica hasta webSeedMaxBackoff)
+	webSeedMinBackoff = 5 * time.Second
+	webSeedMaxBackoff = 5 * time.Minute
+	webSeedTimeout    = 60 * time.Second
+)
+
+// WebSeed es un servidor HTTP con el contenido del torrent (BEP 19, url-list).
+// Baja piezas enteras con requests Range cuando no hay peers que puedan darlas
+// o el swarm es lento; cada pieza pasa por WriteBlock, que verifica el SHA-1.
+type WebSeed struct {
+	URL string
+
+	m      *Manager
+	name   string      // info["name"]
+	files  []FileEntry // vacío en torrents de un solo archivo
+	client *http.Client
+
+	mu         sync.Mutex
+	failures   int
+	retryAt    time.Time
+	downloaded atomic.Int64
+}
+
+// WebSeedStatus es el estado de un web seed para /status
+type WebSeedStatus struct {
+	URL        string `json:"url"`
+	Active     bool   `json:"active"` // false mientras está en backoff por errores
+	Failures   int    `json:"failures"`
+	Downloaded int64  `json:"downloaded"`
+}
+
+// AddWebSeed agrega un web seed al torrent y arranca su descarga en segundo
+// plano. name y files son los del info dictionary.
+func (m *Manager) AddWebSeed(rawURL, name string, files []FileEntry) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("web seed inválido: %q", rawURL)
+	}
+	if m.store == nil {
+		return errors.New("web seed sin storage")
+	}
+	ws := &WebSeed{
+		URL:    rawURL,
+		m:      m,
+		name:   name,
+		files:  files,
+		client: &http.Client{Timeout: webSeedTimeout},
+	}
+	m.webMu.Lock()
+	m.webSeeds = append(m.webSeeds, ws)
+	m.webMu.Unlock()
+	go ws.run()
+	return nil
+}
+
+// WebSeeds devuelve el estado de los web seeds del torrent
+func (m *Manager) WebSeeds() []WebSeedStatus {
+	m.webMu.Lock()
+	seeds := append([]*WebSeed(nil), m.webSeeds...)
+	m.webMu.Unlock()
+	out := make([]WebSeedStatus, 0, len(seeds))
+	for _, ws := range seeds {
+		ws.mu.Lock()
+		out = append(out, WebSeedStatus{
+			URL:        ws.URL,
+			Active:     time.Now().After(ws.retryAt),
+			Failures:   ws.failures,
+			Downloaded: ws.downloaded.Load(),
+		})
+		ws.mu.Unlock()
+	}
+	return out
+}
+
+// webFetching indica si un web seed está bajando la pieza
+func (m *Manager) webFetching(piece int) bool {
+	m.webMu.Lock()
+	defer m.webMu.Unlock()
+	_, ok := m.webPieces[piece]
+	return ok
+}
+
+// webPieceSet copia las piezas que están bajando los web seeds
+func (m *Manager) webPieceSet() map[int]struct{} {
+	m.webMu.Lock()
+	defer m.webMu.Unlock()
+	out := make(map[int]struct{}, len(m.webPieces))
+	for i := range m.webPieces {
+		out[i] = struct{}{}
+	}
+	return out
+}
+
+// swarmSlow indica si conviene usar web seeds: ningún peer nos tiene
+// unchoked o la tasa total de los peers es menor que webSeedSlowRate
+func (m *Manager) swarmSlow() bool {
+	var rate float64
+	unchoked := false
+	for _, p := range m.snapshotPeers() {
+		if !p.PeerChoking.Load() {
+			unchoked = true
+		}
+		rate += p.Rate()
+	}
+	return !unchoked || rate < webSeedSlowRate
+}
+
+func (ws *WebSeed) run() {
+	m := ws.m
+	for {
+		wait := webSeedIdleWait
+		if !m.Paused() && m.swarmSlow() {
+			if piece := ws.reserve(); piece >= 0 {
+				err := ws.fetchPiece(piece)
+				ws.release(piece)
+				if err == nil {
+					ws.mu.Lock()
+					ws.failures = 0
+					ws.mu.Unlock()
+					continue
+				}
+				wait = ws.fail(piece, err)
+			}
+		}
+		select {
+		case <-m.stopCh:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// reserve elige una pieza que no esté bajando nadie y la marca como del web
+// seed para que el picker no se la dé a los peers. Toma downloadsMu y después
+// webMu (el mismo orden que DownloadPieceParallel) para que la pieza no pase a
+// los peers entre la verificación y la reserva.
+func (ws *WebSeed) reserve() int {
+	m := ws.m
+	piece := m.picker.NextPieceAny(m.store)
+	if piece < 0 {
+		return -1
+	}
+	m.downloadsMu.Lock()
+	defer m.downloadsMu.Unlock()
+	m.webMu.Lock()
+	defer m.webMu.Unlock()
+	if _, busy := m.pieceDownloads[piece]; busy {
+		return -1
+	}
+	if _, busy := m.webPieces[piece]; busy {
+		return -1
+	}
+	m.webPieces[piece] = struct{}{}
+	return piece
+}
+
+func (ws *WebSeed) release(piece int) {
+	ws.m.webMu.Lock()
+	delete(ws.m.webPieces, piece)
+	ws.m.webMu.Unlock()
+}
+
+// fail registra un error y devuelve cuánto esperar antes de reintentar
+func (ws *WebSeed) fail(piece int, err error) time.Duration {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.failures++
+	backoff := min(webSeedMinBackoff<<min(ws.failures-1, 10), webSeedMaxBackoff)
+	ws.retryAt = time.Now().Add(backoff)
+	ws.m.log().Warn("web seed falló", "url", ws.URL, logging.Piece(piece), logging.Err(err), "retry_in", backoff)
+	return backoff
+}
+
+// fetchPiece baja la pieza completa (uno o más requests Range si cruza
+// archivos) y la escribe en el storage
+func (ws *WebSeed) fetchPiece(piece int) error {
+	m := ws.m
+	store := m.store
+	plen := int64(store.PieceLength())
+	size := min(plen, store.TotalLength()-int64(piece)*plen)
+	buf := make([]byte, 0, size)
+	for _, seg := range ws.segments(int64(piece)*plen, size) {
+		data, err := ws.get(seg.url, seg.offset, seg.length)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, data...)
+	}
+
+	completed, err := store.WriteBlock(piece, 0, buf)
+	if err != nil {
+		return err
+	}
+	if !completed {
+		// la pieza ya estaba completa (llegó de un peer mientras se bajaba):
+		// los bytes no se usaron y no cuentan como descargados
+		m.log().Debug("pieza del web seed descartada, ya estaba completa", "url", ws.URL, logging.Piece(piece))
+		return nil
+	}
+	m.downloaded.Add(size)
+	ws.downloaded.Add(size)
+	m.log().Debug("pieza recibida de web seed", "url", ws.URL, logging.Piece(piece))
+	return nil
+}
+
+type webSegment struct {
+	url            string
+	offset, length int64 // dentro del archivo
+}
+
+// segments traduce el rango global [off, off+n) del torrent a rangos de
+// los archivos del web seed
+func (ws *WebSeed) segments(off, n int64) []webSegment {
+	if len(ws.files) == 0 {
+		return []webSegment{{ws.fileURL(nil), off, n}}
+	}
+	var out []webSegment
+	var start int64
+	for _, fe := range ws.files {
+		end := start + fe.Length
+		if off < end && off+n > start {
+			from := max(off, start)
+			to := min(off+n, end)
+			out = append(out, webSegment{ws.fileURL(fe.Path), from - start, to - from})
+		}
+		start = end
+	}
+	return out
+}
+
+// fileURL arma la URL de un archivo según BEP 19: en torrents de un solo
+// archivo una URL terminada en "/" lleva el nombre agregado; en multi-file
+// siempre es <url>/<name>/<path>
+func (ws *WebSeed) fileURL(path []string) string {
+	base := ws.URL
+	if len(ws.files) == 0 {
+		if strings.HasSuffix(base, "/") {
+			base += url.PathEscape(ws.name)
+		}
+		return base
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	parts := []string{url.PathEscape(ws.name)}
+	for _, p := range path {
+		parts = append(parts, url.PathEscape(p))
+	}
+	return base + strings.Join(parts, "/")
+}
+
+// get pide [offset, offset+length) de un archivo con Range, aplicando el
+// límite global de descarga
+func (ws *WebSeed) get(u string, offset, length int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+	case resp.StatusCode == http.StatusOK && offset == 0 && resp.ContentLength == length:
+		// el servidor ignoró Range pero el rango es el archivo entero
+	default:
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+
+	data := make([]byte, length)
+	for read := int64(0); read < length; {
+		chunk := min(int64(blockLen), length-read)
+		if _, err := io.ReadFull(resp.Body, data[read:read+chunk]); err != nil {
+			return nil, err
+		}
+		globalDownloadLimit.Wait(int(chunk))
+		read += chunk
+	}
+	return data, nil
+}
@@ -0,0 +1,82 @@
+package swarmtest
+
+import (
+	"testing"
+	"time"
+)
+
+// Peers que entran y salen durante la descarga: un seed parcial muere de
+// golpe, otro con el resto de las piezas aparece más tarde (los leechers lo
+// encuentran por los announces periódicos), un leecher se va con stopped y
+// uno nuevo termina con lo que queda del swarm.
+func TestPeerChurn(t *testing.T) {
+	tr := NewTracker(t, TrackerOptions{})
+	c := NewContent(t, ContentOptions{Size: 1<<20 + 999, Announce: []string{tr.URL}})
+	half := c.NumPieces / 2
+
+	// a tiene sólo la primera mitad
+	a := NewClient(t, c, ClientOptions{Have: func(i int) bool { return i < half }})
+	if !a.HasPieces(0, half-1) || a.Store.HasPiece(half) {
+		t.Fatal("el cliente parcial no verificó sus piezas")
+	}
+	a.Start()
+	l1 := NewClient(t, c, ClientOptions{})
+	l2 := NewClient(t, c, ClientOptions{})
+	l1.Start()
+	l2.Start()
+	WaitFor(t, downloadTimeout, "la primera mitad en l1 y l2", func() bool {
+		return l1.HasPieces(0, half-1) && l2.HasPieces(0, half-1)
+	})
+
+	// a muere sin avisar: el tracker lo sigue listando, pero nadie pierde nada
+	a.Kill()
+	if !tr.HasPeer(c.InfoHash, a.Cfg.PeerId) {
+		t.Fatal("el tracker no debería enterarse de un cliente caído")
+	}
+
+	// b trae la segunda mitad
+	b := NewClient(t, c, ClientOptions{Have: func(i int) bool { return i >= half }})
+	b.Start()
+	l1.WaitDone(downloadTimeout)
+	l2.WaitDone(downloadTimeout)
+	l1.Verify()
+	l2.Verify()
+
+	// l1 se va ordenadamente y llega l3
+	l1.Stop()
+	if tr.HasPeer(c.InfoHash, l1.Cfg.PeerId) {
+		t.Fatal("el tracker sigue listando a l1 después de event=stopped")
+	}
+	l3 := NewClient(t, c, ClientOptions{})
+	l3.Start()
+	l3.WaitDone(downloadTimeout)
+	l3.Verify()
+	b.WaitDone(downloadTimeout)
+}
+
+// Un leecher que se conecta sólo a un seed que muere a mitad de descarga
+// termina con otro seed que entra después
+func TestSeedReplaced(t *testing.T) {
+	tr := NewTracker(t, TrackerOptions{})
+	c := NewContent(t, ContentOptions{Size: 768 * 1024, Announce: []string{tr.URL}})
+	third := c.NumPieces / 3
+
+	// s1 tiene sólo el primer tercio: el leecher se queda a medias
+	s1 := NewClient(t, c, ClientOptions{Have: func(i int) bool { return i < third }})
+	s1.Start()
+	leech := NewClient(t, c, ClientOptions{})
+	leech.Start()
+	WaitFor(t, downloadTimeout, "el primer tercio en el leecher", func() bool {
+		return leech.HasPieces(0, third-1)
+	})
+	s1.Kill()
+	time.Sleep(200 * time.Millisecond)
+	if leech.Done() {
+		t.Fatal("el leecher no puede haber terminado sin el resto de las piezas")
+	}
+
+	s2 := NewClient(t, c, ClientOptions{Seed: true})
+	s2.Start()
+	leech.WaitDone(downloadTimeout)
+	leech.Verify()
+}
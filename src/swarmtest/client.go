@@ -0,0 +1,236 @@
+package swarmtest
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"src/client"
+	"src/peerwire"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Hostname es el host con el que los clientes se anuncian (todo en loopback)
+const Hostname = "127.0.0.1"
+
+// ClientOptions configura un cliente de prueba
+type ClientOptions struct {
+	Seed             bool                 // arranca con el contenido completo
+	Have             func(piece int) bool // arranca con estas piezas (ignorado si Seed)
+	Announce         []string             // reemplaza los trackers del .torrent
+	AnnounceInterval time.Duration        // announces periódicos; 0 = 300ms
+	Overlay          *Overlay             // descubrir peers por el overlay en vez del tracker
+	WebSeeds         bool                 // usar los web seeds del torrent
+	Host             string               // IP de loopback donde escucha y con la que se anuncia; vacío = Hostname
+}
+
+// Client es un cliente del torrent escuchando peers en loopback, con su
+// propio directorio de archivos. Se arma igual que en client/cmd.
+type Client struct {
+	Cfg     *client.ClientConfig
+	Store   *peerwire.DiskPieceStore
+	Manager *peerwire.Manager
+	Addr    string // host:puerto donde acepta peers
+	Port    int
+	Dir     string // directorio de archivos (--archives)
+
+	tb          testing.TB
+	content     *Content
+	opts        ClientOptions
+	ln          net.Listener
+	seeded      bool // el contenido ya estaba completo al abrir el storage
+	completedCh chan struct{}
+	completedMu sync.Mutex
+	computeLeft client.ComputeLeftFunc
+	stopCh      chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewClient prepara un cliente: abre el storage (verificando lo que haya en
+// disco) y empieza a aceptar peers, pero no anuncia hasta Start.
+func NewClient(tb testing.TB, c *Content, opts ClientOptions) *Client {
+	tb.Helper()
+	if opts.AnnounceInterval <= 0 {
+		opts.AnnounceInterval = 300 * time.Millisecond
+	}
+	if opts.Host == "" {
+		opts.Host = Hostname
+	}
+
+	dir := tb.TempDir()
+	cfg, err := client.ParseTorrentFile(c.TorrentPath, dir)
+	if err != nil {
+		tb.Fatalf("leyendo torrent: %v", err)
+	}
+	if opts.Announce != nil {
+		cfg.AnnounceURLs = append([]string(nil), opts.Announce...)
+		cfg.CurrentTrackerIdx = 0
+	}
+
+	tempPath, finalPath := cfg.GetStoragePaths()
+	switch {
+	case opts.Seed:
+		c.writeTo(finalPath, nil)
+	case opts.Have != nil:
+		c.writeTo(tempPath, opts.Have)
+	}
+
+	store, mgr, useFinal, err := client.OpenStorage(cfg)
+	if err != nil {
+		tb.Fatalf("abriendo storage: %v", err)
+	}
+	mgr.SetMetadata(cfg.InfoBytes)
+	mgr.SetPipeline(peerwire.DefaultPipelineDepth, true, 2*time.Second)
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(opts.Host, "0"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	cl := &Client{
+		Cfg:         cfg,
+		Store:       store,
+		Manager:     mgr,
+		Addr:        ln.Addr().String(),
+		Port:        port,
+		Dir:         dir,
+		tb:          tb,
+		content:     c,
+		opts:        opts,
+		ln:          ln,
+		seeded:      useFinal,
+		completedCh: make(chan struct{}),
+		computeLeft: client.CreateComputeLeftFunc(store, cfg.FileLength),
+		stopCh:      make(chan struct{}),
+	}
+	client.SetupPieceCompletionHandler(store, cfg, useFinal, cl.completedCh, &cl.completedMu, false)
+	client.StartListeningForIncomingPeers(ln, cfg.InfoHash, cfg.PeerId, store, mgr)
+	tb.Cleanup(cl.Kill)
+	return cl
+}
+
+// Start anuncia el cliente (al tracker o al overlay), se conecta a los peers
+// que obtiene y arranca los announces periódicos. Devuelve el error del
+// announce inicial; los periódicos siguen intentando igual.
+func (cl *Client) Start() error {
+	cfg, host := cl.Cfg, cl.opts.Host
+	if cl.opts.WebSeeds {
+		client.StartWebSeeds(cfg, cl.Manager)
+	}
+
+	if ov := cl.opts.Overlay; ov != nil {
+		ov.Announce(cfg.InfoHashEncoded, client.LocalProvider(cl.Addr, cfg.PeerId, cl.computeLeft()))
+		peers := client.ParsePeersFromOthers(nil, ov.Overlay, cl.Addr, cfg)
+		client.ConnectToPeers(peers, cfg.InfoHash, cfg.PeerId, cl.Store, cl.Manager)
+		client.StartCompletionAnnounceRoutineOverlay(cl.completedCh, cfg, cl.Port, host, ov.Overlay, cl.Addr)
+		client.StartPeriodicAnnounceRoutineOverlay(cfg, cl.Port, host, cl.computeLeft, cl.stopCh,
+			cl.opts.AnnounceInterval, ov.Overlay, cl.Addr, cfg.InfoHash, cfg.PeerId, cl.Store, cl.Manager)
+		return nil
+	}
+
+	resp, err := client.SendAnnounceWithFailover(cfg, cl.Port, 0, 0, cl.computeLeft(), "started", host)
+	if err == nil {
+		client.ConnectToPeers(client.ParsePeersFromTracker(resp), cfg.InfoHash, cfg.PeerId, cl.Store, cl.Manager)
+	}
+	client.StartCompletionAnnounceRoutine(cl.completedCh, cfg, cl.Port, host)
+	client.StartPeriodicAnnounceRoutine(cfg, cl.Port, host, cl.computeLeft, cl.stopCh,
+		cl.opts.AnnounceInterval, cfg.InfoHash, cfg.PeerId, cl.Store, cl.Manager)
+	return err
+}
+
+// Connect conecta el cliente directamente a otros, sin tracker ni overlay
+func (cl *Client) Connect(others ...*Client) {
+	peers := make([]client.PeerInfo, len(others))
+	for i, o := range others {
+		peers[i] = client.PeerInfo{Addr: o.Addr}
+	}
+	client.ConnectToPeers(peers, cl.Cfg.InfoHash, cl.Cfg.PeerId, cl.Store, cl.Manager)
+}
+
+// HasPieces indica si el cliente tiene todas las piezas en [first, last]
+func (cl *Client) HasPieces(first, last int) bool {
+	for i := first; i <= last; i++ {
+		if !cl.Store.HasPiece(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// Done indica si la descarga terminó (y el contenido ya está en su ruta final)
+func (cl *Client) Done() bool {
+	select {
+	case <-cl.completedCh:
+		return true
+	default:
+	}
+	return cl.seeded && cl.Store.WantedLeft() == 0
+}
+
+// WaitDone espera a que termine la descarga; falla el test si no termina a tiempo
+func (cl *Client) WaitDone(timeout time.Duration) {
+	cl.tb.Helper()
+	WaitFor(cl.tb, timeout, "descarga de "+cl.Addr, cl.Done)
+}
+
+// Verify compara byte a byte lo descargado con el contenido original
+func (cl *Client) Verify() {
+	cl.tb.Helper()
+	_, finalPath := cl.Cfg.GetStoragePaths()
+	var off int64
+	for i, rel := range cl.content.relPaths() {
+		got, err := os.ReadFile(filepath.Join(finalPath, rel))
+		if err != nil {
+			cl.tb.Fatalf("%s: %v", cl.Addr, err)
+		}
+		n := cl.content.Length()
+		if len(cl.content.Files) > 0 {
+			n = cl.content.Files[i].Length
+		}
+		if !bytes.Equal(got, cl.content.data[off:off+n]) {
+			cl.tb.Fatalf("%s: el archivo %q no coincide con el original", cl.Addr, filepath.Join(cl.content.Name, rel))
+		}
+		off += n
+	}
+}
+
+// Stop cierra el cliente ordenadamente: avisa event=stopped al tracker
+func (cl *Client) Stop() {
+	cl.closeOnce.Do(func() {
+		cl.shutdown()
+		if cl.opts.Overlay == nil {
+			client.SendStoppedAnnounce(cl.Cfg, cl.Port, cl.computeLeft, cl.opts.Host)
+		}
+		_ = cl.Store.Close()
+	})
+}
+
+// Kill corta el cliente de golpe, como si el proceso muriera: sin stopped,
+// el tracker lo sigue listando hasta que expire
+func (cl *Client) Kill() {
+	cl.closeOnce.Do(func() {
+		cl.shutdown()
+		_ = cl.Store.Close()
+	})
+}
+
+func (cl *Client) shutdown() {
+	close(cl.stopCh)
+	cl.ln.Close()
+	cl.Manager.Close()
+}
+
+// WaitFor espera hasta que cond sea verdadera; si pasa timeout falla el test
+func WaitFor(tb testing.TB, timeout time.Duration, what string, cond func() bool) {
+	tb.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			tb.Fatalf("timeout (%v) esperando %s", timeout, what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
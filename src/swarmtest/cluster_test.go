@@ -0,0 +1,75 @@
+package swarmtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"src/tracker"
+	"testing"
+	"time"
+)
+
+// Un tracker se une al cluster a través de cualquier seed, todos aprenden la
+// lista completa y la sincronización llega a los miembros descubiertos. Un
+// leave saca al tracker enseguida y uno caído pasa por sospechoso a caído.
+func TestClusterMembership(t *testing.T) {
+	t1 := NewTracker(t, TrackerOptions{NodeID: "t1", Cluster: true})
+	t2 := NewTracker(t, TrackerOptions{NodeID: "t2", Cluster: true, SyncPeers: []string{t1.SyncAddr()}})
+	t3 := NewTracker(t, TrackerOptions{NodeID: "t3", Cluster: true, SyncPeers: []string{t2.SyncAddr()}})
+	trs := []*Tracker{t1, t2, t3}
+
+	WaitFor(t, 5*time.Second, "que todos vean a los otros dos", func() bool {
+		for _, tr := range trs {
+			if len(tr.LiveMembers()) != 2 {
+				return false
+			}
+		}
+		return true
+	})
+
+	// t3 nunca tuvo a t1 como seed, pero su announce le llega por sync
+	t3.AddPeer(syncIH, syncPeer, "10.0.0.3", 3000, "", false)
+	WaitFor(t, 5*time.Second, "el peer de t3 en t1", func() bool {
+		return len(t1.GetPeers(syncIH, "", 10)) == 1
+	})
+
+	// /cluster muestra el conjunto vivo
+	resp, err := http.Get("http://" + t1.SyncAddr() + "/cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var view struct {
+		Live    []string
+		Members []tracker.MemberStatus
+	}
+	json.NewDecoder(resp.Body).Decode(&view)
+	resp.Body.Close()
+	if len(view.Live) != 2 || len(view.Members) != 3 {
+		t.Fatalf("/cluster: %+v", view)
+	}
+
+	t2.Leave()
+	WaitFor(t, time.Second, "que t2 figure como left", func() bool {
+		return stateOf(t1, "t2") == tracker.MemberLeft && stateOf(t3, "t2") == tracker.MemberLeft
+	})
+	if slices.Contains(t1.LiveMembers(), t2.SyncAddr()) {
+		t.Fatal("t2 se fue pero sigue en el conjunto vivo de t1")
+	}
+
+	t3.Close() // caída sin aviso
+	WaitFor(t, 5*time.Second, "que t1 sospeche de t3", func() bool { return stateOf(t1, "t3") == tracker.MemberSuspect })
+	WaitFor(t, 5*time.Second, "que t1 declare caído a t3", func() bool { return stateOf(t1, "t3") == tracker.MemberDead })
+	if len(t1.LiveMembers()) != 0 {
+		t.Fatalf("conjunto vivo de t1: %v", t1.LiveMembers())
+	}
+}
+
+// stateOf devuelve el estado de un miembro visto por tr ("" si no lo conoce)
+func stateOf(tr *Tracker, nodeID string) tracker.MemberState {
+	for _, m := range tr.Cluster().Members() {
+		if m.NodeID == nodeID {
+			return m.State
+		}
+	}
+	return ""
+}
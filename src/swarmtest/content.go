@@ -0,0 +1,158 @@
+package swarmtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"src/client"
+	"src/peerwire"
+	"src/torrent"
+	"testing"
+)
+
+// ContentOptions describe el contenido a compartir
+type ContentOptions struct {
+	Name        string         // nombre del torrent; vacío = "content"
+	Size        int            // torrent de un solo archivo de Size bytes
+	Files       map[string]int // multi-file: ruta relativa ("a/b.bin") -> tamaño; tiene prioridad sobre Size
+	PieceLength int            // 0 = 32 KiB
+	Announce    []string       // URLs de announce de los trackers
+	WebSeeds    []string
+}
+
+// Content es un contenido aleatorio y su .torrent
+type Content struct {
+	Name        string
+	Dir         string // directorio con el original: Dir/Name
+	TorrentPath string
+	InfoHash    [20]byte
+	PieceLength int
+	NumPieces   int
+	Files       []peerwire.FileEntry // en el orden del torrent; vacío en single-file
+
+	tb   testing.TB
+	data []byte // contenido completo en el orden de las piezas
+}
+
+// NewContent genera archivos con datos aleatorios y crea su .torrent
+func NewContent(tb testing.TB, opts ContentOptions) *Content {
+	tb.Helper()
+	if opts.Name == "" {
+		opts.Name = "content"
+	}
+	if opts.PieceLength == 0 {
+		opts.PieceLength = 32 * 1024
+	}
+
+	dir := tb.TempDir()
+	root := filepath.Join(dir, opts.Name)
+	if len(opts.Files) > 0 {
+		for rel, size := range opts.Files {
+			writeRandom(tb, filepath.Join(root, filepath.FromSlash(rel)), size)
+		}
+	} else {
+		writeRandom(tb, root, opts.Size)
+	}
+
+	meta, infoHash, err := torrent.Create(torrent.CreateOptions{
+		Path:        root,
+		PieceLength: opts.PieceLength,
+		Announce:    opts.Announce,
+		WebSeeds:    opts.WebSeeds,
+	})
+	if err != nil {
+		tb.Fatalf("creando torrent: %v", err)
+	}
+	torrentPath := filepath.Join(dir, opts.Name+".torrent")
+	if err := os.WriteFile(torrentPath, meta, 0644); err != nil {
+		tb.Fatal(err)
+	}
+
+	// el orden de los archivos (y por lo tanto de los bytes) es el del torrent
+	cfg, err := client.ParseTorrentFile(torrentPath, dir)
+	if err != nil {
+		tb.Fatalf("leyendo torrent: %v", err)
+	}
+	c := &Content{
+		Name:        opts.Name,
+		Dir:         dir,
+		TorrentPath: torrentPath,
+		InfoHash:    infoHash,
+		PieceLength: opts.PieceLength,
+		NumPieces:   len(cfg.ExpectedHashes),
+		Files:       cfg.Files,
+		tb:          tb,
+	}
+	for _, rel := range c.relPaths() {
+		b, err := os.ReadFile(filepath.Join(root, rel))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		c.data = append(c.data, b...)
+	}
+	return c
+}
+
+func writeRandom(tb testing.TB, path string, size int) {
+	b := make([]byte, size)
+	_, _ = rand.Read(b)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		tb.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// InfoHashHex devuelve el info_hash en hex, como lo indexa el tracker
+func (c *Content) InfoHashHex() string { return hex.EncodeToString(c.InfoHash[:]) }
+
+// Length devuelve el tamaño total del contenido
+func (c *Content) Length() int64 { return int64(len(c.data)) }
+
+// relPaths devuelve la ruta de cada archivo relativa a la raíz del contenido
+// ("" para el archivo único de un single-file)
+func (c *Content) relPaths() []string {
+	if len(c.Files) == 0 {
+		return []string{""}
+	}
+	out := make([]string, len(c.Files))
+	for i, fe := range c.Files {
+		out[i] = fe.RelPath()
+	}
+	return out
+}
+
+// writeTo escribe el contenido bajo root (archivo o directorio del torrent).
+// Las piezas para las que have devuelve false se escriben con ceros, así el
+// cliente que lo abra las encuentra inválidas al verificar y las descarga.
+func (c *Content) writeTo(root string, have func(piece int) bool) {
+	data := c.data
+	if have != nil {
+		data = make([]byte, len(c.data))
+		for i := 0; i < c.NumPieces; i++ {
+			if have(i) {
+				start := i * c.PieceLength
+				end := min(start+c.PieceLength, len(c.data))
+				copy(data[start:end], c.data[start:end])
+			}
+		}
+	}
+
+	var off int64
+	for i, rel := range c.relPaths() {
+		n := int64(len(data))
+		if len(c.Files) > 0 {
+			n = c.Files[i].Length
+		}
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			c.tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, data[off:off+n], 0644); err != nil {
+			c.tb.Fatal(err)
+		}
+		off += n
+	}
+}
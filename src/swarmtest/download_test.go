@@ -0,0 +1,89 @@
+package swarmtest
+
+import (
+	"testing"
+	"time"
+)
+
+const downloadTimeout = 30 * time.Second
+
+// Un seed y tres leechers que se encuentran por el tracker
+func TestFullDownload(t *testing.T) {
+	tr := NewTracker(t, TrackerOptions{})
+	c := NewContent(t, ContentOptions{Size: 2<<20 + 1234, Announce: []string{tr.URL}})
+
+	seed := NewClient(t, c, ClientOptions{Seed: true})
+	if !seed.Done() {
+		t.Fatal("el seed no verificó su contenido")
+	}
+	if err := seed.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	var leechers []*Client
+	for i := 0; i < 3; i++ {
+		l := NewClient(t, c, ClientOptions{})
+		if err := l.Start(); err != nil {
+			t.Fatal(err)
+		}
+		leechers = append(leechers, l)
+	}
+	for _, l := range leechers {
+		l.WaitDone(downloadTimeout)
+		l.Verify()
+	}
+
+	// los leechers terminados pasan a seeders en el tracker
+	WaitFor(t, 5*time.Second, "event=completed en el tracker", func() bool {
+		complete, incomplete := tr.CountPeers(c.InfoHashHex())
+		return complete == 4 && incomplete == 0
+	})
+}
+
+// Torrent multi-file con piezas que cruzan archivos
+func TestFullDownloadMultiFile(t *testing.T) {
+	tr := NewTracker(t, TrackerOptions{})
+	c := NewContent(t, ContentOptions{
+		Name: "album",
+		Files: map[string]int{
+			"a.bin":       100*1024 + 7,
+			"sub/b.bin":   3 * 1024,
+			"sub/c.bin":   700 * 1024,
+			"z/empty.bin": 0,
+		},
+		PieceLength: 16 * 1024,
+		Announce:    []string{tr.URL},
+	})
+
+	seed := NewClient(t, c, ClientOptions{Seed: true})
+	leech := NewClient(t, c, ClientOptions{})
+	if err := seed.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := leech.Start(); err != nil {
+		t.Fatal(err)
+	}
+	leech.WaitDone(downloadTimeout)
+	leech.Verify()
+}
+
+// Descubrimiento por el overlay: el seed se anuncia en un nodo y el leecher
+// lo encuentra preguntando a otro que tiene al primero como bootstrap
+func TestOverlayDownload(t *testing.T) {
+	ov1 := NewOverlay(t)
+	ov2 := NewOverlay(t, ov1.Addr)
+	c := NewContent(t, ContentOptions{Size: 512 * 1024})
+
+	seed := NewClient(t, c, ClientOptions{Seed: true, Overlay: ov1})
+	seed.Start()
+	leech := NewClient(t, c, ClientOptions{Overlay: ov2})
+	leech.Start()
+
+	leech.WaitDone(downloadTimeout)
+	leech.Verify()
+
+	// el announce del leecher se empujó a ov1: el seed también lo ve
+	WaitFor(t, 5*time.Second, "el leecher como provider en ov1", func() bool {
+		return len(ov1.Lookup(seed.Cfg.InfoHashEncoded, 10)) == 2
+	})
+}
@@ -0,0 +1,40 @@
+package swarmtest
+
+import (
+	"testing"
+	"time"
+)
+
+// El tracker principal cae; el cliente pasa al siguiente del announce-list,
+// que conoce al seed por la sincronización entre trackers
+func TestTrackerFailover(t *testing.T) {
+	t2 := NewTracker(t, TrackerOptions{NodeID: "t2"})
+	t1 := NewTracker(t, TrackerOptions{NodeID: "t1", SyncPeers: []string{t2.SyncAddr()}})
+	c := NewContent(t, ContentOptions{Size: 1 << 20, Announce: []string{t1.URL, t2.URL}})
+
+	seed := NewClient(t, c, ClientOptions{Seed: true})
+	if err := seed.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if !t1.HasPeer(c.InfoHash, seed.Cfg.PeerId) {
+		t.Fatal("el seed no quedó registrado en t1")
+	}
+	WaitFor(t, 5*time.Second, "el seed en t2 por sincronización", func() bool {
+		return t2.HasPeer(c.InfoHash, seed.Cfg.PeerId)
+	})
+
+	t1.Close()
+
+	leech := NewClient(t, c, ClientOptions{})
+	if err := leech.Start(); err != nil {
+		t.Fatalf("announce con failover: %v", err)
+	}
+	if got := leech.Cfg.GetCurrentTrackerURL(); got != t2.URL {
+		t.Fatalf("tracker en uso %s, se esperaba %s", got, t2.URL)
+	}
+	leech.WaitDone(downloadTimeout)
+	leech.Verify()
+	if !t2.HasPeer(c.InfoHash, leech.Cfg.PeerId) {
+		t.Fatal("el leecher no quedó registrado en t2")
+	}
+}
@@ -0,0 +1,79 @@
+package swarmtest
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+const loopback6 = "::1"
+
+// requireIPv6 saltea el test si no hay loopback IPv6
+func requireIPv6(t *testing.T) {
+	t.Helper()
+	ln, err := net.Listen("tcp6", net.JoinHostPort(loopback6, "0"))
+	if err != nil {
+		t.Skipf("sin loopback IPv6: %v", err)
+	}
+	ln.Close()
+}
+
+// Tracker, seed y leecher sólo en [::1]: el leecher sólo puede encontrar al
+// seed por peers6 (HTTP) o por los peers de 18 bytes (UDP)
+func TestIPv6Download(t *testing.T) {
+	requireIPv6(t)
+	for _, proto := range []string{"http", "udp"} {
+		t.Run(proto, func(t *testing.T) {
+			tr := NewTracker(t, TrackerOptions{Host: loopback6, UDP: true})
+			announce := tr.URL
+			if proto == "udp" {
+				announce = "udp://" + tr.UDPAddr() + "/announce"
+			}
+			c := NewContent(t, ContentOptions{Size: 512*1024 + 99, Announce: []string{announce}})
+
+			seed := NewClient(t, c, ClientOptions{Seed: true, Host: loopback6})
+			leech := NewClient(t, c, ClientOptions{Host: loopback6})
+			if host, _, _ := net.SplitHostPort(leech.Addr); host != loopback6 {
+				t.Fatalf("el cliente escucha en %s", leech.Addr)
+			}
+			if err := seed.Start(); err != nil {
+				t.Fatal(err)
+			}
+			if err := leech.Start(); err != nil {
+				t.Fatal(err)
+			}
+			leech.WaitDone(downloadTimeout)
+			leech.Verify()
+
+			// los dos quedan registrados con su dirección IPv6
+			WaitFor(t, 5*time.Second, "el leecher como seeder en el tracker", func() bool {
+				complete, incomplete := tr.CountPeers(c.InfoHashHex())
+				return complete == 2 && incomplete == 0
+			})
+			for _, p := range tr.Peers(c.InfoHash) {
+				if p.IP != loopback6 {
+					t.Fatalf("peer %s registrado con IP %q", p.PeerIDHex, p.IP)
+				}
+			}
+		})
+	}
+}
+
+// Descubrimiento por el overlay con nodos y clientes en [::1]
+func TestIPv6OverlayDownload(t *testing.T) {
+	requireIPv6(t)
+	ov1 := NewOverlayAt(t, loopback6)
+	ov2 := NewOverlayAt(t, loopback6, ov1.Addr)
+	c := NewContent(t, ContentOptions{Size: 256 * 1024})
+
+	seed := NewClient(t, c, ClientOptions{Seed: true, Overlay: ov1, Host: loopback6})
+	seed.Start()
+	leech := NewClient(t, c, ClientOptions{Overlay: ov2, Host: loopback6})
+	leech.Start()
+
+	leech.WaitDone(downloadTimeout)
+	leech.Verify()
+	WaitFor(t, 5*time.Second, "el leecher como provider en ov1", func() bool {
+		return len(ov1.Lookup(seed.Cfg.InfoHashEncoded, 10)) == 2
+	})
+}
@@ -0,0 +1,50 @@
+package swarmtest
+
+import (
+	"net"
+	"src/overlay"
+	"sync"
+	"testing"
+)
+
+// Overlay es un nodo del overlay gossip escuchando en loopback (IPv4 o IPv6)
+type Overlay struct {
+	*overlay.Overlay
+	Addr string
+
+	ln        net.Listener
+	closeOnce sync.Once
+}
+
+// NewOverlay arranca un nodo del overlay con los bootstrap dados (Addr de
+// otros nodos). No corre el gossip periódico: los announces se empujan a los
+// bootstrap al momento y los lookups les preguntan directamente.
+func NewOverlay(tb testing.TB, bootstrap ...string) *Overlay {
+	tb.Helper()
+	return NewOverlayAt(tb, Hostname, bootstrap...)
+}
+
+// NewOverlayAt es NewOverlay escuchando en host (p. ej. "::1")
+func NewOverlayAt(tb testing.TB, host string, bootstrap ...string) *Overlay {
+	tb.Helper()
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ov := &Overlay{
+		Overlay: overlay.NewOverlay(ln.Addr().String(), bootstrap),
+		Addr:    ln.Addr().String(),
+		ln:      ln,
+	}
+	go ov.ServeListener(ln)
+	tb.Cleanup(ov.Close)
+	return ov
+}
+
+// Close detiene el nodo y deja de escuchar
+func (ov *Overlay) Close() {
+	ov.closeOnce.Do(func() {
+		ov.Stop()
+		ov.ln.Close()
+	})
+}
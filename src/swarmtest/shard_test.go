@@ -0,0 +1,219 @@
+package swarmtest
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"src/tracker"
+	"strings"
+	"testing"
+	"time"
+)
+
+// shardCluster levanta n trackers sharded en un mismo cluster y espera a que
+// todos vean a los demás
+func shardCluster(t *testing.T, n int, opts tracker.ShardOptions) []*Tracker {
+	var trs []*Tracker
+	for i := 0; i < n; i++ {
+		o := TrackerOptions{NodeID: fmt.Sprintf("s%d", i+1), Cluster: true, Shard: &opts, UDP: true}
+		if i > 0 {
+			o.SyncPeers = []string{trs[0].SyncAddr()}
+		}
+		trs = append(trs, NewTracker(t, o))
+	}
+	WaitFor(t, 5*time.Second, "que todos vean a los demás", func() bool {
+		for _, tr := range trs {
+			if len(tr.LiveMembers()) != n-1 {
+				return false
+			}
+		}
+		return true
+	})
+	return trs
+}
+
+// swarmOwnedBy busca un info_hash cuyos dueños son exactamente owners
+func swarmOwnedBy(t *testing.T, tr *Tracker, owners ...string) string {
+	slices.Sort(owners)
+	for i := 0; i < 1000; i++ {
+		ih := fmt.Sprintf("%040x", i+1)
+		var got []string
+		for _, m := range tr.ShardOwners(ih) {
+			got = append(got, m.NodeID)
+		}
+		slices.Sort(got)
+		if slices.Equal(got, owners) {
+			return ih
+		}
+	}
+	t.Fatalf("ningún info_hash con dueños %v", owners)
+	return ""
+}
+
+// announce hace un announce HTTP al tracker y devuelve la respuesta
+func announce(t *testing.T, client *http.Client, tr *Tracker, infoHash, peerID string) *http.Response {
+	t.Helper()
+	ih, _ := hex.DecodeString(infoHash)
+	q := "info_hash=" + url.QueryEscape(string(ih)) + "&peer_id=" + url.QueryEscape(peerID) + "&port=6881&left=0&event=started"
+	resp, err := client.Get(tr.URL + "?" + q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+// Con tres trackers y dos réplicas: un announce a un tracker que no es
+// dueño se reenvía, el swarm queda sólo en sus dueños y, cuando un dueño se
+// va, el nuevo dueño recibe el swarm
+func TestShardedAnnounceAndSync(t *testing.T) {
+	trs := shardCluster(t, 3, tracker.ShardOptions{Replicas: 2, VirtualNodes: 32})
+	s1, s2, s3 := trs[0], trs[1], trs[2]
+
+	ih := swarmOwnedBy(t, s1, "s1", "s2")
+	peerID := "-JC0001-shardpeer001"
+	if resp := announce(t, http.DefaultClient, s3, ih, peerID); resp.StatusCode != http.StatusOK {
+		t.Fatalf("announce a s3: status %d", resp.StatusCode)
+	}
+	var infoHash [20]byte
+	hex.Decode(infoHash[:], []byte(ih))
+	WaitFor(t, 5*time.Second, "el peer en los dos dueños", func() bool {
+		return s1.HasPeer(infoHash, peerID) && s2.HasPeer(infoHash, peerID)
+	})
+	if len(s3.Snapshot()[ih]) != 0 {
+		t.Fatal("s3 guardó un swarm del que no es dueño")
+	}
+
+	// un cambio en un tracker que no es dueño (p. ej. un announce UDP) se
+	// empuja sólo a los dueños
+	other := swarmOwnedBy(t, s1, "s2", "s3")
+	s1.AddPeer(other, syncPeer, "10.0.0.1", 1000, "", false)
+	WaitFor(t, 5*time.Second, "el peer en s2 y s3", func() bool {
+		return len(s2.GetPeers(other, "", 10)) == 1 && len(s3.GetPeers(other, "", 10)) == 1
+	})
+	time.Sleep(300 * time.Millisecond)
+	if len(s1.Snapshot()[ih]) != 1 || len(s3.Snapshot()[ih]) != 0 {
+		t.Fatal("la sincronización llevó un swarm a quien no es dueño")
+	}
+
+	// s2 se va: con dos miembros los dos son dueños de todo y s3 recibe el swarm
+	s2.Leave()
+	WaitFor(t, 5*time.Second, "el swarm en s3 después del cambio de anillo", func() bool {
+		return s3.HasPeer(infoHash, peerID)
+	})
+}
+
+// En modo redirect un tracker que no es dueño responde 307 hacia un dueño,
+// y el scrape de un solo torrent también se atiende en un dueño
+func TestShardedRedirect(t *testing.T) {
+	trs := shardCluster(t, 3, tracker.ShardOptions{Replicas: 1, Redirect: true})
+	owner := trs[0]
+	ih := swarmOwnedBy(t, owner, "s1")
+
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp := announce(t, noFollow, trs[2], ih, "-JC0001-shardpeer002")
+	if resp.StatusCode != http.StatusTemporaryRedirect || !strings.HasPrefix(resp.Header.Get("Location"), owner.URL+"?") {
+		t.Fatalf("status %d, Location %q; se esperaba 307 a %s", resp.StatusCode, resp.Header.Get("Location"), owner.URL)
+	}
+
+	// siguiendo el redirect el announce llega al dueño
+	announce(t, http.DefaultClient, trs[2], ih, "-JC0001-shardpeer002")
+	if len(owner.GetPeers(ih, "", 10)) != 1 || len(trs[2].Snapshot()[ih]) != 0 {
+		t.Fatal("el announce redirigido no quedó sólo en el dueño")
+	}
+
+	raw, _ := hex.DecodeString(ih)
+	scrape := strings.TrimSuffix(trs[1].URL, "/announce") + "/scrape?info_hash=" + url.QueryEscape(string(raw))
+	sr, err := noFollow.Get(scrape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr.Body.Close()
+	if sr.StatusCode != http.StatusTemporaryRedirect || !strings.Contains(sr.Header.Get("Location"), "/scrape?") {
+		t.Fatalf("scrape: status %d, Location %q", sr.StatusCode, sr.Header.Get("Location"))
+	}
+}
+
+// udpRequest hace connect y después el pedido action (BEP 15) al listener UDP
+// del tracker y devuelve la respuesta
+func udpRequest(t *testing.T, tr *Tracker, action uint32, body []byte) []byte {
+	t.Helper()
+	conn, err := net.Dial("udp", tr.UDPAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	req := binary.BigEndian.AppendUint64(nil, 0x41727101980)
+	req = binary.BigEndian.AppendUint32(req, 0) // connect
+	req = binary.BigEndian.AppendUint32(req, 1)
+	resp := make([]byte, 2048)
+	if _, err := conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	n, err := conn.Read(resp)
+	if err != nil || n < 16 {
+		t.Fatalf("connect: %d bytes, %v", n, err)
+	}
+
+	req = append(resp[8:16:16], 0, 0, 0, 0, 0, 0, 0, 2)
+	binary.BigEndian.PutUint32(req[8:12], action)
+	if _, err := conn.Write(append(req, body...)); err != nil {
+		t.Fatal(err)
+	}
+	n, err = conn.Read(resp)
+	if err != nil || n < 8 {
+		t.Fatalf("action %d: %d bytes, %v", action, n, err)
+	}
+	if got := binary.BigEndian.Uint32(resp[0:4]); got != action {
+		t.Fatalf("action %d respondida con %d: %q", action, got, resp[8:n])
+	}
+	return resp[:n]
+}
+
+// Un announce UDP a un tracker que no es dueño se reenvía a un dueño (UDP no
+// tiene redirect), y el scrape UDP devuelve los contadores del dueño
+func TestShardedUDPAnnounce(t *testing.T) {
+	trs := shardCluster(t, 3, tracker.ShardOptions{Replicas: 2, VirtualNodes: 32, Redirect: true})
+	s1, s2, s3 := trs[0], trs[1], trs[2]
+	ih := swarmOwnedBy(t, s1, "s1", "s2")
+	raw, _ := hex.DecodeString(ih)
+	var infoHash [20]byte
+	copy(infoHash[:], raw)
+	announce(t, http.DefaultClient, s1, ih, "-JC0001-shardpeer003")
+	WaitFor(t, 5*time.Second, "el primer peer en los dos dueños", func() bool {
+		return s1.HasPeer(infoHash, "-JC0001-shardpeer003") && s2.HasPeer(infoHash, "-JC0001-shardpeer003")
+	})
+
+	peerID := "-JC0001-shardudp0001"
+	body := append(append([]byte{}, raw...), peerID...)
+	body = binary.BigEndian.AppendUint64(body, 0)          // downloaded
+	body = binary.BigEndian.AppendUint64(body, 0)          // left
+	body = binary.BigEndian.AppendUint64(body, 0)          // uploaded
+	body = binary.BigEndian.AppendUint32(body, 2)          // event=started
+	body = binary.BigEndian.AppendUint32(body, 0)          // ip
+	body = binary.BigEndian.AppendUint32(body, 0)          // key
+	body = binary.BigEndian.AppendUint32(body, ^uint32(0)) // num_want=-1
+	body = binary.BigEndian.AppendUint16(body, 7000)
+	resp := udpRequest(t, s3, 1, body)
+	if seeders := binary.BigEndian.Uint32(resp[16:20]); seeders != 2 || len(resp) != 20+6 {
+		t.Fatalf("announce UDP: %d seeders y %d bytes de peers; se esperaban 2 y 6", seeders, len(resp)-20)
+	}
+
+	WaitFor(t, 5*time.Second, "el peer UDP en los dos dueños", func() bool {
+		return s1.HasPeer(infoHash, peerID) && s2.HasPeer(infoHash, peerID)
+	})
+	if len(s3.Snapshot()[ih]) != 0 {
+		t.Fatal("s3 guardó un swarm del que no es dueño")
+	}
+
+	resp = udpRequest(t, s3, 2, raw)
+	if len(resp) != 8+12 || binary.BigEndian.Uint32(resp[8:12]) != 2 {
+		t.Fatalf("scrape UDP en s3: %x", resp)
+	}
+}
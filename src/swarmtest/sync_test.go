@@ -0,0 +1,379 @@
+package swarmtest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"src/tracker"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	syncIH   = "0123456789abcdef0123456789abcdef01234567"
+	syncPeer = "2d4a43303030312d616263646566303132333435"
+)
+
+// peerState devuelve el peer (tombstones incluidos) o nil si no existe
+func peerState(tr *Tracker, infoHash, peerID string) *tracker.Peer {
+	return tr.Snapshot()[infoHash][peerID]
+}
+
+// exchange sincroniza dos trackers en ambos sentidos
+func exchange(a, b *Tracker) {
+	b.MergeSwarms(a.NewSyncMessage())
+	a.MergeSwarms(b.NewSyncMessage())
+}
+
+// El mismo peer actualizado en dos trackers: gana la escritura más reciente
+// (HLC) y ambos convergen al mismo estado
+func TestSyncLastWriterWins(t *testing.T) {
+	t1 := NewTracker(t, TrackerOptions{NodeID: "t1"})
+	t2 := NewTracker(t, TrackerOptions{NodeID: "t2"})
+
+	t1.AddPeer(syncIH, syncPeer, "10.0.0.1", 1000, "", false)
+	time.Sleep(5 * time.Millisecond)
+	t2.AddPeer(syncIH, syncPeer, "10.0.0.2", 2000, "", true)
+
+	exchange(t1, t2)
+	for _, tr := range []*Tracker{t1, t2} {
+		p := peerState(tr, syncIH, syncPeer)
+		if p == nil || p.Port != 2000 || p.IP != "10.0.0.2" || !p.Completed {
+			t.Fatalf("%s: %+v, se esperaba la versión de t2", tr.NodeID, p)
+		}
+	}
+
+	// una actualización posterior en t1 vuelve a ganar
+	time.Sleep(5 * time.Millisecond)
+	t1.AddPeer(syncIH, syncPeer, "10.0.0.1", 1001, "", true)
+	exchange(t1, t2)
+	if p := peerState(t2, syncIH, syncPeer); p.Port != 1001 {
+		t.Fatalf("t2 tiene puerto %d, se esperaba 1001", p.Port)
+	}
+}
+
+// Un borrado (tombstone) más nuevo le gana a un alta vieja, y un alta
+// posterior al borrado resucita al peer en todos los trackers
+func TestSyncTombstoneAndResurrection(t *testing.T) {
+	t1 := NewTracker(t, TrackerOptions{NodeID: "t1"})
+	t2 := NewTracker(t, TrackerOptions{NodeID: "t2"})
+
+	t1.AddPeer(syncIH, syncPeer, "10.0.0.1", 1000, "", false)
+	stale := t1.NewSyncMessage()
+	t2.MergeSwarms(stale)
+	if len(t2.GetPeers(syncIH, "", 10)) != 1 {
+		t.Fatal("t2 no recibió el peer")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	t2.RemovePeer(syncIH, syncPeer)
+	t1.MergeSwarms(t2.NewSyncMessage())
+	if p := peerState(t1, syncIH, syncPeer); p == nil || !p.Deleted {
+		t.Fatalf("t1: %+v, se esperaba el tombstone", p)
+	}
+	if n := len(t1.GetPeers(syncIH, "", 10)); n != 0 {
+		t.Fatalf("t1 devuelve %d peers borrados", n)
+	}
+
+	// un mensaje viejo que llega tarde no deshace el borrado
+	t2.MergeSwarms(stale)
+	if p := peerState(t2, syncIH, syncPeer); !p.Deleted {
+		t.Fatal("un mensaje viejo resucitó al peer")
+	}
+
+	// el peer vuelve a anunciarse en t1: la resurrección se propaga
+	time.Sleep(5 * time.Millisecond)
+	t1.AddPeer(syncIH, syncPeer, "10.0.0.1", 1002, "", false)
+	exchange(t1, t2)
+	for _, tr := range []*Tracker{t1, t2} {
+		p := peerState(tr, syncIH, syncPeer)
+		if p == nil || p.Deleted || p.Port != 1002 {
+			t.Fatalf("%s: %+v, se esperaba el peer resucitado", tr.NodeID, p)
+		}
+	}
+}
+
+// Altas y bajas concurrentes en tres trackers convergen al mismo estado sin
+// importar el orden en que se intercambian
+func TestSyncConvergence(t *testing.T) {
+	trs := []*Tracker{
+		NewTracker(t, TrackerOptions{NodeID: "a"}),
+		NewTracker(t, TrackerOptions{NodeID: "b"}),
+		NewTracker(t, TrackerOptions{NodeID: "c"}),
+	}
+	peers := []string{
+		"2d4a43303030312d000000000000000000000001",
+		"2d4a43303030312d000000000000000000000002",
+		"2d4a43303030312d000000000000000000000003",
+	}
+	for i, tr := range trs {
+		for j, p := range peers {
+			tr.AddPeer(syncIH, p, "10.0.0.1", uint16(1000*(i+1)+j), "", false)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	trs[1].RemovePeer(syncIH, peers[0])
+	trs[2].AddPeer(syncIH, peers[1], "10.0.0.9", 9999, "", true)
+
+	exchange(trs[2], trs[0])
+	exchange(trs[0], trs[1])
+	exchange(trs[1], trs[2])
+	exchange(trs[2], trs[0])
+
+	want, _ := json.Marshal(trs[0].Snapshot())
+	for _, tr := range trs[1:] {
+		if got, _ := json.Marshal(tr.Snapshot()); !bytes.Equal(got, want) {
+			t.Fatalf("%s no convergió:\n%s\n%s", tr.NodeID, got, want)
+		}
+	}
+	if p := peerState(trs[0], syncIH, peers[0]); !p.Deleted {
+		t.Fatal("el borrado en b no ganó")
+	}
+	if p := peerState(trs[0], syncIH, peers[1]); p.Port != 9999 {
+		t.Fatalf("puerto %d, se esperaba la actualización de c", p.Port)
+	}
+}
+
+// Sincronización real por HTTP: t1 empuja su estado firmado a t2, y t2
+// rechaza mensajes sin firma o con una firma inválida
+func TestSyncOverHTTP(t *testing.T) {
+	t2 := NewTracker(t, TrackerOptions{NodeID: "t2"})
+	t1 := NewTracker(t, TrackerOptions{NodeID: "t1", SyncPeers: []string{t2.SyncAddr()}})
+
+	t1.AddPeer(syncIH, syncPeer, "10.0.0.1", 1000, "", false)
+	WaitFor(t, 5*time.Second, "el peer en t2", func() bool {
+		return len(t2.GetPeers(syncIH, "", 10)) == 1
+	})
+
+	forged := t1.NewSyncMessage()
+	forged.Swarms[syncIH][syncPeer].Port = 6666
+	for _, sig := range []string{"", "00" + tracker.SignMessage([]byte("otro mensaje"))[2:]} {
+		forged.Signature = sig
+		body, _ := json.Marshal(forged)
+		resp, err := http.Post("http://"+t2.SyncAddr()+"/sync", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("firma %q: status %d, se esperaba 401", sig, resp.StatusCode)
+		}
+	}
+	if p := peerState(t2, syncIH, syncPeer); p.Port != 1000 {
+		t.Fatalf("un mensaje rechazado cambió el estado de t2 (puerto %d)", p.Port)
+	}
+}
+
+// syncProxy reenvía los mensajes de sincronización a un tracker y registra
+// si cada uno era un snapshot o un delta
+type syncProxy struct {
+	mu     sync.Mutex
+	target string
+	msgs   []tracker.SyncMessage
+	status []int
+}
+
+func (p *syncProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var msg tracker.SyncMessage
+	json.Unmarshal(body, &msg)
+	p.mu.Lock()
+	target := p.target
+	p.mu.Unlock()
+
+	resp, err := http.Post("http://"+target+"/sync", "application/json", bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	resp.Body.Close()
+	p.mu.Lock()
+	p.msgs = append(p.msgs, msg)
+	p.status = append(p.status, resp.StatusCode)
+	p.mu.Unlock()
+	w.WriteHeader(resp.StatusCode)
+}
+
+// last devuelve el último mensaje aceptado por el tracker destino
+func (p *syncProxy) last() (tracker.SyncMessage, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := len(p.msgs) - 1; i >= 0; i-- {
+		if p.status[i] == http.StatusOK {
+			return p.msgs[i], true
+		}
+	}
+	return tracker.SyncMessage{}, false
+}
+
+// Después del primer snapshot sólo viajan los peers cambiados; un tracker
+// que no tiene el estado anterior (reinicio) rechaza el delta y recibe un
+// snapshot completo
+func TestSyncDeltas(t *testing.T) {
+	t2 := NewTracker(t, TrackerOptions{NodeID: "t2"})
+	proxy := &syncProxy{target: t2.SyncAddr()}
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+	t1 := NewTracker(t, TrackerOptions{NodeID: "t1", SyncPeers: []string{srv.Listener.Addr().String()}})
+
+	peerB := "2d4a43303030312d000000000000000000000002"
+	t1.AddPeer(syncIH, syncPeer, "10.0.0.1", 1000, "", false)
+	WaitFor(t, 5*time.Second, "el peer en t2", func() bool { return len(t2.GetPeers(syncIH, "", 10)) == 1 })
+	WaitFor(t, time.Second, "el primer mensaje en el proxy", func() bool { _, ok := proxy.last(); return ok })
+	if msg, _ := proxy.last(); msg.Since != nil {
+		t.Fatal("el primer mensaje debería ser un snapshot")
+	}
+
+	t1.AddPeer(syncIH, peerB, "10.0.0.2", 2000, "", false)
+	WaitFor(t, 5*time.Second, "el segundo peer en t2", func() bool { return len(t2.GetPeers(syncIH, "", 10)) == 2 })
+	// el proxy registra el mensaje después de que t2 lo aplicó
+	var msg tracker.SyncMessage
+	WaitFor(t, time.Second, "el mensaje con el segundo peer en el proxy", func() bool {
+		msg, _ = proxy.last()
+		return msg.Swarms[syncIH][peerB] != nil
+	})
+	if msg.Since == nil || len(msg.Swarms[syncIH]) != 1 || msg.Swarms[syncIH][peerB] == nil {
+		t.Fatalf("se esperaba un delta sólo con el peer nuevo: since=%v swarms=%v", msg.Since, msg.Swarms)
+	}
+
+	// t3 no recibió nada de t1: el próximo delta se rechaza y llega un snapshot
+	t3 := NewTracker(t, TrackerOptions{NodeID: "t3"})
+	proxy.mu.Lock()
+	proxy.target = t3.SyncAddr()
+	proxy.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	t1.RemovePeer(syncIH, syncPeer)
+	WaitFor(t, 5*time.Second, "el estado completo en t3", func() bool {
+		p := peerState(t3, syncIH, syncPeer)
+		return p != nil && p.Deleted && len(t3.GetPeers(syncIH, "", 10)) == 1
+	})
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	conflict := false
+	for _, s := range proxy.status {
+		conflict = conflict || s == http.StatusConflict
+	}
+	if !conflict {
+		t.Fatal("t3 no pidió el snapshot con 409")
+	}
+}
+
+// Dos trackers que divergieron durante una partición (sin push entre ellos)
+// se reparan con anti-entropía: sólo viajan las hojas del árbol de Merkle que
+// difieren y después ambos tienen el mismo estado
+func TestSyncAntiEntropyAfterPartition(t *testing.T) {
+	t1 := NewTracker(t, TrackerOptions{NodeID: "t1"})
+	t2 := NewTracker(t, TrackerOptions{NodeID: "t2"})
+
+	shared := "2d4a43303030312d000000000000000000000010"
+	t1.AddPeer(syncIH, shared, "10.0.0.1", 1000, "", false)
+	exchange(t1, t2)
+
+	// partición: cada lado recibe announces distintos
+	for i := 0; i < 20; i++ {
+		t1.AddPeer(syncIH, fmt.Sprintf("2d4a43303030312d0000000000000000000001%02x", i), "10.0.1.1", uint16(3000+i), "", false)
+		t2.AddPeer(syncIH, fmt.Sprintf("2d4a43303030312d0000000000000000000002%02x", i), "10.0.2.1", uint16(4000+i), "", true)
+	}
+	time.Sleep(5 * time.Millisecond)
+	t2.RemovePeer(syncIH, shared)
+
+	n, err := t1.AntiEntropy(t2.SyncAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 21 {
+		t.Fatalf("t1 reparó %d entradas, se esperaban 21", n)
+	}
+	if n, err := t2.AntiEntropy(t1.SyncAddr()); err != nil || n != 20 {
+		t.Fatalf("t2 reparó %d entradas (err=%v), se esperaban 20", n, err)
+	}
+
+	want, _ := json.Marshal(t1.Snapshot())
+	if got, _ := json.Marshal(t2.Snapshot()); !bytes.Equal(got, want) {
+		t.Fatalf("no convergieron:\n%s\n%s", got, want)
+	}
+	if p := peerState(t1, syncIH, shared); !p.Deleted {
+		t.Fatal("el borrado en t2 no se reparó en t1")
+	}
+	if n, err := t1.AntiEntropy(t2.SyncAddr()); err != nil || n != 0 {
+		t.Fatalf("ronda con el estado igual: %d reparadas, err=%v", n, err)
+	}
+}
+
+// postSync envía msg al /sync de tr y devuelve el status
+func postSync(t *testing.T, tr *Tracker, msg *tracker.SyncMessage) int {
+	t.Helper()
+	body, _ := json.Marshal(msg)
+	resp, err := http.Post("http://"+tr.SyncAddr()+"/sync", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// Con claves Ed25519 por tracker: la sincronización entre nodos de confianza
+// funciona, un mensaje capturado no se puede repetir, un nodo sin clave de
+// confianza se rechaza y la clave de t1 se rota sin cortar la sincronización
+func TestSyncEd25519Keys(t *testing.T) {
+	pub1, priv1, _ := ed25519.GenerateKey(rand.Reader)
+	pub2, priv2, _ := ed25519.GenerateKey(rand.Reader)
+	_, priv3, _ := ed25519.GenerateKey(rand.Reader)
+
+	t2 := NewTracker(t, TrackerOptions{NodeID: "t2", Key: priv2, Trust: map[string]ed25519.PublicKey{"t1": pub1}})
+	proxy := &syncProxy{target: t2.SyncAddr()}
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+	t1 := NewTracker(t, TrackerOptions{
+		NodeID:    "t1",
+		SyncPeers: []string{srv.Listener.Addr().String()},
+		Key:       priv1,
+		Trust:     map[string]ed25519.PublicKey{"t2": pub2},
+	})
+
+	t1.AddPeer(syncIH, syncPeer, "10.0.0.1", 1000, "", false)
+	WaitFor(t, 5*time.Second, "el peer en t2", func() bool { return len(t2.GetPeers(syncIH, "", 10)) == 1 })
+
+	// repetir un mensaje ya aceptado
+	var captured tracker.SyncMessage
+	WaitFor(t, time.Second, "el mensaje aceptado en el proxy", func() bool {
+		var ok bool
+		captured, ok = proxy.last()
+		return ok
+	})
+	if status := postSync(t, t2, &captured); status != http.StatusUnauthorized {
+		t.Fatalf("mensaje repetido: status %d, se esperaba 401", status)
+	}
+
+	// t3 firma bien pero t2 no confía en su clave; tampoco vale el HMAC
+	t3 := NewTracker(t, TrackerOptions{NodeID: "t3", Key: priv3})
+	untrusted := t3.NewSyncMessage()
+	untrusted.Nonce = "n1"
+	untrusted.Signature = "ed25519:" + base64.StdEncoding.EncodeToString(ed25519.Sign(priv3, []byte("x")))
+	if status := postSync(t, t2, untrusted); status != http.StatusUnauthorized {
+		t.Fatalf("nodo sin confianza: status %d, se esperaba 401", status)
+	}
+	untrusted.Signature = tracker.SignMessage([]byte("x"))
+	if status := postSync(t, t2, untrusted); status != http.StatusUnauthorized {
+		t.Fatalf("HMAC con claves configuradas: status %d, se esperaba 401", status)
+	}
+
+	// rotación: t2 confía en la clave nueva, t1 firma con ella y después se
+	// retira la vieja
+	pubNew, privNew, _ := ed25519.GenerateKey(rand.Reader)
+	t2.TrustKey("t1", pubNew)
+	t1.SetSigningKey(privNew)
+	t2.UntrustKey("t1", pub1)
+	peerB := "2d4a43303030312d000000000000000000000002"
+	t1.AddPeer(syncIH, peerB, "10.0.0.2", 2000, "", false)
+	WaitFor(t, 5*time.Second, "el peer firmado con la clave nueva en t2", func() bool {
+		return len(t2.GetPeers(syncIH, "", 10)) == 2
+	})
+}
@@ -0,0 +1,186 @@
+// Package swarmtest levanta en un mismo proceso todo lo necesario para probar
+// el sistema de punta a punta: trackers (con sincronización entre ellos),
+// nodos del overlay y N clientes sobre loopback, cada uno con su directorio
+// temporal. Todo se cierra solo con tb.Cleanup al terminar el test.
+//
+// Uso típico:
+//
+//	tr := swarmtest.NewTracker(t, swarmtest.TrackerOptions{})
+//	c := swarmtest.NewContent(t, swarmtest.ContentOptions{Size: 1 << 20, Announce: []string{tr.URL}})
+//	seed := swarmtest.NewClient(t, c, swarmtest.ClientOptions{Seed: true})
+//	leech := swarmtest.NewClient(t, c, swarmtest.ClientOptions{})
+//	seed.Start()
+//	leech.Start()
+//	leech.WaitDone(30 * time.Second)
+//	leech.Verify()
+package swarmtest
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"src/tracker"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var trackerSeq atomic.Int32
+
+// TrackerOptions configura un tracker de prueba
+type TrackerOptions struct {
+	NodeID       string        // vacío = "tracker-N"
+	Interval     time.Duration // "interval" de los announces; 0 = 1s
+	SyncPeers    []string      // SyncAddr de otros trackers a los que empujar el estado (seeds con Cluster)
+	SyncInterval time.Duration // 0 = 100ms
+
+	Cluster         bool          // membresía dinámica: SyncPeers son seeds y se empuja a los miembros vivos
+	ClusterInterval time.Duration // gossip de membresía; 0 = 50ms
+
+	Key   ed25519.PrivateKey           // clave de firma de la sincronización; nil = HMAC legacy
+	Trust map[string]ed25519.PublicKey // node_id -> clave pública aceptada
+
+	Shard *tracker.ShardOptions // modo sharded (requiere Cluster); nil = todos guardan todo
+
+	UDP bool // atender también announces UDP (BEP 15) en UDPAddr
+
+	Host string // IP de loopback donde escucha (HTTP, sincronización y UDP); vacío = Hostname
+}
+
+// Tracker es un tracker.Tracker servido por HTTP en loopback. Siempre escucha
+// sincronización (en SyncAddr) y, si tiene SyncPeers, empuja su estado a ellos.
+type Tracker struct {
+	*tracker.Tracker
+	URL    string // URL de announce: http://<host>:<puerto>/announce
+	NodeID string
+
+	tb        testing.TB
+	srv       *httptest.Server
+	closeOnce sync.Once
+}
+
+// NewTracker arranca un tracker con persistencia en un directorio temporal
+func NewTracker(tb testing.TB, opts TrackerOptions) *Tracker {
+	tb.Helper()
+	if opts.NodeID == "" {
+		opts.NodeID = fmt.Sprintf("tracker-%d", trackerSeq.Add(1))
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = 100 * time.Millisecond
+	}
+	if opts.Host == "" {
+		opts.Host = Hostname
+	}
+
+	dataPath := filepath.Join(tb.TempDir(), opts.NodeID+"_data.json")
+	t := tracker.New(opts.Interval, 2*opts.Interval, 50, dataPath, opts.NodeID, opts.SyncPeers)
+	if opts.Key != nil {
+		t.SetSigningKey(opts.Key)
+	}
+	for nodeID, pub := range opts.Trust {
+		t.TrustKey(nodeID, pub)
+	}
+	if err := t.StartSyncListener(net.JoinHostPort(opts.Host, "0")); err != nil {
+		tb.Fatalf("tracker %s: %v", opts.NodeID, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/announce", t.AnnounceHandler)
+	mux.HandleFunc("/scrape", t.ScrapeHandler)
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(opts.Host, "0"))
+	if err != nil {
+		tb.Fatalf("tracker %s: %v", opts.NodeID, err)
+	}
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+
+	tr := &Tracker{
+		Tracker: t,
+		NodeID:  opts.NodeID,
+		tb:      tb,
+		srv:     srv,
+	}
+	tr.URL = tr.srv.URL + "/announce"
+	tb.Cleanup(tr.Close)
+
+	if opts.Cluster {
+		if opts.ClusterInterval <= 0 {
+			opts.ClusterInterval = 50 * time.Millisecond
+		}
+		err := t.StartCluster(tracker.ClusterOptions{Seeds: opts.SyncPeers, Announce: tr.srv.URL, Interval: opts.ClusterInterval})
+		if err != nil {
+			tb.Fatalf("tracker %s: %v", opts.NodeID, err)
+		}
+	}
+	if opts.Shard != nil {
+		if err := t.EnableSharding(*opts.Shard); err != nil {
+			tb.Fatalf("tracker %s: %v", opts.NodeID, err)
+		}
+	}
+	if len(opts.SyncPeers) > 0 || opts.Cluster {
+		t.StartSyncManager(opts.SyncInterval)
+	}
+	// como en tracker/cmd: el listener UDP arranca con el sharding ya configurado
+	if opts.UDP {
+		if err := t.StartUDPListener(net.JoinHostPort(opts.Host, "0")); err != nil {
+			tb.Fatalf("tracker %s: %v", opts.NodeID, err)
+		}
+	}
+	return tr
+}
+
+// Close apaga el tracker (HTTP, UDP y sincronización), como si el proceso
+// muriera. Se puede llamar más de una vez.
+func (tr *Tracker) Close() {
+	tr.closeOnce.Do(func() {
+		tr.srv.CloseClientConnections()
+		tr.srv.Close()
+		tr.StopUDPListener()
+		tr.StopSync()
+	})
+}
+
+// Leave cierra el tracker avisando antes al cluster que se va
+func (tr *Tracker) Leave() {
+	tr.LeaveCluster()
+	tr.Close()
+}
+
+// LiveMembers devuelve las direcciones de sincronización de los miembros
+// vivos que ve el tracker (sin incluirlo)
+func (tr *Tracker) LiveMembers() []string {
+	return tr.Cluster().LiveAddrs()
+}
+
+// Peers devuelve los peers activos (sin tombstones) del torrent
+func (tr *Tracker) Peers(infoHash [20]byte) []*tracker.Peer {
+	return tr.GetPeers(hex.EncodeToString(infoHash[:]), "", 1000)
+}
+
+// HasPeer indica si el tracker tiene al peer como activo en el torrent
+func (tr *Tracker) HasPeer(infoHash [20]byte, peerId string) bool {
+	id := hex.EncodeToString([]byte(peerId))
+	for _, p := range tr.Peers(infoHash) {
+		if p.PeerIDHex == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot devuelve el estado completo del tracker, tombstones incluidos
+// (infoHash -> peerID -> Peer), tal como lo enviaría por sincronización
+func (tr *Tracker) Snapshot() map[string]map[string]*tracker.Peer {
+	return tr.NewSyncMessage().Swarms
+}
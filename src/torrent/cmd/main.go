@@ -0,0 +1,131 @@
+// torrent/cmd/main.go
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"src/torrent"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "uso: torrent create [opciones] <archivo o directorio>")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Opciones de create:")
+	createFlags(nil).PrintDefaults()
+}
+
+type createArgs struct {
+	out, announce, comment, createdBy, webSeeds, name, pieceLength string
+	private                                                        bool
+	workers                                                        int
+}
+
+func createFlags(a *createArgs) *flag.FlagSet {
+	if a == nil {
+		a = &createArgs{}
+	}
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	fs.Usage = usage
+	fs.StringVar(&a.out, "o", "", "archivo .torrent de salida (por defecto <nombre>.torrent)")
+	fs.StringVar(&a.announce, "announce", "", "trackers separados por comas; el primero es el principal")
+	fs.StringVar(&a.comment, "comment", "", "comentario")
+	fs.StringVar(&a.createdBy, "created-by", torrent.DefaultCreatedBy, "valor de \"created by\"")
+	fs.StringVar(&a.webSeeds, "web-seeds", "", "URLs de web seeds (url-list) separadas por comas")
+	fs.StringVar(&a.name, "name", "", "nombre del torrent (por defecto el del archivo o directorio)")
+	fs.StringVar(&a.pieceLength, "piece-length", "auto", "tamaño de pieza: auto o potencia de 2 en bytes (admite sufijos K y M, p.ej. 256K)")
+	fs.BoolVar(&a.private, "private", false, "marcar el torrent como privado")
+	fs.IntVar(&a.workers, "workers", 0, "goroutines de hashing (0 = una por CPU)")
+	return fs
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "create" {
+		usage()
+		os.Exit(2)
+	}
+
+	var a createArgs
+	fs := createFlags(&a)
+	fs.Parse(os.Args[2:])
+	if fs.NArg() != 1 {
+		usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+
+	pieceLength, err := parsePieceLength(a.pieceLength)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
+
+	start := time.Now()
+	data, infoHash, err := torrent.Create(torrent.CreateOptions{
+		Path:        path,
+		Name:        a.name,
+		PieceLength: pieceLength,
+		Announce:    splitList(a.announce),
+		Comment:     a.comment,
+		CreatedBy:   a.createdBy,
+		Private:     a.private,
+		WebSeeds:    splitList(a.webSeeds),
+		Workers:     a.workers,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error creando torrent:", err)
+		os.Exit(1)
+	}
+
+	out := a.out
+	if out == "" {
+		name := a.name
+		if name == "" {
+			name = filepath.Base(filepath.Clean(path))
+		}
+		out = name + ".torrent"
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "Error escribiendo torrent:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Torrent creado: %s\n", out)
+	fmt.Printf("  info_hash: %x\n", infoHash)
+	fmt.Printf("  tiempo:    %v\n", time.Since(start).Round(time.Millisecond))
+}
+
+// parsePieceLength interpreta "auto" (0), bytes o sufijos K/M
+func parsePieceLength(s string) (int, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" || s == "AUTO" {
+		return 0, nil
+	}
+	mult := 1
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult, s = 1024, strings.TrimSuffix(s, "K")
+	case strings.HasSuffix(s, "M"):
+		mult, s = 1024*1024, strings.TrimSuffix(s, "M")
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("piece length inválido: %q", s)
+	}
+	return n * mult, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
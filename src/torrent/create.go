@@ -0,0 +1,268 @@
+package torrent
+
+// torrent/create.go
+// Creación de archivos .torrent a partir de un archivo o directorio: lista de
+// archivos, hash SHA-1 de las piezas (en paralelo) y metainfo bencodeada.
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"src/bencode"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// límites del modo automático de piece length
+	minAutoPieceLength = 16 * 1024
+	maxAutoPieceLength = 16 * 1024 * 1024
+	// el modo automático busca quedar por debajo de esta cantidad de piezas
+	targetPieces = 1500
+
+	DefaultCreatedBy = "JC BitTorrent"
+)
+
+// CreateOptions son los parámetros de Create
+type CreateOptions struct {
+	Path        string   // archivo o directorio a compartir
+	Name        string   // nombre en el info dict; vacío = base de Path
+	PieceLength int      // bytes por pieza (potencia de 2); 0 = automático
+	Announce    []string // trackers: el primero es "announce", todos van en "announce-list"
+	Comment     string
+	CreatedBy   string // vacío = DefaultCreatedBy
+	Private     bool   // info["private"]=1: sin DHT/PEX, sólo trackers
+	WebSeeds    []string
+	Workers     int // goroutines de hashing; 0 = runtime.NumCPU()
+}
+
+// fileEntry es un archivo a incluir, con su ruta relativa a Path
+type fileEntry struct {
+	fullPath string
+	relPath  []string
+	length   int64
+}
+
+// AutoPieceLength elige la menor potencia de 2 (entre 16 KiB y 16 MiB) que
+// deja el torrent en a lo sumo targetPieces piezas
+func AutoPieceLength(totalLength int64) int {
+	pl := minAutoPieceLength
+	for pl < maxAutoPieceLength && (totalLength+int64(pl)-1)/int64(pl) > targetPieces {
+		pl *= 2
+	}
+	return pl
+}
+
+// Create arma el .torrent de opts.Path. Devuelve la metainfo bencodeada y el info_hash.
+func Create(opts CreateOptions) ([]byte, [20]byte, error) {
+	var infoHash [20]byte
+
+	files, isDir, err := collectFiles(opts.Path)
+	if err != nil {
+		return nil, infoHash, err
+	}
+	var total int64
+	for _, f := range files {
+		total += f.length
+	}
+	if total == 0 {
+		return nil, infoHash, errors.New("no hay datos para compartir (tamaño total 0)")
+	}
+
+	pieceLength := opts.PieceLength
+	if pieceLength == 0 {
+		pieceLength = AutoPieceLength(total)
+	}
+	if pieceLength < minAutoPieceLength || pieceLength&(pieceLength-1) != 0 {
+		return nil, infoHash, fmt.Errorf("piece length %d inválido: debe ser potencia de 2 y al menos %d", pieceLength, minAutoPieceLength)
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	pieces, err := hashPieces(files, total, pieceLength, workers)
+	if err != nil {
+		return nil, infoHash, err
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = filepath.Base(filepath.Clean(opts.Path))
+	}
+	info := map[string]interface{}{
+		"name":         name,
+		"piece length": int64(pieceLength),
+		"pieces":       string(pieces),
+	}
+	if isDir {
+		list := make([]interface{}, len(files))
+		for i, f := range files {
+			path := make([]interface{}, len(f.relPath))
+			for j, p := range f.relPath {
+				path[j] = p
+			}
+			list[i] = map[string]interface{}{"length": f.length, "path": path}
+		}
+		info["files"] = list
+	} else {
+		info["length"] = total
+	}
+	if opts.Private {
+		info["private"] = int64(1)
+	}
+
+	createdBy := opts.CreatedBy
+	if createdBy == "" {
+		createdBy = DefaultCreatedBy
+	}
+	meta := map[string]interface{}{
+		"info":          info,
+		"created by":    createdBy,
+		"creation date": time.Now().Unix(),
+	}
+	if len(opts.Announce) > 0 {
+		meta["announce"] = opts.Announce[0]
+		// un tier por tracker, en el orden dado
+		tiers := make([]interface{}, len(opts.Announce))
+		for i, url := range opts.Announce {
+			tiers[i] = []interface{}{url}
+		}
+		meta["announce-list"] = tiers
+	}
+	if opts.Comment != "" {
+		meta["comment"] = opts.Comment
+	}
+	if len(opts.WebSeeds) > 0 {
+		seeds := make([]interface{}, len(opts.WebSeeds))
+		for i, s := range opts.WebSeeds {
+			seeds[i] = s
+		}
+		meta["url-list"] = seeds
+	}
+
+	infoHash = sha1.Sum(bencode.Encode(info))
+	return bencode.Encode(meta), infoHash, nil
+}
+
+// collectFiles devuelve los archivos regulares bajo path en orden lexicográfico
+func collectFiles(path string) ([]fileEntry, bool, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if !st.IsDir() {
+		return []fileEntry{{fullPath: path, relPath: []string{st.Name()}, length: st.Size()}}, false, nil
+	}
+
+	var files []fileEntry
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, fileEntry{
+			fullPath: p,
+			relPath:  strings.Split(filepath.ToSlash(rel), "/"),
+			length:   info.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, true, err
+	}
+	if len(files) == 0 {
+		return nil, true, fmt.Errorf("el directorio %s no tiene archivos", path)
+	}
+	return files, true, nil
+}
+
+// pieceJob es una pieza leída pendiente de hashear
+type pieceJob struct {
+	index int
+	data  []byte
+}
+
+// hashPieces lee los archivos como un único flujo continuo, cortado en piezas
+// de pieceLength, y calcula el SHA-1 de cada una con workers goroutines
+func hashPieces(files []fileEntry, total int64, pieceLength, workers int) ([]byte, error) {
+	numPieces := int((total + int64(pieceLength) - 1) / int64(pieceLength))
+	pieces := make([]byte, numPieces*20)
+
+	jobs := make(chan pieceJob, workers*2)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				sum := sha1.Sum(job.data)
+				copy(pieces[job.index*20:], sum[:])
+			}
+		}()
+	}
+
+	err := readPieces(files, pieceLength, func(index int, data []byte) {
+		jobs <- pieceJob{index: index, data: data}
+	})
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return pieces, nil
+}
+
+// readPieces entrega cada pieza (la última puede ser más corta) a emit
+func readPieces(files []fileEntry, pieceLength int, emit func(index int, data []byte)) error {
+	index := 0
+	buf := make([]byte, 0, pieceLength)
+	for _, f := range files {
+		fh, err := os.Open(f.fullPath)
+		if err != nil {
+			return err
+		}
+		var read int64
+		for {
+			n, err := io.ReadFull(fh, buf[len(buf):pieceLength])
+			buf = buf[:len(buf)+n]
+			read += int64(n)
+			if len(buf) == pieceLength {
+				emit(index, buf)
+				index++
+				buf = make([]byte, 0, pieceLength)
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				fh.Close()
+				return err
+			}
+		}
+		fh.Close()
+		if read != f.length {
+			return fmt.Errorf("%s cambió de tamaño durante el hashing", f.fullPath)
+		}
+	}
+	if len(buf) > 0 {
+		emit(index, buf)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package torrent_test
+
+import (
+	"crypto/sha1"
+	"os"
+	"path/filepath"
+	"src/client"
+	"src/torrent"
+	"testing"
+)
+
+const testPieceLength = 16 * 1024
+
+// testData devuelve n bytes deterministas distintos por semilla
+func testData(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i*7) ^ seed
+	}
+	return b
+}
+
+// Un torrent creado con Create se vuelve a leer con ParseTorrentFile: los
+// hashes de pieza son el SHA-1 de los datos, la última pieza es corta cuando
+// el total no es múltiplo de piece length y el info_hash no cambia entre
+// creaciones
+func TestCreateRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		files map[string][]byte // contenido por ruta relativa
+		order []string          // rutas en orden lexicográfico (el de info["files"])
+		multi bool
+		last  int // bytes de la última pieza
+	}{
+		{
+			name:  "un archivo",
+			files: map[string][]byte{"data.bin": testData(3*testPieceLength+1234, 1)},
+			order: []string{"data.bin"},
+			last:  1234,
+		},
+		{
+			name:  "un archivo múltiplo exacto",
+			files: map[string][]byte{"data.bin": testData(2*testPieceLength, 2)},
+			order: []string{"data.bin"},
+			last:  testPieceLength,
+		},
+		{
+			name: "multi-archivo",
+			files: map[string][]byte{
+				"a.txt":          testData(5000, 3),
+				"sub/b.bin":      testData(testPieceLength+777, 4),
+				"sub/deep/c.bin": testData(2*testPieceLength+10, 5),
+			},
+			order: []string{"a.txt", "sub/b.bin", "sub/deep/c.bin"},
+			multi: true,
+			last:  5000 + testPieceLength + 777 + 2*testPieceLength + 10 - 3*testPieceLength,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var path string
+			var data []byte
+			if tc.multi {
+				path = filepath.Join(dir, "tree")
+			}
+			for _, rel := range tc.order {
+				full := filepath.Join(dir, filepath.FromSlash(rel))
+				if tc.multi {
+					full = filepath.Join(path, filepath.FromSlash(rel))
+				} else {
+					path = full
+				}
+				if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(full, tc.files[rel], 0644); err != nil {
+					t.Fatal(err)
+				}
+				data = append(data, tc.files[rel]...)
+			}
+
+			opts := torrent.CreateOptions{
+				Path:        path,
+				PieceLength: testPieceLength,
+				Announce:    []string{"http://127.0.0.1:1/announce"},
+				Workers:     1,
+			}
+			meta, infoHash, err := torrent.Create(opts)
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			// el info_hash no depende de la fecha ni del paralelismo del hashing
+			opts.Workers = 4
+			if _, again, err := torrent.Create(opts); err != nil || again != infoHash {
+				t.Fatalf("info_hash inestable: %x vs %x (%v)", infoHash, again, err)
+			}
+
+			torrentPath := filepath.Join(t.TempDir(), "test.torrent")
+			if err := os.WriteFile(torrentPath, meta, 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := client.ParseTorrentFile(torrentPath, t.TempDir())
+			if err != nil {
+				t.Fatalf("ParseTorrentFile: %v", err)
+			}
+			if cfg.InfoHash != infoHash || sha1.Sum(cfg.InfoBytes) != infoHash {
+				t.Fatalf("info_hash %x, Create devolvió %x", cfg.InfoHash, infoHash)
+			}
+			if cfg.FileLength != int64(len(data)) || cfg.PieceLength != testPieceLength {
+				t.Fatalf("length=%d piece length=%d, se esperaba %d/%d",
+					cfg.FileLength, cfg.PieceLength, len(data), testPieceLength)
+			}
+
+			if tc.multi {
+				if len(cfg.Files) != len(tc.order) {
+					t.Fatalf("%d archivos, se esperaban %d", len(cfg.Files), len(tc.order))
+				}
+				for i, fe := range cfg.Files {
+					if filepath.ToSlash(fe.RelPath()) != tc.order[i] || fe.Length != int64(len(tc.files[tc.order[i]])) {
+						t.Fatalf("archivo %d: %q (%d bytes), se esperaba %q", i, fe.RelPath(), fe.Length, tc.order[i])
+					}
+				}
+			} else if len(cfg.Files) != 0 {
+				t.Fatalf("torrent de un archivo con %d entradas en files", len(cfg.Files))
+			}
+
+			numPieces := (len(data) + testPieceLength - 1) / testPieceLength
+			if len(cfg.ExpectedHashes) != numPieces {
+				t.Fatalf("%d hashes, se esperaban %d", len(cfg.ExpectedHashes), numPieces)
+			}
+			for i, h := range cfg.ExpectedHashes {
+				start := i * testPieceLength
+				end := min(start+testPieceLength, len(data))
+				if want := sha1.Sum(data[start:end]); h != want {
+					t.Fatalf("pieza %d: hash %x, se esperaba %x", i, h, want)
+				}
+			}
+			// la última pieza es corta sólo si el total no es múltiplo de piece length
+			lastStart := (numPieces - 1) * testPieceLength
+			if last := len(data) - lastStart; last != tc.last {
+				t.Fatalf("última pieza de %d bytes, se esperaban %d", last, tc.last)
+			}
+			if cfg.ExpectedHashes[numPieces-1] != sha1.Sum(data[lastStart:]) {
+				t.Fatal("el hash de la última pieza no cubre sólo los datos restantes")
+			}
+		})
+	}
+}
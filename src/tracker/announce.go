@@ -5,11 +5,11 @@ package tracker
 import (
 	"encoding/binary"
 	"errors"
-	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"src/bencode"
+	"src/logging"
 	"strconv"
 	"strings"
 )
@@ -18,7 +18,8 @@ import (
 // AnnounceHandler valida los parámetros mínimos (info_hash, peer_id, port),
 // registra/actualiza el peer en el swarm correspondiente y responde con un
 // diccionario bencode que incluye el intervalo (interval) y la lista de peers
-// en formato compacto IPv4 (6 bytes por peer: 4 de IP + 2 de puerto).
+// en formato compacto IPv4 (6 bytes por peer: 4 de IP + 2 de puerto) más
+// peers6 para los peers con IPv6 (18 bytes por peer, BEP 7).
 func (t *Tracker) AnnounceHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -53,7 +54,7 @@ func (t *Tracker) AnnounceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	event := vals.Get("event")
-	_ = vals.Get("compact") // leemos pero siempre respondemos en formato compacto IPv4
+	_ = vals.Get("compact") // leemos pero siempre respondemos en formato compacto (peers y peers6)
 	numwant := t.MaxPeersResp
 	if nw, err := strconv.Atoi(vals.Get("numwant")); err == nil && nw >= 0 {
 		if nw < numwant {
@@ -61,40 +62,37 @@ func (t *Tracker) AnnounceHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	hostname := vals.Get("hostname") // vals.Get() ya devuelve string limpio
-	// ip := clientIP(r, vals.Get("ip"))
-	// if ip == nil || ip.To4() == nil {
-	// 	t.failure(w, "ipv4 required")
-	// 	return
-	// }
+	ip := clientIP(r, vals.Get("ip"))
+	if hostname == "" {
+		// sin hostname, la dirección del peer es la IP (v4 o v6) de la conexión
+		if ip == nil {
+			t.failure(w, "missing hostname or ip")
+			return
+		}
+		hostname = ip.String()
+	}
+
+	// ipv6= (BEP 7): "<ip>" o "[<ip>]:<puerto>". Si no viene y el announce
+	// llegó por IPv6, se usa la dirección de origen.
+	addr6, err := announceIPv6(vals.Get("ipv6"), uint16(port64))
+	if err != nil {
+		t.failure(w, err.Error())
+		return
+	}
+	if addr6 == "" && ip != nil && ip.To4() == nil && ip.String() != hostname {
+		addr6 = net.JoinHostPort(ip.String(), strconv.Itoa(int(port64)))
+	}
 
 	infoHex, _ := Bytes20ToHex(infoHash)
 	peerHex, _ := Bytes20ToHex(peerID)
 
-	log.Printf("announce from %s ih=%s pid=%s port=%d", hostname, infoHex[:8], peerHex[:8], port64)
-
-	// Determinar si el peer es seeder
-	completed := left == 0
-
-	// event handling: stopped => eliminar; completed/started/empty => alta/refresh
-	switch event {
-	case "stopped":
-		log.Printf("event=stopped from %s (ih=%s pid=%s)", hostname, infoHex[:8], peerHex[:8])
-		_ = t.SaveOnChange(func() { t.RemovePeer(infoHex, peerHex) })
-
-	case "started":
-		log.Printf("event=started from %s (ih=%s pid=%s left=%d)", hostname, infoHex[:8], peerHex[:8], left)
-		_ = t.SaveOnChange(func() { t.AddPeer(infoHex, peerHex, hostname, uint16(port64), completed) })
-
-	case "completed":
-		log.Printf("event=completed from %s (ih=%s pid=%s) - peer is now seeder!", hostname, infoHex[:8], peerHex[:8])
-		_ = t.SaveOnChange(func() { t.AddPeer(infoHex, peerHex, hostname, uint16(port64), true) })
-
-	default:
-		// Announce regular sin evento (periódico)
-		log.Printf("periodic announce from %s (ih=%s pid=%s left=%d)", hostname, infoHex[:8], peerHex[:8], left)
-		_ = t.SaveOnChange(func() { t.AddPeer(infoHex, peerHex, hostname, uint16(port64), completed) })
+	// Modo sharded: si no somos dueños del swarm lo atiende un dueño
+	if t.forwardAnnounce(w, r, infoHex, ip) {
+		return
 	}
 
+	t.applyAnnounce(infoHex, peerHex, hostname, uint16(port64), addr6, left, event)
+
 	// Build peer list excluding requester
 	peers := t.GetPeers(infoHex, peerHex, numwant)
 
@@ -102,7 +100,7 @@ func (t *Tracker) AnnounceHandler(w http.ResponseWriter, r *http.Request) {
 	// Si algún peer tiene hostname (no es IP numérica), usar non-compact
 	useNonCompact := false
 	for _, p := range peers {
-		if net.ParseIP(p.HostName).To4() == nil && p.HostName != "" {
+		if net.ParseIP(p.HostName) == nil && p.HostName != "" {
 			useNonCompact = true
 			break
 		}
@@ -129,6 +127,9 @@ func (t *Tracker) AnnounceHandler(w http.ResponseWriter, r *http.Request) {
 		// Formato compact: string de bytes
 		reply["peers"] = compactPeers(peers)
 	}
+	if peers6 := compactPeers6(peers); len(peers6) > 0 {
+		reply["peers6"] = peers6
+	}
 
 	data := bencode.Encode(relySafe(reply))
 	w.Header().Set("Content-Type", "application/x-bittorrent")
@@ -136,6 +137,34 @@ func (t *Tracker) AnnounceHandler(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(data)
 }
 
+// applyAnnounce aplica al swarm el efecto de un announce (HTTP o UDP):
+// stopped => eliminar; completed/started/vacío => alta/refresh.
+func (t *Tracker) applyAnnounce(infoHex, peerHex, hostname string, port uint16, addr6 string, left int64, event string) {
+	// Determinar si el peer es seeder
+	completed := left == 0
+
+	attrs := []any{logging.InfoHashHex(infoHex), logging.Peer(net.JoinHostPort(hostname, strconv.Itoa(int(port)))),
+		"peer_id", peerHex, "left", left}
+	switch event {
+	case "stopped":
+		log.Info("announce event=stopped", attrs...)
+		_ = t.SaveOnChange(func() { t.RemovePeer(infoHex, peerHex) })
+
+	case "started":
+		log.Info("announce event=started", attrs...)
+		_ = t.SaveOnChange(func() { t.AddPeer(infoHex, peerHex, hostname, port, addr6, completed) })
+
+	case "completed":
+		log.Info("announce event=completed, peer is now a seeder", attrs...)
+		_ = t.SaveOnChange(func() { t.AddPeer(infoHex, peerHex, hostname, port, addr6, true) })
+
+	default:
+		// Announce regular sin evento (periódico)
+		log.Debug("periodic announce", attrs...)
+		_ = t.SaveOnChange(func() { t.AddPeer(infoHex, peerHex, hostname, port, addr6, completed) })
+	}
+}
+
 // relySafe es un placeholder por si se quisiera sanear/normalizar el mapa de
 // respuesta antes de codificarlo. Actualmente devuelve el mismo mapa.
 func relySafe(m map[string]interface{}) map[string]interface{} { return m }
@@ -143,7 +172,7 @@ func relySafe(m map[string]interface{}) map[string]interface{} { return m }
 // failure envía una respuesta de error bencodeada con la clave "failure reason"
 // y código HTTP 400, además de registrar el motivo en el log.
 func (t *Tracker) failure(w http.ResponseWriter, reason string) {
-	log.Printf("failure: %s", reason)
+	log.Warn("announce rejected", "reason", reason)
 	data := bencode.Encode(map[string]interface{}{"failure reason": reason})
 	w.Header().Set("Content-Type", "application/x-bittorrent")
 	w.WriteHeader(http.StatusBadRequest)
@@ -167,6 +196,53 @@ func compactPeers(peers []*Peer) string {
 	return string(b)
 }
 
+// compactPeers6 construye la lista compacta IPv6 (BEP 7): 16 bytes de IP y 2
+// de puerto por dirección. Incluye los peers registrados con una IPv6 literal
+// y las direcciones anunciadas con ipv6=.
+func compactPeers6(peers []*Peer) string {
+	b := make([]byte, 0, len(peers)*18)
+	add := func(ip net.IP, port uint16) {
+		if ip == nil || ip.To4() != nil || port == 0 {
+			return
+		}
+		b = append(b, ip.To16()...)
+		b = binary.BigEndian.AppendUint16(b, port)
+	}
+	for _, p := range peers {
+		add(net.ParseIP(p.IP), p.Port)
+		if p.Addr6 == "" {
+			continue
+		}
+		host, portStr, err := net.SplitHostPort(p.Addr6)
+		if err != nil || host == p.IP {
+			continue
+		}
+		port, _ := strconv.ParseUint(portStr, 10, 16)
+		add(net.ParseIP(host), uint16(port))
+	}
+	return string(b)
+}
+
+// announceIPv6 normaliza el parámetro ipv6= a "[ip]:puerto"; sin puerto
+// explícito se usa el del announce
+func announceIPv6(v string, port uint16) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	host, portStr := v, strconv.Itoa(int(port))
+	if h, p, err := net.SplitHostPort(v); err == nil {
+		host, portStr = h, p
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.To4() != nil {
+		return "", errors.New("invalid ipv6")
+	}
+	if n, err := strconv.ParseUint(portStr, 10, 16); err != nil || n == 0 {
+		return "", errors.New("invalid ipv6 port")
+	}
+	return net.JoinHostPort(ip.String(), portStr), nil
+}
+
 // nonCompactPeers construye la representación "non-compact" de la lista de peers,
 // devolviendo una lista de diccionarios con peer_id, ip (hostname), y port.
 func nonCompactPeers(peers []*Peer) []map[string]interface{} {
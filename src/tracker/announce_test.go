@@ -0,0 +1,186 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"src/bencode"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listen6 abre un listener en [::1]; saltea el test si no hay loopback IPv6
+func listen6(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("sin loopback IPv6: %v", err)
+	}
+	return ln
+}
+
+// compactAddrs decodifica una lista compacta de ipLen bytes de IP + 2 de puerto
+func compactAddrs(t *testing.T, raw string, ipLen int) []string {
+	t.Helper()
+	if len(raw)%(ipLen+2) != 0 {
+		t.Fatalf("lista compacta de %d bytes no es múltiplo de %d", len(raw), ipLen+2)
+	}
+	var out []string
+	for i := 0; i < len(raw); i += ipLen + 2 {
+		ip := net.IP(raw[i : i+ipLen])
+		port := binary.BigEndian.Uint16([]byte(raw[i+ipLen : i+ipLen+2]))
+		out = append(out, net.JoinHostPort(ip.String(), strconv.Itoa(int(port))))
+	}
+	return out
+}
+
+func sameSet(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	seen := map[string]bool{}
+	for _, s := range got {
+		seen[s] = true
+	}
+	for _, s := range want {
+		if !seen[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// Un peer que anuncia por IPv6 (sin ip= ni hostname) vuelve en peers6 y no en
+// peers; uno IPv4 al revés; uno dual-stack (ip= + ipv6=) en las dos listas
+func TestAnnounceIPv6Peers(t *testing.T) {
+	tr := New(time.Second, 2*time.Second, 50, "", "t1", nil)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(tr.AnnounceHandler))
+	srv.Listener.Close()
+	srv.Listener = listen6(t)
+	srv.Start()
+	defer srv.Close()
+
+	infoHash, _ := hex.DecodeString(testIH)
+	announce := func(peerID string, port int, extra url.Values) map[string]interface{} {
+		t.Helper()
+		q := url.Values{
+			"info_hash": {string(infoHash)},
+			"peer_id":   {peerID},
+			"port":      {strconv.Itoa(port)},
+			"left":      {"0"},
+			"compact":   {"1"},
+		}
+		for k, v := range extra {
+			q[k] = v
+		}
+		resp, err := http.Get(srv.URL + "/announce?" + q.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		reply, err := bencode.Decode(resp.Body)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("announce de %s: %d %v %v", peerID, resp.StatusCode, reply, err)
+		}
+		return reply
+	}
+
+	announce("-JC0001-ipv6peer0001", 7001, nil)
+	announce("-JC0001-ipv4peer0002", 7002, url.Values{"ip": {"10.0.0.2"}})
+	announce("-JC0001-dualpeer0003", 7003, url.Values{"ip": {"10.0.0.3"}, "ipv6": {"[::1]:7013"}})
+	reply := announce("-JC0001-askingpeer04", 7004, url.Values{"ip": {"10.0.0.4"}})
+
+	peers, _ := reply["peers"].(string)
+	peers6, _ := reply["peers6"].(string)
+	if got, want := compactAddrs(t, peers, net.IPv4len), []string{"10.0.0.2:7002", "10.0.0.3:7003"}; !sameSet(got, want) {
+		t.Fatalf("peers = %v, se esperaba %v", got, want)
+	}
+	if got, want := compactAddrs(t, peers6, net.IPv6len), []string{"[::1]:7001", "[::1]:7013"}; !sameSet(got, want) {
+		t.Fatalf("peers6 = %v, se esperaba %v", got, want)
+	}
+
+	// el peer IPv6 quedó registrado con la IP de origen de la conexión
+	peerHex := hex.EncodeToString([]byte("-JC0001-ipv6peer0001"))
+	for _, p := range tr.GetPeers(testIH, "", 50) {
+		if p.PeerIDHex == peerHex && (p.IP != "::1" || p.Addr6 != "") {
+			t.Fatalf("peer IPv6 registrado como ip=%q addr6=%q", p.IP, p.Addr6)
+		}
+	}
+}
+
+// Sobre udp6 la respuesta de announce trae peers de 18 bytes (BEP 15) y el
+// peer queda registrado con su IPv6 de origen
+func TestUDPAnnounceIPv6(t *testing.T) {
+	listen6(t).Close()
+	tr := New(time.Second, 2*time.Second, 50, "", "t1", nil)
+	tr.AddPeer(testIH, testPeerA, "10.0.0.1", 1000, "[::1]:1001", true)
+	if err := tr.StartUDPListener("[::1]:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.StopUDPListener()
+
+	conn, err := net.Dial("udp6", tr.UDPAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	request := func(req []byte) []byte {
+		t.Helper()
+		if _, err := conn.Write(req); err != nil {
+			t.Fatal(err)
+		}
+		resp := make([]byte, udpMaxPacket)
+		n, err := conn.Read(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp[:n]
+	}
+
+	req := binary.BigEndian.AppendUint64(nil, udpProtocolID)
+	req = binary.BigEndian.AppendUint32(req, udpActionConnect)
+	req = binary.BigEndian.AppendUint32(req, 1)
+	resp := request(req)
+	if len(resp) != 16 || binary.BigEndian.Uint32(resp[0:4]) != udpActionConnect {
+		t.Fatalf("connect: %x", resp)
+	}
+
+	infoHash, _ := hex.DecodeString(testIH)
+	req = append([]byte{}, resp[8:16]...)
+	req = binary.BigEndian.AppendUint32(req, udpActionAnnounce)
+	req = binary.BigEndian.AppendUint32(req, 2)
+	req = append(req, infoHash...)
+	req = append(req, "-JC0001-udp6peer0001"...)
+	req = binary.BigEndian.AppendUint64(req, 0)          // downloaded
+	req = binary.BigEndian.AppendUint64(req, 100)        // left
+	req = binary.BigEndian.AppendUint64(req, 0)          // uploaded
+	req = binary.BigEndian.AppendUint32(req, 2)          // event=started
+	req = binary.BigEndian.AppendUint32(req, 0)          // ip
+	req = binary.BigEndian.AppendUint32(req, 0)          // key
+	req = binary.BigEndian.AppendUint32(req, ^uint32(0)) // num_want=-1
+	req = binary.BigEndian.AppendUint16(req, 7001)
+	resp = request(req)
+	if len(resp) < 20 || binary.BigEndian.Uint32(resp[0:4]) != udpActionAnnounce {
+		t.Fatalf("announce: %x", resp)
+	}
+	// sólo la dirección ipv6= del peer dual-stack, en formato de 18 bytes
+	if got := compactAddrs(t, string(resp[20:]), net.IPv6len); !sameSet(got, []string{"[::1]:1001"}) {
+		t.Fatalf("peers = %v, se esperaba [[::1]:1001]", got)
+	}
+
+	peerHex := hex.EncodeToString([]byte("-JC0001-udp6peer0001"))
+	var found bool
+	for _, p := range tr.GetPeers(testIH, "", 50) {
+		if p.PeerIDHex == peerHex {
+			found = p.IP == "::1" && p.Port == 7001
+		}
+	}
+	if !found {
+		t.Fatal("el peer UDP no quedó registrado como [::1]:7001")
+	}
+}
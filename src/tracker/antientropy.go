@@ -0,0 +1,208 @@
+package tracker
+
+// tracker/antientropy.go
+// Anti-entropía entre trackers: además del push periódico, cada tracker
+// compara su árbol de Merkle con el de los remotos y trae sólo las hojas que
+// difieren. Así se reparan divergencias que el push no corrige, por ejemplo
+// después de que una partición de red se cura.
+//
+// Protocolo (en el listener de sincronización):
+//
+//	POST /merkle          {"prefixes": ["", "3", ...]} -> {"nodes": {"3": {"hash": ..., "children": [16 hashes]}}}
+//	POST /merkle/entries  {"prefixes": ["3a", ...]}    -> SyncMessage firmado con los peers de esas hojas
+//
+// En modo sharded el pedido lleva el node_id de quien lo hace ("from") y
+// ambos lados arman el árbol sólo con los swarms de los que son dueños los
+// dos.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"src/logging"
+	"time"
+)
+
+// antiEntropyTimeout limita cada request de una ronda de anti-entropía
+const antiEntropyTimeout = 10 * time.Second
+
+// merkleRequest es el cuerpo de /merkle y /merkle/entries
+type merkleRequest struct {
+	From     string   `json:"from,omitempty"` // node_id de quien pide (modo sharded)
+	Prefixes []string `json:"prefixes"`
+}
+
+// merkleNode es un nodo del árbol: su hash y, si no es hoja, los de sus hijos
+type merkleNode struct {
+	Hash     string   `json:"hash"`
+	Children []string `json:"children,omitempty"`
+}
+
+// merkleResponse es la respuesta de /merkle
+type merkleResponse struct {
+	Nodes map[string]merkleNode `json:"nodes"`
+}
+
+var antiEntropyClient = &http.Client{Timeout: antiEntropyTimeout}
+
+// StartAntiEntropy inicia las rondas periódicas de anti-entropía con los
+// trackers remotos.
+func (t *Tracker) StartAntiEntropy(interval time.Duration) {
+	t.antiEntropyStop = make(chan struct{})
+	stop := t.antiEntropyStop
+	syncLog.Info("anti-entropy started", "interval", interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, remote := range t.syncPeers() {
+					if _, err := t.AntiEntropy(remote); err != nil {
+						syncLog.Warn("anti-entropy round failed", "remote", remote, logging.Err(err))
+					}
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// AntiEntropy hace una ronda con el tracker remoto (dirección de su listener
+// de sincronización): baja por el árbol de Merkle sólo por los nodos que
+// difieren, trae los peers de las hojas distintas y los mezcla con LWW.
+// Devuelve la cantidad de entradas reparadas.
+func (t *Tracker) AntiEntropy(remote string) (int, error) {
+	var keep func(string) bool
+	if t.shard != nil {
+		nodeID, ok := t.cluster.Load().nodeAt(remote)
+		if !ok {
+			return 0, fmt.Errorf("%s is not a cluster member", remote)
+		}
+		keep = t.sharedFilter(nodeID)
+	}
+	local := t.merkleTree(keep)
+
+	prefixes := []string{""}
+	for depth := 0; depth < merkleDepth && len(prefixes) > 0; depth++ {
+		var resp merkleResponse
+		if err := postJSON(remote, "/merkle", merkleRequest{From: t.nodeID, Prefixes: prefixes}, &resp); err != nil {
+			return 0, err
+		}
+		var next []string
+		for _, p := range prefixes {
+			rn, ok := resp.Nodes[p]
+			if !ok || rn.Hash == local.hash(p) {
+				continue
+			}
+			if len(rn.Children) != merkleFanout {
+				return 0, fmt.Errorf("invalid merkle node %q from %s", p, remote)
+			}
+			for i, ch := range rn.Children {
+				if cp := p + hexDigits[i:i+1]; ch != local.hash(cp) {
+					next = append(next, cp)
+				}
+			}
+		}
+		prefixes = next
+	}
+	if len(prefixes) == 0 {
+		syncLog.Debug("anti-entropy: in sync", "remote", remote)
+		return 0, nil
+	}
+
+	var msg SyncMessage
+	if err := postJSON(remote, "/merkle/entries", merkleRequest{From: t.nodeID, Prefixes: prefixes}, &msg); err != nil {
+		return 0, err
+	}
+	if err := t.open(&msg, msg.FromNodeID, msg.Timestamp, msg.Nonce, &msg.Signature); err != nil {
+		securityLog.Warn("rejected anti-entropy entries", "from", msg.FromNodeID, "remote", remote, logging.Err(err))
+		return 0, fmt.Errorf("entries from %s: %w", remote, err)
+	}
+
+	repaired := t.MergeSwarms(&msg)
+	if repaired > 0 {
+		_ = t.SaveToFile()
+		syncLog.Info("anti-entropy repaired entries", "remote", remote, "from", msg.FromNodeID,
+			"repaired", repaired, "buckets", len(prefixes))
+	} else {
+		syncLog.Debug("anti-entropy: differing buckets already up to date", "remote", remote, "buckets", len(prefixes))
+	}
+	return repaired, nil
+}
+
+// postJSON envía req como JSON a http://<remote><path> y decodifica la respuesta en out
+func postJSON(remote, path string, req, out any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := antiEntropyClient.Post("http://"+remote+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// readMerkleRequest decodifica y valida el pedido de /merkle y /merkle/entries
+func readMerkleRequest(w http.ResponseWriter, r *http.Request, leavesOnly bool) (*merkleRequest, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	var req merkleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return nil, false
+	}
+	if len(req.Prefixes) > merkleFanout*merkleFanout {
+		http.Error(w, "Bad request: too many prefixes", http.StatusBadRequest)
+		return nil, false
+	}
+	for _, p := range req.Prefixes {
+		if !validMerklePrefix(p) || (leavesOnly && len(p) != merkleDepth) {
+			http.Error(w, "Bad request: invalid prefix", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	return &req, true
+}
+
+// handleMerkle responde los hashes de los nodos pedidos y de sus hijos
+func (sl *SyncListener) handleMerkle(w http.ResponseWriter, r *http.Request) {
+	req, ok := readMerkleRequest(w, r, false)
+	if !ok {
+		return
+	}
+	tree := sl.tracker.merkleTree(sl.tracker.sharedFilter(req.From))
+	resp := merkleResponse{Nodes: make(map[string]merkleNode, len(req.Prefixes))}
+	for _, p := range req.Prefixes {
+		resp.Nodes[p] = tree.node(p)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleMerkleEntries responde, firmados, los peers de las hojas pedidas
+func (sl *SyncListener) handleMerkleEntries(w http.ResponseWriter, r *http.Request) {
+	req, ok := readMerkleRequest(w, r, true)
+	if !ok {
+		return
+	}
+	msg := sl.tracker.bucketMessage(req.Prefixes, sl.tracker.sharedFilter(req.From))
+	if err := sl.tracker.seal(msg, &msg.Nonce, &msg.Signature); err != nil {
+		syncLog.Error("error signing anti-entropy entries", logging.Err(err))
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	syncLog.Debug("serving anti-entropy entries", "remote", r.RemoteAddr, "buckets", len(req.Prefixes), "swarms", len(msg.Swarms))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
@@ -0,0 +1,97 @@
+package tracker
+
+// tracker/changelog.go
+// Registro de cambios indexado por HLC para la sincronización incremental:
+// cada alta, baja o merge que modifica un peer deja una entrada, y los deltas
+// llevan el estado actual de los peers cambiados después de un HLC dado.
+
+import (
+	"sort"
+)
+
+// changeLogMax es la cantidad máxima de entradas retenidas. Al superarla se
+// descartan las más viejas y los trackers que no las recibieron vuelven a
+// sincronizar con un snapshot completo.
+const changeLogMax = 1 << 16
+
+// peerKey identifica a un peer dentro de un swarm
+type peerKey struct {
+	infoHash string
+	peerID   string
+}
+
+// changeEntry registra que un peer cambió en el instante at (HLC local)
+type changeEntry struct {
+	at  HLC
+	key peerKey
+}
+
+// changeLog es la lista de cambios ordenada por HLC. Se protege con el mutex
+// del Tracker: el HLC local sólo avanza bajo t.mu, así que las entradas se
+// agregan en orden.
+type changeLog struct {
+	entries []changeEntry
+	latest  map[peerKey]HLC // última entrada de cada peer
+	floor   HLC             // HLC de la entrada más nueva descartada
+	max     int
+}
+
+func newChangeLog(max int) *changeLog {
+	return &changeLog{latest: make(map[peerKey]HLC), max: max}
+}
+
+// record agrega un cambio del peer en el instante at
+func (l *changeLog) record(at HLC, infoHash, peerID string) {
+	key := peerKey{infoHash, peerID}
+	if last, ok := l.latest[key]; ok && last.Equal(at) {
+		return
+	}
+	l.entries = append(l.entries, changeEntry{at: at, key: key})
+	l.latest[key] = at
+	if len(l.entries) > l.max {
+		l.trim()
+	}
+}
+
+// trim compacta las entradas reemplazadas por otras más nuevas del mismo
+// peer y, si no alcanza, descarta las más viejas hasta dejar 3/4 de max
+func (l *changeLog) trim() {
+	kept := l.entries[:0]
+	for _, e := range l.entries {
+		if l.isLatest(e) {
+			kept = append(kept, e)
+		}
+	}
+	l.entries = kept
+
+	if over := len(l.entries) - l.max*3/4; over > 0 {
+		for _, e := range l.entries[:over] {
+			delete(l.latest, e.key)
+		}
+		l.floor = l.entries[over-1].at
+		l.entries = append(l.entries[:0:0], l.entries[over:]...)
+	}
+}
+
+// since devuelve los peers que cambiaron después de from, sin repetidos.
+// ok es false si parte de esos cambios ya se descartó y hace falta un
+// snapshot completo.
+func (l *changeLog) since(from HLC) (keys []peerKey, ok bool) {
+	if l.floor.After(from) {
+		return nil, false
+	}
+	i := sort.Search(len(l.entries), func(i int) bool { return l.entries[i].at.After(from) })
+	for _, e := range l.entries[i:] {
+		// si hay una entrada más nueva del mismo peer, se envía con ella
+		if l.isLatest(e) {
+			keys = append(keys, e.key)
+		}
+	}
+	return keys, true
+}
+
+// isLatest indica si e es la última entrada de su peer
+func (l *changeLog) isLatest(e changeEntry) bool {
+	last := l.latest[e.key]
+	return last.Equal(e.at)
+}
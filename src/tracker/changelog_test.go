@@ -0,0 +1,73 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+const (
+	testIH    = "0123456789abcdef0123456789abcdef01234567"
+	testPeerA = "2d4a43303030312d000000000000000000000001"
+	testPeerB = "2d4a43303030312d000000000000000000000002"
+)
+
+func TestDeltaSyncMessageOnlyCarriesChanges(t *testing.T) {
+	tr := New(time.Second, 2*time.Second, 50, "", "t1", nil)
+	tr.AddPeer(testIH, testPeerA, "10.0.0.1", 1000, "", false)
+	full := tr.NewSyncMessage()
+
+	delta, ok := tr.NewDeltaSyncMessage(full.Timestamp)
+	if !ok || len(delta.Swarms) != 0 {
+		t.Fatalf("delta sin cambios: ok=%v swarms=%v", ok, delta.Swarms)
+	}
+
+	tr.AddPeer(testIH, testPeerB, "10.0.0.2", 2000, "", false)
+	tr.AddPeer(testIH, testPeerB, "10.0.0.2", 2001, "", true)
+	delta, ok = tr.NewDeltaSyncMessage(full.Timestamp)
+	if !ok || delta.Since == nil || !delta.Since.Equal(full.Timestamp) {
+		t.Fatalf("delta inválido: ok=%v since=%v", ok, delta.Since)
+	}
+	peers := delta.Swarms[testIH]
+	if len(peers) != 1 || peers[testPeerB] == nil || peers[testPeerB].Port != 2001 {
+		t.Fatalf("se esperaba sólo el último estado de B: %+v", peers)
+	}
+
+	// el borrado viaja como tombstone
+	tr.RemovePeer(testIH, testPeerA)
+	delta, _ = tr.NewDeltaSyncMessage(delta.Timestamp)
+	if p := delta.Swarms[testIH][testPeerA]; p == nil || !p.Deleted || len(delta.Swarms[testIH]) != 1 {
+		t.Fatalf("se esperaba el tombstone de A: %+v", delta.Swarms)
+	}
+}
+
+func TestChangeLogTrim(t *testing.T) {
+	l := newChangeLog(8)
+	h := NewHLC("t1")
+	start := h.Clone()
+	var mid HLC
+	for i := 0; i < 12; i++ {
+		h.Update(nil)
+		if i == 5 {
+			mid = h.Clone()
+		}
+		l.record(h.Clone(), testIH, string(rune('a'+i)))
+	}
+
+	if _, ok := l.since(start); ok {
+		t.Fatal("since antes de lo descartado debería pedir snapshot")
+	}
+	keys, ok := l.since(mid)
+	if !ok || len(keys) != 6 {
+		t.Fatalf("since(mid) = %d claves, ok=%v; se esperaban 6", len(keys), ok)
+	}
+
+	// las entradas reemplazadas se compactan antes de descartar
+	l = newChangeLog(8)
+	for i := 0; i < 20; i++ {
+		h.Update(nil)
+		l.record(h.Clone(), testIH, string(rune('a'+i%3)))
+	}
+	if keys, ok := l.since(start); !ok || len(keys) != 3 {
+		t.Fatalf("since(start) = %d claves, ok=%v; se esperaban 3 sin truncar", len(keys), ok)
+	}
+}
@@ -5,34 +5,84 @@ package main
 import (
 	"flag"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"src/logging"
 	"src/tracker"
 	"strings"
+	"syscall"
 	"time"
 )
 
+var log = logging.For("main")
+
+// fatal registra err y termina el proceso
+func fatal(msg string, err error) {
+	log.Error(msg, logging.Err(err))
+	os.Exit(1)
+}
+
 func main() {
 	// Flags de configuración del tracker:
 	// -listen: dirección de escucha HTTP (por defecto ":8080")
 	// -interval: segundos para el campo "interval" en respuestas y base para expiración
 	// -maxpeers: límite de peers a devolver en /announce
 	// -sync-listen: dirección de escucha para sincronización entre trackers
-	// -sync-peers: lista de direcciones de otros trackers (separados por coma)
+	// -sync-peers: direcciones de otros trackers (separados por coma); con -cluster son seeds para unirse
+	// -cluster: membresía dinámica (join por cualquier seed, detección de caídas, leave al cerrar)
+	// -advertise: dirección de sincronización con la que los demás trackers nos contactan
+	// -cluster-interval: intervalo del gossip de membresía en segundos
 	// -sync-interval: intervalo de sincronización en segundos
+	// -anti-entropy-interval: intervalo de las rondas de anti-entropía (Merkle) en segundos, 0 para desactivarlas
+	// -udp-listen: dirección de escucha del tracker UDP (BEP 15), vacío para desactivarlo
+	// -sync-key / -sync-trust: clave Ed25519 del tracker y claves públicas de los demás (SIGHUP las recarga)
+	// -gen-key: genera una clave privada en el archivo indicado, imprime la línea para -sync-trust y sale
+	// -shard: reparte los swarms entre los miembros del cluster con un anillo de hash consistente (requiere -cluster)
+	// -shard-replicas / -shard-vnodes: dueños por swarm y nodos virtuales por tracker en el anillo
+	// -shard-redirect: redirige (307) los announces de swarms ajenos en lugar de hacer de proxy
+	// -announce-url: URL base del HTTP de announce con la que los demás trackers nos reenvían announces
 	listen := flag.String("listen", ":8080", "address to listen, e.g. :8080")
 	interval := flag.Int("interval", 60, "announce interval in seconds")
 	maxPeers := flag.Int("maxpeers", 50, "max peers per response")
 	syncListen := flag.String("sync-listen", ":9090", "address to listen for sync messages, e.g. :9090")
 	syncPeersStr := flag.String("sync-peers", "", "comma-separated list of remote tracker addresses for sync, e.g. tracker2:9090,tracker3:9090")
 	syncInterval := flag.Int("sync-interval", 15, "sync interval in seconds")
+	cluster := flag.Bool("cluster", true, "dynamic cluster membership: -sync-peers are only seeds to join, members are discovered by gossip")
+	advertise := flag.String("advertise", "", "sync address other trackers use to reach this one (default <hostname>:<sync port>)")
+	clusterInterval := flag.Int("cluster-interval", 2, "cluster membership gossip interval in seconds")
+	antiEntropyInterval := flag.Int("anti-entropy-interval", 60, "anti-entropy (Merkle tree comparison) interval in seconds, 0 to disable")
+	udpListen := flag.String("udp-listen", ":8080", "address to listen for UDP tracker requests (BEP 15), empty to disable")
+	syncKey := flag.String("sync-key", "", "Ed25519 private key file for signing sync messages (PEM or base64 seed); default $TRACKER_SYNC_KEY")
+	syncTrust := flag.String("sync-trust", "", "trusted tracker keys file, one \"<node_id> <base64 public key>\" per line; default $TRACKER_SYNC_TRUST (node=key,...)")
+	genKey := flag.String("gen-key", "", "generate an Ed25519 private key at this path, print its trust line and exit")
+	shard := flag.Bool("shard", false, "shard swarms across cluster members with a consistent hash ring (requires -cluster)")
+	shardReplicas := flag.Int("shard-replicas", 2, "trackers that own (store and replicate) each swarm in sharded mode")
+	shardVnodes := flag.Int("shard-vnodes", 64, "virtual nodes per tracker on the hash ring")
+	shardRedirect := flag.Bool("shard-redirect", false, "redirect announces for swarms owned by other trackers (307) instead of proxying them")
+	announceURL := flag.String("announce-url", "", "base URL other trackers use to reach this tracker's HTTP announce (default http://<hostname>:<listen port>)")
+	logOpts := logging.RegisterFlags(nil)
 	flag.Parse()
 
+	if err := logging.Setup(*logOpts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	// Obtener hostname del contenedor como node-id (automático con Docker)
 	nodeID, err := os.Hostname()
 	if err != nil {
-		log.Fatalf("failed to get hostname: %v", err)
+		fatal("failed to get hostname", err)
+	}
+
+	if *genKey != "" {
+		pub, err := tracker.GenerateKeyFile(*genKey)
+		if err != nil {
+			fatal("failed to generate key", err)
+		}
+		fmt.Printf("%s %s\n", nodeID, tracker.EncodePublicKey(pub))
+		return
 	}
 
 	// Usar hostname como nombre del archivo de datos (automático)
@@ -59,33 +109,87 @@ func main() {
 		remotePeers,
 	)
 
-	log.Printf("Tracker node-id: %s, data: %s", nodeID, dataPath)
+	log.Info("tracker node", "node_id", nodeID, "data", dataPath)
 
 	// Carga estado previo desde disco si existe.
 	if err := t.LoadFromFile(); err != nil {
-		log.Fatalf("load failed: %v", err)
+		fatal("load failed", err)
 	}
 
-	// Iniciar sincronización distribuida si hay peers remotos
-	if len(remotePeers) > 0 {
-		log.Printf("Starting distributed sync with %d peers", len(remotePeers))
+	if *shard && !*cluster {
+		fatal("invalid flags", fmt.Errorf("-shard requires -cluster"))
+	}
+
+	// Iniciar sincronización distribuida si hay peers remotos o membresía
+	// dinámica (otros trackers pueden unirse a través de este)
+	if len(remotePeers) > 0 || *cluster {
+		log.Info("starting distributed sync", "peers", len(remotePeers), "cluster", *cluster)
 
-		// Log de estado de seguridad
-		tracker.LogSecurityStatus()
+		// Claves de sincronización y log de estado de seguridad
+		if err := t.LoadKeys(tracker.KeyOptions{KeyFile: *syncKey, TrustFile: *syncTrust}); err != nil {
+			fatal("failed to load sync keys", err)
+		}
+		t.LogSecurityStatus()
 
 		// Iniciar listener de sincronización
 		if err := t.StartSyncListener(*syncListen); err != nil {
-			log.Fatalf("failed to start sync listener: %v", err)
+			fatal("failed to start sync listener", err)
+		}
+
+		if *cluster {
+			if *advertise == "" {
+				_, port, _ := net.SplitHostPort(t.SyncAddr())
+				*advertise = net.JoinHostPort(nodeID, port)
+			}
+			if *announceURL == "" {
+				_, port, _ := net.SplitHostPort(*listen)
+				*announceURL = "http://" + net.JoinHostPort(nodeID, port)
+			}
+			err := t.StartCluster(tracker.ClusterOptions{
+				Advertise: *advertise,
+				Announce:  *announceURL,
+				Seeds:     remotePeers,
+				Interval:  time.Duration(*clusterInterval) * time.Second,
+			})
+			if err != nil {
+				fatal("failed to start cluster membership", err)
+			}
+		}
+
+		// Modo sharded: cada swarm lo guardan y replican sólo sus dueños
+		if *shard {
+			err := t.EnableSharding(tracker.ShardOptions{
+				Replicas:     *shardReplicas,
+				VirtualNodes: *shardVnodes,
+				Redirect:     *shardRedirect,
+			})
+			if err != nil {
+				fatal("failed to enable sharding", err)
+			}
 		}
 
 		// Iniciar manager de sincronización periódica
 		t.StartSyncManager(time.Duration(*syncInterval) * time.Second)
+
+		// Anti-entropía: repara divergencias que el push no corrige (particiones)
+		if *antiEntropyInterval > 0 {
+			t.StartAntiEntropy(time.Duration(*antiEntropyInterval) * time.Second)
+		}
 	}
 
 	// Registra el handler /announce del tracker.
 	http.HandleFunc("/announce", t.AnnounceHandler)
 	// Registra el handler /scrape del tracker.
 	http.HandleFunc("/scrape", t.ScrapeHandler)
+	// Miembros del cluster y conjunto vivo al que se sincroniza.
+	http.HandleFunc("/cluster", t.ClusterHandler)
+
+	// Tracker UDP (BEP 15): comparte swarms y persistencia con el HTTP
+	if *udpListen != "" {
+		if err := t.StartUDPListener(*udpListen); err != nil {
+			fatal("failed to start udp listener", err)
+		}
+	}
 
 	// GC loop
 	// Bucle en background que expira peers inactivos periódicamente y persiste
@@ -96,8 +200,28 @@ func main() {
 		for range ticker.C {
 			if exp := t.GC(); exp > 0 {
 				_ = t.SaveToFile()
-				log.Printf("gc expired %d peers", exp)
+				log.Info("gc expired peers", "peers", exp)
+			}
+		}
+	}()
+
+	// SIGHUP recarga las claves (rotación sin reiniciar); al cerrar, avisar
+	// al cluster que nos vamos y guardar el estado
+	go func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		for sig := range sigCh {
+			if sig == syscall.SIGHUP {
+				if err := t.ReloadKeys(); err != nil {
+					log.Error("failed to reload sync keys, keeping the previous ones", logging.Err(err))
+				}
+				continue
 			}
+			log.Info("signal received, shutting down", "signal", sig.String())
+			t.LeaveCluster()
+			t.StopSync()
+			_ = t.SaveToFile()
+			os.Exit(0)
 		}
 	}()
 
@@ -114,8 +238,8 @@ func main() {
 	// }
 
 	// Arranca el servidor HTTP del tracker.
-	log.Printf("tracker listening on %s interval=%ds", *listen, *interval)
+	log.Info("tracker listening", "addr", *listen, "interval", time.Duration(*interval)*time.Second)
 	if err := http.ListenAndServe(*listen, nil); err != nil {
-		log.Fatal(err)
+		fatal("http server failed", err)
 	}
 }
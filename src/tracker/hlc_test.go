@@ -0,0 +1,78 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHLCLocalEventsAreMonotonic(t *testing.T) {
+	h := NewHLC("a")
+	prev := h.Clone()
+	for i := 0; i < 1000; i++ {
+		h.Update(nil)
+		if !h.After(prev) {
+			t.Fatalf("%v no es posterior a %v", h, &prev)
+		}
+		prev = h.Clone()
+	}
+}
+
+func TestHLCReceiveFromFuture(t *testing.T) {
+	h := NewHLC("a")
+	future := HLC{PhysicalTime: time.Now().Add(time.Hour).UnixMilli(), LogicalTime: 7, NodeID: "b"}
+	h.Update(&future)
+	if !h.After(future) {
+		t.Fatalf("después de recibir %v el reloj quedó en %v", &future, h)
+	}
+	if h.PhysicalTime != future.PhysicalTime || h.LogicalTime != 8 {
+		t.Fatalf("se esperaba adoptar el tiempo del mensaje: %v", h)
+	}
+}
+
+func TestHLCOrder(t *testing.T) {
+	a := HLC{PhysicalTime: 10, LogicalTime: 1, NodeID: "a"}
+	cases := []struct {
+		b     HLC
+		after bool // b.After(a)
+	}{
+		{HLC{PhysicalTime: 11, LogicalTime: 0, NodeID: "a"}, true},
+		{HLC{PhysicalTime: 9, LogicalTime: 5, NodeID: "z"}, false},
+		{HLC{PhysicalTime: 10, LogicalTime: 2, NodeID: "a"}, true},
+		{HLC{PhysicalTime: 10, LogicalTime: 1, NodeID: "b"}, true}, // desempate por nodo
+		{HLC{PhysicalTime: 10, LogicalTime: 1, NodeID: "a"}, false},
+	}
+	for _, c := range cases {
+		if got := c.b.After(a); got != c.after {
+			t.Errorf("%v.After(%v) = %v", &c.b, &a, got)
+		}
+		if c.b.Equal(a) {
+			continue
+		}
+		if got := a.Before(c.b); got != c.after {
+			t.Errorf("%v.Before(%v) = %v", &a, &c.b, got)
+		}
+	}
+}
+
+func TestGCTombstones(t *testing.T) {
+	tr := New(time.Second, 50*time.Millisecond, 50, "", "a", nil)
+	const ih, pid = "aa", "bb"
+	tr.AddPeer(ih, pid, "10.0.0.1", 1, "", false)
+	if tr.GC() != 0 {
+		t.Fatal("GC expiró un peer activo")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if tr.GC() != 1 || len(tr.GetPeers(ih, "", 10)) != 0 {
+		t.Fatal("el peer inactivo no pasó a tombstone")
+	}
+	if tr.Torrents[ih].Peers[pid] == nil {
+		t.Fatal("el tombstone se borró antes de tiempo")
+	}
+
+	time.Sleep(110 * time.Millisecond)
+	tr.GC()
+	if _, ok := tr.Torrents[ih]; ok {
+		t.Fatal("el tombstone viejo no se eliminó")
+	}
+}
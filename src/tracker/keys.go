@@ -0,0 +1,334 @@
+package tracker
+
+// tracker/keys.go
+// Claves Ed25519 por tracker para firmar la sincronización: cada tracker
+// firma con su clave privada y acepta sólo mensajes de nodos cuya clave
+// pública está en su lista de confianza. Una lista puede tener varias claves
+// por nodo, así una clave se rota sin cortar la sincronización:
+//
+//  1. generar la clave nueva (tracker -gen-key nueva.pem)
+//  2. agregar su clave pública a la lista de confianza de los demás, junto a
+//     la vieja, y recargar (SIGHUP)
+//  3. apuntar -sync-key a la clave nueva en el tracker y recargar
+//  4. quitar la clave pública vieja de las listas y recargar
+//
+// Sin claves configuradas se usa el HMAC con SHARED_SECRET (modo legacy).
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// variables de entorno usadas si no se pasan archivos
+	envSyncKey   = "TRACKER_SYNC_KEY"   // clave privada: PEM o base64 de la semilla
+	envSyncTrust = "TRACKER_SYNC_TRUST" // "nodo=clave,nodo=clave"
+
+	ed25519SigPrefix = "ed25519:"
+)
+
+var (
+	errMissingSignature = errors.New("missing signature")
+	errInvalidSignature = errors.New("invalid signature")
+	errUntrustedNode    = errors.New("untrusted node")
+	errReplay           = errors.New("replayed or stale message")
+)
+
+// KeyOptions indica de dónde cargar las claves de sincronización
+type KeyOptions struct {
+	KeyFile   string // clave privada Ed25519 (PEM PKCS#8 o base64 de la semilla); vacío = $TRACKER_SYNC_KEY
+	TrustFile string // líneas "<node_id> <clave pública base64>"; vacío = $TRACKER_SYNC_TRUST
+}
+
+// keyring guarda la clave de firma del tracker y las claves públicas en las
+// que confía
+type keyring struct {
+	mu    sync.RWMutex
+	opts  KeyOptions
+	priv  ed25519.PrivateKey             // nil: modo legacy (HMAC)
+	trust map[string][]ed25519.PublicKey // node_id -> claves aceptadas
+}
+
+func newKeyring() *keyring {
+	return &keyring{trust: make(map[string][]ed25519.PublicKey)}
+}
+
+// legacy indica si no hay claves configuradas y se firma con HMAC
+func (k *keyring) legacy() bool {
+	return k.priv == nil && len(k.trust) == 0
+}
+
+// sign firma payload con la clave del tracker
+func (k *keyring) sign(payload []byte) string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.priv == nil {
+		return SignMessage(payload)
+	}
+	return ed25519SigPrefix + base64.StdEncoding.EncodeToString(ed25519.Sign(k.priv, payload))
+}
+
+// verify valida que from firmó payload con alguna de sus claves de confianza
+func (k *keyring) verify(from string, payload []byte, sig string) error {
+	if sig == "" {
+		return errMissingSignature
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	raw, ok := strings.CutPrefix(sig, ed25519SigPrefix)
+	if !ok {
+		// HMAC: sólo mientras no haya claves configuradas
+		if k.legacy() && ValidateSignature(payload, sig) {
+			return nil
+		}
+		return errInvalidSignature
+	}
+	keys := k.trust[from]
+	if len(keys) == 0 {
+		return errUntrustedNode
+	}
+	b, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return errInvalidSignature
+	}
+	for _, pub := range keys {
+		if ed25519.Verify(pub, payload, b) {
+			return nil
+		}
+	}
+	return errInvalidSignature
+}
+
+// load lee la clave privada y la lista de confianza de opts (o del entorno)
+func (k *keyring) load(opts KeyOptions) error {
+	priv, err := loadPrivateKey(opts.KeyFile)
+	if err != nil {
+		return err
+	}
+	trust, err := loadTrustList(opts.TrustFile)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	k.opts, k.priv, k.trust = opts, priv, trust
+	k.mu.Unlock()
+	return nil
+}
+
+// LoadKeys carga la clave privada y la lista de confianza de la
+// sincronización. Con ambas vacías (y sin variables de entorno) el tracker
+// sigue en modo legacy con HMAC.
+func (t *Tracker) LoadKeys(opts KeyOptions) error {
+	return t.keys.load(opts)
+}
+
+// ReloadKeys vuelve a leer los archivos (o variables de entorno) de LoadKeys;
+// si fallan se mantienen las claves anteriores.
+func (t *Tracker) ReloadKeys() error {
+	t.keys.mu.RLock()
+	opts := t.keys.opts
+	t.keys.mu.RUnlock()
+	if err := t.keys.load(opts); err != nil {
+		return err
+	}
+	securityLog.Info("sync keys reloaded")
+	t.LogSecurityStatus()
+	return nil
+}
+
+// SetSigningKey cambia la clave con la que firma el tracker
+func (t *Tracker) SetSigningKey(priv ed25519.PrivateKey) {
+	t.keys.mu.Lock()
+	t.keys.priv = priv
+	t.keys.mu.Unlock()
+}
+
+// TrustKey agrega una clave pública aceptada para el nodo
+func (t *Tracker) TrustKey(nodeID string, pub ed25519.PublicKey) {
+	t.keys.mu.Lock()
+	t.keys.trust[nodeID] = append(t.keys.trust[nodeID], pub)
+	t.keys.mu.Unlock()
+}
+
+// UntrustKey quita una clave pública del nodo
+func (t *Tracker) UntrustKey(nodeID string, pub ed25519.PublicKey) {
+	t.keys.mu.Lock()
+	defer t.keys.mu.Unlock()
+	keys := t.keys.trust[nodeID][:0]
+	for _, k := range t.keys.trust[nodeID] {
+		if !k.Equal(pub) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		delete(t.keys.trust, nodeID)
+		return
+	}
+	t.keys.trust[nodeID] = keys
+}
+
+// LogSecurityStatus registra cómo se autentica la sincronización.
+func (t *Tracker) LogSecurityStatus() {
+	t.keys.mu.RLock()
+	defer t.keys.mu.RUnlock()
+	if t.keys.legacy() {
+		LogSecurityStatus()
+		securityLog.Warn("no sync keys configured, using the shared HMAC secret (see -sync-key and -sync-trust)")
+		return
+	}
+	attrs := []any{"trusted_nodes", len(t.keys.trust)}
+	if t.keys.priv != nil {
+		attrs = append(attrs, "key_fingerprint", KeyFingerprint(t.keys.priv.Public().(ed25519.PublicKey)))
+	} else {
+		securityLog.Warn("no sync signing key: other trackers will reject our messages")
+	}
+	securityLog.Info("Ed25519 authentication enabled for tracker sync", attrs...)
+}
+
+// KeyFingerprint es un identificador corto de una clave pública para logs
+func KeyFingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// EncodePublicKey devuelve la clave pública en base64, como va en la lista de confianza
+func EncodePublicKey(pub ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(pub)
+}
+
+// ParsePublicKey lee una clave pública en base64
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 public key %q", s)
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// ParsePrivateKey lee una clave privada en PEM (PKCS#8, como la de
+// `openssl genpkey -algorithm ed25519`) o en base64 (semilla de 32 bytes o
+// clave de 64)
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		priv, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("PEM key is not Ed25519")
+		}
+		return priv, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, errors.New("private key is neither PEM nor base64")
+	}
+	switch len(b) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(b), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(b), nil
+	}
+	return nil, fmt.Errorf("invalid Ed25519 private key length %d", len(b))
+}
+
+// GenerateKeyFile crea una clave privada nueva en path (PEM PKCS#8, 0600) y
+// devuelve su clave pública
+func GenerateKeyFile(path string) (ed25519.PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// loadPrivateKey lee la clave de path o, si está vacío, de $TRACKER_SYNC_KEY
+// (nil si no hay ninguna)
+func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	var data []byte
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	} else if env := os.Getenv(envSyncKey); env != "" {
+		data = []byte(env)
+	} else {
+		return nil, nil
+	}
+	priv, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("sync key: %w", err)
+	}
+	return priv, nil
+}
+
+// loadTrustList lee la lista de confianza de path o, si está vacío, de
+// $TRACKER_SYNC_TRUST
+func loadTrustList(path string) (map[string][]ed25519.PublicKey, error) {
+	trust := make(map[string][]ed25519.PublicKey)
+	add := func(entry, sep string) error {
+		nodeID, key, ok := strings.Cut(strings.TrimSpace(entry), sep)
+		if !ok {
+			return fmt.Errorf("invalid trust entry %q", entry)
+		}
+		pub, err := ParsePublicKey(key)
+		if err != nil {
+			return err
+		}
+		nodeID = strings.TrimSpace(nodeID)
+		trust[nodeID] = append(trust[nodeID], pub)
+		return nil
+	}
+
+	if path == "" {
+		for _, entry := range strings.Split(os.Getenv(envSyncTrust), ",") {
+			if strings.TrimSpace(entry) == "" {
+				continue
+			}
+			if err := add(entry, "="); err != nil {
+				return nil, fmt.Errorf("%s: %w", envSyncTrust, err)
+			}
+		}
+		return trust, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := add(strings.Join(strings.Fields(line), " "), " "); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+	}
+	return trust, sc.Err()
+}
@@ -0,0 +1,141 @@
+package tracker
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplayGuard(t *testing.T) {
+	g := newReplayGuard()
+	now := time.Now().UnixMilli()
+	at := func(ms int64) HLC { return HLC{PhysicalTime: now + ms, NodeID: "a"} }
+
+	if !g.accept("a", at(0), "n1") {
+		t.Fatal("primer mensaje rechazado")
+	}
+	if g.accept("a", at(0), "n1") {
+		t.Fatal("nonce repetido aceptado")
+	}
+	if !g.accept("a", at(5000), "n2") {
+		t.Fatal("mensaje más nuevo rechazado")
+	}
+	// desordenado pero dentro de la ventana
+	if !g.accept("a", at(1000), "n3") {
+		t.Fatal("mensaje dentro de la ventana rechazado")
+	}
+	if g.accept("a", at(5000-replayWindow.Milliseconds()-1), "n4") {
+		t.Fatal("mensaje más viejo que la ventana aceptado")
+	}
+	if g.accept("a", at(6000), "") {
+		t.Fatal("mensaje sin nonce aceptado")
+	}
+	// cada nodo tiene su propio registro
+	if !g.accept("b", at(0), "n1") {
+		t.Fatal("nonce de otro nodo rechazado")
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	pub1, priv1, _ := ed25519.GenerateKey(rand.Reader)
+	pub2, priv2, _ := ed25519.GenerateKey(rand.Reader)
+	a := New(time.Second, 2*time.Second, 50, "", "a", nil)
+	b := New(time.Second, 2*time.Second, 50, "", "b", nil)
+
+	// sin claves: HMAC legacy
+	msg := a.NewSyncMessage()
+	if err := a.seal(msg, &msg.Nonce, &msg.Signature); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.open(msg, "a", msg.Timestamp, msg.Nonce, &msg.Signature); err != nil {
+		t.Fatalf("legacy: %v", err)
+	}
+	if err := b.open(msg, "a", msg.Timestamp, msg.Nonce, &msg.Signature); !errors.Is(err, errReplay) {
+		t.Fatalf("repetición: %v, se esperaba errReplay", err)
+	}
+
+	// con claves, HMAC ya no se acepta y sólo vale la clave de confianza del nodo
+	a.SetSigningKey(priv1)
+	b.TrustKey("a", pub1)
+	legacy := a.NewSyncMessage()
+	legacy.Nonce = newNonce()
+	legacy.Signature = ""
+	legacy.Signature = SignMessage(mustJSON(t, legacy))
+	if err := b.open(legacy, "a", legacy.Timestamp, legacy.Nonce, &legacy.Signature); !errors.Is(err, errInvalidSignature) {
+		t.Fatalf("HMAC con claves configuradas: %v", err)
+	}
+	sealed := func() *SyncMessage {
+		m := a.NewSyncMessage()
+		if err := a.seal(m, &m.Nonce, &m.Signature); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	m := sealed()
+	if err := b.open(m, "c", m.Timestamp, m.Nonce, &m.Signature); !errors.Is(err, errUntrustedNode) {
+		t.Fatalf("nodo sin clave de confianza: %v", err)
+	}
+	m.Swarms["x"] = nil
+	if err := b.open(m, "a", m.Timestamp, m.Nonce, &m.Signature); !errors.Is(err, errInvalidSignature) {
+		t.Fatalf("mensaje alterado: %v", err)
+	}
+
+	// rotación: con las dos claves en la lista valen ambas
+	b.TrustKey("a", pub2)
+	a.SetSigningKey(priv2)
+	if m := sealed(); b.open(m, "a", m.Timestamp, m.Nonce, &m.Signature) != nil {
+		t.Fatal("clave nueva rechazada durante la rotación")
+	}
+	b.UntrustKey("a", pub2)
+	if m := sealed(); b.open(m, "a", m.Timestamp, m.Nonce, &m.Signature) == nil {
+		t.Fatal("clave quitada de la lista aceptada")
+	}
+}
+
+func TestLoadKeysFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	pubA, err := GenerateKeyFile(filepath.Join(dir, "a.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, privB, _ := ed25519.GenerateKey(rand.Reader)
+	trust := "# trackers\nb " + EncodePublicKey(privB.Public().(ed25519.PublicKey)) + "\n\na " + EncodePublicKey(pubA) + "\n"
+	os.WriteFile(filepath.Join(dir, "trust"), []byte(trust), 0o600)
+
+	tr := New(time.Second, 2*time.Second, 50, "", "a", nil)
+	if err := tr.LoadKeys(KeyOptions{KeyFile: filepath.Join(dir, "a.pem"), TrustFile: filepath.Join(dir, "trust")}); err != nil {
+		t.Fatal(err)
+	}
+	if !tr.keys.priv.Public().(ed25519.PublicKey).Equal(pubA) || len(tr.keys.trust) != 2 {
+		t.Fatalf("claves cargadas: %d nodos de confianza", len(tr.keys.trust))
+	}
+
+	// una recarga con un archivo roto mantiene las claves anteriores
+	os.WriteFile(filepath.Join(dir, "trust"), []byte("b no-es-base64\n"), 0o600)
+	if err := tr.ReloadKeys(); err == nil {
+		t.Fatal("lista de confianza inválida aceptada")
+	}
+	if len(tr.keys.trust) != 2 {
+		t.Fatal("una recarga fallida cambió las claves")
+	}
+
+	t.Setenv(envSyncKey, "")
+	t.Setenv(envSyncTrust, "b="+EncodePublicKey(privB.Public().(ed25519.PublicKey)))
+	if err := tr.LoadKeys(KeyOptions{}); err != nil || tr.keys.priv != nil || len(tr.keys.trust["b"]) != 1 {
+		t.Fatalf("claves desde el entorno: err=%v", err)
+	}
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
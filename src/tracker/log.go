@@ -0,0 +1,11 @@
+package tracker
+
+import "src/logging"
+
+// Loggers del tracker por componente; se filtran con component=<nombre>
+var (
+	log         = logging.For("tracker")
+	syncLog     = logging.For("sync")
+	udpLog      = logging.For("udp")
+	securityLog = logging.For("security")
+)
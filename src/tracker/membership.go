@@ -0,0 +1,519 @@
+package tracker
+
+// tracker/membership.go
+// Membresía dinámica del cluster de trackers: un tracker nuevo se une a
+// través de cualquier miembro (seed), la lista de miembros se difunde por
+// gossip push-pull sobre el listener de sincronización y las caídas se
+// detectan por heartbeats: sin noticias de un miembro pasa a sospechoso y
+// después a caído. Al cerrarse, un tracker avisa que se va (leave).
+//
+// Cada miembro es dueño de su versión (Incarnation, Heartbeat): la
+// incrementa en cada ronda y los demás sólo la reenvían, junto con cuánto
+// hace que la vieron cambiar, así un miembro caído no revive por gossip viejo.
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"src/logging"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemberState es el estado de un miembro visto por este tracker
+type MemberState string
+
+const (
+	MemberAlive   MemberState = "alive"   // recibe sincronización
+	MemberSuspect MemberState = "suspect" // sin noticias hace SuspectAfter; sigue recibiendo sincronización
+	MemberDead    MemberState = "dead"    // sin noticias hace DeadAfter; fuera del conjunto vivo
+	MemberLeft    MemberState = "left"    // se fue avisando
+)
+
+// ClusterOptions configura la membresía del cluster
+type ClusterOptions struct {
+	Advertise    string        // host:puerto del listener de sincronización tal como lo ven los demás
+	Announce     string        // URL base del HTTP de announce (http://host:puerto), para el modo sharded
+	Seeds        []string      // direcciones de cualquier miembro, para unirse
+	Interval     time.Duration // entre rondas de gossip; 0 = 2s
+	SuspectAfter time.Duration // sin noticias de un miembro: sospechoso; 0 = 5×Interval
+	DeadAfter    time.Duration // sin noticias: caído; 0 = 15×Interval
+	Fanout       int           // miembros contactados por ronda; 0 = 3
+}
+
+// Member es la versión de un miembro que se difunde por gossip
+type Member struct {
+	NodeID      string `json:"node_id"`
+	Addr        string `json:"addr"`               // listener de sincronización
+	Announce    string `json:"announce,omitempty"` // URL base del HTTP de announce
+	Incarnation int64  `json:"incarnation"`        // arranque del proceso (unix nanos)
+	Heartbeat   uint64 `json:"heartbeat"`
+	Left        bool   `json:"left,omitempty"`
+}
+
+// newer indica si m es una versión posterior a other del mismo miembro
+func (m Member) newer(other Member) bool {
+	if m.Incarnation != other.Incarnation {
+		return m.Incarnation > other.Incarnation
+	}
+	if m.Heartbeat != other.Heartbeat {
+		return m.Heartbeat > other.Heartbeat
+	}
+	return m.Left && !other.Left
+}
+
+// gossipMember es Member más la antigüedad de esa versión para el emisor
+type gossipMember struct {
+	Member
+	AgeMs int64 `json:"age_ms"`
+}
+
+// ClusterMessage es el cuerpo de POST /cluster/gossip y de su respuesta
+type ClusterMessage struct {
+	FromNodeID string         `json:"from_node_id"`
+	Timestamp  HLC            `json:"timestamp"`
+	Members    []gossipMember `json:"members"` // el emisor y los miembros vivos, sospechosos o que se fueron
+	Nonce      string         `json:"nonce"`
+	Signature  string         `json:"signature"`
+}
+
+// MemberStatus es un miembro tal como se muestra en /cluster
+type MemberStatus struct {
+	Member
+	State     MemberState `json:"state"`
+	LastHeard int64       `json:"last_heard_ms"` // hace cuánto cambió su heartbeat
+}
+
+// memberInfo es lo que sabemos de un miembro
+type memberInfo struct {
+	Member
+	state     MemberState
+	lastHeard time.Time // cuándo cambió su versión (estimado con el age del gossip)
+}
+
+// Cluster mantiene la lista de miembros del cluster de trackers
+type Cluster struct {
+	t      *Tracker // firma, verificación y HLC de los mensajes
+	opts   ClusterOptions
+	client *http.Client
+
+	mu      sync.Mutex
+	self    Member
+	members map[string]*memberInfo // por NodeID, sin incluirnos
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func newCluster(t *Tracker, opts ClusterOptions) *Cluster {
+	if opts.Interval <= 0 {
+		opts.Interval = 2 * time.Second
+	}
+	if opts.SuspectAfter <= 0 {
+		opts.SuspectAfter = 5 * opts.Interval
+	}
+	if opts.DeadAfter <= opts.SuspectAfter {
+		opts.DeadAfter = 15 * opts.Interval
+		if opts.DeadAfter <= opts.SuspectAfter {
+			opts.DeadAfter = 2 * opts.SuspectAfter
+		}
+	}
+	if opts.Fanout <= 0 {
+		opts.Fanout = 3
+	}
+	timeout := opts.Interval
+	if timeout < time.Second {
+		timeout = time.Second
+	}
+	return &Cluster{
+		t:       t,
+		opts:    opts,
+		client:  &http.Client{Timeout: timeout},
+		self:    Member{NodeID: t.nodeID, Addr: opts.Advertise, Announce: opts.Announce, Incarnation: time.Now().UnixNano()},
+		members: make(map[string]*memberInfo),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// StartCluster activa la membresía dinámica: los destinos de la
+// sincronización y de la anti-entropía pasan a ser los miembros vivos en
+// lugar de la lista fija de peers remotos. Requiere StartSyncListener.
+func (t *Tracker) StartCluster(opts ClusterOptions) error {
+	if t.syncListener == nil {
+		return fmt.Errorf("cluster membership requires the sync listener")
+	}
+	if opts.Advertise == "" {
+		opts.Advertise = t.SyncAddr()
+	}
+	// atómico: el push de sincronización, la anti-entropía y los handlers
+	// HTTP lo leen desde sus goroutines
+	c := newCluster(t, opts)
+	t.cluster.Store(c)
+	c.start()
+	return nil
+}
+
+// LeaveCluster avisa a los miembros vivos que este tracker se va y detiene
+// el gossip. No hace nada si la membresía no está activa.
+func (t *Tracker) LeaveCluster() {
+	if c := t.cluster.Load(); c != nil {
+		c.leave()
+	}
+}
+
+// Cluster devuelve la membresía del cluster (nil si no está activa)
+func (t *Tracker) Cluster() *Cluster { return t.cluster.Load() }
+
+// syncPeers devuelve a quién sincronizar: los miembros vivos del cluster o,
+// sin membresía dinámica, la lista fija de peers remotos
+func (t *Tracker) syncPeers() []string {
+	if c := t.cluster.Load(); c != nil {
+		return c.LiveAddrs()
+	}
+	return t.remotePeers
+}
+
+func (c *Cluster) start() {
+	syncLog.Info("cluster membership started", "node_id", c.self.NodeID, "advertise", c.self.Addr,
+		"seeds", c.opts.Seeds, "interval", c.opts.Interval)
+	go func() {
+		ticker := time.NewTicker(c.opts.Interval)
+		defer ticker.Stop()
+		c.round()
+		for {
+			select {
+			case <-ticker.C:
+				c.round()
+			case <-c.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (c *Cluster) stop() {
+	c.stopOnce.Do(func() { close(c.stopCh) })
+}
+
+// round incrementa nuestro heartbeat, actualiza los estados por timeout e
+// intercambia la lista de miembros con algunos de ellos
+func (c *Cluster) round() {
+	c.mu.Lock()
+	c.self.Heartbeat++
+	c.updateStates(time.Now())
+	targets := c.pickTargets()
+	c.mu.Unlock()
+
+	for _, addr := range targets {
+		go func(addr string) {
+			if err := c.exchange(addr); err != nil {
+				syncLog.Debug("cluster gossip failed", "remote", addr, logging.Err(err))
+			}
+		}(addr)
+	}
+}
+
+// pickTargets elige hasta Fanout miembros vivos o sospechosos al azar y uno
+// caído (para curar particiones); sin miembros vivos, los seeds
+func (c *Cluster) pickTargets() []string {
+	var live, dead []string
+	for _, m := range c.members {
+		switch m.state {
+		case MemberAlive, MemberSuspect:
+			live = append(live, m.Addr)
+		case MemberDead:
+			dead = append(dead, m.Addr)
+		}
+	}
+	rand.Shuffle(len(live), func(i, j int) { live[i], live[j] = live[j], live[i] })
+	targets := live[:min(len(live), c.opts.Fanout)]
+	if len(dead) > 0 {
+		targets = append(targets, dead[rand.Intn(len(dead))])
+	}
+	if len(live) == 0 {
+		for _, s := range c.opts.Seeds {
+			if s != "" && s != c.self.Addr {
+				targets = append(targets, s)
+			}
+		}
+	}
+	return targets
+}
+
+// updateStates pasa a sospechoso o caído a los miembros sin noticias y
+// olvida a los caídos o que se fueron hace mucho
+func (c *Cluster) updateStates(now time.Time) {
+	for id, m := range c.members {
+		silent := now.Sub(m.lastHeard)
+		switch {
+		case m.state == MemberLeft || m.state == MemberDead:
+			if silent > 3*c.opts.DeadAfter {
+				delete(c.members, id)
+			}
+		case silent > c.opts.DeadAfter:
+			m.state = MemberDead
+			syncLog.Warn("cluster member declared dead", "node_id", id, "addr", m.Addr, "silent", silent.Round(time.Millisecond))
+		case silent > c.opts.SuspectAfter && m.state == MemberAlive:
+			m.state = MemberSuspect
+			syncLog.Info("cluster member suspected", "node_id", id, "addr", m.Addr, "silent", silent.Round(time.Millisecond))
+		}
+	}
+}
+
+// message arma el gossip firmado con nuestra versión y la de los miembros
+// que no están caídos
+func (c *Cluster) message() (*ClusterMessage, error) {
+	ts := c.t.tick()
+	c.mu.Lock()
+	now := time.Now()
+	msg := &ClusterMessage{FromNodeID: c.self.NodeID, Timestamp: ts, Members: []gossipMember{{Member: c.self}}}
+	for _, m := range c.members {
+		if m.state != MemberDead {
+			msg.Members = append(msg.Members, gossipMember{Member: m.Member, AgeMs: now.Sub(m.lastHeard).Milliseconds()})
+		}
+	}
+	c.mu.Unlock()
+	return msg, c.t.seal(msg, &msg.Nonce, &msg.Signature)
+}
+
+// merge aplica las versiones recibidas que son más nuevas que las nuestras
+func (c *Cluster) merge(members []gossipMember) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for _, gm := range members {
+		if gm.NodeID == "" || gm.NodeID == c.self.NodeID || gm.Addr == "" {
+			continue
+		}
+		heard := now.Add(-time.Duration(max(gm.AgeMs, 0)) * time.Millisecond)
+		m := c.members[gm.NodeID]
+		if m != nil && !gm.newer(m.Member) {
+			continue
+		}
+		if now.Sub(heard) > c.opts.DeadAfter && !gm.Left {
+			// versión vieja: no revive al miembro ni agrega uno desconocido
+			if m != nil {
+				m.Member, m.lastHeard = gm.Member, heard
+			}
+			continue
+		}
+
+		prev := MemberState("")
+		if m == nil {
+			m = &memberInfo{}
+			c.members[gm.NodeID] = m
+		} else {
+			prev = m.state
+		}
+		m.Member = gm.Member
+		m.lastHeard = heard
+		m.state = MemberAlive
+		if gm.Left {
+			m.state = MemberLeft
+		}
+
+		switch {
+		case m.state == MemberLeft && prev != MemberLeft:
+			syncLog.Info("cluster member left", "node_id", gm.NodeID, "addr", gm.Addr)
+		case prev == "" || prev == MemberLeft:
+			syncLog.Info("cluster member joined", "node_id", gm.NodeID, "addr", gm.Addr)
+		case prev == MemberSuspect || prev == MemberDead:
+			syncLog.Info("cluster member alive again", "node_id", gm.NodeID, "addr", gm.Addr, "was", prev)
+		}
+	}
+	c.updateStates(now)
+}
+
+// exchange hace un push-pull de la lista de miembros con addr
+func (c *Cluster) exchange(addr string) error {
+	msg, err := c.message()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Post("http://"+addr+"/cluster/gossip", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var reply ClusterMessage
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return err
+	}
+	if err := c.t.open(&reply, reply.FromNodeID, reply.Timestamp, reply.Nonce, &reply.Signature); err != nil {
+		securityLog.Warn("rejected cluster gossip reply", "from", reply.FromNodeID, "remote", addr, logging.Err(err))
+		return fmt.Errorf("reply from %s: %w", addr, err)
+	}
+	c.merge(reply.Members)
+	return nil
+}
+
+// leave difunde que nos vamos a los miembros vivos y detiene el gossip
+func (c *Cluster) leave() {
+	c.stop()
+	c.mu.Lock()
+	c.self.Left = true
+	c.self.Heartbeat++
+	var targets []string
+	for _, m := range c.members {
+		if m.state == MemberAlive || m.state == MemberSuspect {
+			targets = append(targets, m.Addr)
+		}
+	}
+	c.mu.Unlock()
+
+	syncLog.Info("leaving cluster", "node_id", c.self.NodeID, "members", len(targets))
+	var wg sync.WaitGroup
+	for _, addr := range targets {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			if err := c.exchange(addr); err != nil {
+				syncLog.Debug("leave notification failed", "remote", addr, logging.Err(err))
+			}
+		}(addr)
+	}
+	wg.Wait()
+}
+
+// LiveAddrs devuelve las direcciones de los miembros vivos o sospechosos
+// (sin incluirnos), ordenadas
+func (c *Cluster) LiveAddrs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var addrs []string
+	for _, m := range c.members {
+		if m.state == MemberAlive || m.state == MemberSuspect {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// ringMembers devuelve los miembros entre los que se reparten los shards:
+// nosotros y los vivos o sospechosos
+func (c *Cluster) ringMembers() []Member {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []Member
+	if !c.self.Left {
+		out = append(out, c.self)
+	}
+	for _, m := range c.members {
+		if m.state == MemberAlive || m.state == MemberSuspect {
+			out = append(out, m.Member)
+		}
+	}
+	return out
+}
+
+// nodeAt devuelve el NodeID del miembro con esa dirección de sincronización
+func (c *Cluster) nodeAt(addr string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, m := range c.members {
+		if m.Addr == addr {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// Members devuelve todos los miembros conocidos, nosotros incluidos
+func (c *Cluster) Members() []MemberStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	self := MemberStatus{Member: c.self, State: MemberAlive}
+	if c.self.Left {
+		self.State = MemberLeft
+	}
+	out := []MemberStatus{self}
+	for _, m := range c.members {
+		out = append(out, MemberStatus{Member: m.Member, State: m.state, LastHeard: now.Sub(m.lastHeard).Milliseconds()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].NodeID < out[j].NodeID })
+	return out
+}
+
+// handleClusterGossip recibe la lista de miembros de otro tracker y responde
+// con la nuestra (push-pull)
+func (sl *SyncListener) handleClusterGossip(w http.ResponseWriter, r *http.Request) {
+	c := sl.tracker.cluster.Load()
+	if c == nil {
+		http.Error(w, "cluster membership disabled", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var msg ClusterMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if err := sl.tracker.open(&msg, msg.FromNodeID, msg.Timestamp, msg.Nonce, &msg.Signature); err != nil {
+		securityLog.Warn("rejected cluster gossip", "from", msg.FromNodeID, "remote", r.RemoteAddr, logging.Err(err))
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	c.merge(msg.Members)
+
+	reply, err := c.message()
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reply)
+}
+
+// ClusterHandler atiende GET /cluster: los miembros conocidos con su estado
+// y el conjunto vivo al que se sincroniza. En modo sharded agrega la
+// configuración del anillo y, con ?info_hash=<hex>, los dueños de ese swarm.
+func (t *Tracker) ClusterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := struct {
+		NodeID  string         `json:"node_id"`
+		Dynamic bool           `json:"dynamic"` // false: lista fija de --sync-peers
+		Live    []string       `json:"live"`
+		Members []MemberStatus `json:"members,omitempty"`
+		Shard   *shardStatus   `json:"shard,omitempty"`
+	}{NodeID: t.nodeID, Live: t.syncPeers()}
+	if c := t.cluster.Load(); c != nil {
+		resp.Dynamic = true
+		resp.Members = c.Members()
+	}
+	if ring, epoch := t.shardRing(); ring != nil {
+		opts := t.shard.opts
+		resp.Shard = &shardStatus{Replicas: opts.Replicas, VirtualNodes: opts.VirtualNodes, Redirect: opts.Redirect, Epoch: epoch}
+		if ih := strings.ToLower(r.URL.Query().Get("info_hash")); ih != "" {
+			if _, err := hex.DecodeString(ih); err != nil || len(ih) != 40 {
+				http.Error(w, "invalid info_hash (40 hex digits)", http.StatusBadRequest)
+				return
+			}
+			resp.Shard.Owners = ring.owners(ih)
+		}
+	}
+	if resp.Live == nil {
+		resp.Live = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
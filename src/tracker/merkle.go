@@ -0,0 +1,159 @@
+package tracker
+
+// tracker/merkle.go
+// Árbol de Merkle sobre el estado de los swarms para anti-entropía: cada
+// peer (infoHash, peerID, LastSeen) cae en una hoja según el hash de su
+// clave, y dos trackers con el mismo estado tienen la misma raíz. Comparando
+// nodo por nodo se encuentran las hojas que difieren sin enviar el estado.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+const (
+	merkleFanout = 16 // hijos por nodo: un dígito hex del prefijo por nivel
+	merkleDepth  = 2  // niveles bajo la raíz: 256 hojas
+)
+
+const hexDigits = "0123456789abcdef"
+
+// merkleTree guarda el hash de cada nodo por su prefijo hex ("" es la raíz,
+// los prefijos de merkleDepth dígitos son las hojas)
+type merkleTree struct {
+	nodes map[string][]byte
+}
+
+// merkleBucket devuelve la hoja donde cae el peer
+func merkleBucket(infoHash, peerID string) string {
+	sum := sha256.Sum256([]byte(infoHash + "/" + peerID))
+	return hex.EncodeToString(sum[:])[:merkleDepth]
+}
+
+// merkleEntryHash es el hash de un peer en una hoja. Como el merge es LWW por
+// LastSeen, dos trackers con el mismo HLC para el peer tienen el mismo estado.
+func merkleEntryHash(infoHash, peerID string, seen HLC) []byte {
+	h := sha256.New()
+	h.Write([]byte(infoHash))
+	h.Write([]byte{0})
+	h.Write([]byte(peerID))
+	h.Write([]byte{0})
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(seen.PhysicalTime))
+	binary.BigEndian.PutUint64(buf[8:], uint64(seen.LogicalTime))
+	h.Write(buf[:])
+	h.Write([]byte(seen.NodeID))
+	return h.Sum(nil)
+}
+
+// merkleTree arma el árbol con el estado actual de los swarms que pasan keep
+// (todos si es nil). Incluye los tombstones salvo los que ya puede borrar el
+// GC: un tracker que los borró y otro que todavía no tienen la misma raíz.
+func (t *Tracker) merkleTree(keep func(string) bool) *merkleTree {
+	t.mu.RLock()
+	horizon := t.tombstoneHorizon()
+	leaves := make(map[string][][]byte)
+	for infoHash, sw := range t.Torrents {
+		if keep != nil && !keep(infoHash) {
+			continue
+		}
+		for peerID, p := range sw.Peers {
+			if p.Deleted && horizon.After(p.LastSeen) {
+				continue
+			}
+			b := merkleBucket(infoHash, peerID)
+			leaves[b] = append(leaves[b], merkleEntryHash(infoHash, peerID, p.LastSeen))
+		}
+	}
+	t.mu.RUnlock()
+
+	tree := &merkleTree{nodes: make(map[string][]byte, 1+merkleFanout+merkleFanout*merkleFanout)}
+	tree.build("", leaves)
+	return tree
+}
+
+func (m *merkleTree) build(prefix string, leaves map[string][][]byte) []byte {
+	h := sha256.New()
+	if len(prefix) == merkleDepth {
+		entries := leaves[prefix]
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i], entries[j]) < 0 })
+		for _, e := range entries {
+			h.Write(e)
+		}
+	} else {
+		for i := 0; i < merkleFanout; i++ {
+			h.Write(m.build(prefix+hexDigits[i:i+1], leaves))
+		}
+	}
+	sum := h.Sum(nil)
+	m.nodes[prefix] = sum
+	return sum
+}
+
+// hash devuelve el hash hex del nodo
+func (m *merkleTree) hash(prefix string) string {
+	return hex.EncodeToString(m.nodes[prefix])
+}
+
+// node devuelve el hash del nodo y los de sus hijos, como se envía en /merkle
+func (m *merkleTree) node(prefix string) merkleNode {
+	n := merkleNode{Hash: m.hash(prefix)}
+	if len(prefix) < merkleDepth {
+		n.Children = make([]string, merkleFanout)
+		for i := range n.Children {
+			n.Children[i] = m.hash(prefix + hexDigits[i:i+1])
+		}
+	}
+	return n
+}
+
+// validMerklePrefix indica si p es un prefijo de nodo del árbol
+func validMerklePrefix(p string) bool {
+	if len(p) > merkleDepth {
+		return false
+	}
+	for i := 0; i < len(p); i++ {
+		if strings.IndexByte(hexDigits, p[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bucketMessage arma un SyncMessage (sin firmar) con los peers de las hojas
+// pedidas, tombstones incluidos, de los swarms que pasan keep (todos si es nil)
+func (t *Tracker) bucketMessage(leaves []string, keep func(string) bool) *SyncMessage {
+	want := make(map[string]bool, len(leaves))
+	for _, l := range leaves {
+		want[l] = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hlc.Update(nil)
+
+	swarms := make(map[string]map[string]*Peer)
+	for infoHash, sw := range t.Torrents {
+		if keep != nil && !keep(infoHash) {
+			continue
+		}
+		for peerID, p := range sw.Peers {
+			if !want[merkleBucket(infoHash, peerID)] {
+				continue
+			}
+			if swarms[infoHash] == nil {
+				swarms[infoHash] = make(map[string]*Peer)
+			}
+			swarms[infoHash][peerID] = copyPeer(p)
+		}
+	}
+	return &SyncMessage{
+		FromNodeID: t.nodeID,
+		Timestamp:  t.hlc.Clone(),
+		Swarms:     swarms,
+	}
+}
@@ -0,0 +1,76 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMerkleTreeLocatesDifference(t *testing.T) {
+	a := New(time.Second, 2*time.Second, 50, "", "a", nil)
+	b := New(time.Second, 2*time.Second, 50, "", "b", nil)
+	for i := 0; i < 200; i++ {
+		a.AddPeer(testIH, string(rune('A'+i)), "10.0.0.1", uint16(1000+i), "", false)
+	}
+	b.MergeSwarms(a.NewSyncMessage())
+
+	ta, tb := a.merkleTree(nil), b.merkleTree(nil)
+	if ta.hash("") != tb.hash("") {
+		t.Fatal("mismo estado con raíces distintas")
+	}
+
+	a.AddPeer(testIH, testPeerA, "10.0.0.9", 9999, "", false)
+	ta = a.merkleTree(nil)
+	if ta.hash("") == tb.hash("") {
+		t.Fatal("la raíz no cambió")
+	}
+	leaf := merkleBucket(testIH, testPeerA)
+	for prefix := range ta.nodes {
+		onPath := prefix == leaf[:len(prefix)]
+		if differs := ta.hash(prefix) != tb.hash(prefix); differs != onPath {
+			t.Errorf("nodo %q: difiere=%v, se esperaba %v", prefix, differs, onPath)
+		}
+	}
+
+	msg := a.bucketMessage([]string{leaf}, nil)
+	if p := msg.Swarms[testIH][testPeerA]; p == nil || p.Port != 9999 {
+		t.Fatalf("la hoja %s no trae el peer nuevo: %+v", leaf, msg.Swarms)
+	}
+	for ih, peers := range msg.Swarms {
+		for id := range peers {
+			if merkleBucket(ih, id) != leaf {
+				t.Fatalf("peer %s fuera de la hoja %s", id, leaf)
+			}
+		}
+	}
+}
+
+// Un tombstone que el GC ya puede borrar no cuenta en la raíz, y la
+// anti-entropía no lo reinserta en un tracker que ya lo borró
+func TestMerkleIgnoresExpiredTombstones(t *testing.T) {
+	a := New(time.Second, 20*time.Millisecond, 50, "", "a", nil)
+	b := New(time.Second, 20*time.Millisecond, 50, "", "b", nil)
+	a.AddPeer(testIH, testPeerA, "10.0.0.1", 1000, "", false)
+	a.RemovePeer(testIH, testPeerA)
+	b.MergeSwarms(a.NewSyncMessage())
+	if a.merkleTree(nil).hash("") != b.merkleTree(nil).hash("") {
+		t.Fatal("mismo estado con raíces distintas")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	b.GC()
+	if _, ok := b.Torrents[testIH]; ok {
+		t.Fatalf("b no borró los tombstones: %+v", b.Torrents[testIH].Peers)
+	}
+	// a todavía no corrió el GC pero su tombstone ya venció
+	if a.merkleTree(nil).hash("") != b.merkleTree(nil).hash("") {
+		t.Fatal("el tombstone vencido cambia la raíz")
+	}
+
+	leaf := merkleBucket(testIH, testPeerA)
+	if n := b.MergeSwarms(a.bucketMessage([]string{leaf}, nil)); n != 0 {
+		t.Fatalf("el merge aplicó %d tombstones vencidos", n)
+	}
+	if _, ok := b.Torrents[testIH]; ok {
+		t.Fatal("la anti-entropía reinsertó el tombstone")
+	}
+}
@@ -0,0 +1,73 @@
+package tracker
+
+// tracker/replay.go
+// Protección contra repetición de mensajes firmados entre trackers: cada
+// mensaje lleva el HLC del emisor y un nonce aleatorio. Se rechaza un mensaje
+// cuyo HLC es más viejo que el último aceptado de ese nodo menos
+// replayWindow, o cuyo nonce ya se vio dentro de la ventana. La ventana deja
+// pasar mensajes legítimos que llegan desordenados (push, gossip y
+// anti-entropía del mismo nodo viajan en paralelo).
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// replayWindow es cuánto más viejo que el último aceptado puede ser un mensaje
+const replayWindow = 30 * time.Second
+
+type replayGuard struct {
+	mu    sync.Mutex
+	nodes map[string]*replayState
+}
+
+type replayState struct {
+	last   HLC              // HLC más nuevo aceptado del nodo
+	nonces map[string]int64 // nonces aceptados dentro de la ventana -> PhysicalTime
+}
+
+func newReplayGuard() *replayGuard {
+	return &replayGuard{nodes: make(map[string]*replayState)}
+}
+
+// accept registra el mensaje (from, ts, nonce) y devuelve false si es una
+// repetición o es demasiado viejo
+func (g *replayGuard) accept(from string, ts HLC, nonce string) bool {
+	if nonce == "" {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	st := g.nodes[from]
+	if st == nil {
+		st = &replayState{nonces: make(map[string]int64)}
+		g.nodes[from] = st
+	}
+	floor := st.last.PhysicalTime - replayWindow.Milliseconds()
+	if ts.PhysicalTime < floor {
+		return false
+	}
+	if _, seen := st.nonces[nonce]; seen {
+		return false
+	}
+	st.nonces[nonce] = ts.PhysicalTime
+	if ts.After(st.last) {
+		st.last = ts
+		for n, pt := range st.nonces {
+			if pt < st.last.PhysicalTime-replayWindow.Milliseconds() {
+				delete(st.nonces, n)
+			}
+		}
+	}
+	return true
+}
+
+// newNonce devuelve un nonce aleatorio de 128 bits en hex
+func newNonce() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -25,6 +25,14 @@ func (t *Tracker) ScrapeHandler(w http.ResponseWriter, r *http.Request) {
 	raw := r.URL.RawQuery
 	hashes := raw20multi(raw, "info_hash")
 
+	// Modo sharded: el scrape de un solo torrent lo responde un dueño; con
+	// varios se responde con lo que hay localmente
+	if len(hashes) == 1 {
+		if ihHex, err := Bytes20ToHex(hashes[0]); err == nil && t.forwardAnnounce(w, r, ihHex, nil) {
+			return
+		}
+	}
+
 	// files: map con clave binaria (string de 20 bytes) -> stats
 	files := make(map[string]interface{})
 
@@ -2,14 +2,15 @@ package tracker
 
 // tracker/security.go
 // Sistema de autenticación e integridad para mensajes de sincronización entre trackers.
-// Utiliza HMAC-SHA256 para garantizar que los mensajes provienen de trackers legítimos
-// y no han sido modificados en tránsito.
+// Cada tracker firma con su clave Ed25519 (ver keys.go) y los mensajes llevan
+// HLC y nonce contra repeticiones (ver replay.go). Sin claves configuradas se
+// usa HMAC-SHA256 con un secreto compartido (modo legacy).
 
 import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
-	"log"
+	"encoding/json"
 )
 
 // SHARED_SECRET es el secreto compartido entre todos los trackers para autenticación.
@@ -70,9 +71,42 @@ func ValidateSignature(message []byte, signature string) bool {
 // LogSecurityStatus registra el estado de seguridad al iniciar el tracker.
 // Informa que la autenticación HMAC está habilitada para sync de trackers.
 func LogSecurityStatus() {
-	log.Println("[SECURITY] HMAC authentication enabled for tracker synchronization")
-	log.Println("[SECURITY] Sync messages will be signed with HMAC-SHA256")
-	log.Printf("[SECURITY] Secret fingerprint: %s...%s",
-		SHARED_SECRET[:8],
-		SHARED_SECRET[len(SHARED_SECRET)-8:])
+	securityLog.Info("HMAC-SHA256 authentication enabled for tracker sync",
+		"secret_fingerprint", SHARED_SECRET[:8]+"..."+SHARED_SECRET[len(SHARED_SECRET)-8:])
+}
+
+// seal firma un mensaje entre trackers: le asigna un nonce nuevo y firma el
+// JSON de msg con el campo signature vacío. nonce y sig apuntan a esos
+// campos de msg.
+func (t *Tracker) seal(msg any, nonce, sig *string) error {
+	*nonce = newNonce()
+	*sig = ""
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	*sig = t.keys.sign(payload)
+	return nil
+}
+
+// open valida un mensaje firmado por from (ver seal) y que no sea una
+// repetición de uno ya aceptado (ver replayGuard).
+func (t *Tracker) open(msg any, from string, ts HLC, nonce string, sig *string) error {
+	signature := *sig
+	if signature == "" {
+		return errMissingSignature
+	}
+	*sig = ""
+	payload, err := json.Marshal(msg)
+	*sig = signature
+	if err != nil {
+		return err
+	}
+	if err := t.keys.verify(from, payload, signature); err != nil {
+		return err
+	}
+	if !t.replay.accept(from, ts, nonce) {
+		return errReplay
+	}
+	return nil
 }
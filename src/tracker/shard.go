@@ -0,0 +1,323 @@
+package tracker
+
+// tracker/shard.go
+// Modo sharded: en lugar de que todos los trackers guarden y repliquen todos
+// los swarms, cada info_hash tiene Replicas dueños elegidos con un anillo de
+// hash consistente (con nodos virtuales) sobre los miembros vivos del
+// cluster. Un announce que llega a un tracker que no es dueño se reenvía
+// (proxy) o se redirige a un dueño (por UDP siempre se reenvía por HTTP), y
+// la sincronización sólo lleva cada swarm
+// a sus dueños. Cuando cambia la membresía sólo se mueven ~1/N de los shards.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"src/bencode"
+	"src/logging"
+	"strings"
+	"sync"
+	"time"
+)
+
+// forwardedHeader marca los announces reenviados por otro tracker: se
+// atienden localmente aunque el anillo de este tracker no coincida, para no
+// reenviarlos en círculo mientras las vistas de la membresía convergen
+const forwardedHeader = "X-Tracker-Forwarded"
+
+// ShardOptions configura el modo sharded
+type ShardOptions struct {
+	Replicas     int  // dueños de cada info_hash; 0 = 2
+	VirtualNodes int  // puntos de cada miembro en el anillo; 0 = 64
+	Redirect     bool // true: 307 al dueño; false: el tracker hace de proxy
+}
+
+// ringPoint es un nodo virtual: su posición en el anillo y el miembro
+type ringPoint struct {
+	hash   uint64
+	member int
+}
+
+// hashRing reparte los info_hash entre los miembros
+type hashRing struct {
+	members  []Member
+	points   []ringPoint // ordenados por hash
+	replicas int
+}
+
+// ringHash es la posición en el anillo de una clave
+func ringHash(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func newHashRing(members []Member, vnodes, replicas int) *hashRing {
+	r := &hashRing{members: members, replicas: replicas}
+	r.points = make([]ringPoint, 0, len(members)*vnodes)
+	for i, m := range members {
+		for v := 0; v < vnodes; v++ {
+			r.points = append(r.points, ringPoint{hash: ringHash(fmt.Sprintf("%s#%d", m.NodeID, v)), member: i})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i].hash < r.points[j].hash })
+	return r
+}
+
+// owners devuelve los dueños del info_hash: los primeros miembros distintos
+// recorriendo el anillo en sentido horario desde su posición
+func (r *hashRing) owners(infoHash string) []Member {
+	n := min(r.replicas, len(r.members))
+	if n == 0 {
+		return nil
+	}
+	h := ringHash(infoHash)
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	out := make([]Member, 0, n)
+	seen := make(map[int]bool, n)
+	for i := 0; len(out) < n; i++ {
+		p := r.points[(start+i)%len(r.points)]
+		if !seen[p.member] {
+			seen[p.member] = true
+			out = append(out, r.members[p.member])
+		}
+	}
+	return out
+}
+
+// owns indica si nodeID es uno de los dueños del info_hash
+func (r *hashRing) owns(infoHash, nodeID string) bool {
+	return slices.ContainsFunc(r.owners(infoHash), func(m Member) bool { return m.NodeID == nodeID })
+}
+
+// sharding es el estado del modo sharded. El anillo se reconstruye cuando
+// cambia el conjunto de miembros vivos; epoch cuenta esos cambios.
+type sharding struct {
+	opts   ShardOptions
+	client *http.Client
+
+	mu    sync.Mutex
+	key   string // miembros del anillo actual
+	ring  *hashRing
+	epoch uint64
+}
+
+// EnableSharding activa el modo sharded. Requiere la membresía dinámica
+// (StartCluster): el anillo se arma con sus miembros vivos.
+func (t *Tracker) EnableSharding(opts ShardOptions) error {
+	if t.cluster.Load() == nil {
+		return fmt.Errorf("sharding requires cluster membership")
+	}
+	if opts.Replicas <= 0 {
+		opts.Replicas = 2
+	}
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = 64
+	}
+	t.shard = &sharding{opts: opts, client: &http.Client{Timeout: 5 * time.Second}}
+	log.Info("sharding enabled", "replicas", opts.Replicas, "virtual_nodes", opts.VirtualNodes, "redirect", opts.Redirect)
+	return nil
+}
+
+// shardRing devuelve el anillo con los miembros vivos actuales y su epoch
+// (nil si el modo sharded no está activo)
+func (t *Tracker) shardRing() (*hashRing, uint64) {
+	s := t.shard
+	if s == nil {
+		return nil, 0
+	}
+	members := t.cluster.Load().ringMembers()
+	sort.Slice(members, func(i, j int) bool { return members[i].NodeID < members[j].NodeID })
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = m.NodeID + "=" + m.Announce
+	}
+	key := strings.Join(ids, ",")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ring == nil || key != s.key {
+		s.ring = newHashRing(members, s.opts.VirtualNodes, s.opts.Replicas)
+		s.key = key
+		s.epoch++
+		log.Info("shard ring updated", "members", len(members), "epoch", s.epoch)
+	}
+	return s.ring, s.epoch
+}
+
+// ShardOwners devuelve los dueños del info_hash (hex); nil si el modo
+// sharded no está activo
+func (t *Tracker) ShardOwners(infoHash string) []Member {
+	ring, _ := t.shardRing()
+	if ring == nil {
+		return nil
+	}
+	return ring.owners(infoHash)
+}
+
+// ownerFilter devuelve qué swarms le corresponden al tracker nodeID (los que
+// tiene como dueño); nil si todos
+func ownerFilter(ring *hashRing, nodeID string) func(infoHash string) bool {
+	if ring == nil {
+		return nil
+	}
+	return func(infoHash string) bool { return ring.owns(infoHash, nodeID) }
+}
+
+// sharedFilter devuelve los swarms de los que somos dueños junto con nodeID;
+// nil si todos
+func (t *Tracker) sharedFilter(nodeID string) func(infoHash string) bool {
+	ring, _ := t.shardRing()
+	if ring == nil {
+		return nil
+	}
+	return func(infoHash string) bool { return ring.owns(infoHash, t.nodeID) && ring.owns(infoHash, nodeID) }
+}
+
+// filterSwarms deja en msg sólo los swarms que pasan keep
+func filterSwarms(msg *SyncMessage, keep func(string) bool) {
+	if keep == nil {
+		return
+	}
+	for infoHash := range msg.Swarms {
+		if !keep(infoHash) {
+			delete(msg.Swarms, infoHash)
+		}
+	}
+}
+
+// forwardAnnounce envía el announce (o scrape) a un dueño del info_hash si
+// este tracker no lo es: con redirect responde 307, si no lo reenvía y copia
+// la respuesta. Devuelve false si hay que atenderlo localmente: modo sharded
+// inactivo, somos dueños, ya viene reenviado o ningún dueño responde.
+func (t *Tracker) forwardAnnounce(w http.ResponseWriter, r *http.Request, infoHex string, ip net.IP) bool {
+	if r.Header.Get(forwardedHeader) != "" {
+		return false
+	}
+	owners := t.remoteOwners(infoHex)
+	if owners == nil {
+		return false
+	}
+
+	query := r.URL.RawQuery
+	vals, _ := url.ParseQuery(query)
+	if ip != nil && vals.Get("ip") == "" && vals.Get("hostname") == "" {
+		// el dueño vería nuestra IP en lugar de la del cliente
+		query += "&ip=" + url.QueryEscape(ip.String())
+	}
+	for _, owner := range owners {
+		if owner.Announce == "" {
+			continue
+		}
+		base := strings.TrimRight(owner.Announce, "/") + r.URL.Path
+		if t.shard.opts.Redirect {
+			log.Debug("redirecting to shard owner", logging.InfoHashHex(infoHex), "owner", owner.NodeID)
+			http.Redirect(w, r, base+"?"+r.URL.RawQuery, http.StatusTemporaryRedirect)
+			return true
+		}
+		if err := t.proxyTo(w, base+"?"+query); err != nil {
+			log.Warn("shard owner unreachable", logging.InfoHashHex(infoHex), "owner", owner.NodeID, logging.Err(err))
+			continue
+		}
+		log.Debug("announce proxied to shard owner", logging.InfoHashHex(infoHex), "owner", owner.NodeID)
+		return true
+	}
+	log.Warn("no shard owner reachable, serving locally", logging.InfoHashHex(infoHex))
+	return false
+}
+
+// forwardUDP reenvía por HTTP a un dueño del info_hash un announce o scrape
+// que llegó por UDP (path "/announce" o "/scrape") y devuelve la respuesta
+// bencode del dueño. BEP 15 no tiene redirect, así que también en modo
+// redirect el tracker hace de proxy. Devuelve false si hay que atenderlo
+// localmente: modo sharded inactivo, somos dueños o ningún dueño responde.
+func (t *Tracker) forwardUDP(infoHex, path string, query url.Values) (map[string]interface{}, bool) {
+	owners := t.remoteOwners(infoHex)
+	if owners == nil {
+		return nil, false
+	}
+	for _, owner := range owners {
+		if owner.Announce == "" {
+			continue
+		}
+		resp, body, err := t.ownerGet(strings.TrimRight(owner.Announce, "/") + path + "?" + query.Encode())
+		var reply map[string]interface{}
+		if err == nil {
+			// un rechazo del dueño (failure reason, status 400) también se
+			// devuelve al cliente
+			if reply, err = bencode.Decode(bytes.NewReader(body)); err != nil {
+				err = fmt.Errorf("status %d: %w", resp.StatusCode, err)
+			}
+		}
+		if err != nil {
+			log.Warn("shard owner unreachable", logging.InfoHashHex(infoHex), "owner", owner.NodeID, logging.Err(err))
+			continue
+		}
+		udpLog.Debug("request proxied to shard owner", logging.InfoHashHex(infoHex), "owner", owner.NodeID, "path", path)
+		return reply, true
+	}
+	log.Warn("no shard owner reachable, serving locally", logging.InfoHashHex(infoHex))
+	return nil, false
+}
+
+// remoteOwners devuelve los dueños del info_hash si el modo sharded está
+// activo y este tracker no es uno de ellos; nil si lo atiende este tracker
+func (t *Tracker) remoteOwners(infoHex string) []Member {
+	if t.shard == nil {
+		return nil
+	}
+	ring, _ := t.shardRing()
+	owners := ring.owners(infoHex)
+	if slices.ContainsFunc(owners, func(m Member) bool { return m.NodeID == t.nodeID }) {
+		return nil
+	}
+	return owners
+}
+
+// ownerGet hace el GET a target marcado como reenviado y lee la respuesta
+func (t *Tracker) ownerGet(target string) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set(forwardedHeader, t.nodeID)
+	resp, err := t.shard.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// proxyTo hace el GET a target y copia la respuesta en w
+func (t *Tracker) proxyTo(w http.ResponseWriter, target string) error {
+	resp, body, err := t.ownerGet(target)
+	if err != nil {
+		return err
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(body)
+	return nil
+}
+
+// shardStatus es la parte de /cluster del modo sharded
+type shardStatus struct {
+	Replicas     int      `json:"replicas"`
+	VirtualNodes int      `json:"virtual_nodes"`
+	Redirect     bool     `json:"redirect"`
+	Epoch        uint64   `json:"epoch"`
+	Owners       []Member `json:"owners,omitempty"` // con ?info_hash=<hex>
+}
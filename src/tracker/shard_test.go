@@ -0,0 +1,86 @@
+package tracker
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func ringOf(ids ...string) *hashRing {
+	members := make([]Member, len(ids))
+	for i, id := range ids {
+		members[i] = Member{NodeID: id}
+	}
+	return newHashRing(members, 64, 2)
+}
+
+func randomInfoHashes(n int) []string {
+	rng := rand.New(rand.NewSource(1))
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("%016x%016x%08x", rng.Uint64(), rng.Uint64(), rng.Uint32())
+	}
+	return out
+}
+
+func ownerIDs(r *hashRing, infoHash string) string {
+	s := ""
+	for _, m := range r.owners(infoHash) {
+		s += m.NodeID + ","
+	}
+	return s
+}
+
+func TestHashRingOwners(t *testing.T) {
+	r := ringOf("a", "b", "c", "d")
+	// el orden de los miembros no cambia el anillo
+	same := ringOf("d", "b", "a", "c")
+	load := map[string]int{}
+	for _, ih := range randomInfoHashes(4000) {
+		owners := r.owners(ih)
+		if len(owners) != 2 || owners[0].NodeID == owners[1].NodeID {
+			t.Fatalf("%s: dueños %v", ih, owners)
+		}
+		if ownerIDs(r, ih) != ownerIDs(same, ih) {
+			t.Fatalf("%s: dueños distintos según el orden de los miembros", ih)
+		}
+		for _, m := range owners {
+			load[m.NodeID]++
+		}
+	}
+	// 8000 réplicas entre 4 miembros: ~2000 cada uno
+	for id, n := range load {
+		if n < 1500 || n > 2500 {
+			t.Fatalf("miembro %s con %d réplicas, reparto desparejo: %v", id, n, load)
+		}
+	}
+
+	if got := ringOf("a").owners(testIH); len(got) != 1 {
+		t.Fatalf("con un miembro: %v", got)
+	}
+	if got := ringOf().owners(testIH); got != nil {
+		t.Fatalf("sin miembros: %v", got)
+	}
+}
+
+// Al agregar un miembro sólo cambian de dueño los swarms que pasan a él
+func TestHashRingMinimalMovement(t *testing.T) {
+	before := ringOf("a", "b", "c", "d")
+	after := ringOf("a", "b", "c", "d", "e")
+	moved := 0
+	hashes := randomInfoHashes(4000)
+	for _, ih := range hashes {
+		for _, m := range before.owners(ih) {
+			if !after.owns(ih, m.NodeID) {
+				moved++
+				if !after.owns(ih, "e") {
+					t.Fatalf("%s perdió a %s sin pasar al miembro nuevo", ih, m.NodeID)
+				}
+			}
+		}
+	}
+	// se espera ~2/5 de los swarms con una réplica movida
+	if moved > len(hashes)/2 {
+		t.Fatalf("%d de %d réplicas cambiaron de dueño", moved, len(hashes)*2)
+	}
+}
@@ -8,18 +8,32 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
+	"src/logging"
+	"sync"
 	"time"
 )
 
 // SyncManager maneja la sincronización periódica con otros trackers (push).
+// A cada tracker remoto le envía sólo los cambios posteriores a lo último que
+// confirmó; a los nuevos, o si el registro de cambios ya no llega tan atrás,
+// un snapshot completo.
 type SyncManager struct {
 	tracker      *Tracker
 	remotePeers  []string      // Direcciones de otros trackers
 	syncInterval time.Duration // Intervalo entre sincronizaciones
 	stopCh       chan struct{}
+
+	mu      sync.Mutex
+	remotes map[string]*remoteSync // estado de sincronización por tracker remoto
+}
+
+// remoteSync es lo que sabemos de un tracker remoto
+type remoteSync struct {
+	acked *HLC   // Timestamp del último mensaje aceptado; nil = enviar snapshot
+	busy  bool   // hay un push en curso
+	epoch uint64 // anillo de shards con el que se calculó acked
 }
 
 // SyncListener escucha conexiones entrantes de otros trackers para recibir sincronización.
@@ -27,6 +41,9 @@ type SyncListener struct {
 	tracker  *Tracker
 	listener net.Listener
 	stopCh   chan struct{}
+
+	mu      sync.Mutex
+	applied map[string]HLC // por tracker emisor: Timestamp del último mensaje aplicado
 }
 
 // NewSyncManager crea un nuevo gestor de sincronización.
@@ -36,12 +53,13 @@ func NewSyncManager(tracker *Tracker, remotePeers []string, syncInterval time.Du
 		remotePeers:  remotePeers,
 		syncInterval: syncInterval,
 		stopCh:       make(chan struct{}),
+		remotes:      make(map[string]*remoteSync),
 	}
 }
 
 // Start inicia el proceso de sincronización periódica (push a otros trackers).
 func (sm *SyncManager) Start() {
-	log.Printf("[SYNC] Starting sync manager with %d remote peers, interval=%v", len(sm.remotePeers), sm.syncInterval)
+	syncLog.Info("sync manager started", "peers", sm.targets(), "interval", sm.syncInterval)
 
 	go func() {
 		ticker := time.NewTicker(sm.syncInterval)
@@ -52,7 +70,7 @@ func (sm *SyncManager) Start() {
 			case <-ticker.C:
 				sm.pushToAllPeers()
 			case <-sm.stopCh:
-				log.Println("[SYNC] Sync manager stopped")
+				syncLog.Info("sync manager stopped")
 				return
 			}
 		}
@@ -64,32 +82,103 @@ func (sm *SyncManager) Stop() {
 	close(sm.stopCh)
 }
 
-// pushToAllPeers envía el estado actual a todos los peers remotos.
+// pushToAllPeers envía a cada peer remoto los cambios que todavía no confirmó.
+// Los mensajes se firman una sola vez y se comparten entre los remotos que
+// parten del mismo HLC (normalmente todos). En modo sharded cada remoto
+// recibe sólo los swarms de los que es dueño, y cuando cambia el anillo se
+// le vuelve a enviar un snapshot con los shards que le tocan ahora.
 func (sm *SyncManager) pushToAllPeers() {
-	msg := sm.tracker.NewSyncMessage()
+	ring, epoch := sm.tracker.shardRing()
+	signed := make(map[string]*signedSync) // HLC de partida ("" = snapshot) y destino -> mensaje
+	for _, remotePeer := range sm.targets() {
+		var keep func(string) bool
+		key := ""
+		if ring != nil {
+			nodeID, ok := sm.tracker.cluster.Load().nodeAt(remotePeer)
+			if !ok {
+				continue
+			}
+			keep = ownerFilter(ring, nodeID)
+			key = nodeID + "/"
+		}
+		since, ok := sm.begin(remotePeer, epoch)
+		if !ok {
+			continue // el push anterior todavía no terminó
+		}
+		if since != nil {
+			key += since.String()
+		}
+		s, built := signed[key]
+		if !built {
+			s = sm.buildMessage(since, keep)
+			signed[key] = s
+		}
+		if s == nil {
+			sm.finish(remotePeer, nil, false)
+			continue
+		}
+		go sm.pushToPeer(remotePeer, s)
+	}
+}
+
+// targets devuelve los trackers a los que empujar: los miembros vivos del
+// cluster o, sin membresía dinámica, la lista fija de peers remotos
+func (sm *SyncManager) targets() []string {
+	if c := sm.tracker.cluster.Load(); c != nil {
+		return c.LiveAddrs()
+	}
+	return sm.remotePeers
+}
+
+// signedSync es un SyncMessage serializado y firmado
+type signedSync struct {
+	timestamp HLC
+	body      []byte
+	sigShort  string
+}
+
+// buildMessage arma y firma el delta desde since (o un snapshot si since es
+// nil o el registro de cambios ya no llega hasta ahí) con los swarms que
+// pasan keep (todos si es nil). Devuelve nil si no hay nada que enviar o si
+// falla la serialización. Un delta sin swarms del destino se envía igual,
+// vacío, para que avance lo que confirmó.
+func (sm *SyncManager) buildMessage(since *HLC, keep func(string) bool) *signedSync {
+	var msg *SyncMessage
+	if since != nil {
+		delta, ok := sm.tracker.NewDeltaSyncMessage(*since)
+		if ok && len(delta.Swarms) == 0 {
+			return nil
+		}
+		if !ok {
+			syncLog.Info("change log truncated, sending full snapshot", "since", since.String())
+		}
+		msg = delta
+	}
+	if msg == nil {
+		msg = sm.tracker.NewSyncMessage()
+	}
+	filterSwarms(msg, keep)
 
 	// Calcular firma UNA SOLA VEZ antes de enviar a múltiples peers
 	// Esto evita race conditions cuando múltiples goroutines modifican msg.Signature
-	msg.Signature = ""
-	msgBytes, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("[SYNC] Error marshaling message for signing: %v", err)
-		return
+	if err := sm.tracker.seal(msg, &msg.Nonce, &msg.Signature); err != nil {
+		syncLog.Error("error marshaling message for signing", logging.Err(err))
+		return nil
 	}
-
-	signature := SignMessage(msgBytes)
-	msg.Signature = signature
+	signature := msg.Signature
 
 	// Serializar mensaje completo con firma (una sola vez)
 	signedMsgBytes, err := json.Marshal(msg)
 	if err != nil {
-		log.Printf("[SYNC] Error marshaling signed message: %v", err)
-		return
+		syncLog.Error("error marshaling signed message", logging.Err(err))
+		return nil
 	}
 
 	// Crear resumen de datos a enviar
 	swarmSummary := ""
+	changed := 0
 	for infoHash, peers := range msg.Swarms {
+		changed += len(peers)
 		activePeers := 0
 		for _, peer := range peers {
 			if !peer.Deleted {
@@ -107,35 +196,74 @@ func (sm *SyncManager) pushToAllPeers() {
 		swarmSummary = "empty"
 	}
 
-	log.Printf("[SYNC] Pushing to %d peers | Swarms[%s] | sig=%s...",
-		len(sm.remotePeers), swarmSummary, signature[:12])
+	syncLog.Debug("built sync message", "full", msg.Since == nil, "peers", changed, "bytes", len(signedMsgBytes),
+		"swarms", swarmSummary, "sig", signature[:12])
 
-	// Enviar el mismo mensaje firmado a todos los peers
-	for _, remotePeer := range sm.remotePeers {
-		go sm.pushToPeer(remotePeer, signedMsgBytes, signature[:16])
+	return &signedSync{timestamp: msg.Timestamp, body: signedMsgBytes, sigShort: signature[:16]}
+}
+
+// begin marca un push en curso al remoto y devuelve desde qué HLC enviarle
+// cambios (nil = snapshot). ok es false si ya hay un push en curso. Si el
+// anillo de shards cambió desde lo último confirmado, vuelve al snapshot.
+func (sm *SyncManager) begin(remotePeer string, epoch uint64) (since *HLC, ok bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	st := sm.remotes[remotePeer]
+	if st == nil {
+		st = &remoteSync{}
+		sm.remotes[remotePeer] = st
+	}
+	if st.busy {
+		return nil, false
+	}
+	if st.epoch != epoch {
+		st.acked, st.epoch = nil, epoch
+	}
+	st.busy = true
+	return st.acked, true
+}
+
+// finish termina el push al remoto. Con acked != nil avanza lo confirmado;
+// con reset vuelve a enviarle un snapshot completo en la próxima ronda.
+func (sm *SyncManager) finish(remotePeer string, acked *HLC, reset bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	st := sm.remotes[remotePeer]
+	st.busy = false
+	switch {
+	case reset:
+		st.acked = nil
+	case acked != nil:
+		st.acked = acked
 	}
 }
 
 // pushToPeer envía un mensaje de sincronización pre-firmado a un peer específico.
 // Recibe los bytes ya serializados y firmados para evitar race conditions.
-func (sm *SyncManager) pushToPeer(remotePeer string, signedMsgBytes []byte, signaturePreview string) {
+func (sm *SyncManager) pushToPeer(remotePeer string, msg *signedSync) {
 	url := fmt.Sprintf("http://%s/sync", remotePeer)
 
-	log.Printf("[SYNC] Sending signed message to %s (signature: %s...)", remotePeer, signaturePreview)
-
-	resp, err := http.Post(url, "application/json", bytes.NewReader(signedMsgBytes))
+	resp, err := http.Post(url, "application/json", bytes.NewReader(msg.body))
 	if err != nil {
-		log.Printf("[SYNC] Error pushing to %s: %v", remotePeer, err)
+		syncLog.Warn("push failed", "remote", remotePeer, "sig", msg.sigShort, logging.Err(err))
+		sm.finish(remotePeer, nil, false)
 		return
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("[SYNC] Push to %s failed with status %d", remotePeer, resp.StatusCode)
-		return
+	switch resp.StatusCode {
+	case http.StatusOK:
+		ts := msg.timestamp
+		sm.finish(remotePeer, &ts, false)
+		syncLog.Debug("push succeeded", "remote", remotePeer, "sig", msg.sigShort)
+	case http.StatusConflict:
+		// el remoto no tiene los cambios anteriores al delta (p. ej. reinició)
+		sm.finish(remotePeer, nil, true)
+		syncLog.Info("remote requested full snapshot", "remote", remotePeer)
+	default:
+		sm.finish(remotePeer, nil, false)
+		syncLog.Warn("push rejected", "remote", remotePeer, "sig", msg.sigShort, "status", resp.StatusCode)
 	}
-
-	log.Printf("[SYNC] Successfully pushed to %s", remotePeer)
 }
 
 // NewSyncListener crea un nuevo listener de sincronización.
@@ -149,15 +277,20 @@ func NewSyncListener(tracker *Tracker, listenAddr string) (*SyncListener, error)
 		tracker:  tracker,
 		listener: listener,
 		stopCh:   make(chan struct{}),
+		applied:  make(map[string]HLC),
 	}, nil
 }
 
 // Start inicia el servidor de sincronización para recibir mensajes de otros trackers.
 func (sl *SyncListener) Start() {
-	log.Printf("[SYNC] Sync listener started on %s", sl.listener.Addr().String())
+	syncLog.Info("sync listener started", "addr", sl.listener.Addr().String())
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/sync", sl.handleSync)
+	mux.HandleFunc("/merkle", sl.handleMerkle)
+	mux.HandleFunc("/merkle/entries", sl.handleMerkleEntries)
+	mux.HandleFunc("/cluster/gossip", sl.handleClusterGossip)
+	mux.HandleFunc("/cluster", sl.tracker.ClusterHandler)
 
 	server := &http.Server{
 		Handler: mux,
@@ -165,13 +298,13 @@ func (sl *SyncListener) Start() {
 
 	go func() {
 		<-sl.stopCh
-		log.Println("[SYNC] Shutting down sync listener")
+		syncLog.Info("shutting down sync listener")
 		sl.listener.Close()
 	}()
 
 	go func() {
 		if err := server.Serve(sl.listener); err != nil && err != http.ErrServerClosed {
-			log.Printf("[SYNC] Sync listener error: %v", err)
+			syncLog.Error("sync listener error", logging.Err(err))
 		}
 	}()
 }
@@ -181,6 +314,22 @@ func (sl *SyncListener) Stop() {
 	close(sl.stopCh)
 }
 
+// follows indica si un delta que parte de since no deja huecos respecto a lo
+// aplicado del tracker from
+func (sl *SyncListener) follows(from string, since HLC) bool {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	last, ok := sl.applied[from]
+	return ok && !since.After(last)
+}
+
+// markApplied registra el Timestamp del último mensaje aplicado de from
+func (sl *SyncListener) markApplied(from string, ts HLC) {
+	sl.mu.Lock()
+	sl.applied[from] = ts
+	sl.mu.Unlock()
+}
+
 // handleSync maneja las peticiones de sincronización entrantes.
 func (sl *SyncListener) handleSync(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -190,7 +339,7 @@ func (sl *SyncListener) handleSync(w http.ResponseWriter, r *http.Request) {
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("[SYNC] Error reading sync request: %v", err)
+		syncLog.Warn("error reading sync request", "remote", r.RemoteAddr, logging.Err(err))
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
@@ -198,41 +347,31 @@ func (sl *SyncListener) handleSync(w http.ResponseWriter, r *http.Request) {
 
 	var msg SyncMessage
 	if err := json.Unmarshal(body, &msg); err != nil {
-		log.Printf("[SYNC] Error unmarshaling sync message: %v", err)
+		syncLog.Warn("invalid sync message", "remote", r.RemoteAddr, logging.Err(err))
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
-	// VALIDACIÓN DE SEGURIDAD: Verificar firma HMAC
-	receivedSignature := msg.Signature
-
-	if receivedSignature == "" {
-		log.Printf("[SECURITY] ❌ Rejected sync from %s: missing signature", msg.FromNodeID)
-		http.Error(w, "Unauthorized: missing signature", http.StatusUnauthorized)
+	// VALIDACIÓN DE SEGURIDAD: firma del nodo emisor y que no sea una repetición
+	if err := sl.tracker.open(&msg, msg.FromNodeID, msg.Timestamp, msg.Nonce, &msg.Signature); err != nil {
+		securityLog.Warn("rejected sync", "from", msg.FromNodeID, "remote", r.RemoteAddr, logging.Err(err))
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 		return
 	}
 
-	// Reconstruir mensaje sin firma para validar
-	msg.Signature = ""
-	messageBytes, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("[SYNC] Error marshaling message for validation: %v", err)
-		http.Error(w, "Internal error", http.StatusInternalServerError)
-		return
-	}
+	syncLog.Debug("valid sync signature", "from", msg.FromNodeID, "swarms", len(msg.Swarms), "full", msg.Since == nil)
 
-	// Validar firma
-	if !ValidateSignature(messageBytes, receivedSignature) {
-		log.Printf("[SECURITY] ❌ Rejected sync from %s: invalid signature (potential attack)", msg.FromNodeID)
-		log.Printf("[SECURITY] Remote IP: %s", r.RemoteAddr)
-		http.Error(w, "Unauthorized: invalid signature", http.StatusUnauthorized)
+	// Un delta sólo se aplica si continúa lo último que aplicamos de ese
+	// tracker; si no (reinicio, mensajes perdidos) se pide un snapshot
+	if msg.Since != nil && !sl.follows(msg.FromNodeID, *msg.Since) {
+		syncLog.Info("delta out of sequence, requesting full snapshot", "from", msg.FromNodeID, "since", msg.Since.String())
+		http.Error(w, "Conflict: full snapshot required", http.StatusConflict)
 		return
 	}
 
-	log.Printf("[SYNC] ✅ Valid signature from %s with %d swarms", msg.FromNodeID, len(msg.Swarms))
-
 	// Hacer merge del estado recibido
 	sl.tracker.MergeSwarms(&msg)
+	sl.markApplied(msg.FromNodeID, msg.Timestamp)
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
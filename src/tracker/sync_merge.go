@@ -4,19 +4,20 @@ package tracker
 // Implementación de merge de estado usando LWW (Last Write Wins) con tombstones.
 
 import (
-	"log"
+	"src/logging"
 )
 
 // MergeSwarms procesa un mensaje de sincronización y hace merge del estado remoto
 // con el estado local usando la estrategia LWW (Last Write Wins) basada en HLC.
-func (t *Tracker) MergeSwarms(msg *SyncMessage) {
+// Devuelve la cantidad de peers que cambiaron localmente.
+func (t *Tracker) MergeSwarms(msg *SyncMessage) (applied int) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
 	// Actualizar HLC local con el timestamp del mensaje
 	t.hlc.Update(&msg.Timestamp)
 
-	log.Printf("[SYNC] Merging swarms from node %s", msg.FromNodeID)
+	syncLog.Debug("merging swarms", "from", msg.FromNodeID, "swarms", len(msg.Swarms))
 
 	// Procesar cada swarm del mensaje
 	for infoHash, remotePeers := range msg.Swarms {
@@ -25,17 +26,31 @@ func (t *Tracker) MergeSwarms(msg *SyncMessage) {
 
 		// Procesar cada peer del swarm remoto
 		for peerID, remotePeer := range remotePeers {
-			t.mergePeer(infoHash, localSwarm, peerID, remotePeer)
+			if t.mergePeer(infoHash, localSwarm, peerID, remotePeer) {
+				applied++
+			}
+		}
+		// sólo traía tombstones vencidos (ver mergePeer)
+		if len(localSwarm.Peers) == 0 {
+			delete(t.Torrents, infoHash)
 		}
 	}
+	return applied
 }
 
 // mergePeer hace merge de un peer individual usando LWW y tombstone resurrection.
-func (t *Tracker) mergePeer(infoHash string, localSwarm *Swarm, peerID string, remotePeer *Peer) {
+// Devuelve true si el estado local cambió.
+func (t *Tracker) mergePeer(infoHash string, localSwarm *Swarm, peerID string, remotePeer *Peer) bool {
 	localPeer := localSwarm.Peers[peerID]
 
 	if localPeer == nil {
-		// Caso 1: El peer no existe localmente, agregarlo (incluso si es tombstone)
+		// Caso 1: El peer no existe localmente, agregarlo (incluso si es
+		// tombstone, salvo que el GC ya lo hubiera borrado: si no, la
+		// anti-entropía lo reinsertaría en los trackers que ya lo borraron)
+		if horizon := t.tombstoneHorizon(); remotePeer.Deleted && horizon.After(remotePeer.LastSeen) {
+			syncLog.Debug("skipped expired tombstone", logging.InfoHashHex(infoHash), "peer_id", peerID)
+			return false
+		}
 		localSwarm.Peers[peerID] = &Peer{
 			PeerIDHex: remotePeer.PeerIDHex,
 			IP:        remotePeer.IP,
@@ -43,14 +58,12 @@ func (t *Tracker) mergePeer(infoHash string, localSwarm *Swarm, peerID string, r
 			LastSeen:  remotePeer.LastSeen,
 			Completed: remotePeer.Completed,
 			HostName:  remotePeer.HostName,
+			Addr6:     remotePeer.Addr6,
 			Deleted:   remotePeer.Deleted,
 		}
-		peerLabel := remotePeer.HostName
-		if peerLabel == "" {
-			peerLabel = peerID[:8] + "..."
-		}
-		log.Printf("[SYNC] Added peer %s to swarm %s (deleted=%v)", peerLabel, infoHash[:8], remotePeer.Deleted)
-		return
+		t.changes.record(t.hlc.Clone(), infoHash, peerID)
+		syncLog.Debug("added peer", logging.InfoHashHex(infoHash), "peer_id", peerID, "host", remotePeer.HostName, "deleted", remotePeer.Deleted)
+		return true
 	}
 
 	// Caso 2: El peer existe localmente, comparar timestamps (LWW)
@@ -66,12 +79,10 @@ func (t *Tracker) mergePeer(infoHash string, localSwarm *Swarm, peerID string, r
 			localPeer.LastSeen = remotePeer.LastSeen
 			localPeer.Completed = remotePeer.Completed
 			localPeer.HostName = remotePeer.HostName
-			peerLabel := remotePeer.HostName
-			if peerLabel == "" {
-				peerLabel = peerID[:8] + "..."
-			}
-			log.Printf("[SYNC] Resurrected peer %s in swarm %s", peerLabel, infoHash[:8])
-			return
+			localPeer.Addr6 = remotePeer.Addr6
+			t.changes.record(t.hlc.Clone(), infoHash, peerID)
+			syncLog.Debug("resurrected peer", logging.InfoHashHex(infoHash), "peer_id", peerID, "host", remotePeer.HostName)
+			return true
 		}
 
 		// Subcaso 2b: Actualización normal o propagación de tombstone
@@ -80,24 +91,15 @@ func (t *Tracker) mergePeer(infoHash string, localSwarm *Swarm, peerID string, r
 		localPeer.LastSeen = remotePeer.LastSeen
 		localPeer.Completed = remotePeer.Completed
 		localPeer.HostName = remotePeer.HostName
+		localPeer.Addr6 = remotePeer.Addr6
 		localPeer.Deleted = remotePeer.Deleted
+		t.changes.record(t.hlc.Clone(), infoHash, peerID)
 
-		peerLabel := remotePeer.HostName
-		if peerLabel == "" {
-			peerLabel = peerID[:8] + "..."
-		}
-		if remotePeer.Deleted {
-			log.Printf("[SYNC] Updated peer %s in swarm %s to tombstone", peerLabel, infoHash[:8])
-		} else {
-			log.Printf("[SYNC] Updated peer %s in swarm %s", peerLabel, infoHash[:8])
-		}
-		return
+		syncLog.Debug("updated peer", logging.InfoHashHex(infoHash), "peer_id", peerID, "host", remotePeer.HostName, "deleted", remotePeer.Deleted)
+		return true
 	}
 
 	// Caso 3: El peer local es más reciente o igual -> ignorar el remoto
-	peerLabel := remotePeer.HostName
-	if peerLabel == "" {
-		peerLabel = peerID[:8] + "..."
-	}
-	log.Printf("[SYNC] Ignored older update for peer %s in swarm %s", peerLabel, infoHash[:8])
+	syncLog.Debug("ignored older update", logging.InfoHashHex(infoHash), "peer_id", peerID, "host", remotePeer.HostName)
+	return false
 }
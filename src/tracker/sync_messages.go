@@ -4,38 +4,31 @@ package tracker
 // Definición de mensajes para sincronización entre trackers distribuidos.
 
 // SyncMessage es el mensaje que se envía periódicamente entre trackers
-// para sincronizar el estado de los swarms.
+// para sincronizar el estado de los swarms. Puede ser un snapshot completo
+// (Since == nil) o un delta con los peers que cambiaron después de Since.
 type SyncMessage struct {
-	FromNodeID string                      `json:"from_node_id"` // ID del tracker emisor
-	Timestamp  HLC                         `json:"timestamp"`    // HLC del mensaje
-	Swarms     map[string]map[string]*Peer `json:"swarms"`       // infoHash -> peerID -> Peer
-	Signature  string                      `json:"signature"`    // Firma HMAC-SHA256 del mensaje
+	FromNodeID string                      `json:"from_node_id"`    // ID del tracker emisor
+	Timestamp  HLC                         `json:"timestamp"`       // HLC del mensaje
+	Since      *HLC                        `json:"since,omitempty"` // delta: cambios posteriores a este HLC
+	Swarms     map[string]map[string]*Peer `json:"swarms"`          // infoHash -> peerID -> Peer
+	Nonce      string                      `json:"nonce,omitempty"` // contra repeticiones (ver replayGuard)
+	Signature  string                      `json:"signature"`       // Firma Ed25519 (o HMAC legacy) del mensaje
 }
 
 // NewSyncMessage crea un nuevo mensaje de sincronización con el estado actual del tracker.
 func (t *Tracker) NewSyncMessage() *SyncMessage {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
 	// Actualizar HLC para el evento de creación de mensaje
 	t.hlc.Update(nil)
 
-	// Copiar todos los swarms y peers
+	// Copiar todos los swarms y peers (incluyendo tombstones)
 	swarms := make(map[string]map[string]*Peer)
 	for infoHash, swarm := range t.Torrents {
 		peers := make(map[string]*Peer)
 		for peerID, peer := range swarm.Peers {
-			// Copiar peer (incluyendo tombstones)
-			peerCopy := &Peer{
-				PeerIDHex: peer.PeerIDHex,
-				IP:        peer.IP,
-				Port:      peer.Port,
-				LastSeen:  peer.LastSeen,
-				Completed: peer.Completed,
-				HostName:  peer.HostName,
-				Deleted:   peer.Deleted,
-			}
-			peers[peerID] = peerCopy
+			peers[peerID] = copyPeer(peer)
 		}
 		swarms[infoHash] = peers
 	}
@@ -46,3 +39,62 @@ func (t *Tracker) NewSyncMessage() *SyncMessage {
 		Swarms:     swarms,
 	}
 }
+
+// NewDeltaSyncMessage crea un mensaje con el estado actual de los peers que
+// cambiaron después de since. Devuelve false si el registro de cambios ya no
+// llega hasta since y hay que enviar un snapshot completo.
+func (t *Tracker) NewDeltaSyncMessage(since HLC) (*SyncMessage, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys, ok := t.changes.since(since)
+	if !ok {
+		return nil, false
+	}
+	t.hlc.Update(nil)
+
+	swarms := make(map[string]map[string]*Peer)
+	for _, k := range keys {
+		sw := t.Torrents[k.infoHash]
+		if sw == nil {
+			continue
+		}
+		peer := sw.Peers[k.peerID]
+		if peer == nil {
+			continue // tombstone ya eliminado por GC
+		}
+		if swarms[k.infoHash] == nil {
+			swarms[k.infoHash] = make(map[string]*Peer)
+		}
+		swarms[k.infoHash][k.peerID] = copyPeer(peer)
+	}
+
+	return &SyncMessage{
+		FromNodeID: t.nodeID,
+		Timestamp:  t.hlc.Clone(),
+		Since:      &since,
+		Swarms:     swarms,
+	}, true
+}
+
+// copyPeer copia un peer para enviarlo sin exponer el estado interno
+func copyPeer(peer *Peer) *Peer {
+	return &Peer{
+		PeerIDHex: peer.PeerIDHex,
+		IP:        peer.IP,
+		Port:      peer.Port,
+		LastSeen:  peer.LastSeen,
+		Completed: peer.Completed,
+		HostName:  peer.HostName,
+		Addr6:     peer.Addr6,
+		Deleted:   peer.Deleted,
+	}
+}
+
+// tick avanza el HLC por un evento local (envío de un mensaje) y lo devuelve
+func (t *Tracker) tick() HLC {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hlc.Update(nil)
+	return t.hlc.Clone()
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,7 +20,8 @@ type Peer struct {
 	LastSeen  HLC    `json:"last_seen"` // HLC para sincronización distribuida
 	Completed bool   `json:"completed"`
 	HostName  string `json:"host_name"`
-	Deleted   bool   `json:"deleted"` // Tombstone: true si el peer fue eliminado
+	Addr6     string `json:"addr6,omitempty"` // [ipv6]:puerto anunciado con ipv6= (BEP 7)
+	Deleted   bool   `json:"deleted"`         // Tombstone: true si el peer fue eliminado
 }
 
 // Swarm: conjunto de peers de un mismo torrent (info_hash)
@@ -42,6 +44,15 @@ type Tracker struct {
 	remotePeers  []string      `json:"-"` // Direcciones de otros trackers
 	syncListener *SyncListener `json:"-"` // Servidor de sincronización
 	syncManager  *SyncManager  `json:"-"` // Cliente de sincronización
+	changes      *changeLog    `json:"-"` // Cambios por HLC para los deltas de sincronización
+
+	antiEntropyStop chan struct{}           `json:"-"` // Detiene las rondas de anti-entropía
+	cluster         atomic.Pointer[Cluster] `json:"-"` // Membresía dinámica (nil: lista fija de remotePeers)
+	keys            *keyring                `json:"-"` // Clave de firma y claves de confianza de la sincronización
+	replay          *replayGuard            `json:"-"` // Último HLC y nonces aceptados por nodo
+	shard           *sharding               `json:"-"` // Modo sharded (nil: todos los trackers guardan todos los swarms)
+
+	udpListener *UDPListener `json:"-"` // Listener del protocolo UDP (BEP 15)
 }
 
 // New crea una instancia de Tracker con configuración y estado iniciales.
@@ -61,6 +72,9 @@ func New(interval, timeout time.Duration, maxPeers int, dataPath, nodeID string,
 		hlc:          *NewHLC(nodeID),
 		nodeID:       nodeID,
 		remotePeers:  remotePeers,
+		changes:      newChangeLog(changeLogMax),
+		keys:         newKeyring(),
+		replay:       newReplayGuard(),
 	}
 }
 
@@ -79,7 +93,8 @@ func (t *Tracker) getOrCreateSwarm(infoHashHex string) *Swarm {
 // AddPeer da de alta o actualiza (upsert) un peer dentro del swarm de infoHashHex.
 // Actualiza IP, puerto y LastSeen con HLC. Si el peer estaba marcado como eliminado
 // (tombstone), lo resucita si esta actualización es más reciente.
-func (t *Tracker) AddPeer(infoHashHex, peerIDHex string, hostname string, port uint16, completed bool) {
+// addr6 es la dirección IPv6 adicional del peer ("" si no anunció ipv6=).
+func (t *Tracker) AddPeer(infoHashHex, peerIDHex string, hostname string, port uint16, addr6 string, completed bool) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -101,8 +116,10 @@ func (t *Tracker) AddPeer(infoHashHex, peerIDHex string, hostname string, port u
 	p.HostName = hostname
 	p.IP = hostname // Usar hostname como IP para compatibilidad
 	p.Port = port
+	p.Addr6 = addr6
 	p.LastSeen = t.hlc.Clone()
 	p.Completed = completed || p.Completed
+	t.changes.record(p.LastSeen, infoHashHex, peerIDHex)
 }
 
 // Remove peer
@@ -128,6 +145,7 @@ func (t *Tracker) RemovePeer(infoHashHex, peerIDHex string) {
 	// Marcar como eliminado (tombstone) en lugar de borrar
 	p.Deleted = true
 	p.LastSeen = t.hlc.Clone()
+	t.changes.record(p.LastSeen, infoHashHex, peerIDHex)
 }
 
 // Get peers (excluding one) up to max
@@ -146,7 +164,7 @@ func (t *Tracker) GetPeers(infoHashHex, excludePeerIDHex string, max int) []*Pee
 		if id == excludePeerIDHex || p.Deleted {
 			continue
 		}
-		res = append(res, &Peer{PeerIDHex: p.PeerIDHex, IP: p.IP, HostName: p.HostName, Port: p.Port, LastSeen: p.LastSeen})
+		res = append(res, &Peer{PeerIDHex: p.PeerIDHex, IP: p.IP, HostName: p.HostName, Port: p.Port, Addr6: p.Addr6, LastSeen: p.LastSeen})
 		if len(res) >= max {
 			break
 		}
@@ -168,7 +186,7 @@ func (t *Tracker) GC() (expired int) {
 
 	// Calcular umbrales de tiempo
 	thresholdInactive := t.hlc.SubtractDuration(t.PeerTimeout)
-	thresholdTombstone := t.hlc.SubtractDuration(2 * t.PeerTimeout)
+	thresholdTombstone := t.tombstoneHorizon()
 
 	for ih, sw := range t.Torrents {
 		for id, p := range sw.Peers {
@@ -183,6 +201,7 @@ func (t *Tracker) GC() (expired int) {
 				if thresholdInactive.After(p.LastSeen) {
 					p.Deleted = true
 					p.LastSeen = t.hlc.Clone()
+					t.changes.record(p.LastSeen, ih, id)
 					expired++
 				}
 			}
@@ -194,6 +213,15 @@ func (t *Tracker) GC() (expired int) {
 	return
 }
 
+// tombstoneHorizon es el umbral del GC de tombstones: los de LastSeen anterior
+// se borran físicamente. Usa el mayor entre el HLC y el reloj del sistema para
+// que trackers con el mismo estado coincidan aunque su HLC no haya avanzado
+// desde el último evento. Requiere t.mu.
+func (t *Tracker) tombstoneHorizon() HLC {
+	now := max(t.hlc.PhysicalTime, time.Now().UnixMilli())
+	return HLC{PhysicalTime: now - (2 * t.PeerTimeout).Milliseconds()}
+}
+
 // CountPeers retorna el número de seeders (complete) y leechers (incomplete)
 // en el swarm identificado por infoHashHex, excluyendo peers eliminados.
 func (t *Tracker) CountPeers(infoHashHex string) (complete, incomplete int) {
@@ -237,6 +265,41 @@ func (t *Tracker) StartSyncListener(listenAddr string) error {
 	return nil
 }
 
+// SyncAddr devuelve la dirección donde escucha el listener de sincronización
+// ("" si no se inició); útil con StartSyncListener("127.0.0.1:0").
+func (t *Tracker) SyncAddr() string {
+	if t.syncListener == nil {
+		return ""
+	}
+	return t.syncListener.listener.Addr().String()
+}
+
+// StartUDPListener inicia el listener del protocolo de tracker UDP (BEP 15).
+func (t *Tracker) StartUDPListener(listenAddr string) error {
+	listener, err := NewUDPListener(t, listenAddr)
+	if err != nil {
+		return err
+	}
+	t.udpListener = listener
+	t.udpListener.Start()
+	return nil
+}
+
+// UDPAddr devuelve la dirección del listener UDP ("" si no está activo)
+func (t *Tracker) UDPAddr() string {
+	if t.udpListener == nil {
+		return ""
+	}
+	return t.udpListener.conn.LocalAddr().String()
+}
+
+// StopUDPListener cierra el listener UDP si está activo.
+func (t *Tracker) StopUDPListener() {
+	if t.udpListener != nil {
+		t.udpListener.Stop()
+	}
+}
+
 // StartSyncManager inicia el cliente de sincronización periódica.
 func (t *Tracker) StartSyncManager(syncInterval time.Duration) {
 	t.syncManager = NewSyncManager(t, t.remotePeers, syncInterval)
@@ -245,12 +308,19 @@ func (t *Tracker) StartSyncManager(syncInterval time.Duration) {
 
 // StopSync detiene los procesos de sincronización.
 func (t *Tracker) StopSync() {
+	if c := t.cluster.Load(); c != nil {
+		c.stop()
+	}
 	if t.syncListener != nil {
 		t.syncListener.Stop()
 	}
 	if t.syncManager != nil {
 		t.syncManager.Stop()
 	}
+	if t.antiEntropyStop != nil {
+		close(t.antiEntropyStop)
+		t.antiEntropyStop = nil
+	}
 }
 
 // Paths
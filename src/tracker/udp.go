@@ -0,0 +1,355 @@
+package tracker
+
+// tracker/udp.go
+// Listener del protocolo de tracker UDP (BEP 15). Comparte el estado del
+// Tracker con los handlers HTTP: mismos swarms, persistencia y sincronización.
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"src/logging"
+	"strconv"
+	"time"
+)
+
+// Acciones del protocolo UDP (BEP 15)
+const (
+	udpActionConnect  = 0
+	udpActionAnnounce = 1
+	udpActionScrape   = 2
+	udpActionError    = 3
+
+	// udpProtocolID es la constante mágica del paquete connect
+	udpProtocolID = 0x41727101980
+
+	// udpConnIDWindow: un connection ID es válido durante la ventana en la que
+	// se emitió y la siguiente (entre 1 y 2 minutos, como pide BEP 15)
+	udpConnIDWindow = time.Minute
+
+	udpMaxPacket      = 2048
+	udpMaxScrapeFiles = 74 // máximo de info_hash por scrape que caben en un paquete
+)
+
+// UDPListener atiende announces y scrapes por UDP.
+type UDPListener struct {
+	tracker *Tracker
+	conn    net.PacketConn
+	secret  []byte // clave para derivar connection IDs sin guardar estado
+	stopCh  chan struct{}
+}
+
+// NewUDPListener abre el socket UDP del tracker en listenAddr.
+func NewUDPListener(tracker *Tracker, listenAddr string) (*UDPListener, error) {
+	conn, err := net.ListenPacket("udp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on udp %s: %w", listenAddr, err)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to generate connection id secret: %w", err)
+	}
+	return &UDPListener{
+		tracker: tracker,
+		conn:    conn,
+		secret:  secret,
+		stopCh:  make(chan struct{}),
+	}, nil
+}
+
+// Start lanza el bucle de lectura de paquetes.
+func (ul *UDPListener) Start() {
+	udpLog.Info("UDP tracker listening", "addr", ul.conn.LocalAddr().String())
+
+	go func() {
+		<-ul.stopCh
+		udpLog.Info("shutting down UDP listener")
+		ul.conn.Close()
+	}()
+
+	go func() {
+		buf := make([]byte, udpMaxPacket)
+		for {
+			n, addr, err := ul.conn.ReadFrom(buf)
+			if err != nil {
+				select {
+				case <-ul.stopCh:
+					return
+				default:
+				}
+				udpLog.Warn("read error", logging.Err(err))
+				continue
+			}
+			if ul.tracker.shard != nil {
+				// en modo sharded un announce puede esperar la respuesta HTTP
+				// de un dueño: no frenar la lectura de los demás paquetes
+				go ul.respond(append([]byte(nil), buf[:n]...), addr)
+				continue
+			}
+			ul.respond(buf[:n], addr)
+		}
+	}()
+}
+
+// respond atiende un paquete y envía la respuesta, si la hay.
+func (ul *UDPListener) respond(pkt []byte, addr net.Addr) {
+	if resp := ul.handlePacket(pkt, addr); resp != nil {
+		if _, err := ul.conn.WriteTo(resp, addr); err != nil {
+			udpLog.Warn("write failed", "remote", addr.String(), logging.Err(err))
+		}
+	}
+}
+
+// Stop cierra el listener UDP.
+func (ul *UDPListener) Stop() {
+	close(ul.stopCh)
+}
+
+// handlePacket procesa una petición y devuelve la respuesta a enviar (nil si
+// el paquete se descarta sin responder).
+func (ul *UDPListener) handlePacket(pkt []byte, addr net.Addr) []byte {
+	if len(pkt) < 16 {
+		return nil
+	}
+	connID := binary.BigEndian.Uint64(pkt[0:8])
+	action := binary.BigEndian.Uint32(pkt[8:12])
+	txID := binary.BigEndian.Uint32(pkt[12:16])
+	ip := udpAddrIP(addr)
+
+	if action == udpActionConnect {
+		if connID != udpProtocolID {
+			return nil
+		}
+		resp := make([]byte, 16)
+		binary.BigEndian.PutUint32(resp[0:4], udpActionConnect)
+		binary.BigEndian.PutUint32(resp[4:8], txID)
+		binary.BigEndian.PutUint64(resp[8:16], ul.connectionID(ip, time.Now()))
+		return resp
+	}
+
+	if !ul.validConnectionID(connID, ip) {
+		return udpError(txID, "invalid connection id")
+	}
+
+	switch action {
+	case udpActionAnnounce:
+		return ul.handleAnnounce(pkt, txID, ip)
+	case udpActionScrape:
+		return ul.handleScrape(pkt, txID)
+	default:
+		return udpError(txID, "unknown action")
+	}
+}
+
+// handleAnnounce procesa un announce (98 bytes):
+// connection_id, action, transaction_id, info_hash, peer_id, downloaded, left,
+// uploaded, event, ip, key, num_want, port.
+func (ul *UDPListener) handleAnnounce(pkt []byte, txID uint32, srcIP net.IP) []byte {
+	t := ul.tracker
+	if len(pkt) < 98 {
+		return udpError(txID, "announce packet too short")
+	}
+	infoHex, _ := Bytes20ToHex(pkt[16:36])
+	peerHex, _ := Bytes20ToHex(pkt[36:56])
+	downloaded := int64(binary.BigEndian.Uint64(pkt[56:64]))
+	left := int64(binary.BigEndian.Uint64(pkt[64:72]))
+	uploaded := int64(binary.BigEndian.Uint64(pkt[72:80]))
+	eventID := binary.BigEndian.Uint32(pkt[80:84])
+	numwant := int32(binary.BigEndian.Uint32(pkt[92:96]))
+	port := binary.BigEndian.Uint16(pkt[96:98])
+
+	if port == 0 {
+		return udpError(txID, "invalid port")
+	}
+	if uploaded < 0 || downloaded < 0 || left < 0 {
+		return udpError(txID, "invalid counters")
+	}
+
+	// Sobre IPv6 (BEP 15) el campo ip de 4 bytes no aplica y la respuesta
+	// lleva peers de 18 bytes; sobre IPv4 el campo ip sólo se respeta si
+	// viene informado, si no se usa el origen
+	if srcIP == nil {
+		return udpError(txID, "unknown source address")
+	}
+	ipv6 := srcIP.To4() == nil
+	host := srcIP
+	if reqIP := net.IP(pkt[84:88]); !ipv6 && !reqIP.Equal(net.IPv4zero) {
+		host = reqIP
+	}
+	hostname := host.String()
+
+	var event string
+	switch eventID {
+	case 1:
+		event = "completed"
+	case 2:
+		event = "started"
+	case 3:
+		event = "stopped"
+	}
+
+	want := t.MaxPeersResp
+	if numwant >= 0 && int(numwant) < want {
+		want = int(numwant)
+	}
+
+	// Modo sharded: si no somos dueños del swarm el announce lo atiende un
+	// dueño, como announce HTTP con la dirección del cliente en ip=
+	query := url.Values{
+		"info_hash":  {string(pkt[16:36])},
+		"peer_id":    {string(pkt[36:56])},
+		"port":       {strconv.Itoa(int(port))},
+		"uploaded":   {strconv.FormatInt(uploaded, 10)},
+		"downloaded": {strconv.FormatInt(downloaded, 10)},
+		"left":       {strconv.FormatInt(left, 10)},
+		"numwant":    {strconv.Itoa(want)},
+		"compact":    {"1"},
+		"ip":         {hostname},
+	}
+	if event != "" {
+		query.Set("event", event)
+	}
+	if reply, ok := t.forwardUDP(infoHex, "/announce", query); ok {
+		return udpProxiedAnnounce(txID, reply, ipv6)
+	}
+
+	t.applyAnnounce(infoHex, peerHex, hostname, port, "", left, event)
+
+	// La respuesta UDP sólo admite peers compactos: los peers registrados por
+	// hostname (HTTP non-compact) no se pueden incluir
+	peers := compactPeers(t.GetPeers(infoHex, peerHex, want))
+	if ipv6 {
+		peers = compactPeers6(t.GetPeers(infoHex, peerHex, want))
+	}
+	comp, incomp := t.CountPeers(infoHex)
+	return udpAnnounceResponse(txID, uint32(t.Interval.Seconds()), uint32(incomp), uint32(comp), peers)
+}
+
+// udpAnnounceResponse arma la respuesta de announce: interval, leechers,
+// seeders y los peers compactos.
+func udpAnnounceResponse(txID, interval, leechers, seeders uint32, peers string) []byte {
+	resp := make([]byte, 20, 20+len(peers))
+	binary.BigEndian.PutUint32(resp[0:4], udpActionAnnounce)
+	binary.BigEndian.PutUint32(resp[4:8], txID)
+	binary.BigEndian.PutUint32(resp[8:12], interval)
+	binary.BigEndian.PutUint32(resp[12:16], leechers)
+	binary.BigEndian.PutUint32(resp[16:20], seeders)
+	return append(resp, peers...)
+}
+
+// udpProxiedAnnounce traduce la respuesta bencode del dueño del swarm a un
+// paquete de announce (o de error, si el dueño lo rechazó).
+func udpProxiedAnnounce(txID uint32, reply map[string]interface{}, ipv6 bool) []byte {
+	if reason, ok := reply["failure reason"].(string); ok {
+		return udpError(txID, reason)
+	}
+	interval, _ := reply["interval"].(int64)
+	complete, _ := reply["complete"].(int64)
+	incomplete, _ := reply["incomplete"].(int64)
+	var peers string
+	if ipv6 {
+		peers, _ = reply["peers6"].(string)
+	} else {
+		switch p := reply["peers"].(type) {
+		case string:
+			peers = p
+		case []interface{}:
+			// non-compact (hay peers con hostname): sólo entran los de IPv4
+			var buf []byte
+			for _, item := range p {
+				d, _ := item.(map[string]interface{})
+				ip, _ := d["ip"].(string)
+				port, _ := d["port"].(int64)
+				if ip4 := net.ParseIP(ip).To4(); ip4 != nil && port > 0 && port <= 65535 {
+					buf = append(buf, ip4...)
+					buf = binary.BigEndian.AppendUint16(buf, uint16(port))
+				}
+			}
+			peers = string(buf)
+		}
+	}
+	return udpAnnounceResponse(txID, uint32(interval), uint32(incomplete), uint32(complete), peers)
+}
+
+// handleScrape responde seeders/completed/leechers de cada info_hash pedido.
+func (ul *UDPListener) handleScrape(pkt []byte, txID uint32) []byte {
+	hashes := pkt[16:]
+	if len(hashes) == 0 || len(hashes)%20 != 0 {
+		return udpError(txID, "invalid scrape request")
+	}
+	n := min(len(hashes)/20, udpMaxScrapeFiles)
+
+	resp := make([]byte, 8, 8+n*12)
+	binary.BigEndian.PutUint32(resp[0:4], udpActionScrape)
+	binary.BigEndian.PutUint32(resp[4:8], txID)
+	for i := 0; i < n; i++ {
+		ihRaw := hashes[i*20 : (i+1)*20]
+		ihHex, _ := Bytes20ToHex(ihRaw)
+		comp, incomp := ul.scrapeCounts(ihHex, ihRaw)
+		var entry [12]byte
+		binary.BigEndian.PutUint32(entry[0:4], uint32(comp))
+		// downloaded=0 en esta versión, igual que en /scrape
+		binary.BigEndian.PutUint32(entry[8:12], uint32(incomp))
+		resp = append(resp, entry[:]...)
+	}
+	return resp
+}
+
+// scrapeCounts devuelve seeders y leechers del swarm: en modo sharded, si no
+// somos dueños, los del scrape HTTP a un dueño.
+func (ul *UDPListener) scrapeCounts(ihHex string, ihRaw []byte) (complete, incomplete int64) {
+	if reply, ok := ul.tracker.forwardUDP(ihHex, "/scrape", url.Values{"info_hash": {string(ihRaw)}}); ok {
+		files, _ := reply["files"].(map[string]interface{})
+		stats, _ := files[string(ihRaw)].(map[string]interface{})
+		complete, _ = stats["complete"].(int64)
+		incomplete, _ = stats["incomplete"].(int64)
+		return complete, incomplete
+	}
+	comp, incomp := ul.tracker.CountPeers(ihHex)
+	return int64(comp), int64(incomp)
+}
+
+// connectionID deriva el ID para ip en la ventana de tiempo de now:
+// HMAC(secret, ip || ventana) truncado a 64 bits.
+func (ul *UDPListener) connectionID(ip net.IP, now time.Time) uint64 {
+	var window [8]byte
+	binary.BigEndian.PutUint64(window[:], uint64(now.Unix()/int64(udpConnIDWindow.Seconds())))
+	mac := hmac.New(sha256.New, ul.secret)
+	mac.Write(ip.To16())
+	mac.Write(window[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil)[:8])
+}
+
+// validConnectionID acepta IDs emitidos para ip en la ventana actual o la anterior.
+func (ul *UDPListener) validConnectionID(id uint64, ip net.IP) bool {
+	now := time.Now()
+	return id == ul.connectionID(ip, now) || id == ul.connectionID(ip, now.Add(-udpConnIDWindow))
+}
+
+// udpError construye un paquete de error (action 3) con el mensaje. Se
+// registra en Debug: cualquiera puede mandar paquetes inválidos y no deben
+// llenar el log.
+func udpError(txID uint32, msg string) []byte {
+	udpLog.Debug("request rejected", "reason", msg)
+	resp := make([]byte, 8, 8+len(msg))
+	binary.BigEndian.PutUint32(resp[0:4], udpActionError)
+	binary.BigEndian.PutUint32(resp[4:8], txID)
+	return append(resp, msg...)
+}
+
+// udpAddrIP extrae la IP de origen de una dirección UDP.
+func udpAddrIP(addr net.Addr) net.IP {
+	if ua, ok := addr.(*net.UDPAddr); ok {
+		return ua.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}